@@ -11,10 +11,14 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"extraction/internal/analysis"
+	"extraction/internal/archive"
 	"extraction/internal/batch"
+	"extraction/internal/cache"
+	"extraction/internal/doctor"
 	"extraction/internal/export"
 	"extraction/internal/files"
 	"extraction/internal/grouping"
@@ -105,6 +109,13 @@ func readLinesFile(path string) ([]string, error) {
 }
 
 func main() {
+	// "extract doctor" reports the external tools found and exits
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		fmt.Println("External tools:")
+		doctor.Report(os.Stdout, doctor.Check())
+		return
+	}
+
 	var inputs stringSliceFlag
 	var fileSources fileSourcePairFlag
 	var linksFile string
@@ -121,6 +132,27 @@ func main() {
 	var enableValidation bool
 	var groupByDocumentType bool
 	var groupByClient bool
+	var llmProvider string
+	var ocrEngine string
+	var preprocess string
+	var replayDir string
+	var recordDir string
+	var mergePolicy string
+	var cacheDir string
+	var noCache bool
+	var refreshCache bool
+	var journalPath string
+	var resumePath string
+	var excelDirect bool
+	var archiveDepth int
+	var archiveMaxSizeMB int
+	var archiveMaxFiles int
+	var classifyThreshold float64
+	var confirmSources bool
+	var noSplit bool
+	var pageRows bool
+	var pageConcurrency int
+	var visionBudget int
 
 	flag.Var(&inputs, "input", "Input URL or local path (repeatable)")
 	flag.Var(&fileSources, "file-source", "File with specific document source: 'file_path:source_type' (repeatable)")
@@ -138,6 +170,27 @@ func main() {
 	flag.BoolVar(&enableValidation, "validate", false, "Enable validation and quality checks")
 	flag.BoolVar(&groupByDocumentType, "group-by-type", false, "Group files by document type")
 	flag.BoolVar(&groupByClient, "group-by-client", false, "Group files by client name")
+	flag.StringVar(&ocrEngine, "ocr-engine", "", "OCR engine: vision, tesseract, ensemble (both, keeping the best text per page), or a fallback chain such as vision,tesseract (default: $OCR_ENGINE or vision)")
+	flag.StringVar(&preprocess, "preprocess", "", "Image clean-up before OCR: steps (orient, rotate, deskew, contrast, downscale, all, none), optionally per document type, e.g. 'all;site_visit_photos=orient,contrast' (default: all, and orient,contrast,downscale for site_visit_photos). Applies to image files only; PDF and TIFF pages are OCR'd as they are")
+	flag.StringVar(&llmProvider, "llm-provider", "", "LLM backend for analysis: gemini, openai, ollama, llamacpp (default: $LLM_PROVIDER or gemini)")
+	flag.StringVar(&replayDir, "replay-dir", "", "Replay recorded LLM responses from this directory instead of calling the LLM (offline runs)")
+	flag.StringVar(&recordDir, "record-dir", "", "Record every LLM response into this directory for later --replay-dir runs")
+	flag.StringVar(&mergePolicy, "merge-policy", "first", "How to resolve fields filled by several documents: first, latest-dated, highest-confidence, require-agreement")
+	flag.StringVar(&cacheDir, "cache-dir", "", "Directory for cached OCR text and LLM output (default: user cache dir, e.g. ~/.cache/extraction)")
+	flag.BoolVar(&noCache, "no-cache", false, "Don't read or write the OCR/LLM cache")
+	flag.BoolVar(&refreshCache, "refresh", false, "Ignore cached results but store fresh ones")
+	flag.StringVar(&journalPath, "journal", "", "Checkpoint journal of completed inputs (default: <out>_journal.jsonl)")
+	flag.StringVar(&resumePath, "resume", "", "Resume an interrupted run from this journal, skipping inputs it already completed")
+	flag.BoolVar(&excelDirect, "excel-direct", false, "Read financial statement workbooks (.xlsx/.xls) directly from their cells instead of via the LLM")
+	flag.IntVar(&archiveDepth, "archive-depth", archive.DefaultLimits.MaxDepth, "Maximum nesting depth of archives inside archive inputs")
+	flag.IntVar(&archiveMaxSizeMB, "archive-max-size", int(archive.DefaultLimits.MaxTotalSize>>20), "Maximum total uncompressed size of an archive input, in MB")
+	flag.Float64Var(&classifyThreshold, "classify-threshold", analysis.DefaultClassifyThreshold, "Confidence (0-1) a guessed document type needs to be used for files without a source")
+	flag.BoolVar(&confirmSources, "confirm-sources", false, "Ask on the terminal for the document type of files classified below --classify-threshold")
+	flag.BoolVar(&noSplit, "no-split", false, "Don't split PDFs without a source into the documents scanned into them")
+	flag.BoolVar(&pageRows, "page-rows", false, "Add a Pages sheet to the _raw.xlsx export with one row per PDF page (text, OCR confidence, errors)")
+	flag.IntVar(&pageConcurrency, "page-concurrency", ocr.DefaultPageConcurrency, "Maximum number of pages of one PDF OCR'd in parallel")
+	flag.IntVar(&visionBudget, "vision-budget", ocr.DefaultVisionBudget, "Maximum number of Google Vision requests in flight across all files and pages")
+	flag.IntVar(&archiveMaxFiles, "archive-max-files", archive.DefaultLimits.MaxFiles, "Maximum number of files extracted from an archive input")
 	flag.Parse()
 
 	if linksFile != "" {
@@ -165,11 +218,16 @@ func main() {
 	}
 
 	if len(allInputs) == 0 {
-		fmt.Println("Usage: extract --input <url|path> [--input <url|path> ...] [--file-source 'file_path:source_type'] [--links-file file] --out output.xlsx [--json data.json] [--lang eng] [--source document_type] [--dpi 300] [--skip-analysis] [--concurrency 3] [--progress] [--group] [--validate] [--group-by-type] [--group-by-client]")
+		fmt.Println("Usage: extract --input <url|path> [--input <url|path> ...] [--file-source 'file_path:source_type'] [--links-file file] --out output.xlsx [--json data.json] [--lang eng] [--source document_type] [--dpi 300] [--skip-analysis] [--concurrency 3] [--progress] [--group] [--validate] [--group-by-type] [--group-by-client] [--ocr-engine vision|tesseract|ensemble|vision,tesseract] [--preprocess 'all;site_visit_photos=orient,contrast'] [--llm-provider gemini|openai|ollama|llamacpp] [--replay-dir dir | --record-dir dir] [--merge-policy first|latest-dated|highest-confidence|require-agreement] [--cache-dir dir] [--no-cache] [--refresh] [--journal file] [--resume journal] [--excel-direct] [--archive-depth 3] [--archive-max-size 1024] [--archive-max-files 1000] [--classify-threshold 0.6] [--confirm-sources] [--no-split] [--page-rows] [--page-concurrency 4] [--vision-budget 8]")
+		fmt.Println("       extract doctor")
 		fmt.Println("\nDocument source types: business_license, evn_bill, rental_agreement, land_certificate, id_check, financial_statement, site_visit_photos, cic_report")
 		os.Exit(2)
 	}
 
+	if missing := doctor.Missing(doctor.Check()); len(missing) > 0 {
+		fmt.Printf("Optional tools not found: %s (run 'extract doctor' for details)\n", strings.Join(missing, ", "))
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutSec)*time.Second)
 	defer cancel()
 
@@ -181,8 +239,98 @@ func main() {
 
 	// Create batch processor
 	processor := batch.NewProcessor(maxConcurrency, skipAnalysis, lang, dpi, source)
+	processor.Provider = llmProvider
+	engine, err := ocr.NewEngine(ocrEngine)
+	if err != nil {
+		log.Fatalf("invalid --ocr-engine: %v", err)
+	}
+	processor.OCREngine = engine
+	processor.Preprocess, err = batch.ParsePreprocess(preprocess)
+	if err != nil {
+		log.Fatalf("invalid --preprocess: %v", err)
+	}
+	policy, err := analysis.ParseMergePolicy(mergePolicy)
+	if err != nil {
+		log.Fatalf("invalid --merge-policy: %v", err)
+	}
+	processor.MergePolicy = policy
+	processor.ExcelDirect = excelDirect
+	processor.ClassifyThreshold = classifyThreshold
+	processor.NoSplit = noSplit
+	processor.PageConcurrency = pageConcurrency
+	ocr.SetVisionBudget(visionBudget)
+	if confirmSources {
+		processor.ConfirmSource = confirmSourceOnTerminal()
+	}
+	processor.ArchiveLimits = archive.Limits{
+		MaxDepth:     archiveDepth,
+		MaxTotalSize: int64(archiveMaxSizeMB) << 20,
+		MaxFiles:     archiveMaxFiles,
+	}
+
+	// Set up the OCR/LLM result cache
+	var resultCache *cache.Cache
+	if !noCache {
+		if cacheDir == "" {
+			cacheDir = cache.DefaultDir()
+		}
+		resultCache, err = cache.New(cacheDir, refreshCache)
+		if err != nil {
+			log.Fatalf("failed to set up cache: %v", err)
+		}
+		processor.Cache = resultCache
+	}
 	defer processor.Close()
 
+	// Set up fixture replay/recording of LLM responses
+	if replayDir != "" && recordDir != "" {
+		log.Fatalf("--replay-dir and --record-dir cannot be used together")
+	}
+	if replayDir != "" && !skipAnalysis {
+		replay, err := analysis.NewReplayAnalyzer(replayDir)
+		if err != nil {
+			log.Fatalf("failed to set up replay: %v", err)
+		}
+		processor.Analyzer = replay
+	}
+	if recordDir != "" && !skipAnalysis {
+		analyzer, err := analysis.NewAnalyzer(llmProvider)
+		if err != nil {
+			log.Fatalf("failed to create LLM client: %v", err)
+		}
+		if resultCache != nil {
+			analyzer = analysis.NewCachedAnalyzer(analyzer, resultCache)
+		}
+		recorder, err := analysis.NewRecordingAnalyzer(analyzer, recordDir)
+		if err != nil {
+			log.Fatalf("failed to set up recording: %v", err)
+		}
+		processor.Analyzer = recorder
+	}
+
+	// Set up the checkpoint journal. A resumed run appends to the journal it resumes from.
+	if resumePath != "" {
+		completed, err := batch.LoadJournal(resumePath)
+		if err != nil {
+			log.Fatalf("failed to read journal: %v", err)
+		}
+		fmt.Printf("Resuming from %s: %d inputs already completed\n", resumePath, len(completed))
+		processor.Resumed = completed
+		processor.Journal, err = batch.AppendJournal(resumePath)
+		if err != nil {
+			log.Fatalf("failed to open journal: %v", err)
+		}
+	} else {
+		if journalPath == "" {
+			journalPath = strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + "_journal.jsonl"
+		}
+		processor.Journal, err = batch.CreateJournal(journalPath)
+		if err != nil {
+			log.Fatalf("failed to create journal: %v", err)
+		}
+	}
+	defer processor.Journal.Close()
+
 	// Start progress monitoring if requested
 	if showProgress {
 		go monitorProgress(processor.ProgressChan)
@@ -190,7 +338,6 @@ func main() {
 
 	// Process inputs using batch processor
 	var batchResult *types.BatchResult
-	var err error
 	if len(fileSourceMap) > 0 {
 		// Use specific document sources for files
 		batchResult, err = processor.ProcessFilesWithSources(ctx, allInputs, fileSourceMap)
@@ -218,6 +365,10 @@ func main() {
 	fmt.Printf("Processing rate: %.2f files/second\n", stats.ProcessingRate)
 	fmt.Printf("Error rate: %.1f%%\n", stats.ErrorRate)
 	fmt.Printf("Total data processed: %.2f MB\n", float64(stats.TotalSize)/(1024*1024))
+	if waits, ok := analysis.WaitStatsOf(processor.Analyzer); ok && waits.Requests > 0 {
+		fmt.Printf("LLM requests: %d (%d retries)\n", waits.Requests, waits.Retries)
+		fmt.Printf("LLM wait time: %v rate limited, %v backing off\n", waits.RateLimitWait.Round(time.Second), waits.RetryWait.Round(time.Second))
+	}
 	fmt.Printf("========================\n\n")
 
 	results := batchResult.Results
@@ -289,7 +440,7 @@ func main() {
 
 	// Export raw extraction results and structured customer check
 	rawOutputPath := strings.TrimSuffix(outputPath, ".xlsx") + "_raw.xlsx"
-	if err := export.WriteResults(results, rawOutputPath); err != nil {
+	if err := export.WriteResults(results, rawOutputPath, pageRows); err != nil {
 		log.Fatalf("failed to write raw results: %v", err)
 	}
 	fmt.Printf("Wrote %d extraction results to %s\n", len(results), rawOutputPath)
@@ -320,6 +471,40 @@ func main() {
 	}
 }
 
+// confirmSourceOnTerminal asks the user for the document type of files the
+// classifier wasn't sure about. Files are processed concurrently, so questions
+// are asked one at a time.
+func confirmSourceOnTerminal() func(string, analysis.Classification) analysis.DocumentSource {
+	var mu sync.Mutex
+	reader := bufio.NewReader(os.Stdin)
+	return func(fileName string, guess analysis.Classification) analysis.DocumentSource {
+		mu.Lock()
+		defer mu.Unlock()
+		for {
+			fmt.Printf("\nDocument type of %s? Best guess: %s (confidence %.2f).\n", fileName, guess.Source, guess.Confidence)
+			fmt.Printf("Enter a type (business_license, evn_bill, land_certificate, id_check, financial_statement, site_visit_photos, cic_report), press Enter to accept the guess, or type 'unknown' to skip: ")
+			line, err := reader.ReadString('\n')
+			answer := strings.TrimSpace(line)
+			if answer == "" {
+				if err != nil {
+					// No terminal input available
+					return analysis.SourceUnknown
+				}
+				return guess.Source
+			}
+			switch source := analysis.DocumentSource(strings.ToLower(answer)); source {
+			case analysis.SourceBusinessLicense, analysis.SourceEVNBill, analysis.SourceLandCertificate, analysis.SourceIDCheck,
+				analysis.SourceFinancialStatement, analysis.SourceSiteVisitPhotos, analysis.SourceCICReport, analysis.SourceUnknown:
+				return source
+			}
+			fmt.Printf("Unknown document type %q\n", answer)
+			if err != nil {
+				return analysis.SourceUnknown
+			}
+		}
+	}
+}
+
 // monitorProgress monitors and displays progress updates
 func monitorProgress(progressChan <-chan batch.ProgressUpdate) {
 	for update := range progressChan {
@@ -355,7 +540,7 @@ func saveValidationResults(validationResult validation.ValidationResult, summary
 	return os.WriteFile(outputPath, jsonData, 0644)
 }
 
-func processOne(ctx context.Context, input string, lang string, dpi int, source analysis.DocumentSource, skipAnalysis bool, useGemini bool, check *models.CustomerCheck) types.FileResult {
+func processOne(ctx context.Context, input string, lang string, dpi int, source analysis.DocumentSource, skipAnalysis bool, analyzer analysis.Analyzer, check *models.CustomerCheck) types.FileResult {
 	localPath, sourceURL, filename, mediaType, err := xfer.DownloadToTemp(ctx, input)
 	if err != nil {
 		return types.FileResult{SourceURL: sourceURL, FileName: filename, FileType: mediaType, Error: err.Error()}
@@ -397,21 +582,21 @@ func processOne(ctx context.Context, input string, lang string, dpi int, source
 		var extractedData map[string]interface{}
 		var err error
 		
-		// Use Gemini API
-		client, clientErr := analysis.NewGeminiClient()
-		if clientErr != nil {
-			res.Error = fmt.Sprintf("Gemini client initialization error: %v", clientErr)
+		if analyzer == nil {
+			res.Error = "no LLM analyzer configured"
 			return res
 		}
 		
-		extractedData, err = client.AnalyzeDocument(ctx, text, source)
+		extractedData, err = analyzer.AnalyzeDocument(ctx, text, source)
 		if err != nil {
-			res.Error = fmt.Sprintf("Gemini analysis error: %v", err)
+			res.Error = fmt.Sprintf("%s analysis error: %v", analyzer.Name(), err)
 			return res
 		}
 
 		// Update customer check with extracted data
-		analysis.UpdateCustomerCheck(check, extractedData, source)
+		for _, fieldErr := range analysis.UpdateCustomerCheck(check, extractedData, source, models.FieldProvenance{SourceURL: sourceURL, FileName: filename}) {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("could not use extracted value %s", fieldErr.Error()))
+		}
 	}
 
 	return res
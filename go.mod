@@ -2,7 +2,11 @@ module extraction
 
 go 1.22
 
-require github.com/xuri/excelize/v2 v2.8.1
+require (
+	github.com/xuri/excelize/v2 v2.8.1
+	golang.org/x/image v0.18.0
+	golang.org/x/text v0.16.0
+)
 
 require (
 	github.com/mohae/deepcopy v0.0.0-20170929034955-c48cc78d4826 // indirect
@@ -12,5 +16,4 @@ require (
 	github.com/xuri/nfp v0.0.0-20230919160717-d98342af3f05 // indirect
 	golang.org/x/crypto v0.19.0 // indirect
 	golang.org/x/net v0.21.0 // indirect
-	golang.org/x/text v0.14.0 // indirect
-)
\ No newline at end of file
+)
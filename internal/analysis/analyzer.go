@@ -0,0 +1,120 @@
+package analysis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Analyzer extracts structured information from document text.
+// Every LLM backend (Gemini, OpenAI-compatible, local models) implements it
+// so the same prompts can be pointed at any provider.
+type Analyzer interface {
+	// AnalyzeDocument sends the prompt for the given document source and
+	// returns the parsed JSON object produced by the model.
+	AnalyzeDocument(ctx context.Context, text string, source DocumentSource) (map[string]interface{}, error)
+	// Name identifies the backend and model, e.g. "gemini/gemini-2.5-pro".
+	Name() string
+}
+
+// Supported LLM providers
+const (
+	ProviderGemini   = "gemini"
+	ProviderOpenAI   = "openai"
+	ProviderOllama   = "ollama"
+	ProviderLlamaCpp = "llamacpp"
+)
+
+// systemInstruction is prepended to every analysis prompt
+const systemInstruction = "You are an AI assistant that extracts structured information from documents."
+
+// NewAnalyzer creates the analyzer for the given provider. An empty provider
+// falls back to the LLM_PROVIDER environment variable and then to Gemini.
+func NewAnalyzer(provider string) (Analyzer, error) {
+	provider = strings.ToLower(strings.TrimSpace(provider))
+	if provider == "" {
+		provider = strings.ToLower(strings.TrimSpace(os.Getenv("LLM_PROVIDER")))
+	}
+	if provider == "" {
+		provider = ProviderGemini
+	}
+
+	switch provider {
+	case ProviderGemini:
+		return NewGeminiClient()
+	case ProviderOpenAI:
+		return NewOpenAIClient()
+	case ProviderLlamaCpp:
+		return NewLlamaCppClient()
+	case ProviderOllama:
+		return NewOllamaClient()
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q (supported: %s, %s, %s, %s)", provider, ProviderGemini, ProviderOpenAI, ProviderOllama, ProviderLlamaCpp)
+	}
+}
+
+// WaitStatsOf returns the rate-limit and retry wait metrics of an analyzer,
+// looking through wrappers such as the cache and the recorder. ok is false if
+// the backend doesn't rate limit.
+func WaitStatsOf(a Analyzer) (stats WaitStats, ok bool) {
+	for a != nil {
+		if w, isWaiter := a.(interface{ WaitStats() WaitStats }); isWaiter {
+			return w.WaitStats(), true
+		}
+		u, isWrapper := a.(interface{ Unwrap() Analyzer })
+		if !isWrapper {
+			break
+		}
+		a = u.Unwrap()
+	}
+	return WaitStats{}, false
+}
+
+// envInt reads an integer setting from the environment, returning def if unset
+func envInt(name string, def int) (int, error) {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer, got %q", name, v)
+	}
+	return n, nil
+}
+
+// buildAnalysisPrompt builds the full user prompt for a document, including
+// the system instruction for backends that don't support a system role
+func buildAnalysisPrompt(text string, source DocumentSource) string {
+	return systemInstruction + "\n\n" + generatePromptForSource(text, source)
+}
+
+// parseAnalysisJSON parses the model output into a JSON object. The output
+// might be wrapped in markdown or be an array, which is converted to an
+// object keyed by index.
+func parseAnalysisJSON(content string) (map[string]interface{}, error) {
+	jsonStr := extractJSONFromGemini(content)
+	if jsonStr == "" {
+		return nil, fmt.Errorf("could not extract JSON from response: %s", content)
+	}
+
+	// Try to unmarshal as an object first
+	var result map[string]interface{}
+	if err := json.Unmarshal([]byte(jsonStr), &result); err != nil {
+		// If it fails, try to unmarshal as an array and convert to object
+		var arr []interface{}
+		if err := json.Unmarshal([]byte(jsonStr), &arr); err != nil {
+			return nil, fmt.Errorf("unmarshal response: %w", err)
+		}
+		// Convert array to object by using index as key
+		result = make(map[string]interface{})
+		for i, item := range arr {
+			result[fmt.Sprintf("item_%d", i)] = item
+		}
+	}
+
+	return result, nil
+}
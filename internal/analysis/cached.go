@@ -0,0 +1,56 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+
+	"extraction/internal/cache"
+)
+
+// cacheKindAnalysis is the cache namespace for LLM analysis output
+const cacheKindAnalysis = "analysis"
+
+// CachedAnalyzer serves repeated analyses from an on-disk cache. Entries are
+// keyed by the full prompt, the response schema and the backend name (which
+// includes the model), so changing the prompt templates, the schema or the
+// model misses the cache.
+type CachedAnalyzer struct {
+	next  Analyzer
+	cache *cache.Cache
+}
+
+// NewCachedAnalyzer wraps next with the given cache
+func NewCachedAnalyzer(next Analyzer, c *cache.Cache) *CachedAnalyzer {
+	return &CachedAnalyzer{next: next, cache: c}
+}
+
+// Name identifies the wrapped backend
+func (a *CachedAnalyzer) Name() string {
+	return a.next.Name()
+}
+
+// Unwrap returns the wrapped analyzer
+func (a *CachedAnalyzer) Unwrap() Analyzer {
+	return a.next
+}
+
+// AnalyzeDocument returns the cached output for the prompt, calling the wrapped analyzer on a miss
+func (a *CachedAnalyzer) AnalyzeDocument(ctx context.Context, text string, source DocumentSource) (map[string]interface{}, error) {
+	key := cache.Key(a.next.Name(), promptVersion(source), buildAnalysisPrompt(text, source))
+
+	var result map[string]interface{}
+	if ok, err := a.cache.Get(cacheKindAnalysis, key, &result); err != nil {
+		fmt.Printf("Warning: ignoring analysis cache entry: %v\n", err)
+	} else if ok && result != nil {
+		return result, nil
+	}
+
+	result, err := a.next.AnalyzeDocument(ctx, text, source)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.cache.Put(cacheKindAnalysis, key, result); err != nil {
+		fmt.Printf("Warning: failed to cache analysis result: %v\n", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,56 @@
+package analysis
+
+import (
+	"context"
+	"testing"
+
+	"extraction/internal/cache"
+)
+
+// countingAnalyzer returns the same result for every document and counts its calls
+type countingAnalyzer struct {
+	calls int
+}
+
+func (a *countingAnalyzer) Name() string { return "counting/test" }
+
+func (a *countingAnalyzer) AnalyzeDocument(ctx context.Context, text string, source DocumentSource) (map[string]interface{}, error) {
+	a.calls++
+	return map[string]interface{}{"client_name": "Công ty TNHH An Phát"}, nil
+}
+
+func TestCachedAnalyzer(t *testing.T) {
+	c, err := cache.New(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := &countingAnalyzer{}
+	cached := NewCachedAnalyzer(next, c)
+	analyze := func() {
+		t.Helper()
+		result, err := cached.AnalyzeDocument(context.Background(), "Giấy chứng nhận đăng ký doanh nghiệp", SourceBusinessLicense)
+		if err != nil || result["client_name"] != "Công ty TNHH An Phát" {
+			t.Fatalf("result = %v, %v", result, err)
+		}
+	}
+
+	analyze()
+	analyze()
+	if next.calls != 1 {
+		t.Errorf("%d calls for the same document, want 1", next.calls)
+	}
+
+	// An enum is only part of the response schema, not of the prompt text
+	fields := sourceFields[SourceBusinessLicense]
+	saved := fields[1].Enum
+	defer func() { fields[1].Enum = saved }()
+	prompt := buildAnalysisPrompt("Giấy chứng nhận đăng ký doanh nghiệp", SourceBusinessLicense)
+	fields[1].Enum = append(append([]string(nil), saved...), "household_business")
+	if buildAnalysisPrompt("Giấy chứng nhận đăng ký doanh nghiệp", SourceBusinessLicense) != prompt {
+		t.Fatalf("the enum changed the prompt; pick a schema-only change")
+	}
+	analyze()
+	if next.calls != 2 {
+		t.Errorf("%d calls after the response schema changed, want 2", next.calls)
+	}
+}
@@ -0,0 +1,212 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Classification is the document type guessed for a file whose source wasn't given
+type Classification struct {
+	Source     DocumentSource
+	Confidence float64 // 0 to 1
+	Method     string  // "keywords" or "llm"
+}
+
+// Classification methods
+const (
+	ClassifiedByKeywords = "keywords"
+	ClassifiedByLLM      = "llm"
+)
+
+// DefaultClassifyThreshold is the confidence a guessed document type needs to be used
+const DefaultClassifyThreshold = 0.6
+
+// keywordConfidenceThreshold is the keyword confidence above which the LLM is not asked
+const keywordConfidenceThreshold = 0.8
+
+// classifyTextLimit caps how much of the document is sent to the LLM for classification
+const classifyTextLimit = 4000
+
+// classifiableSources are the document types a file can be classified as
+var classifiableSources = []DocumentSource{
+	SourceBusinessLicense,
+	SourceEVNBill,
+	SourceLandCertificate,
+	SourceIDCheck,
+	SourceFinancialStatement,
+	SourceSiteVisitPhotos,
+	SourceCICReport,
+}
+
+// sourceKeywords are phrases typical of each document type, in lowercase with
+// and without Vietnamese diacritics. Site visit photos have no reliable keywords.
+var sourceKeywords = map[DocumentSource][]string{
+	SourceBusinessLicense: {
+		"giấy chứng nhận đăng ký doanh nghiệp", "giay chung nhan dang ky doanh nghiep",
+		"đăng ký kinh doanh", "dang ky kinh doanh", "mã số doanh nghiệp", "ma so doanh nghiep",
+		"vốn điều lệ", "von dieu le", "người đại diện theo pháp luật", "nguoi dai dien theo phap luat",
+		"business registration", "enterprise registration", "charter capital",
+	},
+	SourceEVNBill: {
+		"evn", "hóa đơn tiền điện", "hoa don tien dien", "tổng công ty điện lực", "tong cong ty dien luc",
+		"công ty điện lực", "cong ty dien luc", "chỉ số mới", "chi so moi", "điện năng tiêu thụ",
+		"dien nang tieu thu", "kwh", "electricity bill",
+	},
+	SourceLandCertificate: {
+		"quyền sử dụng đất", "quyen su dung dat", "hợp đồng thuê", "hop dong thue", "bên cho thuê",
+		"ben cho thue", "bên thuê", "ben thue", "thửa đất", "thua dat", "sổ đỏ", "sổ hồng",
+		"lease agreement", "land use right", "landlord", "tenant",
+	},
+	SourceIDCheck: {
+		"căn cước công dân", "can cuoc cong dan", "căn cước", "can cuoc", "chứng minh nhân dân",
+		"chung minh nhan dan", "quê quán", "que quan", "nơi thường trú", "noi thuong tru",
+		"citizen identity", "identity card", "place of origin", "passport",
+	},
+	SourceFinancialStatement: {
+		"báo cáo tài chính", "bao cao tai chinh", "bảng cân đối kế toán", "bang can doi ke toan",
+		"kết quả hoạt động kinh doanh", "ket qua hoat dong kinh doanh", "lưu chuyển tiền tệ",
+		"luu chuyen tien te", "tổng cộng tài sản", "tong cong tai san", "doanh thu thuần",
+		"doanh thu thuan", "balance sheet", "income statement", "cash flow", "total assets",
+	},
+	SourceCICReport: {
+		"cic", "trung tâm thông tin tín dụng", "trung tam thong tin tin dung", "báo cáo tín dụng",
+		"bao cao tin dung", "thông tin tín dụng", "thong tin tin dung", "tổ chức tín dụng",
+		"to chuc tin dung", "nhóm nợ", "nhom no", "dư nợ", "du no", "credit information", "credit report",
+	},
+}
+
+// keywordPatterns holds sourceKeywords compiled to match whole words only
+var keywordPatterns = map[DocumentSource][]*regexp.Regexp{}
+
+func init() {
+	for source, keywords := range sourceKeywords {
+		for _, kw := range keywords {
+			keywordPatterns[source] = append(keywordPatterns[source], regexp.MustCompile(`(?:^|[^\p{L}\p{N}])`+regexp.QuoteMeta(kw)+`(?:$|[^\p{L}\p{N}])`))
+		}
+	}
+}
+
+// ClassifyByKeywords guesses the document type from the keywords in its text.
+// Confidence grows with the number of distinct keywords found and shrinks when
+// another type matches nearly as well. Returns SourceUnknown if nothing matches.
+func ClassifyByKeywords(text string) Classification {
+	lower := strings.ToLower(text)
+	type score struct {
+		source DocumentSource
+		hits   int
+	}
+	var scores []score
+	for _, source := range classifiableSources {
+		hits := 0
+		for _, re := range keywordPatterns[source] {
+			if re.MatchString(lower) {
+				hits++
+			}
+		}
+		if hits > 0 {
+			scores = append(scores, score{source, hits})
+		}
+	}
+	if len(scores) == 0 {
+		return Classification{Source: SourceUnknown, Method: ClassifiedByKeywords}
+	}
+	// Ties go to the type listed first in classifiableSources
+	sort.SliceStable(scores, func(i, j int) bool { return scores[i].hits > scores[j].hits })
+
+	top := float64(scores[0].hits)
+	runnerUp := 0.0
+	if len(scores) > 1 {
+		runnerUp = float64(scores[1].hits)
+	}
+	confidence := math.Min(1, top/3) * top / (top + runnerUp)
+	return Classification{Source: scores[0].source, Confidence: math.Round(confidence*100) / 100, Method: ClassifiedByKeywords}
+}
+
+// ClassifyDocument guesses the document type of a file. Keywords are tried
+// first; if they aren't conclusive the analyzer is asked. If the analyzer is
+// nil or fails, the keyword guess is returned along with the error.
+func ClassifyDocument(ctx context.Context, analyzer Analyzer, text string) (Classification, error) {
+	guess := ClassifyByKeywords(text)
+	if guess.Confidence >= keywordConfidenceThreshold || analyzer == nil {
+		return guess, nil
+	}
+
+	result, err := analyzer.AnalyzeDocument(ctx, truncateText(text, classifyTextLimit), sourceClassification)
+	if err != nil {
+		return guess, fmt.Errorf("%s classification error: %w", analyzer.Name(), err)
+	}
+	llmGuess, err := parseClassification(result)
+	if err != nil {
+		return guess, fmt.Errorf("%s classification error: %w", analyzer.Name(), err)
+	}
+	// Keywords pointing the same way corroborate the model
+	if llmGuess.Source == guess.Source && guess.Confidence > llmGuess.Confidence {
+		llmGuess.Confidence = guess.Confidence
+	}
+	return llmGuess, nil
+}
+
+// parseClassification reads the model's classification answer
+func parseClassification(result map[string]interface{}) (Classification, error) {
+	name, _ := result["document_type"].(string)
+	source := DocumentSource(strings.ToLower(strings.TrimSpace(name)))
+	known := source == SourceUnknown
+	for _, s := range classifiableSources {
+		if s == source {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return Classification{}, fmt.Errorf("unknown document type %q", name)
+	}
+
+	confidence := extractionConfidence(map[string]interface{}{"extraction_confidence": result["confidence"]})
+	if source == SourceUnknown {
+		confidence = 0
+	}
+	return Classification{Source: source, Confidence: confidence, Method: ClassifiedByLLM}, nil
+}
+
+// truncateText returns at most limit bytes from the start of text, cut at a
+// character boundary. The start of a document is enough to tell its type.
+func truncateText(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut]
+}
+
+// classificationPrompt asks the model which document type the text comes from
+func classificationPrompt(text string) string {
+	var b strings.Builder
+	b.WriteString("Classify the following document, which is part of a Vietnamese corporate credit check, as one of these document types:\n")
+	for _, source := range classifiableSources {
+		b.WriteString("- " + string(source) + ": " + sourceDescriptions[source] + "\n")
+	}
+	b.WriteString("- unknown: none of the above\n\nDocument text:\n")
+	b.WriteString(text)
+	b.WriteString("\n\nReturn the answer in JSON format:\n")
+	b.WriteString(renderPromptFields(fieldsFor(sourceClassification)))
+	return b.String()
+}
+
+// sourceDescriptions explain each document type to the classifier
+var sourceDescriptions = map[DocumentSource]string{
+	SourceBusinessLicense:    "business/enterprise registration certificate (Giấy chứng nhận đăng ký doanh nghiệp)",
+	SourceEVNBill:            "EVN electricity bill (hóa đơn tiền điện)",
+	SourceLandCertificate:    "land use rights certificate or rental/lease agreement",
+	SourceIDCheck:            "citizen ID card, passport or other identity document",
+	SourceFinancialStatement: "financial statements: balance sheet, income statement, cash flow",
+	SourceSiteVisitPhotos:    "photos of the company premises or signboard",
+	SourceCICReport:          "CIC credit information report listing loans and debt groups",
+}
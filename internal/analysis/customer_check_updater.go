@@ -3,69 +3,141 @@ package analysis
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"strings"
 	"time"
 
 	"extraction/internal/models"
 )
 
-// UpdateCustomerCheck updates a CustomerCheck object with information extracted from a document
-func UpdateCustomerCheck(check *models.CustomerCheck, extractedData map[string]interface{}, source DocumentSource) {
+// UpdateCustomerCheck updates a CustomerCheck object with information extracted from a document.
+// The raw model output is decoded into the typed extraction for the source first; values that
+// could not be coerced, or classification values that are not recognized, are returned as field errors.
+// Every field the document fills is stamped with origin as its provenance, along with the raw model value.
+func UpdateCustomerCheck(check *models.CustomerCheck, extractedData map[string]interface{}, source DocumentSource, origin models.FieldProvenance) []FieldError {
+	before := check.FieldValues()
+	loansBefore := len(check.Financial.Loans)
+
+	errs := applyExtraction(check, extractedData, source)
+
+	if origin.DocumentSource == "" {
+		origin.DocumentSource = string(source)
+	}
+	if origin.RecordedAt.IsZero() {
+		origin.RecordedAt = time.Now()
+	}
+	for path, value := range check.FieldValues() {
+		if old, ok := before[path]; ok && reflect.DeepEqual(old, value) {
+			continue
+		}
+		p := origin
+		p.RawValue = rawValueFor(path, extractedData, loansBefore)
+		check.SetProvenance(path, p)
+	}
+	return errs
+}
+
+// extractionKeys maps check fields whose name differs from the extraction key
+var extractionKeys = map[string]string{
+	"land.ownership.owned_docs_complete": "documentation_complete",
+}
+
+// rawValueFor returns the model output that produced the field at path
+func rawValueFor(path string, data map[string]interface{}, loansBefore int) interface{} {
+	if key, ok := extractionKeys[path]; ok {
+		return data[key]
+	}
+	var loanIndex int
+	if _, err := fmt.Sscanf(path, "financial.loans[%d]", &loanIndex); err == nil {
+		if loans, ok := data["loans"].([]interface{}); ok && loanIndex-loansBefore >= 0 && loanIndex-loansBefore < len(loans) {
+			return loans[loanIndex-loansBefore]
+		}
+		return nil
+	}
+	return data[path[strings.LastIndex(path, ".")+1:]]
+}
+
+// applyExtraction decodes the model output for the source and applies it to the check
+func applyExtraction(check *models.CustomerCheck, extractedData map[string]interface{}, source DocumentSource) []FieldError {
 	switch source {
 	case SourceBusinessLicense:
-		updateFromBusinessLicense(&check.Corporate, extractedData)
+		var ext BusinessLicenseExtraction
+		errs := DecodeExtraction(extractedData, &ext)
+		return append(errs, updateFromBusinessLicense(&check.Corporate, &ext)...)
 	case SourceEVNBill:
-		updateFromEVNBill(&check.Land.EVN, extractedData)
+		var ext EVNBillExtraction
+		errs := DecodeExtraction(extractedData, &ext)
+		return append(errs, updateFromEVNBill(&check.Land.EVN, &ext)...)
 	case SourceLandCertificate:
-		updateFromLandCertificate(&check.Land.Ownership, extractedData)
+		var ext LandCertificateExtraction
+		errs := DecodeExtraction(extractedData, &ext)
+		return append(errs, updateFromLandCertificate(&check.Land.Ownership, &ext)...)
 	case SourceIDCheck:
-		updateFromIDCheck(&check.Corporate.Ownership, extractedData)
+		var ext IDCheckExtraction
+		errs := DecodeExtraction(extractedData, &ext)
+		return append(errs, updateFromIDCheck(&check.Corporate.Ownership, &ext)...)
 	case SourceSiteVisitPhotos:
-		updateFromSiteVisit(&check.Additional.SiteVisit, extractedData)
+		var ext SiteVisitExtraction
+		errs := DecodeExtraction(extractedData, &ext)
+		return append(errs, updateFromSiteVisit(&check.Additional.SiteVisit, &ext)...)
 	case SourceFinancialStatement:
-		updateFromFinancialStatement(&check.Financial, extractedData)
+		var ext FinancialStatementExtraction
+		errs := DecodeExtraction(extractedData, &ext)
+		return append(errs, updateFromFinancialStatement(&check.Financial, &ext)...)
 	case SourceCICReport:
-		updateFromCICReport(&check.Corporate.History, &check.Financial.Loans, extractedData)
+		var ext CICReportExtraction
+		errs := DecodeExtraction(extractedData, &ext)
+		return append(errs, updateFromCICReport(&check.Corporate.History, &check.Financial.Loans, &ext)...)
 	}
+	return nil
+}
+
+// unrecognized reports a classification value that doesn't map to any known option
+func unrecognized(field, value string) FieldError {
+	return FieldError{Field: field, Value: value, Err: "unrecognized value"}
 }
 
-func updateFromBusinessLicense(info *models.CorporateInfo, data map[string]interface{}) {
-	if clientName, ok := data["client_name"].(string); ok {
-		info.General.ClientName = clientName
+func updateFromBusinessLicense(info *models.CorporateInfo, ext *BusinessLicenseExtraction) []FieldError {
+	var errs []FieldError
+	if ext.ClientName != "" {
+		info.General.ClientName = ext.ClientName
 	}
-	if clientType, ok := data["client_type"].(string); ok {
-		switch strings.ToLower(clientType) {
+	if ext.ClientType != "" {
+		switch strings.ToLower(ext.ClientType) {
 		case "corporate_entity":
 			info.General.ClientType = models.ClientTypeCorporateEntity
 		case "private_individual":
 			info.General.ClientType = models.ClientTypePrivateIndividual
+		default:
+			errs = append(errs, unrecognized("client_type", ext.ClientType))
 		}
 	}
-	if taxCode, ok := data["tax_code_mst"].(string); ok {
-		info.General.TaxCodeMST = taxCode
+	if ext.TaxCodeMST != "" {
+		info.General.TaxCodeMST = ext.TaxCodeMST
 	}
-	if license, ok := data["business_license_gpkd"].(string); ok {
-		switch strings.ToLower(license) {
+	if ext.BusinessLicenseGPKD != "" {
+		switch strings.ToLower(ext.BusinessLicenseGPKD) {
 		case "yes":
 			info.General.BusinessLicenseGPKD = models.TriYes
 		case "no":
 			info.General.BusinessLicenseGPKD = models.TriNo
 		case "na", "n/a":
 			info.General.BusinessLicenseGPKD = models.TriNA
+		default:
+			errs = append(errs, unrecognized("business_license_gpkd", ext.BusinessLicenseGPKD))
 		}
 	}
-	if address, ok := data["business_address"].(string); ok {
-		info.General.BusinessAddress = address
+	if ext.BusinessAddress != "" {
+		info.General.BusinessAddress = ext.BusinessAddress
 	}
-	if capital, ok := data["registered_share_capital"].(float64); ok {
-		v := models.MoneyVND(capital)
-		info.General.RegisteredShareCapital = &v
+	if ext.RegisteredShareCapital != nil {
+		info.General.RegisteredShareCapital = ext.RegisteredShareCapital
 	}
-	if operations, ok := data["business_operations"].(string); ok {
-		info.General.BusinessOperations = operations
+	if ext.BusinessOperations != "" {
+		info.General.BusinessOperations = ext.BusinessOperations
 	}
-	if customerType, ok := data["customer_type"].(string); ok {
-		switch customerType {
+	if ext.CustomerType != "" {
+		switch strings.ToLower(ext.CustomerType) {
 		case "manufacturing_production":
 			info.General.CustomerType = models.CustomerTypeManufacturing
 		case "trading_commercial":
@@ -88,19 +160,19 @@ func updateFromBusinessLicense(info *models.CorporateInfo, data map[string]inter
 			info.General.CustomerType = models.CustomerTypeMedia
 		case "na_private_individual":
 			info.General.CustomerType = models.CustomerTypeNA
+		default:
+			errs = append(errs, unrecognized("customer_type", ext.CustomerType))
 		}
 	}
-	if date, ok := data["incorporation_date"].(string); ok {
-		if t, err := time.Parse("2006-01-02", date); err == nil {
-			info.History.IncorporationDate = &t
-		}
+	if ext.IncorporationDate != nil {
+		info.History.IncorporationDate = ext.IncorporationDate
 	}
-	if owner, ok := data["owners_name"].(string); ok {
-		info.Ownership.OwnersName = owner
+	if ext.OwnersName != "" {
+		info.Ownership.OwnersName = ext.OwnersName
 	}
-	if ownership, ok := data["ownership_category"].(string); ok {
-		switch ownership {
-		case "100":
+	if ext.OwnershipCategory != "" {
+		switch strings.ToLower(ext.OwnershipCategory) {
+		case "100", "100%":
 			info.Ownership.OwnershipCategory = models.Ownership100
 		case "gt_50", ">50%":
 			info.Ownership.OwnershipCategory = models.OwnershipGT50
@@ -108,19 +180,22 @@ func updateFromBusinessLicense(info *models.CorporateInfo, data map[string]inter
 			info.Ownership.OwnershipCategory = models.OwnershipLT50
 		case "na", "n/a":
 			info.Ownership.OwnershipCategory = models.OwnershipNA
+		default:
+			errs = append(errs, unrecognized("ownership_category", ext.OwnershipCategory))
 		}
 	}
-	if decisionMaker, ok := data["key_decision_maker"].(string); ok {
-		info.Ownership.KeyDecisionMaker = decisionMaker
+	if ext.KeyDecisionMaker != "" {
+		info.Ownership.KeyDecisionMaker = ext.KeyDecisionMaker
 	}
+	return errs
 }
 
-func updateFromEVNBill(info *models.EVNInformation, data map[string]interface{}) {
-	if address, ok := data["billing_address"].(string); ok {
-		info.BillingAddress = address
+func updateFromEVNBill(info *models.EVNInformation, ext *EVNBillExtraction) []FieldError {
+	if ext.BillingAddress != "" {
+		info.BillingAddress = ext.BillingAddress
 	}
-	if matches, ok := data["billing_address_matches_client"].(string); ok {
-		switch strings.ToLower(strings.TrimSpace(matches)) {
+	if ext.BillingAddressMatchesClient != "" {
+		switch strings.ToLower(ext.BillingAddressMatchesClient) {
 		case "yes", "true", "1":
 			info.BillingAddressMatchesClient = models.Yes
 		case "no", "false", "0":
@@ -129,12 +204,11 @@ func updateFromEVNBill(info *models.EVNInformation, data map[string]interface{})
 			info.BillingAddressMatchesClient = models.No // Default to No for unclear responses
 		}
 	}
-	if amount, ok := data["billing_amount"].(float64); ok {
-		v := models.MoneyVND(amount)
-		info.BillingAmount = &v
+	if ext.BillingAmount != nil {
+		info.BillingAmount = ext.BillingAmount
 	}
-	if matches, ok := data["billed_amounts_match_expenses"].(string); ok {
-		switch strings.ToLower(strings.TrimSpace(matches)) {
+	if ext.BilledAmountsMatchExpenses != "" {
+		switch strings.ToLower(ext.BilledAmountsMatchExpenses) {
 		case "yes", "true", "1", "match", "matches":
 			info.BilledAmountsMatchExpenses = models.TriYes
 		case "no", "false", "0", "does not match", "doesn't match":
@@ -143,28 +217,28 @@ func updateFromEVNBill(info *models.EVNInformation, data map[string]interface{})
 			info.BilledAmountsMatchExpenses = models.TriNo // Default to No for unclear responses
 		}
 	}
+	return nil
 }
 
+func updateFromLandCertificate(info *models.LandOwnershipInformation, ext *LandCertificateExtraction) []FieldError {
+	var errs []FieldError
 
-func updateFromLandCertificate(info *models.LandOwnershipInformation, data map[string]interface{}) {
-	// Set situation based on AI classification
-	if situation, ok := data["situation"].(string); ok {
-		switch strings.ToLower(situation) {
-		case "land_owner":
-			info.Situation = models.LandOwner
-		case "rental_agreement":
-			info.Situation = models.RentalAgreement
-		case "unknown":
-			info.Situation = models.Unknown
-		default:
-			info.Situation = models.Unknown // default to unknown if unclear
-		}
-	} else {
-		info.Situation = models.Unknown // default to unknown if not specified
+	// Set situation based on AI classification; a document that doesn't say leaves it unset
+	switch strings.ToLower(ext.Situation) {
+	case "land_owner":
+		info.Situation = models.LandOwner
+	case "rental_agreement":
+		info.Situation = models.RentalAgreement
+	case "":
+	case "unknown":
+		info.Situation = models.Unknown
+	default:
+		info.Situation = models.Unknown // default to unknown if unclear
+		errs = append(errs, unrecognized("situation", ext.Situation))
 	}
-	
-	if signatory, ok := data["landowner_is_signatory"].(string); ok {
-		switch strings.ToLower(strings.TrimSpace(signatory)) {
+
+	if ext.LandownerIsSignatory != "" {
+		switch strings.ToLower(ext.LandownerIsSignatory) {
 		case "yes", "true", "1":
 			info.LandownerIsSignatory = models.Yes
 		case "no", "false", "0":
@@ -173,9 +247,9 @@ func updateFromLandCertificate(info *models.LandOwnershipInformation, data map[s
 			info.LandownerIsSignatory = models.YesNoNA // Default to NA for unclear responses
 		}
 	}
-	
-	if complete, ok := data["documentation_complete"].(string); ok {
-		switch strings.ToLower(strings.TrimSpace(complete)) {
+
+	if ext.DocumentationComplete != "" {
+		switch strings.ToLower(ext.DocumentationComplete) {
 		case "yes", "true", "1", "complete":
 			info.OwnedDocsComplete = models.Yes
 		case "no", "false", "0", "incomplete":
@@ -184,182 +258,147 @@ func updateFromLandCertificate(info *models.LandOwnershipInformation, data map[s
 			info.OwnedDocsComplete = models.YesNoNA // Default to NA for unclear responses
 		}
 	}
-	
-	if date, ok := data["lease_expiration_date"].(string); ok && date != "0000-00-00" && date != "" {
-		if t, err := time.Parse("2006-01-02", date); err == nil {
-			info.LeaseExpirationDate = &t
-		}
+
+	if ext.LeaseExpirationDate != nil {
+		info.LeaseExpirationDate = ext.LeaseExpirationDate
 	}
+	return errs
 }
 
-func updateFromIDCheck(info *models.OwnershipInfo, data map[string]interface{}) {
-	if director, ok := data["company_director_name"].(string); ok {
-		info.CompanyDirectorName = director
+func updateFromIDCheck(info *models.OwnershipInfo, ext *IDCheckExtraction) []FieldError {
+	if ext.CompanyDirectorName != "" {
+		info.CompanyDirectorName = ext.CompanyDirectorName
 	}
-	if decisionMaker, ok := data["key_decision_maker"].(string); ok {
-		info.KeyDecisionMaker = decisionMaker
+	if ext.KeyDecisionMaker != "" {
+		info.KeyDecisionMaker = ext.KeyDecisionMaker
 	}
+	return nil
 }
 
-func updateFromSiteVisit(info *models.SiteVisit, data map[string]interface{}) {
-	if signboard, ok := data["company_signboard"].(string); ok {
-		switch signboard {
-		case "available_matches_client_info":
-			info.CompanySignboard = models.SignboardMatches
-		case "available_does_not_match_client_info":
-			info.CompanySignboard = models.SignboardMismatched
-		case "not_available_or_not_checked":
-			info.CompanySignboard = models.SignboardNotAvail
-		}
-	}
+func updateFromSiteVisit(info *models.SiteVisit, ext *SiteVisitExtraction) []FieldError {
+	if ext.CompanySignboard == "" {
+		return nil
+	}
+	switch strings.ToLower(ext.CompanySignboard) {
+	case "available_matches_client_info":
+		info.CompanySignboard = models.SignboardMatches
+	case "available_does_not_match_client_info":
+		info.CompanySignboard = models.SignboardMismatched
+	case "not_available_or_not_checked":
+		info.CompanySignboard = models.SignboardNotAvail
+	default:
+		return []FieldError{unrecognized("company_signboard", ext.CompanySignboard)}
+	}
+	return nil
 }
 
-func updateFromFinancialStatement(info *models.FinancialInfo, data map[string]interface{}) {
-	if date, ok := data["financial_statement_date"].(string); ok {
-		if t, err := time.Parse("2006-01-02", date); err == nil {
-			info.FinancialStatementDate = &t
-		}
+func updateFromFinancialStatement(info *models.FinancialInfo, ext *FinancialStatementExtraction) []FieldError {
+	if ext.FinancialStatementDate != nil {
+		info.FinancialStatementDate = ext.FinancialStatementDate
 	}
 	
 	// Update P&L data
-	if revenues, ok := data["total_revenues"].([]interface{}); ok && len(revenues) == 5 {
-		for i, v := range revenues {
-			if amount, ok := v.(float64); ok {
-				info.PL.TotalRevenues[i] = models.MoneyVND(amount)
-			}
-		}
+	if ext.TotalRevenues != nil {
+		info.PL.TotalRevenues = *ext.TotalRevenues
 	}
-	if costs, ok := data["total_costs"].([]interface{}); ok && len(costs) == 5 {
-		for i, v := range costs {
-			if amount, ok := v.(float64); ok {
-				info.PL.TotalCosts[i] = models.MoneyVND(amount)
-			}
-		}
+	if ext.TotalCosts != nil {
+		info.PL.TotalCosts = *ext.TotalCosts
 	}
-	if energyCosts, ok := data["total_energy_costs"].([]interface{}); ok && len(energyCosts) == 5 {
-		for i, v := range energyCosts {
-			if amount, ok := v.(float64); ok {
-				info.PL.TotalEnergyCosts[i] = models.MoneyVND(amount)
-			}
-		}
+	if ext.TotalEnergyCosts != nil {
+		info.PL.TotalEnergyCosts = *ext.TotalEnergyCosts
 	}
 	
 	// Update Balance Sheet data
-	if assets, ok := data["total_assets"].([]interface{}); ok && len(assets) == 5 {
-		for i, v := range assets {
-			if amount, ok := v.(float64); ok {
-				info.BalanceSheet.TotalAssets[i] = models.MoneyVND(amount)
-			}
-		}
+	if ext.TotalAssets != nil {
+		info.BalanceSheet.TotalAssets = *ext.TotalAssets
 	}
-	if debt, ok := data["total_debt"].([]interface{}); ok && len(debt) == 5 {
-		for i, v := range debt {
-			if amount, ok := v.(float64); ok {
-				info.BalanceSheet.TotalDebt[i] = models.MoneyVND(amount)
-			}
-		}
+	if ext.TotalDebt != nil {
+		info.BalanceSheet.TotalDebt = *ext.TotalDebt
 	}
+	return nil
 }
 
-func updateFromCICReport(info *models.CorporateHistory, loans *[]models.LoanInfo, data map[string]interface{}) {
-	// Extract loans array from the data
-	if loansData, ok := data["loans"].([]interface{}); ok {
-		for _, loanData := range loansData {
-			if loanMap, ok := loanData.(map[string]interface{}); ok {
-				var loanInfo models.LoanInfo
-				
-				// Set payment history
-				if description, ok := loanMap["payment_history"].(string); ok {
-					loanInfo.PaymentHistory = description
-				} else {
-					loanInfo.PaymentHistory = "No payment history found"
-				}
-				
-				// Update loan type
-				loanInfo.LoanType = models.LoanTypeOtherCredit // Default loan type
-				if loanType, ok := loanMap["loan_type"].(string); ok {
-					switch strings.ToLower(loanType) {
-					case "short_term_loan":
-						loanInfo.LoanType = models.LoanTypeShortTerm
-					case "medium_term_loan":
-						loanInfo.LoanType = models.LoanTypeMediumTerm
-					case "long_term_loan":
-						loanInfo.LoanType = models.LoanTypeLongTerm
-					case "credit_card":
-						loanInfo.LoanType = models.LoanTypeCreditCard
-					case "overdrafts":
-						loanInfo.LoanType = models.LoanTypeOverdrafts
-					case "guarantee":
-						loanInfo.LoanType = models.LoanTypeGuarantee
-					case "financial_leasing":
-						loanInfo.LoanType = models.LoanTypeFinancialLeasing
-					case "factoring":
-						loanInfo.LoanType = models.LoanTypeFactoring
-					case "consumer_loan":
-						loanInfo.LoanType = models.LoanTypeConsumerLoan
-					case "other_credit_facility":
-						loanInfo.LoanType = models.LoanTypeOtherCredit
-					}
-				}
-				
-				// Update debt classification
-				loanInfo.DebtClassification = models.DebtClassificationGroup1 // Default debt classification
-				if debtClass, ok := loanMap["debt_classification"].(string); ok {
-					switch strings.ToLower(debtClass) {
-					case "group_1_current_debt":
-						loanInfo.DebtClassification = models.DebtClassificationGroup1
-					case "group_2_special_mention_debt":
-						loanInfo.DebtClassification = models.DebtClassificationGroup2
-					case "group_3_substandard_debt":
-						loanInfo.DebtClassification = models.DebtClassificationGroup3
-					case "group_4_doubtful_debt":
-						loanInfo.DebtClassification = models.DebtClassificationGroup4
-					case "group_5_loss_debt":
-						loanInfo.DebtClassification = models.DebtClassificationGroup5
-					}
-				}
-				
-				// Set default amounts to 0 if not provided
-				defaultAmount := models.MoneyVND(0)
-				loanInfo.OutstandingAmount = &defaultAmount
-				if amount, ok := loanMap["outstanding_amount"].(float64); ok && amount > 0 {
-					v := models.MoneyVND(amount)
-					loanInfo.OutstandingAmount = &v
-				}
-				
-				defaultInterest := models.MoneyVND(0)
-				loanInfo.AnnualInterestCost = &defaultInterest
-				if interest, ok := loanMap["annual_interest_cost"].(float64); ok && interest > 0 {
-					v := models.MoneyVND(interest)
-					loanInfo.AnnualInterestCost = &v
-				}
-				
-				defaultAmortization := models.MoneyVND(0)
-				loanInfo.AnnualAmortization = &defaultAmortization
-				if amortization, ok := loanMap["annual_amortization"].(float64); ok && amortization > 0 {
-					v := models.MoneyVND(amortization)
-					loanInfo.AnnualAmortization = &v
-				}
-				
-				if maturity, ok := loanMap["maturity"].(string); ok && maturity != "0000-00-00" && maturity != "" {
-					if t, err := time.Parse("2006-01-02", maturity); err == nil {
-						loanInfo.Maturity = &t
-					}
-				}
-				
-				// Add the loan to the loans array
-				*loans = append(*loans, loanInfo)
-			}
+func updateFromCICReport(info *models.CorporateHistory, loans *[]models.LoanInfo, ext *CICReportExtraction) []FieldError {
+	var errs []FieldError
+	for i, loan := range ext.Loans {
+		var loanInfo models.LoanInfo
+		
+		// Set payment history
+		loanInfo.PaymentHistory = loan.PaymentHistory
+		if loanInfo.PaymentHistory == "" {
+			loanInfo.PaymentHistory = "No payment history found"
+		}
+		
+		// Update loan type
+		loanInfo.LoanType = models.LoanTypeOtherCredit // Default loan type
+		switch strings.ToLower(loan.LoanType) {
+		case "short_term_loan":
+			loanInfo.LoanType = models.LoanTypeShortTerm
+		case "medium_term_loan":
+			loanInfo.LoanType = models.LoanTypeMediumTerm
+		case "long_term_loan":
+			loanInfo.LoanType = models.LoanTypeLongTerm
+		case "credit_card":
+			loanInfo.LoanType = models.LoanTypeCreditCard
+		case "overdrafts":
+			loanInfo.LoanType = models.LoanTypeOverdrafts
+		case "guarantee":
+			loanInfo.LoanType = models.LoanTypeGuarantee
+		case "financial_leasing":
+			loanInfo.LoanType = models.LoanTypeFinancialLeasing
+		case "factoring":
+			loanInfo.LoanType = models.LoanTypeFactoring
+		case "consumer_loan":
+			loanInfo.LoanType = models.LoanTypeConsumerLoan
+		case "other_credit_facility", "":
+			loanInfo.LoanType = models.LoanTypeOtherCredit
+		default:
+			errs = append(errs, unrecognized(fmt.Sprintf("loans[%d].loan_type", i), loan.LoanType))
 		}
+		
+		// Update debt classification
+		loanInfo.DebtClassification = models.DebtClassificationGroup1 // Default debt classification
+		switch strings.ToLower(loan.DebtClassification) {
+		case "group_1_current_debt", "":
+			loanInfo.DebtClassification = models.DebtClassificationGroup1
+		case "group_2_special_mention_debt":
+			loanInfo.DebtClassification = models.DebtClassificationGroup2
+		case "group_3_substandard_debt":
+			loanInfo.DebtClassification = models.DebtClassificationGroup3
+		case "group_4_doubtful_debt":
+			loanInfo.DebtClassification = models.DebtClassificationGroup4
+		case "group_5_loss_debt":
+			loanInfo.DebtClassification = models.DebtClassificationGroup5
+		default:
+			errs = append(errs, unrecognized(fmt.Sprintf("loans[%d].debt_classification", i), loan.DebtClassification))
+		}
+		
+		// Set default amounts to 0 if not provided
+		loanInfo.OutstandingAmount = positiveOrZero(loan.OutstandingAmount)
+		loanInfo.AnnualInterestCost = positiveOrZero(loan.AnnualInterestCost)
+		loanInfo.AnnualAmortization = positiveOrZero(loan.AnnualAmortization)
+		loanInfo.Maturity = loan.Maturity
+		
+		// Add the loan to the loans array
+		*loans = append(*loans, loanInfo)
 	}
+	return errs
 }
 
-// compareAddressesWithGemini uses Gemini to compare two addresses and determine if they refer to the same location
-func compareAddressesWithGemini(businessAddress, billingAddress string) (bool, error) {
-	// Create a Gemini client
-	client, err := NewGeminiClient()
-	if err != nil {
-		return false, fmt.Errorf("failed to create Gemini client: %w", err)
+// positiveOrZero returns the amount if it is positive, otherwise a pointer to 0
+func positiveOrZero(amount *models.MoneyVND) *models.MoneyVND {
+	if amount != nil && *amount > 0 {
+		v := *amount
+		return &v
+	}
+	zero := models.MoneyVND(0)
+	return &zero
+}
+
+// compareAddressesWithLLM uses the configured analyzer to compare two addresses and determine if they refer to the same location
+func compareAddressesWithLLM(ctx context.Context, analyzer Analyzer, businessAddress, billingAddress string) (bool, error) {
+	if analyzer == nil {
+		return false, fmt.Errorf("no analyzer configured")
 	}
 
 	// Create a simpler, more direct prompt for address comparison
@@ -377,18 +416,18 @@ Rules:
 Return ONLY: "yes" or "no"`, businessAddress, billingAddress)
 
 	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
 
-	// Call Gemini to analyze the addresses
-	result, err := client.AnalyzeDocument(ctx, prompt, SourceBusinessLicense)
+	// Call the analyzer to compare the addresses
+	result, err := analyzer.AnalyzeDocument(ctx, prompt, sourceAddressComparison)
 	if err != nil {
-		return false, fmt.Errorf("failed to analyze addresses with Gemini: %w", err)
+		return false, fmt.Errorf("failed to analyze addresses with %s: %w", analyzer.Name(), err)
 	}
 
 	// Parse the result - look for various possible response formats
 	if result == nil {
-		return false, fmt.Errorf("empty result from Gemini")
+		return false, fmt.Errorf("empty result from %s", analyzer.Name())
 	}
 
 	// Try to extract the result from various possible fields
@@ -417,19 +456,23 @@ Return ONLY: "yes" or "no"`, businessAddress, billingAddress)
 		return false, nil
 	}
 
-	return false, fmt.Errorf("could not parse Gemini response: %v", result)
+	return false, fmt.Errorf("could not parse %s response: %v", analyzer.Name(), result)
 }
 
-// CompareAddresses compares billing address with business address and updates the match status
-func CompareAddresses(check *models.CustomerCheck) {
+// CompareAddresses compares billing address with business address and updates the match status.
+// The analyzer may be nil, in which case only the simple string comparison is used.
+// Cancelling ctx stops the LLM comparison.
+func CompareAddresses(ctx context.Context, check *models.CustomerCheck, analyzer Analyzer) {
 	if check.Corporate.General.BusinessAddress != "" && check.Land.EVN.BillingAddress != "" {
 		fmt.Printf("Comparing addresses:\nBusiness: %s\nBilling: %s\n", check.Corporate.General.BusinessAddress, check.Land.EVN.BillingAddress)
 		
-		// Use Gemini for more accurate address comparison
-		matches, err := compareAddressesWithGemini(check.Corporate.General.BusinessAddress, check.Land.EVN.BillingAddress)
+		// Use the LLM for more accurate address comparison
+		matches, err := compareAddressesWithLLM(ctx, analyzer, check.Corporate.General.BusinessAddress, check.Land.EVN.BillingAddress)
+		method := "llm"
 		if err != nil {
-			// Fallback to simple comparison if Gemini fails
-			fmt.Printf("Gemini address comparison failed, using fallback: %v\n", err)
+			method = "fallback"
+			// Fallback to simple comparison if the LLM fails
+			fmt.Printf("LLM address comparison failed, using fallback: %v\n", err)
 			if addressesMatch(check.Corporate.General.BusinessAddress, check.Land.EVN.BillingAddress) {
 				check.Land.EVN.BillingAddressMatchesClient = models.Yes
 				fmt.Printf("Fallback comparison: YES (addresses match)\n")
@@ -440,12 +483,17 @@ func CompareAddresses(check *models.CustomerCheck) {
 		} else {
 			if matches {
 				check.Land.EVN.BillingAddressMatchesClient = models.Yes
-				fmt.Printf("Gemini comparison: YES (addresses match)\n")
+				fmt.Printf("LLM comparison: YES (addresses match)\n")
 			} else {
 				check.Land.EVN.BillingAddressMatchesClient = models.No
-				fmt.Printf("Gemini comparison: NO (addresses don't match)\n")
+				fmt.Printf("LLM comparison: NO (addresses don't match)\n")
 			}
 		}
+		check.SetProvenance("land.evn.billing_address_matches_client", models.FieldProvenance{
+			DocumentSource: string(sourceAddressComparison),
+			RawValue:       method,
+			RecordedAt:     time.Now(),
+		})
 	} else {
 		fmt.Printf("Cannot compare addresses - missing data:\nBusiness Address: '%s'\nBilling Address: '%s'\n", 
 			check.Corporate.General.BusinessAddress, check.Land.EVN.BillingAddress)
@@ -0,0 +1,35 @@
+package analysis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"extraction/internal/models"
+)
+
+// blockingAnalyzer waits for its context to end
+type blockingAnalyzer struct{}
+
+func (blockingAnalyzer) Name() string { return "blocking" }
+
+func (blockingAnalyzer) AnalyzeDocument(ctx context.Context, text string, source DocumentSource) (map[string]interface{}, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestCompareAddressesCancelled(t *testing.T) {
+	check := &models.CustomerCheck{}
+	check.Corporate.General.BusinessAddress = "12 Nguyễn Thị Minh Khai, Quận 1"
+	check.Land.EVN.BillingAddress = "12 Nguyễn Thị Minh Khai, Quận 1"
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	CompareAddresses(ctx, check, blockingAnalyzer{})
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("comparison ran %v past its context", elapsed)
+	}
+	if check.Land.EVN.BillingAddressMatchesClient != models.Yes {
+		t.Errorf("match = %q, want the fallback comparison's yes", check.Land.EVN.BillingAddressMatchesClient)
+	}
+}
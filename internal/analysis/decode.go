@@ -0,0 +1,380 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"extraction/internal/models"
+)
+
+// FieldError reports a model value that could not be coerced into the typed extraction
+type FieldError struct {
+	Field string
+	Value interface{}
+	Err   string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s (got %v)", e.Field, e.Err, e.Value)
+}
+
+var (
+	moneyType = reflect.TypeOf(models.MoneyVND(0))
+	timeType  = reflect.TypeOf(time.Time{})
+)
+
+// DecodeExtraction fills a typed extraction struct (e.g. *BusinessLicenseExtraction)
+// from the raw model output. Strings, numbers, money, dates, fixed-size money
+// series and nested object lists are coerced tolerantly; anything that can't
+// be coerced is left unset and reported as a FieldError.
+func DecodeExtraction(data map[string]interface{}, out interface{}) []FieldError {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return []FieldError{{Field: "", Value: out, Err: "decode target must be a pointer to a struct"}}
+	}
+	return decodeStruct(data, rv.Elem(), "")
+}
+
+func decodeStruct(data map[string]interface{}, v reflect.Value, prefix string) []FieldError {
+	var errs []FieldError
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		raw, ok := data[name]
+		if !ok || raw == nil {
+			continue
+		}
+		errs = append(errs, decodeValue(raw, v.Field(i), prefix+name)...)
+	}
+	return errs
+}
+
+func decodeValue(raw interface{}, field reflect.Value, path string) []FieldError {
+	ft := field.Type()
+	switch {
+	case ft.Kind() == reflect.String:
+		s, err := coerceString(raw)
+		if err != nil {
+			return []FieldError{{Field: path, Value: raw, Err: err.Error()}}
+		}
+		field.SetString(s)
+
+	case ft == reflect.PtrTo(moneyType):
+		m, ok, err := coerceMoney(raw)
+		if err != nil {
+			return []FieldError{{Field: path, Value: raw, Err: err.Error()}}
+		}
+		if ok {
+			field.Set(reflect.ValueOf(&m))
+		}
+
+	case ft == reflect.PtrTo(timeType):
+		t, ok, err := coerceDate(raw)
+		if err != nil {
+			return []FieldError{{Field: path, Value: raw, Err: err.Error()}}
+		}
+		if ok {
+			field.Set(reflect.ValueOf(&t))
+		}
+
+	case ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Array && ft.Elem().Elem() == moneyType:
+		items, err := coerceList(raw)
+		if err != nil {
+			return []FieldError{{Field: path, Value: raw, Err: err.Error()}}
+		}
+		n := ft.Elem().Len()
+		if len(items) != n {
+			return []FieldError{{Field: path, Value: raw, Err: fmt.Sprintf("expected %d values, got %d", n, len(items))}}
+		}
+		var errs []FieldError
+		series := reflect.New(ft.Elem())
+		for i, item := range items {
+			m, ok, err := coerceMoney(item)
+			if err != nil {
+				errs = append(errs, FieldError{Field: fmt.Sprintf("%s[%d]", path, i), Value: item, Err: err.Error()})
+				continue
+			}
+			if ok {
+				series.Elem().Index(i).SetInt(int64(m))
+			}
+		}
+		field.Set(series)
+		return errs
+
+	case ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Struct:
+		items, err := coerceList(raw)
+		if err != nil {
+			return []FieldError{{Field: path, Value: raw, Err: err.Error()}}
+		}
+		var errs []FieldError
+		for i, item := range items {
+			obj, ok := item.(map[string]interface{})
+			if !ok {
+				errs = append(errs, FieldError{Field: fmt.Sprintf("%s[%d]", path, i), Value: item, Err: "expected an object"})
+				continue
+			}
+			elem := reflect.New(ft.Elem()).Elem()
+			errs = append(errs, decodeStruct(obj, elem, fmt.Sprintf("%s[%d].", path, i))...)
+			field.Set(reflect.Append(field, elem))
+		}
+		return errs
+
+	default:
+		return []FieldError{{Field: path, Value: raw, Err: fmt.Sprintf("unsupported field type %s", ft)}}
+	}
+	return nil
+}
+
+// coerceString accepts strings, numbers and booleans
+func coerceString(raw interface{}) (string, error) {
+	switch v := raw.(type) {
+	case string:
+		return strings.TrimSpace(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		if v {
+			return "yes", nil
+		}
+		return "no", nil
+	default:
+		return "", fmt.Errorf("expected text, got %T", raw)
+	}
+}
+
+// coerceList accepts a JSON array, or a string holding one
+func coerceList(raw interface{}) ([]interface{}, error) {
+	switch v := raw.(type) {
+	case []interface{}:
+		return v, nil
+	case string:
+		var items []interface{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(v)), &items); err != nil {
+			return nil, fmt.Errorf("expected a list")
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("expected a list, got %T", raw)
+	}
+}
+
+// coerceMoney accepts numbers and numeric text. ok is false when the model
+// explicitly said the value is not available.
+func coerceMoney(raw interface{}) (models.MoneyVND, bool, error) {
+	switch v := raw.(type) {
+	case nil:
+		return 0, false, nil
+	case float64:
+		return models.MoneyVND(math.Round(v)), true, nil
+	case string:
+		return ParseMoneyVND(v)
+	default:
+		return 0, false, fmt.Errorf("expected an amount, got %T", raw)
+	}
+}
+
+// coerceDate accepts ISO and Vietnamese day-first dates. ok is false for
+// placeholders such as "0000-00-00" or "n/a".
+func coerceDate(raw interface{}) (time.Time, bool, error) {
+	s, ok := raw.(string)
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("expected a date, got %T", raw)
+	}
+	return ParseDate(s)
+}
+
+// isNotAvailable reports whether the model used a placeholder meaning "no value"
+func isNotAvailable(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "n/a", "na", "n.a.", "none", "null", "nil", "unknown", "not available", "not found", "-", "--", "không có", "không", "0000-00-00":
+		return true
+	}
+	return false
+}
+
+// Vietnamese and English magnitude words used in amounts like "1,5 tỷ đồng"
+var moneyMultipliers = []struct {
+	words []string
+	value float64
+}{
+	{[]string{"tỷ", "tỉ", "ty", "billion", "bn"}, 1e9},
+	{[]string{"triệu", "trieu", "million", "mn", "tr"}, 1e6},
+	{[]string{"nghìn", "ngàn", "nghin", "ngan", "thousand", "k"}, 1e3},
+}
+
+var moneyNoise = strings.NewReplacer(
+	"vnđ", "", "vnd", "", "đồng", "", "dong", "", "₫", "", "đ", "",
+	"\u00a0", "", "\u202f", "", " ", "", "'", "",
+)
+
+var numericText = regexp.MustCompile(`^[0-9.,]+$`)
+
+// ParseMoneyVND parses an amount in VND written in Vietnamese or English
+// conventions: "1.500.000.000", "1,500,000,000 VND", "1,5 tỷ", "(1.250.000)".
+// A single "." is a decimal point ("1.5" in a column of billions), since
+// models and spreadsheets write decimals that way; "." only separates
+// thousands when it does so more than once or a "," decimal follows.
+// ok is false when the text is a "not available" placeholder.
+func ParseMoneyVND(s string) (models.MoneyVND, bool, error) {
+	if isNotAvailable(s) {
+		return 0, false, nil
+	}
+	text := strings.ToLower(strings.TrimSpace(s))
+
+	negative := false
+	if strings.HasPrefix(text, "(") && strings.HasSuffix(text, ")") {
+		negative = true
+		text = strings.TrimSuffix(strings.TrimPrefix(text, "("), ")")
+	}
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "-") || strings.HasPrefix(text, "−") {
+		negative = true
+		text = strings.TrimLeft(text, "-−")
+	}
+
+	text = strings.TrimSpace(moneyNoise.Replace(text))
+	multiplier := 1.0
+	for _, m := range moneyMultipliers {
+		for _, w := range m.words {
+			if strings.HasSuffix(text, w) {
+				multiplier = m.value
+				text = strings.TrimSuffix(text, w)
+				break
+			}
+		}
+		if multiplier != 1.0 {
+			break
+		}
+	}
+	if text == "" || !numericText.MatchString(text) {
+		return 0, false, fmt.Errorf("not a number: %q", s)
+	}
+
+	value, err := parseLocalizedNumber(text)
+	if err != nil {
+		return 0, false, fmt.Errorf("not a number: %q", s)
+	}
+	value *= multiplier
+	if negative {
+		value = -value
+	}
+	return models.MoneyVND(math.Round(value)), true, nil
+}
+
+// parseLocalizedNumber parses digits with "." or "," used as either the
+// thousands or the decimal separator. A single "." is always the decimal
+// separator; a single "," only when it doesn't split off three digits.
+func parseLocalizedNumber(s string) (float64, error) {
+	dots := strings.Count(s, ".")
+	commas := strings.Count(s, ",")
+	switch {
+	case dots > 0 && commas > 0:
+		// Whichever separator comes last is the decimal separator
+		if strings.LastIndex(s, ".") > strings.LastIndex(s, ",") {
+			s = strings.ReplaceAll(s, ",", "")
+		} else {
+			s = strings.ReplaceAll(s, ".", "")
+			s = strings.ReplaceAll(s, ",", ".")
+		}
+	case dots > 1:
+		if !isThousandsGrouped(s, ".") {
+			return 0, fmt.Errorf("misplaced thousands separators in %q", s)
+		}
+		s = strings.ReplaceAll(s, ".", "")
+	case commas > 1:
+		if !isThousandsGrouped(s, ",") {
+			return 0, fmt.Errorf("misplaced thousands separators in %q", s)
+		}
+		s = strings.ReplaceAll(s, ",", "")
+	case commas == 1:
+		if isThousandsGroup(s, ",") {
+			s = strings.ReplaceAll(s, ",", "")
+		} else {
+			s = strings.ReplaceAll(s, ",", ".")
+		}
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// isThousandsGroup reports whether a single separator splits off a group of exactly three digits
+func isThousandsGroup(s, sep string) bool {
+	return strings.Count(s, sep) == 1 && isThousandsGrouped(s, sep)
+}
+
+// isThousandsGrouped reports whether sep splits s into 1 to 3 leading digits
+// followed by groups of exactly three
+func isThousandsGrouped(s, sep string) bool {
+	parts := strings.Split(s, sep)
+	if len(parts) < 2 || len(parts[0]) < 1 || len(parts[0]) > 3 {
+		return false
+	}
+	for _, part := range parts[1:] {
+		if len(part) != 3 {
+			return false
+		}
+	}
+	return true
+}
+
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006-1-2",
+	"02/01/2006",
+	"2/1/2006",
+	"02-01-2006",
+	"2-1-2006",
+	"02.01.2006",
+	"2006/01/02",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	// Month-first dates are only tried once the day-first layouts failed,
+	// i.e. when the day is over 12
+	"01/02/2006",
+	"1/2/2006",
+}
+
+// "ngày 15 tháng 3 năm 2020"
+var vietnameseDate = regexp.MustCompile(`ngày\s*(\d{1,2})\s*tháng\s*(\d{1,2})\s*năm\s*(\d{4})`)
+
+// "tháng 3 năm 2020", "tháng 03/2020": the first of the month
+var vietnameseMonth = regexp.MustCompile(`tháng\s*(\d{1,2})\s*(?:năm\s*|/\s*)(\d{4})`)
+
+// ParseDate parses ISO and Vietnamese (day-first) dates, and month-first
+// dates that can't be day-first. A month without a day is taken for its
+// first day. ok is false for placeholders such as "0000-00-00".
+func ParseDate(s string) (time.Time, bool, error) {
+	if isNotAvailable(s) {
+		return time.Time{}, false, nil
+	}
+	text := strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t, true, nil
+		}
+	}
+	if m := vietnameseDate.FindStringSubmatch(strings.ToLower(text)); m != nil {
+		day, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[2])
+		year, _ := strconv.Atoi(m[3])
+		if month >= 1 && month <= 12 && day >= 1 && day <= 31 {
+			return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC), true, nil
+		}
+	} else if m := vietnameseMonth.FindStringSubmatch(strings.ToLower(text)); m != nil {
+		month, _ := strconv.Atoi(m[1])
+		year, _ := strconv.Atoi(m[2])
+		if month >= 1 && month <= 12 {
+			return time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC), true, nil
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("unrecognized date %q", s)
+}
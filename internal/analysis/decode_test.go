@@ -0,0 +1,123 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	"extraction/internal/models"
+)
+
+func TestParseMoneyVND(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    models.MoneyVND
+		ok      bool
+		wantErr bool
+	}{
+		{in: "1.500.000", want: 1500000, ok: true},
+		{in: "1,500,000", want: 1500000, ok: true},
+		{in: "1.500.000.000 VNĐ", want: 1500000000, ok: true},
+		{in: "1.500", want: 2, ok: true},     // a single dot is a decimal point
+		{in: "150.123", want: 150, ok: true}, // not 150123
+		{in: "1,500", want: 1500, ok: true},  // a single comma before three digits separates thousands
+		{in: "150,123", want: 150123, ok: true},
+		{in: "1.5", want: 2, ok: true}, // a decimal point, rounded to whole dong
+		{in: "1,5", want: 2, ok: true},
+		{in: "1.234,56", want: 1235, ok: true},
+		{in: "1,234.56", want: 1235, ok: true},
+		{in: "1,5 tỷ", want: 1500000000, ok: true},
+		{in: "1.5 tỷ đồng", want: 1500000000, ok: true},
+		{in: "1.500 tỷ", want: 1500000000, ok: true},
+		{in: "1.500,5 tỷ", want: 1500500000000, ok: true}, // a comma decimal makes the dot a thousands separator
+		{in: "150.123,45", want: 150123, ok: true},
+		{in: "2.500.000", want: 2500000, ok: true},
+		{in: "1.5.00", wantErr: true}, // two dots not grouping thousands
+		{in: "12.34.567", wantErr: true},
+		{in: "1,23,456", wantErr: true},
+		{in: "2 triệu", want: 2000000, ok: true},
+		{in: "250 nghìn", want: 250000, ok: true},
+		{in: "52.350.000 đ", want: 52350000, ok: true},
+		{in: "(1.250.000)", want: -1250000, ok: true},
+		{in: "-1.250.000", want: -1250000, ok: true},
+		{in: "-250.000", want: -250, ok: true}, // one dot group is still a decimal point
+		{in: "0", want: 0, ok: true},
+		{in: "không", ok: false},
+		{in: "Không có", ok: false},
+		{in: "N/A", ok: false},
+		{in: "", ok: false},
+		{in: "khoảng một tỷ", wantErr: true},
+		{in: "1.2.3,4,5x", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, ok, err := ParseMoneyVND(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseMoneyVND(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseMoneyVND(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	date := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		in      string
+		want    time.Time
+		ok      bool
+		wantErr bool
+	}{
+		{in: "2024-03-15", want: date(2024, 3, 15), ok: true},
+		{in: "2024-3-5", want: date(2024, 3, 5), ok: true},
+		{in: "15/03/2024", want: date(2024, 3, 15), ok: true},
+		{in: "03/04/2024", want: date(2024, 4, 3), ok: true}, // ambiguous: day first
+		{in: "3/4/2024", want: date(2024, 4, 3), ok: true},
+		{in: "12/25/2024", want: date(2024, 12, 25), ok: true}, // can only be month first
+		{in: "15-03-2024", want: date(2024, 3, 15), ok: true},
+		{in: "15.03.2024", want: date(2024, 3, 15), ok: true},
+		{in: "2024/03/15", want: date(2024, 3, 15), ok: true},
+		{in: "ngày 15 tháng 3 năm 2024", want: date(2024, 3, 15), ok: true},
+		{in: "Hà Nội, ngày 02 tháng 09 năm 2023", want: date(2023, 9, 2), ok: true},
+		{in: "tháng 3 năm 2024", want: date(2024, 3, 1), ok: true},
+		{in: "Tháng 03/2024", want: date(2024, 3, 1), ok: true},
+		{in: "0000-00-00", ok: false},
+		{in: "không", ok: false},
+		{in: "unknown", ok: false},
+		{in: "ngày 45 tháng 3 năm 2024", wantErr: true},
+		{in: "tháng 13 năm 2024", wantErr: true},
+		{in: "25/13/2024", wantErr: true},
+		{in: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, ok, err := ParseDate(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDate(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !got.Equal(tt.want) || ok != tt.ok {
+			t.Errorf("ParseDate(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestDecodeExtractionNotAvailable(t *testing.T) {
+	// "không" ("none") must leave amounts and dates unset rather than fail or become zero
+	var ext LandCertificateExtraction
+	errs := DecodeExtraction(map[string]interface{}{"situation": "rental_agreement", "lease_expiration_date": "không"}, &ext)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if ext.LeaseExpirationDate != nil {
+		t.Errorf("lease expiration date = %v, want unset", ext.LeaseExpirationDate)
+	}
+
+	var bill EVNBillExtraction
+	errs = DecodeExtraction(map[string]interface{}{"billing_amount": "không"}, &bill)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if bill.BillingAmount != nil {
+		t.Errorf("billing amount = %v, want unset", *bill.BillingAmount)
+	}
+}
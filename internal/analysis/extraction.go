@@ -0,0 +1,81 @@
+package analysis
+
+import (
+	"time"
+
+	"extraction/internal/models"
+)
+
+// Typed extraction results, one per DocumentSource. The json tags match the
+// field names in prompts.go; values are filled by DecodeExtraction, which
+// tolerates the type ambiguity of model output.
+
+// BusinessLicenseExtraction holds the fields extracted from a business license
+type BusinessLicenseExtraction struct {
+	ClientName             string           `json:"client_name"`
+	ClientType             string           `json:"client_type"`
+	TaxCodeMST             string           `json:"tax_code_mst"`
+	BusinessLicenseGPKD    string           `json:"business_license_gpkd"`
+	BusinessAddress        string           `json:"business_address"`
+	RegisteredShareCapital *models.MoneyVND `json:"registered_share_capital"`
+	BusinessOperations     string           `json:"business_operations"`
+	CustomerType           string           `json:"customer_type"`
+	IncorporationDate      *time.Time       `json:"incorporation_date"`
+	OwnersName             string           `json:"owners_name"`
+	OwnershipCategory      string           `json:"ownership_category"`
+	KeyDecisionMaker       string           `json:"key_decision_maker"`
+}
+
+// EVNBillExtraction holds the fields extracted from an EVN electricity bill
+type EVNBillExtraction struct {
+	BillingAddress              string           `json:"billing_address"`
+	BillingAddressMatchesClient string           `json:"billing_address_matches_client"`
+	BillingAmount               *models.MoneyVND `json:"billing_amount"`
+	BilledAmountsMatchExpenses  string           `json:"billed_amounts_match_expenses"`
+}
+
+// LandCertificateExtraction holds the fields extracted from a land certificate or rental agreement
+type LandCertificateExtraction struct {
+	Situation             string     `json:"situation"`
+	LandownerIsSignatory  string     `json:"landowner_is_signatory"`
+	DocumentationComplete string     `json:"documentation_complete"`
+	LeaseExpirationDate   *time.Time `json:"lease_expiration_date"`
+}
+
+// IDCheckExtraction holds the fields extracted from an ID check
+type IDCheckExtraction struct {
+	CompanyDirectorName string `json:"company_director_name"`
+	KeyDecisionMaker    string `json:"key_decision_maker"`
+}
+
+// SiteVisitExtraction holds the fields extracted from site visit photos
+type SiteVisitExtraction struct {
+	CompanySignboard string `json:"company_signboard"`
+}
+
+// FinancialStatementExtraction holds the fields extracted from financial statements.
+// Each series covers the periods 30/06/25, 31/12/24, 30/6/24, 31/12/23, 30/6/23.
+type FinancialStatementExtraction struct {
+	FinancialStatementDate *time.Time          `json:"financial_statement_date"`
+	TotalRevenues          *[5]models.MoneyVND `json:"total_revenues"`
+	TotalCosts             *[5]models.MoneyVND `json:"total_costs"`
+	TotalEnergyCosts       *[5]models.MoneyVND `json:"total_energy_costs"`
+	TotalAssets            *[5]models.MoneyVND `json:"total_assets"`
+	TotalDebt              *[5]models.MoneyVND `json:"total_debt"`
+}
+
+// CICReportExtraction holds the loans extracted from a CIC report
+type CICReportExtraction struct {
+	Loans []CICLoanExtraction `json:"loans"`
+}
+
+// CICLoanExtraction holds one loan/credit facility from a CIC report
+type CICLoanExtraction struct {
+	PaymentHistory     string           `json:"payment_history"`
+	LoanType           string           `json:"loan_type"`
+	DebtClassification string           `json:"debt_classification"`
+	OutstandingAmount  *models.MoneyVND `json:"outstanding_amount"`
+	AnnualInterestCost *models.MoneyVND `json:"annual_interest_cost"`
+	AnnualAmortization *models.MoneyVND `json:"annual_amortization"`
+	Maturity           *time.Time       `json:"maturity"`
+}
@@ -11,24 +11,22 @@ import (
 	"strings"
 	"time"
 	"bytes"
-	"sync"
 )
 
 const (
 	geminiTimeout = 600 * time.Second // Increased to 10 minutes for very slow responses
-	// Free tier allows 2 requests per minute, so we wait 35 seconds between requests to be safe
-	geminiRateLimitDelay = 35 * time.Second
-)
-
-var (
-	lastGeminiRequest time.Time
-	geminiMutex       sync.Mutex
+	// Free tier allows 2 requests per minute; paid tiers can raise this with GEMINI_RPM/GEMINI_TPM
+	geminiDefaultRPM        = 2
+	geminiDefaultMaxRetries = 4
 )
 
 // GeminiClient handles communication with the Google Gemini API
 type GeminiClient struct {
-	apiKey string
-	model  string
+	apiKey   string
+	model    string
+	endpoint string
+	limiter  *RateLimiter
+	retry    retryPolicy
 }
 
 // NewGeminiClient creates a new Gemini client
@@ -44,15 +42,55 @@ func NewGeminiClient() (*GeminiClient, error) {
 		model = "gemini-2.5-pro" // Current model as of 2024
 	}
 
+	// Rate limits and retries (GEMINI_TPM of 0 means no token limit)
+	rpm, err := envInt("GEMINI_RPM", geminiDefaultRPM)
+	if err != nil {
+		return nil, err
+	}
+	tpm, err := envInt("GEMINI_TPM", 0)
+	if err != nil {
+		return nil, err
+	}
+	maxRetries, err := envInt("GEMINI_MAX_RETRIES", geminiDefaultMaxRetries)
+	if err != nil {
+		return nil, err
+	}
+
+	// responseSchema is only available on the v1beta API
+	endpoint := strings.TrimSpace(os.Getenv("GEMINI_API_ENDPOINT"))
+	if endpoint == "" {
+		endpoint = "https://generativelanguage.googleapis.com/v1beta"
+	}
+
 	return &GeminiClient{
-		apiKey: apiKey,
-		model:  model,
+		apiKey:   apiKey,
+		model:    model,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		limiter:  NewRateLimiter(rpm, tpm),
+		retry:    retryPolicy{MaxAttempts: maxRetries + 1, BaseDelay: 5 * time.Second, MaxDelay: 2 * time.Minute},
 	}, nil
 }
 
+// WaitStats returns the time this client has spent rate limited or backing off
+func (c *GeminiClient) WaitStats() WaitStats {
+	return c.limiter.Stats()
+}
+
+// Name returns the provider and model used by this client
+func (c *GeminiClient) Name() string {
+	return ProviderGemini + "/" + c.model
+}
+
 // GeminiRequest represents a request to the Gemini API
 type GeminiRequest struct {
-	Contents []GeminiContent `json:"contents"`
+	Contents         []GeminiContent         `json:"contents"`
+	GenerationConfig *GeminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+// GeminiGenerationConfig asks Gemini for structured JSON output
+type GeminiGenerationConfig struct {
+	ResponseMimeType string        `json:"responseMimeType,omitempty"`
+	ResponseSchema   *GeminiSchema `json:"responseSchema,omitempty"`
 }
 
 // GeminiContent represents content in a Gemini request
@@ -82,37 +120,12 @@ type GeminiResponse struct {
 	} `json:"error"`
 }
 
-// enforceRateLimit ensures we don't exceed Gemini free tier limits
-func enforceRateLimit() {
-	geminiMutex.Lock()
-	defer geminiMutex.Unlock()
-	
-	now := time.Now()
-	timeSinceLastRequest := now.Sub(lastGeminiRequest)
-	
-	if timeSinceLastRequest < geminiRateLimitDelay {
-		sleepDuration := geminiRateLimitDelay - timeSinceLastRequest
-		fmt.Printf("Rate limiting: waiting %v before next Gemini request...\n", sleepDuration.Round(time.Second))
-		time.Sleep(sleepDuration)
-	}
-	
-	lastGeminiRequest = time.Now()
-}
-
-// AnalyzeDocument analyzes a document using Gemini to extract relevant information
+// AnalyzeDocument analyzes a document using Gemini to extract relevant information.
+// Requests are rate limited per client; rate-limit (429), server (5xx) and
+// network errors are retried with jittered backoff up to the configured limit.
 func (c *GeminiClient) AnalyzeDocument(ctx context.Context, text string, source DocumentSource) (map[string]interface{}, error) {
-	return c.analyzeDocumentWithRetry(ctx, text, source, 0)
-}
-
-// analyzeDocumentWithRetry handles the actual analysis with retry logic
-func (c *GeminiClient) analyzeDocumentWithRetry(ctx context.Context, text string, source DocumentSource, retryCount int) (map[string]interface{}, error) {
-	// Enforce rate limiting for free tier
-	enforceRateLimit()
-	
-	prompt := generatePromptForSource(text, source)
-	
 	// Combine system instructions with the user prompt since Gemini doesn't support system role
-	combinedPrompt := "You are an AI assistant that extracts structured information from documents.\n\n" + prompt
+	combinedPrompt := buildAnalysisPrompt(text, source)
 	
 	req := GeminiRequest{
 		Contents: []GeminiContent{
@@ -123,6 +136,11 @@ func (c *GeminiClient) analyzeDocumentWithRetry(ctx context.Context, text string
 				Role: "user",
 			},
 		},
+		// Structured output: the response is guaranteed to be JSON matching the schema
+		GenerationConfig: &GeminiGenerationConfig{
+			ResponseMimeType: "application/json",
+			ResponseSchema:   responseSchemaForSource(source),
+		},
 	}
 
 	body, err := json.Marshal(req)
@@ -130,10 +148,40 @@ func (c *GeminiClient) analyzeDocumentWithRetry(ctx context.Context, text string
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
+	for attempt := 1; ; attempt++ {
+		if err := c.limiter.Wait(ctx, estimateTokens(combinedPrompt)); err != nil {
+			return nil, fmt.Errorf("waiting for rate limit: %w", err)
+		}
+
+		result, err := c.generate(ctx, body, source)
+		var retryable *retryableError
+		if err == nil || !errors.As(err, &retryable) || ctx.Err() != nil {
+			return result, err
+		}
+		if attempt >= c.retry.MaxAttempts {
+			return nil, fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		delay := c.retry.backoff(attempt)
+		if retryable.retryAfter > 0 {
+			// The server told us how long to back off; hold other requests too
+			c.limiter.Pause(retryable.retryAfter)
+			delay = maxDuration(delay, retryable.retryAfter)
+		}
+		fmt.Printf("Gemini request failed (%v), retrying in %v (attempt %d/%d)...\n", err, delay.Round(time.Second), attempt+1, c.retry.MaxAttempts)
+		if err := c.limiter.Backoff(ctx, delay); err != nil {
+			return nil, fmt.Errorf("waiting to retry: %w", err)
+		}
+	}
+}
+
+// generate sends one generateContent request. Failures worth retrying are
+// returned as *retryableError.
+func (c *GeminiClient) generate(ctx context.Context, body []byte, source DocumentSource) (map[string]interface{}, error) {
 	httpCtx, cancel := context.WithTimeout(ctx, geminiTimeout)
 	defer cancel()
 
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1/models/%s:generateContent?key=%s", c.model, c.apiKey)
+	url := fmt.Sprintf("%s/models/%s:generateContent?key=%s", c.endpoint, c.model, c.apiKey)
 	httpReq, err := http.NewRequestWithContext(httpCtx, http.MethodPost, url, bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("build http request: %w", err)
@@ -143,61 +191,21 @@ func (c *GeminiClient) analyzeDocumentWithRetry(ctx context.Context, text string
 	client := &http.Client{Timeout: geminiTimeout}
 	resp, err := client.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("gemini request: %w", err)
+		return nil, &retryableError{err: fmt.Errorf("gemini request: %w", err)}
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		respBody, _ := io.ReadAll(resp.Body)
+		httpErr := fmt.Errorf("gemini http error: %s - %s", resp.Status, string(respBody))
 		
-		// Handle 429 rate limit errors with retry
-		if resp.StatusCode == 429 {
-			// Parse the retry delay from the response
-			var errorResp struct {
-				Error struct {
-					Details []struct {
-						RetryInfo struct {
-							RetryDelay string `json:"retryDelay"`
-						} `json:"retryInfo"`
-					} `json:"details"`
-				} `json:"error"`
-			}
-			
-			if json.Unmarshal(respBody, &errorResp) == nil && len(errorResp.Error.Details) > 0 {
-				if retryDelay := errorResp.Error.Details[0].RetryInfo.RetryDelay; retryDelay != "" {
-					if duration, err := time.ParseDuration(retryDelay); err == nil {
-						fmt.Printf("Rate limit hit, waiting %v before retry...\n", duration)
-						time.Sleep(duration)
-						// Update the last request time to account for the wait
-						geminiMutex.Lock()
-						lastGeminiRequest = time.Now()
-						geminiMutex.Unlock()
-						// Retry the request
-						return c.analyzeDocumentWithRetry(ctx, text, source, retryCount+1)
-					}
-				}
-			}
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			return nil, &retryableError{err: httpErr, retryAfter: geminiRetryDelay(respBody)}
+		case resp.StatusCode >= 500:
+			return nil, &retryableError{err: httpErr}
 		}
-		
-		// Handle 503 Service Unavailable errors with exponential backoff retry
-		if resp.StatusCode == 503 {
-			if retryCount < 3 { // Max 3 retries for 503 errors
-				fmt.Printf("Service unavailable (503), retrying (attempt %d/3)...\n", retryCount+1)
-				// Wait with exponential backoff: 5s, 10s, 20s
-				retryDelay := time.Duration(5*(1<<retryCount)) * time.Second
-				time.Sleep(retryDelay)
-				// Update the last request time to account for the wait
-				geminiMutex.Lock()
-				lastGeminiRequest = time.Now()
-				geminiMutex.Unlock()
-				// Retry the request
-				return c.analyzeDocumentWithRetry(ctx, text, source, retryCount+1)
-			} else {
-				fmt.Printf("Service unavailable (503), max retries exceeded\n")
-			}
-		}
-		
-		return nil, fmt.Errorf("gemini http error: %s - %s", resp.Status, string(respBody))
+		return nil, httpErr
 	}
 
 	var geminiResp GeminiResponse
@@ -217,28 +225,40 @@ func (c *GeminiClient) analyzeDocumentWithRetry(ctx context.Context, text string
 	// Parse the JSON response
 	content := geminiResp.Candidates[0].Content.Parts[0].Text
 	
-	// Extract JSON from the response (it might be wrapped in markdown code blocks)
-	jsonStr := extractJSONFromGemini(content)
-	if jsonStr == "" {
-		return nil, fmt.Errorf("could not extract JSON from response: %s", content)
+	// With structured output the text is plain JSON
+	var result map[string]interface{}
+	if err := json.Unmarshal([]byte(content), &result); err == nil {
+		return result, nil
 	}
+	
+	// Fallback: extract JSON from the response (it might be wrapped in markdown code blocks)
+	fmt.Printf("Gemini returned non-structured output for %s, falling back to JSON extraction\n", source)
+	return parseAnalysisJSON(content)
+}
 
-	// Try to unmarshal as an object first
-	var result map[string]interface{}
-	if err := json.Unmarshal([]byte(jsonStr), &result); err != nil {
-		// If it fails, try to unmarshal as an array and convert to object
-		var arr []interface{}
-		if err := json.Unmarshal([]byte(jsonStr), &arr); err != nil {
-			return nil, fmt.Errorf("unmarshal response: %w", err)
-		}
-		// Convert array to object by using index as key
-		result = make(map[string]interface{})
-		for i, item := range arr {
-			result[fmt.Sprintf("item_%d", i)] = item
+// geminiRetryDelay returns the retry delay Gemini suggests in a 429 response, or 0
+func geminiRetryDelay(respBody []byte) time.Duration {
+	var errorResp struct {
+		Error struct {
+			Details []struct {
+				RetryDelay string `json:"retryDelay"` // google.rpc.RetryInfo
+				RetryInfo  struct {
+					RetryDelay string `json:"retryDelay"`
+				} `json:"retryInfo"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(respBody, &errorResp) != nil {
+		return 0
+	}
+	for _, detail := range errorResp.Error.Details {
+		for _, delay := range []string{detail.RetryDelay, detail.RetryInfo.RetryDelay} {
+			if d, err := time.ParseDuration(delay); err == nil {
+				return d
+			}
 		}
 	}
-
-	return result, nil
+	return 0
 }
 
 // extractJSONFromGemini extracts JSON from a string that might contain markdown
@@ -268,11 +288,27 @@ func extractJSONFromGemini(content string) string {
 		openChar, closeChar = '[', ']'
 	}
 	
+	// Count brackets, ignoring any that appear inside JSON strings
 	openCount := 0
+	inString := false
+	escaped := false
 	for i := start; i < len(content); i++ {
-		if content[i] == openChar {
+		ch := content[i]
+		if inString {
+			if escaped {
+				escaped = false
+			} else if ch == '\\' {
+				escaped = true
+			} else if ch == '"' {
+				inString = false
+			}
+			continue
+		}
+		if ch == '"' {
+			inString = true
+		} else if ch == openChar {
 			openCount++
-		} else if content[i] == closeChar {
+		} else if ch == closeChar {
 			openCount--
 			if openCount == 0 {
 				end = i + 1
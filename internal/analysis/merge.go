@@ -0,0 +1,293 @@
+package analysis
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"extraction/internal/models"
+)
+
+// MergePolicy decides which value to keep when several documents fill the same field
+type MergePolicy string
+
+const (
+	// MergeFirst keeps the value from the earliest document in input order
+	MergeFirst MergePolicy = "first"
+	// MergeLatestDated keeps the value from the document with the latest document date
+	MergeLatestDated MergePolicy = "latest-dated"
+	// MergeHighestConfidence keeps the value the model was most confident about
+	MergeHighestConfidence MergePolicy = "highest-confidence"
+	// MergeRequireAgreement leaves the field empty unless all documents agree
+	MergeRequireAgreement MergePolicy = "require-agreement"
+)
+
+// ParseMergePolicy validates a merge policy name. Empty means MergeFirst.
+func ParseMergePolicy(s string) (MergePolicy, error) {
+	switch p := MergePolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case "":
+		return MergeFirst, nil
+	case MergeFirst, MergeLatestDated, MergeHighestConfidence, MergeRequireAgreement:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown merge policy %q (use first, latest-dated, highest-confidence or require-agreement)", s)
+	}
+}
+
+// Merger collects candidate values per field from every analyzed document and
+// resolves them into a CustomerCheck once all documents are in. It is safe for
+// concurrent use, and the outcome does not depend on the order documents arrive.
+type Merger struct {
+	policy MergePolicy
+
+	mu     sync.Mutex
+	fields map[string][]mergeCandidate
+	loans  []mergeCandidate
+}
+
+type mergeCandidate struct {
+	order      int // input position of the document
+	value      interface{}
+	provenance models.FieldProvenance
+}
+
+// NewMerger creates a merger using the given policy (MergeFirst if empty)
+func NewMerger(policy MergePolicy) *Merger {
+	if policy == "" {
+		policy = MergeFirst
+	}
+	return &Merger{policy: policy, fields: make(map[string][]mergeCandidate)}
+}
+
+// AddDocument records the values extracted from one document. order is the
+// document's position in the input and breaks ties between candidates.
+func (m *Merger) AddDocument(order int, extractedData map[string]interface{}, source DocumentSource, origin models.FieldProvenance) []FieldError {
+	if origin.DocumentDate == nil {
+		origin.DocumentDate = documentDate(extractedData, source)
+	}
+	if origin.Confidence == 0 {
+		origin.Confidence = extractionConfidence(extractedData)
+	}
+
+	// Apply the document to an empty check to find out which fields it fills
+	scratch := &models.CustomerCheck{}
+	errs := UpdateCustomerCheck(scratch, extractedData, source, origin)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for path, value := range scratch.FieldValues() {
+		if strings.HasPrefix(path, "financial.loans[") {
+			continue
+		}
+		m.fields[path] = append(m.fields[path], mergeCandidate{order: order, value: value, provenance: scratch.Provenance[path]})
+	}
+	for i, loan := range scratch.Financial.Loans {
+		m.loans = append(m.loans, mergeCandidate{order: order, value: loan, provenance: scratch.Provenance[fmt.Sprintf("financial.loans[%d]", i)]})
+	}
+	return errs
+}
+
+// Resolve writes the merged values into check, along with their provenance.
+// Fields whose documents disagree are recorded in check.Conflicts; under
+// require-agreement, or when the policy has nothing to rank by, they are left empty.
+// Empty and "unknown" values only count when no document has a real value.
+// Loans are the union of all documents' loans, without duplicates.
+func (m *Merger) Resolve(check *models.CustomerCheck) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	paths := make([]string, 0, len(m.fields))
+	for path := range m.fields {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		candidates := sortedCandidates(withValues(m.fields[path]))
+		if distinctValues(candidates) == 1 {
+			if err := setField(check, path, candidates[0]); err != nil {
+				return err
+			}
+			continue
+		}
+
+		winner, ok := m.choose(candidates)
+		conflict := models.FieldConflict{Field: path, Policy: string(m.policy), Resolved: ok}
+		for _, c := range candidates {
+			conflict.Candidates = append(conflict.Candidates, models.FieldCandidate{Value: c.value, Provenance: c.provenance})
+		}
+		if ok {
+			conflict.Chosen = winner.value
+			if err := setField(check, path, winner); err != nil {
+				return err
+			}
+		}
+		check.Conflicts = append(check.Conflicts, conflict)
+	}
+
+	for _, c := range sortedCandidates(m.loans) {
+		loan := c.value.(models.LoanInfo)
+		duplicate := false
+		for _, existing := range check.Financial.Loans {
+			if reflect.DeepEqual(existing, loan) {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+		check.Financial.Loans = append(check.Financial.Loans, loan)
+		check.SetProvenance(fmt.Sprintf("financial.loans[%d]", len(check.Financial.Loans)-1), c.provenance)
+	}
+	return nil
+}
+
+// choose picks the candidate to keep under the merger's policy. ok is false
+// when the policy can't single out one value.
+func (m *Merger) choose(candidates []mergeCandidate) (mergeCandidate, bool) {
+	switch m.policy {
+	case MergeFirst:
+		return candidates[0], true
+	case MergeLatestDated:
+		return best(candidates, func(c mergeCandidate) (float64, bool) {
+			if c.provenance.DocumentDate == nil {
+				return 0, false
+			}
+			return float64(c.provenance.DocumentDate.Unix()), true
+		})
+	case MergeHighestConfidence:
+		return best(candidates, func(c mergeCandidate) (float64, bool) {
+			return c.provenance.Confidence, c.provenance.Confidence > 0
+		})
+	}
+	return mergeCandidate{}, false
+}
+
+// best returns the highest-scoring candidate. ok is false if no candidate has
+// a score, or if the top score is shared by candidates with different values.
+func best(candidates []mergeCandidate, score func(mergeCandidate) (float64, bool)) (mergeCandidate, bool) {
+	var top []mergeCandidate
+	var topScore float64
+	for _, c := range candidates {
+		s, ok := score(c)
+		if !ok {
+			continue
+		}
+		switch {
+		case len(top) == 0 || s > topScore:
+			top, topScore = []mergeCandidate{c}, s
+		case s == topScore:
+			top = append(top, c)
+		}
+	}
+	if len(top) == 0 || distinctValues(top) > 1 {
+		return mergeCandidate{}, false
+	}
+	return top[0], true
+}
+
+// withValues drops the candidates that only say the document didn't tell
+// (see isNoValue), unless no candidate has more to say
+func withValues(candidates []mergeCandidate) []mergeCandidate {
+	var kept []mergeCandidate
+	for _, c := range candidates {
+		if !isNoValue(c.value) {
+			kept = append(kept, c)
+		}
+	}
+	if len(kept) == 0 {
+		return candidates
+	}
+	return kept
+}
+
+// isNoValue reports whether a field value is empty text or "unknown", which
+// shouldn't compete with, or conflict with, the values of other documents
+func isNoValue(value interface{}) bool {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.String {
+		return false
+	}
+	s := strings.ToLower(strings.TrimSpace(v.String()))
+	return s == "" || s == string(models.Unknown)
+}
+
+func sortedCandidates(candidates []mergeCandidate) []mergeCandidate {
+	sorted := append([]mergeCandidate(nil), candidates...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].order < sorted[j].order })
+	return sorted
+}
+
+func distinctValues(candidates []mergeCandidate) int {
+	var seen []interface{}
+	for _, c := range candidates {
+		found := false
+		for _, v := range seen {
+			if reflect.DeepEqual(v, c.value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			seen = append(seen, c.value)
+		}
+	}
+	return len(seen)
+}
+
+func setField(check *models.CustomerCheck, path string, c mergeCandidate) error {
+	if err := check.SetFieldValue(path, c.value); err != nil {
+		return err
+	}
+	check.SetProvenance(path, c.provenance)
+	return nil
+}
+
+// documentDate returns the date the document was issued, if the model reported one.
+// Financial statements fall back to the date the results are as of.
+func documentDate(data map[string]interface{}, source DocumentSource) *time.Time {
+	keys := []string{"document_date"}
+	if source == SourceFinancialStatement {
+		keys = append(keys, "financial_statement_date")
+	}
+	for _, key := range keys {
+		s, ok := data[key].(string)
+		if !ok {
+			continue
+		}
+		if t, ok, err := ParseDate(s); ok && err == nil {
+			return &t
+		}
+	}
+	return nil
+}
+
+// extractionConfidence returns the model's self-reported confidence in [0, 1], or 0 if missing.
+// Percentages such as 85 or "85%" are scaled down.
+func extractionConfidence(data map[string]interface{}) float64 {
+	var c float64
+	switch v := data["extraction_confidence"].(type) {
+	case float64:
+		c = v
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(v), "%"), 64)
+		if err != nil {
+			return 0
+		}
+		c = f
+	default:
+		return 0
+	}
+	if c > 1 && c <= 100 {
+		c /= 100
+	}
+	if c < 0 || c > 1 {
+		return 0
+	}
+	return c
+}
@@ -0,0 +1,76 @@
+package analysis
+
+import (
+	"testing"
+
+	"extraction/internal/models"
+)
+
+func TestMergerIgnoresUnknownSituation(t *testing.T) {
+	for _, policy := range []MergePolicy{MergeFirst, MergeLatestDated, MergeHighestConfidence, MergeRequireAgreement} {
+		m := NewMerger(policy)
+		m.AddDocument(0, map[string]interface{}{"situation": "unknown", "document_date": "2024-01-01", "extraction_confidence": 0.9}, SourceLandCertificate, models.FieldProvenance{FileName: "a.pdf"})
+		m.AddDocument(1, map[string]interface{}{"situation": "rental_agreement", "document_date": "2023-01-01", "extraction_confidence": 0.5}, SourceLandCertificate, models.FieldProvenance{FileName: "b.pdf"})
+		m.AddDocument(2, map[string]interface{}{"situation": ""}, SourceLandCertificate, models.FieldProvenance{FileName: "c.pdf"})
+
+		var check models.CustomerCheck
+		if err := m.Resolve(&check); err != nil {
+			t.Fatal(err)
+		}
+		if check.Land.Ownership.Situation != models.RentalAgreement {
+			t.Errorf("%s: situation = %q, want %q", policy, check.Land.Ownership.Situation, models.RentalAgreement)
+		}
+		if len(check.Conflicts) > 0 {
+			t.Errorf("%s: unexpected conflicts %+v", policy, check.Conflicts)
+		}
+		if p, _ := check.ProvenanceFor("land.ownership.situation"); p.FileName != "b.pdf" {
+			t.Errorf("%s: situation taken from %q, want b.pdf", policy, p.FileName)
+		}
+	}
+}
+
+func TestMergerKeepsUnknownWithoutBetterValue(t *testing.T) {
+	m := NewMerger(MergeRequireAgreement)
+	m.AddDocument(0, map[string]interface{}{"situation": "unknown"}, SourceLandCertificate, models.FieldProvenance{})
+	m.AddDocument(1, map[string]interface{}{"situation": "Unknown"}, SourceLandCertificate, models.FieldProvenance{})
+
+	var check models.CustomerCheck
+	if err := m.Resolve(&check); err != nil {
+		t.Fatal(err)
+	}
+	if check.Land.Ownership.Situation != models.Unknown {
+		t.Errorf("situation = %q, want %q", check.Land.Ownership.Situation, models.Unknown)
+	}
+}
+
+func TestMergerConflict(t *testing.T) {
+	m := NewMerger(MergeRequireAgreement)
+	m.AddDocument(0, map[string]interface{}{"situation": "land_owner"}, SourceLandCertificate, models.FieldProvenance{})
+	m.AddDocument(1, map[string]interface{}{"situation": "rental_agreement"}, SourceLandCertificate, models.FieldProvenance{})
+
+	var check models.CustomerCheck
+	if err := m.Resolve(&check); err != nil {
+		t.Fatal(err)
+	}
+	if check.Land.Ownership.Situation != "" {
+		t.Errorf("situation = %q, want it left empty", check.Land.Ownership.Situation)
+	}
+	if len(check.Conflicts) != 1 || check.Conflicts[0].Resolved {
+		t.Errorf("conflicts = %+v, want one unresolved", check.Conflicts)
+	}
+}
+
+func TestFieldsForAddsMetadata(t *testing.T) {
+	own := len(sourceFields[SourceEVNBill])
+	for i := 0; i < 2; i++ {
+		if got := len(fieldsFor(SourceEVNBill)); got != own+len(documentMetadataFields) {
+			t.Fatalf("fieldsFor(evn_bill) has %d fields, want %d", got, own+len(documentMetadataFields))
+		}
+	}
+	if got := len(fieldsFor(sourceClassification)); got != len(sourceFields[sourceClassification]) {
+		t.Errorf("classification prompt has %d fields, want no metadata fields", got)
+	}
+	if fieldsFor("no_such_source") != nil {
+		t.Errorf("fieldsFor of an unknown source should be nil")
+	}
+}
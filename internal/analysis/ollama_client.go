@@ -0,0 +1,118 @@
+package analysis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Local models are slow on CPU-only servers, so allow plenty of time
+const ollamaTimeout = 900 * time.Second
+
+// OllamaClient talks to a local Ollama server so documents never leave the network
+type OllamaClient struct {
+	host  string
+	model string
+}
+
+// NewOllamaClient creates a new Ollama client.
+// Configured via OLLAMA_HOST (default http://localhost:11434) and OLLAMA_MODEL.
+func NewOllamaClient() (*OllamaClient, error) {
+	host := strings.TrimSpace(os.Getenv("OLLAMA_HOST"))
+	if host == "" {
+		host = "http://localhost:11434"
+	}
+	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+		host = "http://" + host
+	}
+
+	model := strings.TrimSpace(os.Getenv("OLLAMA_MODEL"))
+	if model == "" {
+		model = "llama3.1"
+	}
+
+	return &OllamaClient{
+		host:  strings.TrimRight(host, "/"),
+		model: model,
+	}, nil
+}
+
+// Name returns the provider and model used by this client
+func (c *OllamaClient) Name() string {
+	return ProviderOllama + "/" + c.model
+}
+
+// ollamaChatRequest represents a request to Ollama's /api/chat endpoint
+type ollamaChatRequest struct {
+	Model    string              `json:"model"`
+	Messages []openAIChatMessage `json:"messages"`
+	Stream   bool                `json:"stream"`
+	Format   string              `json:"format,omitempty"`
+	Options  map[string]any      `json:"options,omitempty"`
+}
+
+// ollamaChatResponse represents a non-streaming response from /api/chat
+type ollamaChatResponse struct {
+	Message openAIChatMessage `json:"message"`
+	Error   string            `json:"error"`
+}
+
+// AnalyzeDocument analyzes a document using the local Ollama model
+func (c *OllamaClient) AnalyzeDocument(ctx context.Context, text string, source DocumentSource) (map[string]interface{}, error) {
+	req := ollamaChatRequest{
+		Model: c.model,
+		Messages: []openAIChatMessage{
+			{Role: "system", Content: systemInstruction},
+			{Role: "user", Content: generatePromptForSource(text, source)},
+		},
+		Stream:  false,
+		Format:  "json",
+		Options: map[string]any{"temperature": 0},
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	httpCtx, cancel := context.WithTimeout(ctx, ollamaTimeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(httpCtx, http.MethodPost, c.host+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("build http request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: ollamaTimeout}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("ollama request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("ollama http error: %s - %s", resp.Status, string(respBody))
+	}
+
+	var chatResp ollamaChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	if chatResp.Error != "" {
+		return nil, fmt.Errorf("ollama error: %s", chatResp.Error)
+	}
+	if chatResp.Message.Content == "" {
+		return nil, errors.New("ollama: empty response")
+	}
+
+	return parseAnalysisJSON(chatResp.Message.Content)
+}
@@ -0,0 +1,159 @@
+package analysis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const openAITimeout = 600 * time.Second
+
+// OpenAIClient talks to any OpenAI-compatible chat-completions endpoint
+// (OpenAI, Azure-style gateways, vLLM, llama.cpp server, ...)
+type OpenAIClient struct {
+	provider string
+	baseURL  string
+	apiKey   string
+	model    string
+}
+
+// NewOpenAIClient creates a client for the OpenAI chat-completions API.
+// Configured via OPENAI_API_KEY, OPENAI_BASE_URL and OPENAI_MODEL.
+func NewOpenAIClient() (*OpenAIClient, error) {
+	apiKey := strings.TrimSpace(os.Getenv("OPENAI_API_KEY"))
+	baseURL := strings.TrimSpace(os.Getenv("OPENAI_BASE_URL"))
+	if baseURL == "" {
+		baseURL = "https://api.openai.com/v1"
+	}
+	// A key is only mandatory against the public API; self-hosted gateways often run without one
+	if apiKey == "" && strings.Contains(baseURL, "api.openai.com") {
+		return nil, errors.New("OPENAI_API_KEY is not set; set it in your environment or .env")
+	}
+
+	model := strings.TrimSpace(os.Getenv("OPENAI_MODEL"))
+	if model == "" {
+		model = "gpt-4o-mini"
+	}
+
+	return &OpenAIClient{
+		provider: ProviderOpenAI,
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		apiKey:   apiKey,
+		model:    model,
+	}, nil
+}
+
+// NewLlamaCppClient creates a client for a local llama.cpp server, which
+// exposes an OpenAI-compatible API. Configured via LLAMACPP_URL and LLAMACPP_MODEL.
+func NewLlamaCppClient() (*OpenAIClient, error) {
+	baseURL := strings.TrimSpace(os.Getenv("LLAMACPP_URL"))
+	if baseURL == "" {
+		baseURL = "http://localhost:8080/v1"
+	}
+	model := strings.TrimSpace(os.Getenv("LLAMACPP_MODEL"))
+	if model == "" {
+		model = "local"
+	}
+
+	return &OpenAIClient{
+		provider: ProviderLlamaCpp,
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		apiKey:   strings.TrimSpace(os.Getenv("LLAMACPP_API_KEY")),
+		model:    model,
+	}, nil
+}
+
+// Name returns the provider and model used by this client
+func (c *OpenAIClient) Name() string {
+	return c.provider + "/" + c.model
+}
+
+// openAIChatRequest represents a chat-completions request
+type openAIChatRequest struct {
+	Model          string              `json:"model"`
+	Messages       []openAIChatMessage `json:"messages"`
+	Temperature    float64             `json:"temperature"`
+	ResponseFormat *openAIFormat       `json:"response_format,omitempty"`
+}
+
+type openAIChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIFormat struct {
+	Type string `json:"type"`
+}
+
+// openAIChatResponse represents a chat-completions response
+type openAIChatResponse struct {
+	Choices []struct {
+		Message openAIChatMessage `json:"message"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+// AnalyzeDocument analyzes a document using the chat-completions endpoint
+func (c *OpenAIClient) AnalyzeDocument(ctx context.Context, text string, source DocumentSource) (map[string]interface{}, error) {
+	req := openAIChatRequest{
+		Model: c.model,
+		Messages: []openAIChatMessage{
+			{Role: "system", Content: systemInstruction},
+			{Role: "user", Content: generatePromptForSource(text, source)},
+		},
+		Temperature:    0,
+		ResponseFormat: &openAIFormat{Type: "json_object"},
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	httpCtx, cancel := context.WithTimeout(ctx, openAITimeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(httpCtx, http.MethodPost, c.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("build http request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	client := &http.Client{Timeout: openAITimeout}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("%s request: %w", c.provider, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%s http error: %s - %s", c.provider, resp.Status, string(respBody))
+	}
+
+	var chatResp openAIChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	if chatResp.Error != nil && chatResp.Error.Message != "" {
+		return nil, fmt.Errorf("%s error: %s", c.provider, chatResp.Error.Message)
+	}
+	if len(chatResp.Choices) == 0 || chatResp.Choices[0].Message.Content == "" {
+		return nil, fmt.Errorf("%s: empty response", c.provider)
+	}
+
+	return parseAnalysisJSON(chatResp.Choices[0].Message.Content)
+}
@@ -2,29 +2,169 @@ package analysis
 
 import (
 	"fmt"
+	"strings"
 )
 
+// fieldType is the JSON type the model must return for a prompt field
+type fieldType int
+
+const (
+	fieldString fieldType = iota
+	fieldNumber
+	fieldNumberArray
+	fieldObjectArray
+)
+
+// promptField describes one field the model must return for a document source.
+// The same list drives the JSON block in the prompt and the structured-output schema.
+type promptField struct {
+	Name        string
+	Type        fieldType
+	Description string
+	Enum        []string      // allowed values for classification fields
+	Items       []promptField // object fields for fieldObjectArray
+}
+
+// sourceFields lists the fields extracted for each document source, without
+// the documentMetadataFields every document is also asked for (see fieldsFor)
+var sourceFields = map[DocumentSource][]promptField{
+	SourceBusinessLicense: {
+		{Name: "client_name", Type: fieldString, Description: "The name of the business entity"},
+		{Name: "client_type", Type: fieldString, Description: "Classify as either 'corporate_entity' or 'private_individual' using the rules below", Enum: []string{"corporate_entity", "private_individual"}},
+		{Name: "tax_code_mst", Type: fieldString, Description: "The tax code or business registration number"},
+		{Name: "business_license_gpkd", Type: fieldString, Description: "Whether a business license exists (yes/no/na)", Enum: []string{"yes", "no", "na"}},
+		{Name: "business_address", Type: fieldString, Description: "The registered business address"},
+		{Name: "registered_share_capital", Type: fieldNumber, Description: "The registered share capital amount in VND (numeric value only)"},
+		{Name: "business_operations", Type: fieldString, Description: "Description of the business operations"},
+		{Name: "customer_type", Type: fieldString, Description: "Classify the company's business sector using web search if needed. Choose from: manufacturing_production, trading_commercial, construction_real_estate, services, agriculture_forestry_fishery, technology_it_software, energy_utilities, finance_insurance_banking, healthcare_pharmaceuticals, media_entertainment, or na_private_individual", Enum: []string{"manufacturing_production", "trading_commercial", "construction_real_estate", "services", "agriculture_forestry_fishery", "technology_it_software", "energy_utilities", "finance_insurance_banking", "healthcare_pharmaceuticals", "media_entertainment", "na_private_individual"}},
+		{Name: "incorporation_date", Type: fieldString, Description: "The date of incorporation in YYYY-MM-DD format"},
+		{Name: "owners_name", Type: fieldString, Description: "The name of the primary owner or major shareholder"},
+		{Name: "ownership_category", Type: fieldString, Description: "Ownership percentage category (100, gt_50, lt_50, or na)", Enum: []string{"100", "gt_50", "lt_50", "na"}},
+		{Name: "key_decision_maker", Type: fieldString, Description: "The name of the person with the largest ownership percentage in the company (extract from ownership/shareholder information in the business license)"},
+	},
+	SourceEVNBill: {
+		{Name: "billing_address", Type: fieldString, Description: "The address on the EVN bill"},
+		{Name: "billing_address_matches_client", Type: fieldString, Description: "Whether the billing address matches the client's business address (yes/no). Compare the billing address on the EVN bill with the business address from the business license. Consider them a match if they are the same or very similar. BE GENEROUS in matching - minor differences in formatting, abbreviations, punctuation, word order, or common variations should be ignored and treated as a MATCH.", Enum: []string{"yes", "no"}},
+		{Name: "billing_amount", Type: fieldNumber, Description: "The billing amount in VND (numeric value only)"},
+		{Name: "billed_amounts_match_expenses", Type: fieldString, Description: "Compare the billed amounts in the uploaded electricity invoices with expense-related figures in the financial statement (cost of goods sold, administrative expenses, operating expenses, or payments to suppliers). Use approximate matching: consider a match if the difference is within ±5% or if the amounts are the same when rounded to the nearest million VND. For each invoice, return Yes if a match is found (and show the closest number), otherwise return No."},
+	},
+	SourceLandCertificate: {
+		{Name: "situation", Type: fieldString, Description: "Land ownership situation (land_owner, rental_agreement, or unknown)", Enum: []string{"land_owner", "rental_agreement", "unknown"}},
+		{Name: "landowner_is_signatory", Type: fieldString, Description: "Whether the landowner/tenant is the contract signatory (yes/no)", Enum: []string{"yes", "no"}},
+		{Name: "documentation_complete", Type: fieldString, Description: "Whether the ownership documentation is complete (yes/no) (only if situation is land_owner)", Enum: []string{"yes", "no"}},
+		{Name: "lease_expiration_date", Type: fieldString, Description: "The expiration date of the lease in YYYY-MM-DD format (only if situation is rental_agreement)"},
+	},
+	SourceIDCheck: {
+		{Name: "company_director_name", Type: fieldString, Description: "The name of the company director"},
+		{Name: "key_decision_maker", Type: fieldString, Description: "The name of the key decision maker"},
+	},
+	SourceSiteVisitPhotos: {
+		{Name: "company_signboard", Type: fieldString, Description: "Status of the company signboard (available_matches_client_info, available_does_not_match_client_info, or not_available_or_not_checked)", Enum: []string{"available_matches_client_info", "available_does_not_match_client_info", "not_available_or_not_checked"}},
+	},
+	SourceFinancialStatement: {
+		{Name: "financial_statement_date", Type: fieldString, Description: "Date of the financial statements in YYYY-MM-DD format (the date the financial results are as of)"},
+		{Name: "total_revenues", Type: fieldNumberArray, Description: "Array of 5 numbers for total revenues in VND: [30/06/25, 31/12/24, 30/6/24, 31/12/23, 30/6/23]"},
+		{Name: "total_costs", Type: fieldNumberArray, Description: "Array of 5 numbers for total costs in VND: [30/06/25, 31/12/24, 30/6/24, 31/12/23, 30/6/23]"},
+		{Name: "total_energy_costs", Type: fieldNumberArray, Description: "Array of 5 numbers for total energy costs in VND: [30/06/25, 31/12/24, 30/6/24, 31/12/23, 30/6/23] (should match EVN Bill amounts)"},
+		{Name: "total_assets", Type: fieldNumberArray, Description: "Array of 5 numbers for total assets in VND: [30/06/25, 31/12/24, 30/6/24, 31/12/23, 30/6/23]"},
+		{Name: "total_debt", Type: fieldNumberArray, Description: "Array of 5 numbers for total debt in VND: [30/06/25, 31/12/24, 30/6/24, 31/12/23, 30/6/23]"},
+	},
+	SourceCICReport: {
+		{Name: "loans", Type: fieldObjectArray, Description: "All loans/credit facilities found in the document", Items: []promptField{
+			{Name: "payment_history", Type: fieldString, Description: "Description of payment history and repayment behavior that could impact approval decisions"},
+			{Name: "loan_type", Type: fieldString, Description: "Type of loan/credit facility (short_term_loan, medium_term_loan, long_term_loan, credit_card, overdrafts, guarantee, financial_leasing, factoring, consumer_loan, other_credit_facility)", Enum: []string{"short_term_loan", "medium_term_loan", "long_term_loan", "credit_card", "overdrafts", "guarantee", "financial_leasing", "factoring", "consumer_loan", "other_credit_facility"}},
+			{Name: "debt_classification", Type: fieldString, Description: "Debt classification group (group_1_current_debt, group_2_special_mention_debt, group_3_substandard_debt, group_4_doubtful_debt, group_5_loss_debt)", Enum: []string{"group_1_current_debt", "group_2_special_mention_debt", "group_3_substandard_debt", "group_4_doubtful_debt", "group_5_loss_debt"}},
+			{Name: "outstanding_amount", Type: fieldNumber, Description: "Outstanding loan amount in VND (numeric value only)"},
+			{Name: "annual_interest_cost", Type: fieldNumber, Description: "Annual interest cost in VND (numeric value only)"},
+			{Name: "annual_amortization", Type: fieldNumber, Description: "Annual amortization amount in VND (numeric value only)"},
+			{Name: "maturity", Type: fieldString, Description: "Loan maturity date in YYYY-MM-DD format"},
+		}},
+	},
+	sourceAddressComparison: {
+		{Name: "addresses_match", Type: fieldString, Description: "Whether the two addresses refer to the same location (yes/no)", Enum: []string{"yes", "no"}},
+	},
+	sourceClassification: {
+		{Name: "document_type", Type: fieldString, Description: "The document type", Enum: []string{"business_license", "evn_bill", "land_certificate", "id_check", "financial_statement", "site_visit_photos", "cic_report", "unknown"}},
+		{Name: "confidence", Type: fieldNumber, Description: "Your confidence in the document type, from 0 to 1"},
+	},
+	sourceSegmentation: {
+		{Name: "segments", Type: fieldObjectArray, Description: "The documents in page order", Items: []promptField{
+			{Name: "page_start", Type: fieldNumber, Description: "First page of the document"},
+			{Name: "page_end", Type: fieldNumber, Description: "Last page of the document"},
+			{Name: "document_type", Type: fieldString, Description: "The document type", Enum: []string{"business_license", "evn_bill", "land_certificate", "id_check", "financial_statement", "site_visit_photos", "cic_report", "unknown"}},
+			{Name: "confidence", Type: fieldNumber, Description: "Your confidence in the document type, from 0 to 1"},
+		}},
+	},
+}
+
+// documentMetadataFields are requested for every document so that conflicting
+// values from several documents can be ranked by date or confidence
+var documentMetadataFields = []promptField{
+	{Name: "document_date", Type: fieldString, Description: "The issue or signing date of this document in YYYY-MM-DD format"},
+	{Name: "extraction_confidence", Type: fieldNumber, Description: "Your confidence that the extracted values are correct, from 0 to 1"},
+}
+
+// fieldsFor returns the fields requested for a source: its own fields,
+// followed by documentMetadataFields unless the source is one of the internal
+// address comparison, classification and segmentation prompts. It returns nil
+// for sources without a field list.
+func fieldsFor(source DocumentSource) []promptField {
+	own, ok := sourceFields[source]
+	if !ok {
+		return nil
+	}
+	fields := append([]promptField(nil), own...)
+	if source == sourceAddressComparison || source == sourceClassification || source == sourceSegmentation {
+		return fields
+	}
+	return append(fields, documentMetadataFields...)
+}
+
+// renderPromptFields renders the field list as the JSON template shown to the model
+func renderPromptFields(fields []promptField) string {
+	var b strings.Builder
+	writePromptFields(&b, fields, "")
+	return b.String()
+}
+
+func writePromptFields(b *strings.Builder, fields []promptField, indent string) {
+	b.WriteString("{\n")
+	for i, f := range fields {
+		b.WriteString(indent + "  \"" + f.Name + "\": ")
+		if f.Type == fieldObjectArray {
+			b.WriteString("[\n" + indent + "    ")
+			writePromptFields(b, f.Items, indent+"    ")
+			b.WriteString("\n" + indent + "  ]")
+		} else {
+			b.WriteString("\"" + f.Description + "\"")
+		}
+		if i < len(fields)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(indent + "}")
+}
+
 // generatePromptForSource creates a specific prompt based on the document source
 func generatePromptForSource(text string, source DocumentSource) string {
+	// Address comparison prompts are complete on their own
+	if source == sourceAddressComparison {
+		return text + "\n\nReturn the answer in JSON format:\n" + renderPromptFields(fieldsFor(sourceAddressComparison))
+	}
+	if source == sourceClassification {
+		return classificationPrompt(text)
+	}
+	if source == sourceSegmentation {
+		return segmentationPrompt(text)
+	}
+
 	basePrompt := fmt.Sprintf("Please analyze the following document text and extract the relevant information in JSON format. The document is a %s.\n\nDocument text:\n%s\n\n", source, text)
 
 	switch source {
 	case SourceBusinessLicense:
 		return basePrompt + `Please extract the following fields in JSON format:
-{
-  "client_name": "The name of the business entity",
-  "client_type": "Classify as either 'corporate_entity' or 'private_individual' using the rules below",
-  "tax_code_mst": "The tax code or business registration number",
-  "business_license_gpkd": "Whether a business license exists (yes/no/na)",
-  "business_address": "The registered business address",
-  "registered_share_capital": "The registered share capital amount in VND (numeric value only)",
-  "business_operations": "Description of the business operations",
-  "customer_type": "Classify the company's business sector using web search if needed. Choose from: manufacturing_production, trading_commercial, construction_real_estate, services, agriculture_forestry_fishery, technology_it_software, energy_utilities, finance_insurance_banking, healthcare_pharmaceuticals, media_entertainment, or na_private_individual",
-  "incorporation_date": "The date of incorporation in YYYY-MM-DD format",
-  "owners_name": "The name of the primary owner or major shareholder",
-  "ownership_category": "Ownership percentage category (100, gt_50, lt_50, or na)",
-  "key_decision_maker": "The name of the person with the largest ownership percentage in the company (extract from ownership/shareholder information in the business license)"
-}
+` + renderPromptFields(fieldsFor(SourceBusinessLicense)) + `
 
 IMPORTANT: For client_type classification, you are a strict classifier. Using ONLY the text from the business license (no web lookups), output one value for client_type:
 - "corporate_entity"
@@ -86,12 +226,7 @@ Extract the full name of this person from the business license document.`
 
 	case SourceEVNBill:
 		return basePrompt + `Please extract the following fields in JSON format:
-{
-  "billing_address": "The address on the EVN bill",
-  "billing_address_matches_client": "Whether the billing address matches the client's business address (yes/no). Compare the billing address on the EVN bill with the business address from the business license. Consider them a match if they are the same or very similar. BE GENEROUS in matching - minor differences in formatting, abbreviations, punctuation, word order, or common variations should be ignored and treated as a MATCH.",
-  "billing_amount": "The billing amount in VND (numeric value only)",
-  "billed_amounts_match_expenses": "Compare the billed amounts in the uploaded electricity invoices with expense-related figures in the financial statement (cost of goods sold, administrative expenses, operating expenses, or payments to suppliers). Use approximate matching: consider a match if the difference is within ±5% or if the amounts are the same when rounded to the nearest million VND. For each invoice, return Yes if a match is found (and show the closest number), otherwise return No."
-}
+` + renderPromptFields(fieldsFor(SourceEVNBill)) + `
 
 ADDRESS MATCHING RULES - BE GENEROUS:
 - Consider addresses a MATCH ("yes") if they refer to the same location, even with:
@@ -126,12 +261,7 @@ This field helps verify that the EVN bill expenses are properly recorded in the
 
 	case SourceLandCertificate:
 		return basePrompt + `Please extract the following fields in JSON format:
-{
-  "situation": "Land ownership situation (land_owner, rental_agreement, or unknown)",
-  "landowner_is_signatory": "Whether the landowner/tenant is the contract signatory (yes/no)",
-  "documentation_complete": "Whether the ownership documentation is complete (yes/no) (only if situation is land_owner)",
-  "lease_expiration_date": "The expiration date of the lease in YYYY-MM-DD format (only if situation is rental_agreement)"
-}
+` + renderPromptFields(fieldsFor(SourceLandCertificate)) + `
 
 CRITICAL REQUIREMENTS:
 1. You MUST provide a value for EVERY field. Do not leave any field empty.
@@ -183,16 +313,11 @@ Input: "Biên bản bàn giao" -> unknown`
 
 	case SourceIDCheck:
 		return basePrompt + `Please extract the following fields in JSON format:
-{
-  "company_director_name": "The name of the company director",
-  "key_decision_maker": "The name of the key decision maker"
-}`
+` + renderPromptFields(fieldsFor(SourceIDCheck))
 
 	case SourceSiteVisitPhotos:
 		return basePrompt + `Please extract the following fields in JSON format:
-{
-  "company_signboard": "Status of the company signboard (available_matches_client_info, available_does_not_match_client_info, or not_available_or_not_checked)"
-}
+` + renderPromptFields(fieldsFor(SourceSiteVisitPhotos)) + `
 
 IMPORTANT: For company_signboard classification, analyze the signboard visible in the site visit photos and compare it with the client name from the business license. Output one of these values:
 
@@ -209,14 +334,7 @@ Guidelines:
 
 	case SourceFinancialStatement:
 		return basePrompt + `Please extract the following fields in JSON format:
-{
-  "financial_statement_date": "Date of the financial statements in YYYY-MM-DD format (the date the financial results are as of)",
-  "total_revenues": "Array of 5 numbers for total revenues in VND: [30/06/25, 31/12/24, 30/6/24, 31/12/23, 30/6/23]",
-  "total_costs": "Array of 5 numbers for total costs in VND: [30/06/25, 31/12/24, 30/6/24, 31/12/23, 30/6/23]",
-  "total_energy_costs": "Array of 5 numbers for total energy costs in VND: [30/06/25, 31/12/24, 30/6/24, 31/12/23, 30/6/23] (should match EVN Bill amounts)",
-  "total_assets": "Array of 5 numbers for total assets in VND: [30/06/25, 31/12/24, 30/6/24, 31/12/23, 30/6/23]",
-  "total_debt": "Array of 5 numbers for total debt in VND: [30/06/25, 31/12/24, 30/6/24, 31/12/23, 30/6/23]"
-}
+` + renderPromptFields(fieldsFor(SourceFinancialStatement)) + `
 
 IMPORTANT: 
 1. Extract financial data for the 5 specified periods in chronological order (most recent first)
@@ -229,19 +347,7 @@ IMPORTANT:
 		return basePrompt + `Please extract loan information from this CIC report. The document may contain multiple loans/credit facilities. Extract ALL loans found and return them as an array.
 
 Return in JSON format:
-{
-  "loans": [
-    {
-      "payment_history": "Description of payment history and repayment behavior that could impact approval decisions",
-      "loan_type": "Type of loan/credit facility (short_term_loan, medium_term_loan, long_term_loan, credit_card, overdrafts, guarantee, financial_leasing, factoring, consumer_loan, other_credit_facility)",
-      "debt_classification": "Debt classification group (group_1_current_debt, group_2_special_mention_debt, group_3_substandard_debt, group_4_doubtful_debt, group_5_loss_debt)",
-      "outstanding_amount": "Outstanding loan amount in VND (numeric value only)",
-      "annual_interest_cost": "Annual interest cost in VND (numeric value only)",
-      "annual_amortization": "Annual amortization amount in VND (numeric value only)",
-      "maturity": "Loan maturity date in YYYY-MM-DD format"
-    }
-  ]
-}
+` + renderPromptFields(fieldsFor(SourceCICReport)) + `
 
 CRITICAL REQUIREMENTS FOR MULTIPLE LOAN EXTRACTION:
 1. You MUST extract ALL loans/credit facilities found in the document
@@ -0,0 +1,208 @@
+package analysis
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// WaitStats reports how much time an LLM client spent waiting instead of working
+type WaitStats struct {
+	Requests      int           // requests let through by the rate limiter
+	RateLimitWait time.Duration // time spent waiting for rate-limit capacity
+	RetryWait     time.Duration // time spent backing off before retries
+	Retries       int
+}
+
+// RateLimiter is a token bucket limiting both requests per minute and
+// tokens per minute. Waits honour context cancellation.
+type RateLimiter struct {
+	mu    sync.Mutex
+	clock clock
+
+	rpm, tpm    float64
+	requests    float64 // available request capacity
+	tokens      float64 // available token capacity
+	last        time.Time
+	pausedUntil time.Time
+	stats       WaitStats
+}
+
+// NewRateLimiter creates a limiter allowing rpm requests and tpm tokens per
+// minute. Zero or negative values disable the corresponding limit. Requests
+// are spread evenly over the minute rather than allowed in a burst.
+func NewRateLimiter(rpm, tpm int) *RateLimiter {
+	return newRateLimiter(rpm, tpm, realClock{})
+}
+
+func newRateLimiter(rpm, tpm int, clock clock) *RateLimiter {
+	return &RateLimiter{
+		clock:    clock,
+		rpm:      float64(rpm),
+		tpm:      float64(tpm),
+		requests: 1,
+		tokens:   float64(tpm),
+		last:     clock.Now(),
+	}
+}
+
+// Wait blocks until a request of the given estimated token count may be sent
+func (l *RateLimiter) Wait(ctx context.Context, tokens int) error {
+	start := l.clock.Now()
+	for {
+		l.mu.Lock()
+		now := l.clock.Now()
+		l.refill(now)
+		delay := l.delayFor(now, float64(tokens))
+		if delay <= 0 {
+			if l.rpm > 0 {
+				l.requests--
+			}
+			if l.tpm > 0 {
+				l.tokens -= math.Min(float64(tokens), l.tpm)
+			}
+			l.stats.Requests++
+			l.stats.RateLimitWait += now.Sub(start)
+			l.mu.Unlock()
+			return nil
+		}
+		l.mu.Unlock()
+
+		if err := l.clock.Sleep(ctx, delay); err != nil {
+			l.mu.Lock()
+			l.stats.RateLimitWait += l.clock.Now().Sub(start)
+			l.mu.Unlock()
+			return err
+		}
+	}
+}
+
+// Pause holds back all requests for d, e.g. when the server asked us to slow down
+func (l *RateLimiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := l.clock.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// Backoff sleeps for d before a retry, counting it in the stats
+func (l *RateLimiter) Backoff(ctx context.Context, d time.Duration) error {
+	start := l.clock.Now()
+	err := l.clock.Sleep(ctx, d)
+	l.mu.Lock()
+	l.stats.Retries++
+	l.stats.RetryWait += l.clock.Now().Sub(start)
+	l.mu.Unlock()
+	return err
+}
+
+// Stats returns the wait metrics collected so far
+func (l *RateLimiter) Stats() WaitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+func (l *RateLimiter) refill(now time.Time) {
+	elapsed := now.Sub(l.last).Minutes()
+	l.last = now
+	if l.rpm > 0 {
+		l.requests = math.Min(1, l.requests+elapsed*l.rpm)
+	}
+	if l.tpm > 0 {
+		l.tokens = math.Min(l.tpm, l.tokens+elapsed*l.tpm)
+	}
+}
+
+// delayFor returns how long to wait until both buckets can cover the request.
+// A request larger than the whole token budget only needs a full bucket.
+func (l *RateLimiter) delayFor(now time.Time, tokens float64) time.Duration {
+	var delay time.Duration
+	if l.pausedUntil.After(now) {
+		delay = l.pausedUntil.Sub(now)
+	}
+	if l.rpm > 0 && l.requests < 1 {
+		delay = maxDuration(delay, minutes((1-l.requests)/l.rpm))
+	}
+	if l.tpm > 0 {
+		need := math.Min(tokens, l.tpm)
+		if l.tokens < need {
+			delay = maxDuration(delay, minutes((need-l.tokens)/l.tpm))
+		}
+	}
+	return delay
+}
+
+// retryPolicy is a bounded exponential backoff with full jitter
+type retryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Jitter      func() float64 // fraction of the delay ceiling to wait, in [0, 1); nil means random
+}
+
+// backoff returns the delay before retry number attempt (1-based)
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	ceiling := float64(p.BaseDelay) * math.Pow(2, float64(attempt-1))
+	if ceiling > float64(p.MaxDelay) {
+		ceiling = float64(p.MaxDelay)
+	}
+	jitter := rand.Float64
+	if p.Jitter != nil {
+		jitter = p.Jitter
+	}
+	return time.Duration(jitter() * ceiling)
+}
+
+// retryableError marks a failure that is worth retrying, optionally with the
+// delay the server asked for
+type retryableError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// estimateTokens roughly estimates the token count of a prompt (about 4 bytes per token)
+func estimateTokens(s string) int {
+	return len(s)/4 + 1
+}
+
+// clock tells the time and sleeps for the rate limiter, so tests can run it
+// without waiting
+type clock interface {
+	Now() time.Time
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) Sleep(ctx context.Context, d time.Duration) error { return sleepContext(ctx, d) }
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func minutes(m float64) time.Duration {
+	return time.Duration(m * float64(time.Minute))
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,235 @@
+package analysis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock advances only when slept on, and records every sleep
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.advance(d)
+	c.mu.Lock()
+	c.sleeps = append(c.sleeps, d)
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// slept returns the sleeps since the last call
+func (c *fakeClock) slept() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := fmt.Sprint(c.sleeps)
+	c.sleeps = nil
+	return s
+}
+
+func TestRateLimiterRequestsPerMinute(t *testing.T) {
+	clock := newFakeClock()
+	l := newRateLimiter(60, 0, clock)
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(context.Background(), 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// One request at once, then one a second: no burst
+	if got := clock.slept(); got != "[1s 1s]" {
+		t.Errorf("sleeps = %s, want [1s 1s]", got)
+	}
+
+	// Idle time refills at most one request
+	clock.advance(10 * time.Minute)
+	l.Wait(context.Background(), 100)
+	l.Wait(context.Background(), 100)
+	if got := clock.slept(); got != "[1s]" {
+		t.Errorf("sleeps after idling = %s, want [1s]", got)
+	}
+	if stats := l.Stats(); stats.Requests != 5 || stats.RateLimitWait != 3*time.Second {
+		t.Errorf("stats = %+v, want 5 requests and 3s waiting", stats)
+	}
+}
+
+func TestRateLimiterTokensPerMinute(t *testing.T) {
+	clock := newFakeClock()
+	l := newRateLimiter(0, 1000, clock)
+	for _, step := range []struct {
+		tokens int
+		want   string
+	}{
+		{600, "[]"},      // the bucket starts full
+		{600, "[12s]"},   // 200 tokens short, refilled at 1000 a minute
+		{300, "[18s]"},   // empty again
+		{5000, "[1m0s]"}, // more than the whole budget only needs a full bucket
+		{1, "[60ms]"},
+	} {
+		if err := l.Wait(context.Background(), step.tokens); err != nil {
+			t.Fatal(err)
+		}
+		if got := clock.slept(); got != step.want {
+			t.Errorf("%d tokens: sleeps = %s, want %s", step.tokens, got, step.want)
+		}
+	}
+}
+
+func TestRateLimiterPause(t *testing.T) {
+	clock := newFakeClock()
+	l := newRateLimiter(0, 0, clock)
+	l.Wait(context.Background(), 100)
+	if got := clock.slept(); got != "[]" {
+		t.Errorf("unlimited: sleeps = %s", got)
+	}
+
+	// A 429 holds back every request; a shorter pause doesn't cut it short
+	l.Pause(30 * time.Second)
+	l.Pause(10 * time.Second)
+	l.Wait(context.Background(), 100)
+	l.Wait(context.Background(), 100)
+	if got := clock.slept(); got != "[30s]" {
+		t.Errorf("paused: sleeps = %s, want [30s]", got)
+	}
+
+	l = newRateLimiter(60, 0, clock)
+	l.Pause(5 * time.Second)
+	l.Wait(context.Background(), 100)
+	if got := clock.slept(); got != "[5s]" {
+		t.Errorf("paused with capacity: sleeps = %s, want [5s]", got)
+	}
+}
+
+func TestRateLimiterWaitCancelled(t *testing.T) {
+	clock := newFakeClock()
+	l := newRateLimiter(1, 0, clock)
+	if err := l.Wait(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.Wait(ctx, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if stats := l.Stats(); stats.Requests != 1 {
+		t.Errorf("%d requests let through, want 1", stats.Requests)
+	}
+
+	// A real wait of a minute ends with its context
+	real := NewRateLimiter(1, 0)
+	real.Wait(context.Background(), 1)
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := real.Wait(ctx, 1); !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 5*time.Second {
+		t.Errorf("err = %v after %v, want the deadline", err, time.Since(start))
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := retryPolicy{BaseDelay: 5 * time.Second, MaxDelay: 2 * time.Minute, Jitter: func() float64 { return 1 }}
+	var ceilings []time.Duration
+	for attempt := 1; attempt <= 7; attempt++ {
+		ceilings = append(ceilings, p.backoff(attempt))
+	}
+	if got := fmt.Sprint(ceilings); got != "[5s 10s 20s 40s 1m20s 2m0s 2m0s]" {
+		t.Errorf("ceilings = %s", got)
+	}
+
+	p.Jitter = nil
+	for attempt := 1; attempt <= 7; attempt++ {
+		for i := 0; i < 50; i++ {
+			if d := p.backoff(attempt); d < 0 || d >= ceilings[attempt-1] {
+				t.Fatalf("attempt %d: backoff %v outside [0, %v)", attempt, d, ceilings[attempt-1])
+			}
+		}
+	}
+}
+
+// geminiStub answers generateContent requests with the given statuses in
+// turn, then with an empty JSON object
+func geminiStub(t *testing.T, statuses ...int) (*GeminiClient, *fakeClock, *int) {
+	t.Helper()
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/models/test-model:generateContent") {
+			http.NotFound(w, r)
+			return
+		}
+		requests++
+		if requests <= len(statuses) {
+			status := statuses[requests-1]
+			w.WriteHeader(status)
+			if status == http.StatusTooManyRequests {
+				fmt.Fprint(w, `{"error":{"code":429,"details":[{"@type":"type.googleapis.com/google.rpc.RetryInfo","retryDelay":"30s"}]}}`)
+			}
+			return
+		}
+		fmt.Fprint(w, `{"candidates":[{"content":{"parts":[{"text":"{\"company_name\":\"An Phat\"}"}]}}]}`)
+	}))
+	t.Cleanup(srv.Close)
+	clock := newFakeClock()
+	client := &GeminiClient{
+		apiKey:   "test-key",
+		model:    "test-model",
+		endpoint: srv.URL,
+		limiter:  newRateLimiter(0, 0, clock),
+		retry:    retryPolicy{MaxAttempts: 3, BaseDelay: 4 * time.Second, MaxDelay: time.Minute, Jitter: func() float64 { return 0.5 }},
+	}
+	return client, clock, &requests
+}
+
+func TestGeminiRetries(t *testing.T) {
+	client, clock, requests := geminiStub(t, http.StatusTooManyRequests, http.StatusServiceUnavailable)
+	result, err := client.AnalyzeDocument(context.Background(), "text", SourceBusinessLicense)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result["company_name"] != "An Phat" || *requests != 3 {
+		t.Errorf("result %v after %d requests", result, *requests)
+	}
+	// The 429 asked for 30s, more than the 2s backoff; the 503 backs off 4s
+	if got := clock.slept(); got != "[30s 4s]" {
+		t.Errorf("sleeps = %s, want [30s 4s]", got)
+	}
+	if stats := client.WaitStats(); stats.Retries != 2 || stats.RetryWait != 34*time.Second || stats.Requests != 3 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	client, _, requests = geminiStub(t, 500, 502, 503)
+	if _, err := client.AnalyzeDocument(context.Background(), "text", SourceBusinessLicense); err == nil || !strings.Contains(err.Error(), "giving up after 3 attempts") || *requests != 3 {
+		t.Errorf("err = %v after %d requests, want to give up after 3", err, *requests)
+	}
+
+	client, clock, requests = geminiStub(t, http.StatusBadRequest)
+	if _, err := client.AnalyzeDocument(context.Background(), "text", SourceBusinessLicense); err == nil || *requests != 1 || clock.slept() != "[]" {
+		t.Errorf("err = %v after %d requests, want a 400 not to be retried", err, *requests)
+	}
+}
@@ -0,0 +1,152 @@
+package analysis
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// recordedResponse is the on-disk fixture format shared by the recording and replay analyzers
+type recordedResponse struct {
+	Source        DocumentSource         `json:"source"`
+	PromptVersion string                 `json:"prompt_version"`
+	TextSHA256    string                 `json:"text_sha256"`
+	Analyzer      string                 `json:"analyzer,omitempty"`
+	Response      map[string]interface{} `json:"response"`
+}
+
+// promptVersion identifies the prompt template and response schema sent for
+// a source, so that fixtures recorded with other prompts aren't replayed
+func promptVersion(source DocumentSource) string {
+	h := sha256.New()
+	h.Write([]byte(buildAnalysisPrompt("", source)))
+	if schema := responseSchemaForSource(source); schema != nil {
+		_ = json.NewEncoder(h).Encode(schema)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:8]
+}
+
+// fixtureName returns the fixture file name for a document, keyed by its
+// source, the prompt version and a hash of the extracted text
+func fixtureName(text string, source DocumentSource) (string, string) {
+	sum := sha256.Sum256([]byte(text))
+	textHash := hex.EncodeToString(sum[:])
+	name := strings.NewReplacer("/", "_", "\\", "_", " ", "_").Replace(string(source))
+	if name == "" {
+		name = string(SourceUnknown)
+	}
+	return fmt.Sprintf("%s_p%s_%s.json", name, promptVersion(source), textHash[:16]), textHash
+}
+
+// ReplayAnalyzer serves previously recorded responses from a fixture directory.
+// It never touches the network, so full runs can be exercised offline and in CI.
+type ReplayAnalyzer struct {
+	dir string
+}
+
+// NewReplayAnalyzer creates an analyzer that replays fixtures from dir
+func NewReplayAnalyzer(dir string) (*ReplayAnalyzer, error) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("replay dir: %w", err)
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("replay dir %s is not a directory", dir)
+	}
+	return &ReplayAnalyzer{dir: dir}, nil
+}
+
+// Name identifies the replay backend
+func (r *ReplayAnalyzer) Name() string {
+	return "replay"
+}
+
+// AnalyzeDocument returns the recorded response for the document
+func (r *ReplayAnalyzer) AnalyzeDocument(ctx context.Context, text string, source DocumentSource) (map[string]interface{}, error) {
+	name, textHash := fixtureName(text, source)
+	path := filepath.Join(r.dir, name)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no recorded response for %s document (text sha256 %s, prompt version %s); expected %s", source, textHash, promptVersion(source), path)
+		}
+		return nil, fmt.Errorf("read fixture: %w", err)
+	}
+
+	var rec recordedResponse
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("decode fixture %s: %w", path, err)
+	}
+	if rec.Response == nil {
+		return nil, fmt.Errorf("fixture %s has no response", path)
+	}
+	return rec.Response, nil
+}
+
+// RecordingAnalyzer forwards calls to another analyzer and saves every
+// response as a fixture that ReplayAnalyzer can serve later
+type RecordingAnalyzer struct {
+	next Analyzer
+	dir  string
+}
+
+// NewRecordingAnalyzer wraps next and records its responses into dir
+func NewRecordingAnalyzer(next Analyzer, dir string) (*RecordingAnalyzer, error) {
+	if next == nil {
+		return nil, errors.New("recording analyzer needs an underlying analyzer")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("record dir: %w", err)
+	}
+	return &RecordingAnalyzer{next: next, dir: dir}, nil
+}
+
+// Name identifies the wrapped backend
+func (r *RecordingAnalyzer) Name() string {
+	return r.next.Name()
+}
+
+// Unwrap returns the wrapped analyzer
+func (r *RecordingAnalyzer) Unwrap() Analyzer {
+	return r.next
+}
+
+// AnalyzeDocument analyzes the document with the wrapped analyzer and records the response
+func (r *RecordingAnalyzer) AnalyzeDocument(ctx context.Context, text string, source DocumentSource) (map[string]interface{}, error) {
+	result, err := r.next.AnalyzeDocument(ctx, text, source)
+	if err != nil {
+		return nil, err
+	}
+
+	name, textHash := fixtureName(text, source)
+	rec := recordedResponse{
+		Source:        source,
+		PromptVersion: promptVersion(source),
+		TextSHA256:    textHash,
+		Analyzer:      r.next.Name(),
+		Response:      result,
+	}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal fixture: %w", err)
+	}
+
+	// Write to a temp file first so a crash never leaves a truncated fixture behind
+	path := filepath.Join(r.dir, name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return nil, fmt.Errorf("write fixture: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, fmt.Errorf("write fixture: %w", err)
+	}
+
+	return result, nil
+}
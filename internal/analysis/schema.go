@@ -0,0 +1,51 @@
+package analysis
+
+// GeminiSchema is the OpenAPI-subset schema accepted by Gemini's responseSchema
+type GeminiSchema struct {
+	Type             string                   `json:"type"`
+	Description      string                   `json:"description,omitempty"`
+	Enum             []string                 `json:"enum,omitempty"`
+	Nullable         bool                     `json:"nullable,omitempty"`
+	Properties       map[string]*GeminiSchema `json:"properties,omitempty"`
+	PropertyOrdering []string                 `json:"propertyOrdering,omitempty"`
+	Required         []string                 `json:"required,omitempty"`
+	Items            *GeminiSchema            `json:"items,omitempty"`
+}
+
+// responseSchemaForSource derives the response schema for a document source
+// from its field list in prompts.go. Returns nil for sources without a fixed
+// field list, which are left to free-form JSON.
+func responseSchemaForSource(source DocumentSource) *GeminiSchema {
+	fields := fieldsFor(source)
+	if fields == nil {
+		return nil
+	}
+	return objectSchema(fields)
+}
+
+func objectSchema(fields []promptField) *GeminiSchema {
+	schema := &GeminiSchema{
+		Type:       "OBJECT",
+		Properties: make(map[string]*GeminiSchema, len(fields)),
+	}
+	for _, f := range fields {
+		schema.Properties[f.Name] = fieldSchema(f)
+		schema.PropertyOrdering = append(schema.PropertyOrdering, f.Name)
+		schema.Required = append(schema.Required, f.Name)
+	}
+	return schema
+}
+
+func fieldSchema(f promptField) *GeminiSchema {
+	switch f.Type {
+	case fieldNumber:
+		// Nullable so the model can say "not found" instead of inventing a 0
+		return &GeminiSchema{Type: "NUMBER", Description: f.Description, Nullable: true}
+	case fieldNumberArray:
+		return &GeminiSchema{Type: "ARRAY", Description: f.Description, Items: &GeminiSchema{Type: "NUMBER"}}
+	case fieldObjectArray:
+		return &GeminiSchema{Type: "ARRAY", Description: f.Description, Items: objectSchema(f.Items)}
+	default:
+		return &GeminiSchema{Type: "STRING", Description: f.Description, Enum: f.Enum, Nullable: true}
+	}
+}
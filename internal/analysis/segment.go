@@ -0,0 +1,163 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Segment is a run of pages of a multi-document file that belong to one document
+type Segment struct {
+	PageStart int // 1-based
+	PageEnd   int // inclusive
+	Classification
+}
+
+// pageConfidenceThreshold is the keyword confidence a page needs to start a new
+// segment; less certain pages are taken to continue the previous document
+const pageConfidenceThreshold = 0.5
+
+// segmentPageLimit caps how much of each page is sent to the LLM for segmentation
+const segmentPageLimit = 1500
+
+// SegmentPages splits the pages of a scanned bundle into documents and guesses
+// the type of each. Pages are classified by keywords first; if any page is
+// unclear the analyzer is asked to segment the whole bundle. If the analyzer is
+// nil or fails, the keyword segmentation is returned along with the error.
+func SegmentPages(ctx context.Context, analyzer Analyzer, pages []string) ([]Segment, error) {
+	guesses := make([]Classification, len(pages))
+	conclusive := true
+	for i, page := range pages {
+		guesses[i] = ClassifyByKeywords(page)
+		if strings.TrimSpace(page) != "" && guesses[i].Confidence < keywordConfidenceThreshold {
+			conclusive = false
+		}
+	}
+	segments := segmentsFromGuesses(guesses)
+	if conclusive || analyzer == nil {
+		return segments, nil
+	}
+
+	result, err := analyzer.AnalyzeDocument(ctx, segmentationExcerpt(pages), sourceSegmentation)
+	if err != nil {
+		return segments, fmt.Errorf("%s segmentation error: %w", analyzer.Name(), err)
+	}
+	llmSegments, err := parseSegments(result, len(pages))
+	if err != nil {
+		return segments, fmt.Errorf("%s segmentation error: %w", analyzer.Name(), err)
+	}
+	return llmSegments, nil
+}
+
+// segmentsFromGuesses groups consecutive pages into segments. A page starts a
+// new segment when it is confidently of a different type than the current one;
+// pages without a clear type continue the current document, and leading ones
+// belong to the first document.
+func segmentsFromGuesses(guesses []Classification) []Segment {
+	var segments []Segment
+	for i, g := range guesses {
+		page := i + 1
+		clear := g.Source != SourceUnknown && g.Confidence >= pageConfidenceThreshold
+		switch {
+		case len(segments) == 0:
+			segments = append(segments, Segment{PageStart: page, PageEnd: page, Classification: g})
+		case clear && segments[len(segments)-1].Source == SourceUnknown:
+			// Leading unclear pages belong to the first recognized document
+			last := &segments[len(segments)-1]
+			last.PageEnd = page
+			last.Classification = g
+		case clear && segments[len(segments)-1].Source != g.Source:
+			segments = append(segments, Segment{PageStart: page, PageEnd: page, Classification: g})
+		default:
+			last := &segments[len(segments)-1]
+			last.PageEnd = page
+			if g.Source == last.Source && g.Confidence > last.Confidence {
+				last.Confidence = g.Confidence
+			}
+		}
+	}
+	return segments
+}
+
+// parseSegments reads the model's segmentation answer. Segments are sorted by
+// page and stretched so that together they cover every page exactly once.
+func parseSegments(result map[string]interface{}, pageCount int) ([]Segment, error) {
+	items, err := coerceList(result["segments"])
+	if err != nil {
+		return nil, err
+	}
+	var segments []Segment
+	for _, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected a segment object, got %T", item)
+		}
+		c, err := parseClassification(map[string]interface{}{"document_type": obj["document_type"], "confidence": obj["confidence"]})
+		if err != nil {
+			return nil, err
+		}
+		start, okStart := pageNumber(obj["page_start"])
+		end, okEnd := pageNumber(obj["page_end"])
+		if !okStart || !okEnd || start < 1 || end < start || start > pageCount {
+			return nil, fmt.Errorf("invalid page range %v-%v", obj["page_start"], obj["page_end"])
+		}
+		segments = append(segments, Segment{PageStart: start, PageEnd: end, Classification: c})
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("no segments returned")
+	}
+
+	sort.SliceStable(segments, func(i, j int) bool { return segments[i].PageStart < segments[j].PageStart })
+	segments[0].PageStart = 1
+	for i := range segments {
+		if i+1 < len(segments) {
+			if segments[i+1].PageStart <= segments[i].PageStart {
+				return nil, fmt.Errorf("overlapping segments starting at page %d", segments[i].PageStart)
+			}
+			// Gaps and overlaps are resolved in favour of the later segment's start
+			segments[i].PageEnd = segments[i+1].PageStart - 1
+		} else {
+			segments[i].PageEnd = pageCount
+		}
+	}
+	return segments, nil
+}
+
+// pageNumber accepts a page number as a JSON number or numeric text
+func pageNumber(raw interface{}) (int, bool) {
+	switch v := raw.(type) {
+	case float64:
+		return int(math.Round(v)), true
+	case string:
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// segmentationExcerpt labels the start of every page for the segmentation prompt
+func segmentationExcerpt(pages []string) string {
+	var b strings.Builder
+	for i, page := range pages {
+		text := truncateText(strings.TrimSpace(page), segmentPageLimit)
+		fmt.Fprintf(&b, "=== Page %d ===\n%s\n\n", i+1, text)
+	}
+	return b.String()
+}
+
+// segmentationPrompt asks the model where each document in a bundle starts and ends
+func segmentationPrompt(text string) string {
+	var b strings.Builder
+	b.WriteString("The following pages were scanned into one file and may contain several documents from a Vietnamese corporate credit check. Split the pages into documents, giving each document's first and last page, and classify each document as one of these types:\n")
+	for _, source := range classifiableSources {
+		b.WriteString("- " + string(source) + ": " + sourceDescriptions[source] + "\n")
+	}
+	b.WriteString("- unknown: none of the above\n\nA document usually spans several pages; only start a new document where a new title, form or issuer begins. Every page must belong to exactly one document.\n\nPages:\n")
+	b.WriteString(text)
+	b.WriteString("\nReturn the answer in JSON format:\n")
+	b.WriteString(renderPromptFields(fieldsFor(sourceSegmentation)))
+	return b.String()
+}
@@ -14,3 +14,13 @@ const (
 	SourceCICReport2        DocumentSource = "cic_report_2"
 	SourceUnknown           DocumentSource = "unknown"
 )
+
+// sourceAddressComparison is used internally for the billing/business address
+// comparison prompt; it is not a document type users can select
+const sourceAddressComparison DocumentSource = "address_comparison"
+
+// sourceClassification is used internally to ask which document type a file is
+const sourceClassification DocumentSource = "classification"
+
+// sourceSegmentation is used internally to split a multi-document file into documents
+const sourceSegmentation DocumentSource = "segmentation"
@@ -0,0 +1,549 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Limits bound what an archive may expand to, protecting against zip bombs
+// and deeply nested archives
+type Limits struct {
+	MaxDepth     int   // nesting levels below the top-level archive that are still expanded
+	MaxTotalSize int64 // total uncompressed bytes across all extracted files
+	MaxFiles     int   // total number of extracted files
+	MaxRatio     int64 // how many times its own size an archive may expand to
+}
+
+// DefaultLimits are used for any zero field of Limits
+var DefaultLimits = Limits{
+	MaxDepth:     3,
+	MaxTotalSize: 1 << 30, // 1 GiB
+	MaxFiles:     1000,
+	MaxRatio:     200,
+}
+
+// minRatioSize is the uncompressed size below which the expansion ratio isn't
+// checked: small archives of text compress well without being bombs
+const minRatioSize = 16 << 20
+
+// ErrLimitExceeded is returned when an archive expands beyond its Limits
+var ErrLimitExceeded = errors.New("archive exceeds extraction limits")
+
+// Entry is one file extracted from an archive
+type Entry struct {
+	Name string // path inside the archive; nested archives are joined with "!/"
+	Path string // extracted file on disk
+}
+
+// Format identifies an archive container
+type Format string
+
+const (
+	FormatNone  Format = ""
+	FormatZip   Format = "zip"
+	FormatTar   Format = "tar"
+	FormatGzip  Format = "gzip" // tar.gz or a single gzipped file
+	FormatBzip2 Format = "bzip2"
+	Format7z    Format = "7z"
+	FormatRar   Format = "rar"
+)
+
+// DetectFormat identifies an archive by its magic bytes
+func DetectFormat(filePath string) (Format, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return FormatNone, err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return FormatNone, err
+	}
+	return detectMagic(head[:n]), nil
+}
+
+func detectMagic(head []byte) Format {
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return FormatZip
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return FormatGzip
+	case bytes.HasPrefix(head, []byte("BZh")):
+		return FormatBzip2
+	case bytes.HasPrefix(head, []byte("7z\xbc\xaf\x27\x1c")):
+		return Format7z
+	case bytes.HasPrefix(head, []byte("Rar!\x1a\x07")):
+		return FormatRar
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return FormatTar
+	}
+	return FormatNone
+}
+
+// IsOfficeZip reports whether a zip container is really an OOXML document
+// (docx/xlsx/pptx), which must not be expanded as an archive
+func IsOfficeZip(filePath string) bool {
+	zr, err := zip.OpenReader(filePath)
+	if err != nil {
+		return false
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if f.Name == "[Content_Types].xml" {
+			return true
+		}
+	}
+	return false
+}
+
+// expander tracks the shared budget while expanding an archive tree
+type expander struct {
+	ctx      context.Context
+	limits   Limits
+	size     int64
+	files    int
+	warnings []string
+}
+
+// Expand extracts the archive at archivePath into destDir and returns the
+// extracted files in archive order. Nested archives are expanded in place up
+// to limits.MaxDepth; deeper ones are skipped with a warning. Zip, tar,
+// tar.gz and tar.bz2 are read natively; 7z and rar need 7z/7zz/7za or unrar
+// on PATH. Zip, 7z and rar archives are checked against the limits from
+// their listing before anything is extracted.
+func Expand(ctx context.Context, archivePath, destDir string, limits Limits) ([]Entry, []string, error) {
+	return ExpandNamed(ctx, archivePath, filepath.Base(archivePath), destDir, limits)
+}
+
+// ExpandNamed is Expand for an archive stored under another name, such as a
+// downloaded temp file. A single gzipped or bzip2ed file is named after name.
+func ExpandNamed(ctx context.Context, archivePath, name, destDir string, limits Limits) ([]Entry, []string, error) {
+	if limits.MaxDepth <= 0 {
+		limits.MaxDepth = DefaultLimits.MaxDepth
+	}
+	if limits.MaxTotalSize <= 0 {
+		limits.MaxTotalSize = DefaultLimits.MaxTotalSize
+	}
+	if limits.MaxFiles <= 0 {
+		limits.MaxFiles = DefaultLimits.MaxFiles
+	}
+	if limits.MaxRatio <= 0 {
+		limits.MaxRatio = DefaultLimits.MaxRatio
+	}
+	format, err := DetectFormat(archivePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if format == FormatNone {
+		return nil, nil, fmt.Errorf("not a supported archive: %s", name)
+	}
+
+	e := &expander{ctx: ctx, limits: limits}
+	entries, err := e.expand(archivePath, format, name, "", destDir, 0)
+	if err != nil {
+		return nil, e.warnings, err
+	}
+	return entries, e.warnings, nil
+}
+
+func (e *expander) expand(archivePath string, format Format, name, prefix, destDir string, depth int) ([]Entry, error) {
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return nil, err
+	}
+
+	var extracted []Entry
+	var err error
+	switch format {
+	case FormatZip:
+		extracted, err = e.extractZip(archivePath, destDir)
+	case FormatTar:
+		extracted, err = e.extractTarFile(archivePath, nil, destDir, "")
+	case FormatGzip:
+		extracted, err = e.extractTarFile(archivePath, func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }, destDir, singleFileName(name))
+	case FormatBzip2:
+		extracted, err = e.extractTarFile(archivePath, func(r io.Reader) (io.Reader, error) { return bzip2.NewReader(r), nil }, destDir, singleFileName(name))
+	case Format7z, FormatRar:
+		extracted, err = e.extractExternal(archivePath, format, destDir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	var entries []Entry
+	for _, entry := range extracted {
+		entry.Name = prefix + entry.Name
+		nested, err := DetectFormat(entry.Path)
+		if err != nil {
+			return nil, err
+		}
+		if nested == FormatNone || (nested == FormatZip && IsOfficeZip(entry.Path)) {
+			entries = append(entries, entry)
+			continue
+		}
+		if depth+1 > e.limits.MaxDepth {
+			e.warnings = append(e.warnings, fmt.Sprintf("skipped nested archive %s: deeper than %d levels", entry.Name, e.limits.MaxDepth))
+			continue
+		}
+		children, err := e.expand(entry.Path, nested, entry.Name, entry.Name+"!/", entry.Path+".d", depth+1)
+		if err != nil {
+			return nil, err
+		}
+		os.Remove(entry.Path)
+		entries = append(entries, children...)
+	}
+	return entries, nil
+}
+
+func (e *expander) extractZip(archivePath, destDir string) ([]Entry, error) {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var members []*zip.File
+	var size int64
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !f.Mode().IsRegular() || skipEntry(f.Name) {
+			continue
+		}
+		if f.UncompressedSize64 > uint64(e.limits.MaxTotalSize) {
+			return nil, fmt.Errorf("%w: more than %d bytes uncompressed", ErrLimitExceeded, e.limits.MaxTotalSize)
+		}
+		members = append(members, f)
+		size += int64(f.UncompressedSize64)
+	}
+	if err := e.checkListing(archivePath, len(members), size); err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, f := range members {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		entry, err := e.writeEntry(f.Name, rc, destDir)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// singleFileName names the file inside a compressed stream that isn't a tar:
+// the archive's name minus its .gz or .bz2 extension, so the file keeps its
+// own extension
+func singleFileName(archiveName string) string {
+	base := path.Base(archiveName)
+	if name := strings.TrimSuffix(base, path.Ext(base)); name != "" {
+		return name
+	}
+	return "content"
+}
+
+// extractTarFile extracts a (possibly compressed) tar file. A compressed
+// stream that isn't a tar is extracted as a single file named single.
+func (e *expander) extractTarFile(archivePath string, decompress func(io.Reader) (io.Reader, error), destDir, single string) ([]Entry, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if decompress != nil {
+		if r, err = decompress(f); err != nil {
+			return nil, err
+		}
+	}
+	br := bufio.NewReaderSize(r, 1024)
+	head, _ := br.Peek(512)
+	if detectMagic(head) != FormatTar {
+		if decompress == nil {
+			return nil, fmt.Errorf("not a tar archive")
+		}
+		entry, err := e.writeEntry(single, br, destDir)
+		if err != nil {
+			return nil, err
+		}
+		return []Entry{entry}, nil
+	}
+
+	tr := tar.NewReader(br)
+	var entries []Entry
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg || skipEntry(hdr.Name) {
+			continue
+		}
+		entry, err := e.writeEntry(hdr.Name, tr, destDir)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// extractExternal extracts 7z/rar archives with an external tool. The
+// archive is listed first and checked against the limits, and the extracted
+// files are checked again.
+func (e *expander) extractExternal(archivePath string, format Format, destDir string) ([]Entry, error) {
+	tool := ""
+	candidates := []string{"7zz", "7z", "7za"}
+	if format == FormatRar {
+		candidates = append([]string{"unrar"}, candidates...)
+	}
+	for _, name := range candidates {
+		if _, err := exec.LookPath(name); err == nil {
+			tool = name
+			break
+		}
+	}
+	if tool == "" {
+		return nil, fmt.Errorf("%s archives need %s on PATH", format, strings.Join(candidates, ", "))
+	}
+
+	listArgs := []string{"l", "-slt", archivePath}
+	extractArgs := []string{"x", "-y", "-o" + destDir, archivePath}
+	parse := parse7zListing
+	if tool == "unrar" {
+		listArgs = []string{"lt", archivePath}
+		extractArgs = []string{"x", "-o+", "-y", archivePath, destDir + string(filepath.Separator)}
+		parse = parseUnrarListing
+	}
+	listing, err := e.runTool(tool, listArgs...)
+	if err != nil {
+		return nil, err
+	}
+	listed, err := parse(listing)
+	if err != nil {
+		return nil, fmt.Errorf("%s listing: %w", tool, err)
+	}
+	var size int64
+	for _, f := range listed {
+		if !safeMemberPath(f.name) {
+			return nil, fmt.Errorf("member %q would be extracted outside the archive", f.name)
+		}
+		if f.size < 0 || f.size > e.limits.MaxTotalSize {
+			return nil, fmt.Errorf("%w: more than %d bytes uncompressed", ErrLimitExceeded, e.limits.MaxTotalSize)
+		}
+		size += f.size
+	}
+	if err := e.checkListing(archivePath, len(listed), size); err != nil {
+		return nil, err
+	}
+	if _, err := e.runTool(tool, extractArgs...); err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	err = filepath.WalkDir(destDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(destDir, p)
+		rel = filepath.ToSlash(rel)
+		if !d.Type().IsRegular() || skipEntry(rel) {
+			os.Remove(p)
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if err := e.reserve(info.Size()); err != nil {
+			return err
+		}
+		entries = append(entries, Entry{Name: rel, Path: p})
+		return nil
+	})
+	return entries, err
+}
+
+// runTool runs an archive tool and returns its output
+func (e *expander) runTool(tool string, args ...string) (string, error) {
+	cmd := exec.CommandContext(e.ctx, tool, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s error: %v: %s", tool, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// listedFile is a file member in the listing of an archive tool
+type listedFile struct {
+	name string
+	size int64
+}
+
+// parse7zListing reads the files from the technical listing of 7z l -slt:
+// blocks of "Key = value" lines, after the archive's own block ending in a
+// line of dashes
+func parse7zListing(out string) ([]listedFile, error) {
+	_, members, ok := strings.Cut(strings.ReplaceAll(out, "\r\n", "\n"), "\n----------\n")
+	if !ok {
+		return nil, errors.New("no file list")
+	}
+	var files []listedFile
+	for _, block := range strings.Split(members, "\n\n") {
+		fields := listingFields(block, " = ")
+		name, ok := fields["Path"]
+		if !ok {
+			continue
+		}
+		if fields["Folder"] == "+" || strings.HasPrefix(fields["Attributes"], "D") {
+			continue
+		}
+		size, err := strconv.ParseInt(fields["Size"], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad size of %s: %q", name, fields["Size"])
+		}
+		files = append(files, listedFile{name: name, size: size})
+	}
+	return files, nil
+}
+
+// parseUnrarListing reads the files from the technical listing of unrar lt:
+// blocks of "Key: value" lines, each starting with the member's Name
+func parseUnrarListing(out string) ([]listedFile, error) {
+	var files []listedFile
+	for _, block := range strings.Split(strings.ReplaceAll(out, "\r\n", "\n"), "\n\n") {
+		fields := listingFields(block, ": ")
+		name, ok := fields["Name"]
+		if !ok {
+			continue
+		}
+		if fields["Type"] != "File" {
+			continue
+		}
+		size, err := strconv.ParseInt(fields["Size"], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad size of %s: %q", name, fields["Size"])
+		}
+		files = append(files, listedFile{name: name, size: size})
+	}
+	return files, nil
+}
+
+// listingFields splits the lines of one listing block into keys and values
+func listingFields(block, sep string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(block, "\n") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), sep); ok {
+			fields[key] = strings.TrimSpace(value)
+		}
+	}
+	return fields
+}
+
+// safeMemberPath reports whether an archive member name stays inside the
+// directory it is extracted to
+func safeMemberPath(name string) bool {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// checkListing checks what an archive lists, before anything is extracted,
+// against the limits: the number of files, their total size, and how many
+// times the archive's own size they add up to
+func (e *expander) checkListing(archivePath string, files int, size int64) error {
+	if e.files+files > e.limits.MaxFiles {
+		return fmt.Errorf("%w: more than %d files", ErrLimitExceeded, e.limits.MaxFiles)
+	}
+	if e.size+size > e.limits.MaxTotalSize {
+		return fmt.Errorf("%w: more than %d bytes uncompressed", ErrLimitExceeded, e.limits.MaxTotalSize)
+	}
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return err
+	}
+	if size > minRatioSize && info.Size() > 0 && size/info.Size() > e.limits.MaxRatio {
+		return fmt.Errorf("%w: expands to %d times its size", ErrLimitExceeded, size/info.Size())
+	}
+	return nil
+}
+
+// writeEntry copies one archive member to disk under destDir, charging it to the budget
+func (e *expander) writeEntry(name string, r io.Reader, destDir string) (Entry, error) {
+	if err := e.ctx.Err(); err != nil {
+		return Entry{}, err
+	}
+	clean := path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+	target := filepath.Join(destDir, filepath.FromSlash(clean))
+	if err := e.reserve(0); err != nil {
+		return Entry{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return Entry{}, err
+	}
+	out, err := os.Create(target)
+	if err != nil {
+		return Entry{}, err
+	}
+	remaining := e.limits.MaxTotalSize - e.size
+	n, err := io.Copy(out, io.LimitReader(r, remaining+1))
+	out.Close()
+	if err != nil {
+		return Entry{}, fmt.Errorf("%s: %w", name, err)
+	}
+	if n > remaining {
+		return Entry{}, fmt.Errorf("%w: more than %d bytes uncompressed", ErrLimitExceeded, e.limits.MaxTotalSize)
+	}
+	e.size += n
+	return Entry{Name: strings.TrimPrefix(clean, "/"), Path: target}, nil
+}
+
+// reserve counts one more file of the given size against the limits
+func (e *expander) reserve(size int64) error {
+	e.files++
+	e.size += size
+	if e.files > e.limits.MaxFiles {
+		return fmt.Errorf("%w: more than %d files", ErrLimitExceeded, e.limits.MaxFiles)
+	}
+	if e.size > e.limits.MaxTotalSize {
+		return fmt.Errorf("%w: more than %d bytes uncompressed", ErrLimitExceeded, e.limits.MaxTotalSize)
+	}
+	return nil
+}
+
+// skipEntry reports archive members that are OS metadata rather than documents
+func skipEntry(name string) bool {
+	base := path.Base(name)
+	return strings.HasPrefix(name, "__MACOSX/") || strings.Contains(name, "/__MACOSX/") ||
+		base == ".DS_Store" || base == "Thumbs.db" || base == "desktop.ini"
+}
@@ -0,0 +1,420 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// member is a file to put into a test archive
+type member struct {
+	name    string
+	content []byte
+}
+
+func zipBytes(t *testing.T, members ...member) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, m := range members {
+		w, err := zw.Create(m.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(m.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarGzBytes(t *testing.T, members ...member) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, m := range members {
+		if err := tw.WriteHeader(&tar.Header{Name: m.name, Mode: 0644, Size: int64(len(m.content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(m.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func entryNames(entries []Entry) []string {
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+// countFiles returns the number of regular files below dir
+func countFiles(t *testing.T, dir string) int {
+	t.Helper()
+	n := 0
+	filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			n++
+		}
+		return nil
+	})
+	return n
+}
+
+func TestExpandZipSlip(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "out", "dest")
+	archivePath := writeFile(t, dir, "slip.zip", zipBytes(t,
+		member{"../../evil.txt", []byte("evil")},
+		member{"/etc/abs.txt", []byte("abs")},
+		member{"a/../../../up.txt", []byte("up")},
+		member{`..\..\win.txt`, []byte("win")},
+		member{"docs/license.txt", []byte("ok")},
+	))
+
+	entries, _, err := Expand(context.Background(), archivePath, dest, Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"evil.txt", "etc/abs.txt", "up.txt", "win.txt", "docs/license.txt"}
+	if got := entryNames(entries); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("entries = %v, want %v", got, want)
+	}
+	for _, e := range entries {
+		if rel, err := filepath.Rel(dest, e.Path); err != nil || strings.HasPrefix(rel, "..") {
+			t.Errorf("%s extracted outside the destination: %s", e.Name, e.Path)
+		}
+	}
+	if n := countFiles(t, dir) - 1; n != len(want) { // minus the archive itself
+		t.Errorf("%d files written, want %d", n, len(want))
+	}
+}
+
+func TestExpandFileLimit(t *testing.T) {
+	dir := t.TempDir()
+	var members []member
+	for _, name := range []string{"1.txt", "2.txt", "3.txt", "4.txt", "5.txt"} {
+		members = append(members, member{name, []byte(name)})
+	}
+	archivePath := writeFile(t, dir, "many.zip", zipBytes(t, members...))
+	dest := filepath.Join(dir, "dest")
+
+	_, _, err := Expand(context.Background(), archivePath, dest, Limits{MaxFiles: 3})
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("err = %v, want ErrLimitExceeded", err)
+	}
+	if n := countFiles(t, dest); n != 0 {
+		t.Errorf("%d files extracted before the limit was checked", n)
+	}
+
+	if _, _, err := Expand(context.Background(), archivePath, filepath.Join(dir, "dest2"), Limits{MaxFiles: 5}); err != nil {
+		t.Errorf("5 files within a limit of 5: %v", err)
+	}
+}
+
+func TestExpandSizeLimit(t *testing.T) {
+	dir := t.TempDir()
+	big := bytes.Repeat([]byte("x"), 2000)
+	for name, data := range map[string][]byte{
+		"big.zip":    zipBytes(t, member{"big.txt", big}),
+		"big.tar.gz": tarGzBytes(t, member{"big.txt", big}),
+	} {
+		archivePath := writeFile(t, dir, name, data)
+		_, _, err := Expand(context.Background(), archivePath, filepath.Join(dir, name+".d"), Limits{MaxTotalSize: 1000})
+		if !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("%s: err = %v, want ErrLimitExceeded", name, err)
+		}
+	}
+	// Zip sizes are known up front, so nothing is written
+	if n := countFiles(t, filepath.Join(dir, "big.zip.d")); n != 0 {
+		t.Errorf("%d files extracted from big.zip before the limit was checked", n)
+	}
+}
+
+func TestExpandRatioLimit(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := writeFile(t, dir, "bomb.zip", zipBytes(t, member{"zeros.txt", make([]byte, 32<<20)}))
+	dest := filepath.Join(dir, "dest")
+
+	_, _, err := Expand(context.Background(), archivePath, dest, Limits{})
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("err = %v, want ErrLimitExceeded", err)
+	}
+	if n := countFiles(t, dest); n != 0 {
+		t.Errorf("%d files extracted before the limit was checked", n)
+	}
+}
+
+func TestExpandNested(t *testing.T) {
+	dir := t.TempDir()
+	deep := zipBytes(t, member{"doc.txt", []byte("deep")})
+	inner := tarGzBytes(t, member{"deep.zip", deep}, member{"notes.txt", []byte("notes")})
+	archivePath := writeFile(t, dir, "outer.zip", zipBytes(t,
+		member{"inner.tar.gz", inner},
+		member{"top.txt", []byte("top")},
+		member{"__MACOSX/._top.txt", []byte("meta")},
+	))
+
+	entries, warnings, err := Expand(context.Background(), archivePath, filepath.Join(dir, "full"), Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"inner.tar.gz!/deep.zip!/doc.txt", "inner.tar.gz!/notes.txt", "top.txt"}
+	if got := entryNames(entries); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("entries = %v, want %v", got, want)
+	}
+	if len(warnings) > 0 {
+		t.Errorf("unexpected warnings %v", warnings)
+	}
+	data, err := os.ReadFile(entries[0].Path)
+	if err != nil || string(data) != "deep" {
+		t.Errorf("nested file = %q, %v", data, err)
+	}
+
+	entries, warnings, err = Expand(context.Background(), archivePath, filepath.Join(dir, "shallow"), Limits{MaxDepth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"inner.tar.gz!/notes.txt", "top.txt"}
+	if got := entryNames(entries); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("entries with depth 1 = %v, want %v", got, want)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "deep.zip") {
+		t.Errorf("warnings = %v, want one about deep.zip", warnings)
+	}
+}
+
+func TestExpandSingleCompressedFile(t *testing.T) {
+	dir := t.TempDir()
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte("MIT License"))
+	gw.Close()
+	archivePath := writeFile(t, dir, "license.txt.gz", gz.Bytes())
+
+	entries, _, err := Expand(context.Background(), archivePath, filepath.Join(dir, "dest"), Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name != "license.txt" || filepath.Base(entries[0].Path) != "license.txt" {
+		t.Fatalf("entries = %+v, want license.txt named and stored as such", entries)
+	}
+	data, err := os.ReadFile(entries[0].Path)
+	if err != nil || string(data) != "MIT License" {
+		t.Errorf("content = %q, %v", data, err)
+	}
+
+	// A downloaded archive keeps its own name, not its temp file's
+	tempPath := writeFile(t, dir, "xfer-123.gz", gz.Bytes())
+	entries, _, err = ExpandNamed(context.Background(), tempPath, "license.txt.gz", filepath.Join(dir, "named"), Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name != "license.txt" || filepath.Base(entries[0].Path) != "license.txt" {
+		t.Errorf("entries = %+v, want license.txt", entries)
+	}
+
+	// Nested in a zip, the file is named after its own archive
+	zipPath := writeFile(t, dir, "outer.zip", zipBytes(t, member{"docs/license.txt.gz", gz.Bytes()}))
+	entries, _, err = Expand(context.Background(), zipPath, filepath.Join(dir, "nested"), Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name != "docs/license.txt.gz!/license.txt" {
+		t.Errorf("entries = %v, want docs/license.txt.gz!/license.txt", entryNames(entries))
+	}
+}
+
+func TestExpandFileLimitAcrossNestedArchives(t *testing.T) {
+	dir := t.TempDir()
+	inner := zipBytes(t, member{"a.txt", []byte("a")}, member{"b.txt", []byte("b")})
+	archivePath := writeFile(t, dir, "outer.zip", zipBytes(t,
+		member{"one.zip", inner},
+		member{"two.zip", inner},
+	))
+	_, _, err := Expand(context.Background(), archivePath, filepath.Join(dir, "dest"), Limits{MaxFiles: 4})
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("err = %v, want ErrLimitExceeded", err)
+	}
+}
+
+// fake7z puts a 7z stand-in on PATH that prints listing for "l" and, for
+// "x", records that it ran and extracts one file
+func fake7z(t *testing.T, listing string) (archivePath, marker string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell script as 7z")
+	}
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	if err := os.Mkdir(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	listingPath := writeFile(t, dir, "listing.txt", []byte(listing))
+	marker = filepath.Join(dir, "extracted")
+	script := `#!/bin/sh
+case "$1" in
+l) cat "` + listingPath + `" ;;
+x) touch "` + marker + `"
+   for a in "$@"; do case "$a" in -o*) out="${a#-o}" ;; esac; done
+   echo report > "$out/report.txt" ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(bin, "7zz"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return writeFile(t, dir, "docs.7z", []byte("7z\xbc\xaf\x27\x1c rest of the archive")), marker
+}
+
+const sevenZipListing = `
+7-Zip 23.01 (x64) : Copyright (c) 1999-2023 Igor Pavlov : 2023-06-20
+
+Scanning the drive for archives:
+1 file, 1234 bytes (2 KiB)
+
+Listing archive: docs.7z
+
+--
+Path = docs.7z
+Type = 7z
+Physical Size = 1234
+Headers Size = 200
+
+----------
+Path = reports
+Size = 0
+Packed Size = 0
+Attributes = D_ drwxr-xr-x
+
+Path = %s
+Size = %s
+Packed Size = 100
+Attributes = A_ -rw-r--r--
+`
+
+func TestExpandExternalListsBeforeExtracting(t *testing.T) {
+	tests := []struct {
+		name, path, size string
+		limits           Limits
+		wantLimit        bool
+		wantErr          bool
+	}{
+		{name: "ok", path: "reports/report.txt", size: "7"},
+		{name: "too large", path: "reports/report.txt", size: "5000", limits: Limits{MaxTotalSize: 1000}, wantLimit: true},
+		{name: "bomb", path: "reports/report.txt", size: "1073741824", limits: Limits{MaxTotalSize: 2 << 30}, wantLimit: true},
+		{name: "zip slip", path: "../../etc/cron.d/evil", size: "7", wantErr: true},
+		{name: "absolute", path: "/etc/passwd", size: "7", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listing := strings.Replace(strings.Replace(sevenZipListing, "%s", tt.path, 1), "%s", tt.size, 1)
+			archivePath, marker := fake7z(t, listing)
+			entries, _, err := Expand(context.Background(), archivePath, filepath.Join(t.TempDir(), "dest"), tt.limits)
+			_, statErr := os.Stat(marker)
+			extracted := statErr == nil
+			switch {
+			case tt.wantLimit || tt.wantErr:
+				if tt.wantLimit && !errors.Is(err, ErrLimitExceeded) {
+					t.Errorf("err = %v, want ErrLimitExceeded", err)
+				}
+				if err == nil {
+					t.Errorf("no error")
+				}
+				if extracted {
+					t.Errorf("archive extracted although the listing broke the limits")
+				}
+			default:
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !extracted || len(entries) != 1 || entries[0].Name != "report.txt" {
+					t.Errorf("entries = %v, extracted %v", entryNames(entries), extracted)
+				}
+			}
+		})
+	}
+}
+
+func TestExpandExternalFileLimit(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("--\nPath = docs.7z\nType = 7z\n\n----------\n")
+	for i := 0; i < 20; i++ {
+		b.WriteString("Path = f" + string(rune('a'+i)) + ".txt\nSize = 1\nAttributes = A_\n\n")
+	}
+	archivePath, marker := fake7z(t, b.String())
+	_, _, err := Expand(context.Background(), archivePath, filepath.Join(t.TempDir(), "dest"), Limits{MaxFiles: 10})
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("err = %v, want ErrLimitExceeded", err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Errorf("archive extracted although it lists too many files")
+	}
+}
+
+func TestParseUnrarListing(t *testing.T) {
+	out := "\r\nUNRAR 6.24 freeware      Copyright (c) 1993-2023 Alexander Roshal\r\n\r\nArchive: docs.rar\r\nDetails: RAR 5\r\n\r\n" +
+		"        Name: scans\r\n        Type: Directory\r\n  Attributes: drwxr-xr-x\r\n\r\n" +
+		"        Name: scans/license.pdf\r\n        Type: File\r\n        Size: 482113\r\n Packed size: 401222\r\n       Ratio: 83%\r\n\r\n" +
+		"        Name: scans/link\r\n        Type: Symlink\r\n        Size: 9\r\n\r\n" +
+		"        Name: bill.jpg\r\n        Type: File\r\n        Size: 93000\r\n\r\n"
+	files, err := parseUnrarListing(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []listedFile{{"scans/license.pdf", 482113}, {"bill.jpg", 93000}}
+	if len(files) != len(want) {
+		t.Fatalf("files = %v, want %v", files, want)
+	}
+	for i := range want {
+		if files[i] != want[i] {
+			t.Errorf("file %d = %v, want %v", i, files[i], want[i])
+		}
+	}
+}
+
+func TestSafeMemberPath(t *testing.T) {
+	for name, want := range map[string]bool{
+		"docs/a.pdf":       true,
+		"a..b/c.pdf":       true,
+		"../a.pdf":         false,
+		"docs/../../a.pdf": false,
+		`docs\..\..\a.pdf`: false,
+		"/etc/passwd":      false,
+		`\windows\sys.ini`: false,
+	} {
+		if got := safeMemberPath(name); got != want {
+			t.Errorf("safeMemberPath(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package batch
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"extraction/internal/analysis"
+	"extraction/internal/types"
+)
+
+// JournalEntry is one completed input, as written to the checkpoint journal
+type JournalEntry struct {
+	Input     string                  `json:"input"`
+	Source    analysis.DocumentSource `json:"source"`
+	Result    types.FileResult        `json:"result"`
+	Extracted map[string]interface{}  `json:"extracted,omitempty"` // raw analysis output
+	Segments  []JournalSegment        `json:"segments,omitempty"`  // documents of a split PDF
+}
+
+// JournalSegment is one document of an input that was split into several
+type JournalSegment struct {
+	Result    types.FileResult       `json:"result"`
+	Extracted map[string]interface{} `json:"extracted,omitempty"`
+}
+
+// failed reports whether the input or any of its documents failed
+func (e JournalEntry) failed() bool {
+	if e.Result.Error != "" {
+		return true
+	}
+	for _, seg := range e.Segments {
+		if seg.Result.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Journal appends completed inputs to a JSON Lines file so an interrupted
+// batch can be resumed without redoing finished work
+type Journal struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// CreateJournal creates (or truncates) the journal at path
+func CreateJournal(path string) (*Journal, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("create journal: %w", err)
+	}
+	return &Journal{file: f}, nil
+}
+
+// AppendJournal opens an existing journal at path for appending
+func AppendJournal(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+	return &Journal{file: f}, nil
+}
+
+// Append writes an entry and syncs it to disk, so it survives the process being killed
+func (j *Journal) Append(entry JournalEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("encode journal entry: %w", err)
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("write journal entry: %w", err)
+	}
+	return j.file.Sync()
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+// LoadJournal reads the successfully completed inputs from a journal, keyed by
+// journalKey. Failed inputs are left out so they are retried on resume, and a
+// truncated last line (from a crash mid-write) is ignored.
+func LoadJournal(path string) (map[string]JournalEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return map[string]JournalEntry{}, nil
+		}
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+	defer f.Close()
+
+	completed := make(map[string]JournalEntry)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		key := journalKey(entry.Input, entry.Source)
+		if entry.failed() {
+			delete(completed, key)
+			continue
+		}
+		completed[key] = entry
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read journal: %w", err)
+	}
+	return completed, nil
+}
+
+func journalKey(input string, source analysis.DocumentSource) string {
+	return string(source) + "\x00" + input
+}
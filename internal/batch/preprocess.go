@@ -0,0 +1,120 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"extraction/internal/analysis"
+	"extraction/internal/imageprep"
+	"extraction/internal/ocr"
+)
+
+// DefaultPreprocess returns the image preprocessing used by NewProcessor:
+// every step for scans and phone shots of documents, but no turning or
+// deskewing of site visit photos, whose signboards and street scenes have no
+// text lines to go by
+func DefaultPreprocess() map[analysis.DocumentSource]imageprep.Steps {
+	return map[analysis.DocumentSource]imageprep.Steps{
+		"":                             imageprep.All,
+		analysis.SourceSiteVisitPhotos: {Orient: true, Contrast: true, MaxDimension: imageprep.DefaultMaxDimension},
+	}
+}
+
+// ParsePreprocess reads a preprocessing setting such as
+// "none;site_visit_photos=orient,contrast". Entries are separated by ";"; an
+// entry without a document type sets the steps for all types not named. If
+// there is none, types not named keep the steps of DefaultPreprocess.
+func ParsePreprocess(spec string) (map[analysis.DocumentSource]imageprep.Steps, error) {
+	preprocess := map[analysis.DocumentSource]imageprep.Steps{}
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		var source analysis.DocumentSource
+		stepSpec := entry
+		if name, steps, ok := strings.Cut(entry, "="); ok {
+			source = analysis.DocumentSource(strings.ToLower(strings.TrimSpace(name)))
+			switch source {
+			case analysis.SourceBusinessLicense, analysis.SourceEVNBill, analysis.SourceLandCertificate, analysis.SourceIDCheck,
+				analysis.SourceFinancialStatement, analysis.SourceSiteVisitPhotos, analysis.SourceCICReport, analysis.SourceCICReport2,
+				analysis.SourceUnknown:
+			default:
+				return nil, fmt.Errorf("unknown document type %q in preprocessing setting", name)
+			}
+			stepSpec = steps
+		}
+		steps, err := imageprep.ParseSteps(stepSpec)
+		if err != nil {
+			return nil, err
+		}
+		preprocess[source] = steps
+	}
+	if _, ok := preprocess[""]; !ok {
+		for source, steps := range DefaultPreprocess() {
+			if _, ok := preprocess[source]; !ok {
+				preprocess[source] = steps
+			}
+		}
+	}
+	return preprocess, nil
+}
+
+// preprocessSteps returns the preprocessing for images of a document type
+func (p *Processor) preprocessSteps(source analysis.DocumentSource) imageprep.Steps {
+	if steps, ok := p.Preprocess[source]; ok {
+		return steps
+	}
+	return p.Preprocess[""]
+}
+
+// ocrImage preprocesses an image for its document type and OCRs it. What was
+// done to the image is returned with the text; if preprocessing fails the
+// original image is OCR'd and the problem returned as a warning.
+func (p *Processor) ocrImage(ctx context.Context, imagePath string, source analysis.DocumentSource) (ocr.ImageText, []string, []string, error) {
+	steps := p.preprocessSteps(source)
+	if !steps.Enabled() {
+		image, err := ocr.OCRImage(ctx, p.ocrEngine(), imagePath, p.Lang)
+		return image, nil, nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "imageprep-")
+	if err != nil {
+		image, ocrErr := ocr.OCRImage(ctx, p.ocrEngine(), imagePath, p.Lang)
+		return image, nil, []string{fmt.Sprintf("image not preprocessed: %v", err)}, ocrErr
+	}
+	defer os.RemoveAll(dir)
+
+	prepared, err := imageprep.Process(imagePath, steps, dir)
+	if errors.Is(err, imageprep.ErrUnsupportedFormat) {
+		// HEIC and other formats Go can't decode: convert them with
+		// ImageMagick or ffmpeg if either is installed
+		if convertedPath, convertErr := p.convertImageToStandardFormat(ctx, imagePath); convertErr == nil {
+			defer os.Remove(convertedPath)
+			prepared, err = imageprep.Process(convertedPath, steps, dir)
+			if err == nil {
+				prepared.Applied = append([]string{"convert with external tool"}, prepared.Applied...)
+			}
+		}
+	}
+	var warnings []string
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("image not preprocessed: %v", err))
+		prepared = imageprep.Result{Path: imagePath}
+	} else if len(prepared.Applied) > 0 {
+		fmt.Printf("Preprocessed %s: %s\n", imagePath, strings.Join(prepared.Applied, ", "))
+	}
+
+	image, err := ocr.OCRImage(ctx, p.ocrEngine(), prepared.Path, p.Lang)
+	return image, prepared.Applied, warnings, err
+}
+
+// cachedImage is the OCR result of an image as cached, with what was done to
+// the image before OCR
+type cachedImage struct {
+	ocr.ImageText
+	Preprocessed []string `json:",omitempty"`
+}
@@ -5,19 +5,33 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"extraction/internal/analysis"
+	"extraction/internal/archive"
+	"extraction/internal/cache"
 	"extraction/internal/files"
+	"extraction/internal/imageprep"
 	"extraction/internal/models"
 	"extraction/internal/ocr"
+	"extraction/internal/office"
 	"extraction/internal/types"
 	"extraction/internal/xfer"
 )
 
+// Cache namespaces for extracted document text: images store the text, PDFs
+// the text of each page
+const (
+	cacheKindImage = "image"
+	cacheKindPDF = "pdf"
+)
+
 // Processor handles batch processing of multiple files
 type Processor struct {
 	MaxConcurrency int
@@ -26,6 +40,52 @@ type Processor struct {
 	DPI            int
 	Source         analysis.DocumentSource
 	ProgressChan   chan ProgressUpdate
+
+	// Provider selects the LLM backend (gemini, openai, ollama, llamacpp).
+	// Empty means LLM_PROVIDER from the environment, then Gemini.
+	Provider string
+	// Analyzer is the LLM backend used for analysis. If nil it is created
+	// from Provider on first use and shared by all files in the batch.
+	Analyzer analysis.Analyzer
+	// MergePolicy decides which value to keep when several documents fill
+	// the same field. Empty means analysis.MergeFirst.
+	MergePolicy analysis.MergePolicy
+	// Cache stores OCR text across runs, keyed by file contents, OCR engine,
+	// language and DPI. Nil disables caching.
+	Cache *cache.Cache
+	// ExcelDirect reads financial statement workbooks straight from their
+	// cells instead of sending the sheet text to the LLM
+	ExcelDirect bool
+	// Journal, if set, receives every input processed in this run so the batch
+	// can be resumed
+	Journal *Journal
+	// Resumed holds inputs completed by an earlier run (see LoadJournal);
+	// they are taken from here instead of being processed again
+	Resumed map[string]JournalEntry
+	// PageConcurrency is the number of pages of one PDF OCR'd in parallel.
+	// Vision requests of all files together are further limited by
+	// ocr.SetVisionBudget. Zero means ocr.DefaultPageConcurrency.
+	PageConcurrency int
+	// NoSplit analyzes PDFs without a source as one document instead of
+	// splitting scanned bundles into their documents
+	NoSplit bool
+	// ClassifyThreshold is the confidence a guessed document type needs to be
+	// used for a file without a source. Zero means analysis.DefaultClassifyThreshold.
+	ClassifyThreshold float64
+	// ConfirmSource, if set, is asked about guesses below ClassifyThreshold and
+	// returns the source to use; SourceUnknown leaves the file unclassified
+	ConfirmSource func(fileName string, guess analysis.Classification) analysis.DocumentSource
+	// ArchiveLimits bounds how far archive inputs are expanded; zero fields
+	// use archive.DefaultLimits
+	ArchiveLimits archive.Limits
+	// OCREngine reads images, scanned PDFs and slide pictures. Nil means Vision.
+	OCREngine ocr.OCREngine
+	// Preprocess selects the clean-up applied to image files before OCR by
+	// document type; the "" entry applies to types not listed. Pages of PDFs and
+	// multi-page TIFFs are OCR'd as they are. Nil disables preprocessing.
+	Preprocess map[analysis.DocumentSource]imageprep.Steps
+
+	analyzerMutex sync.Mutex
 }
 
 // ProgressUpdate provides progress information during batch processing
@@ -50,6 +110,7 @@ func NewProcessor(maxConcurrency int, skipAnalysis bool, lang string, dpi int, s
 		DPI:            dpi,
 		Source:         source,
 		ProgressChan:   make(chan ProgressUpdate, 100),
+		Preprocess:     DefaultPreprocess(),
 	}
 }
 
@@ -58,98 +119,76 @@ func (p *Processor) ProcessFiles(ctx context.Context, inputs []string) (*types.B
 	return p.ProcessFilesWithSources(ctx, inputs, nil)
 }
 
-// ProcessFilesWithSources processes multiple files with specific document sources
+// ProcessFilesWithSources processes multiple files with specific document sources.
+// Archive inputs are expanded and their files processed like any other input;
+// their results follow the archive's own result.
 func (p *Processor) ProcessFilesWithSources(ctx context.Context, inputs []string, fileSources map[string]analysis.DocumentSource) (*types.BatchResult, error) {
 	startTime := time.Now()
 	
-	// Create a semaphore to limit concurrent processing
-	semaphore := make(chan struct{}, p.MaxConcurrency)
-	
-	// Create channels for results and errors
-	resultsChan := make(chan types.FileResult, len(inputs))
-	errorChan := make(chan error, len(inputs))
-	
-	// Initialize customer check - this will be shared across all processing
-	check := &models.CustomerCheck{}
-	now := time.Now()
-	check.CheckCompletedAt = &now
-	
-	// Use a mutex to protect the shared customer check
-	var checkMutex sync.Mutex
-	
-	var wg sync.WaitGroup
-	
-	// Process files concurrently
+	jobs := make([]batchJob, len(inputs))
 	for i, input := range inputs {
-		wg.Add(1)
-		go func(index int, inputURL string) {
-			defer wg.Done()
-			
-			// Acquire semaphore
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
-			
-			// Send progress update
-			if p.ProgressChan != nil {
-				p.ProgressChan <- ProgressUpdate{
-					CurrentFile:    index + 1,
-					TotalFiles:     len(inputs),
-					CurrentFileURL: inputURL,
-					Status:         "processing",
-				}
-			}
-			
-			// Determine document source for this file
-			fileSource := p.Source
-			if fileSources != nil {
-				if specificSource, exists := fileSources[inputURL]; exists {
-					fileSource = specificSource
-				}
-			}
-			
-			// Process the file
-			result := p.processOneFileWithSource(ctx, inputURL, check, fileSource, &checkMutex)
-			resultsChan <- result
-			
-			// Send completion update
-			if p.ProgressChan != nil {
-				status := "completed"
-				if result.Error != "" {
-					status = "failed"
-				}
-				p.ProgressChan <- ProgressUpdate{
-					CurrentFile:    index + 1,
-					TotalFiles:     len(inputs),
-					CurrentFileURL: inputURL,
-					Status:         status,
-					Error:          func() error {
-						if result.Error != "" {
-							return fmt.Errorf(result.Error)
-						}
-						return nil
-					}(),
-				}
-			}
-		}(i, input)
+		// Determine document source for this file
+		fileSource := p.Source
+		if specificSource, exists := fileSources[input]; exists {
+			fileSource = specificSource
+		}
+		jobs[i] = batchJob{input: input, label: input, source: fileSource, inputIndex: i}
 	}
+	outcomes := p.runJobs(ctx, jobs)
 	
-	// Wait for all goroutines to complete
-	go func() {
-		wg.Wait()
-		close(resultsChan)
-		close(errorChan)
-	}()
+	// Process the files extracted from archive inputs, which inherit the archive's document source
+	var childJobs []batchJob
+	for i, outcome := range outcomes {
+		if outcome.extractDir != "" {
+			defer os.RemoveAll(outcome.extractDir)
+		}
+		for _, entry := range outcome.children {
+			childJobs = append(childJobs, batchJob{
+				input:      entry.Path,
+				label:      outcome.result.SourceURL + "!/" + entry.Name,
+				source:     jobs[i].source,
+				inputIndex: i,
+				parentURL:  outcome.result.SourceURL,
+				member:     entry.Name,
+			})
+		}
+	}
+	childOutcomes := p.runJobs(ctx, childJobs)
 	
-	// Collect results
+	// Results are in input order, each archive followed by its files and each
+	// split PDF replaced by its documents, regardless of which file finished first
 	var results []types.FileResult
-	var errors []error
-	
-	for result := range resultsChan {
-		results = append(results, result)
+	var extracted []map[string]interface{}
+	add := func(outcome fileOutcome) {
+		for _, doc := range outcome.documents() {
+			results = append(results, doc.result)
+			extracted = append(extracted, doc.extracted)
+		}
+	}
+	next := 0
+	for i, outcome := range outcomes {
+		add(outcome)
+		for ; next < len(childJobs) && childJobs[next].inputIndex == i; next++ {
+			add(childOutcomes[next])
+		}
 	}
 	
-	for err := range errorChan {
-		errors = append(errors, err)
+	// Aggregate the extracted data into the customer check in input order,
+	// so the outcome doesn't depend on which file finished first
+	check := &models.CustomerCheck{}
+	now := time.Now()
+	check.CheckCompletedAt = &now
+	merger := analysis.NewMerger(p.MergePolicy)
+	for i, extractedData := range extracted {
+		if extractedData == nil {
+			continue
+		}
+		// The file's own source may have been guessed by classification
+		source := analysis.DocumentSource(results[i].DocumentSource)
+		origin := models.FieldProvenance{SourceURL: results[i].SourceURL, FileName: results[i].FileName, PageStart: results[i].PageStart, PageEnd: results[i].PageEnd}
+		for _, fieldErr := range merger.AddDocument(i, extractedData, source, origin) {
+			results[i].Warnings = append(results[i].Warnings, fmt.Sprintf("could not use extracted value %s", fieldErr.Error()))
+		}
 	}
 	
 	endTime := time.Now()
@@ -170,7 +209,7 @@ func (p *Processor) ProcessFilesWithSources(ctx context.Context, inputs []string
 	}
 	
 	batchResult := &types.BatchResult{
-		TotalFiles:     len(inputs),
+		TotalFiles:     len(results),
 		ProcessedFiles: processedFiles,
 		FailedFiles:    failedFiles,
 		SkippedFiles:   skippedFiles,
@@ -181,31 +220,185 @@ func (p *Processor) ProcessFilesWithSources(ctx context.Context, inputs []string
 		CustomerCheck:  check, // Include the aggregated customer check
 	}
 	
+	// Merge the values extracted from all documents into the customer check
+	if err := merger.Resolve(check); err != nil {
+		return nil, fmt.Errorf("merge extracted fields: %w", err)
+	}
+	
 	// Post-process address comparison after all documents are processed
-	analysis.CompareAddresses(check)
+	var analyzer analysis.Analyzer
+	if !p.SkipAnalysis {
+		analyzer, _ = p.getAnalyzer()
+	}
+	analysis.CompareAddresses(ctx, check, analyzer)
 	
 	return batchResult, nil
 }
 
+// batchJob is one file to process: a batch input, or a file extracted from an archive input
+type batchJob struct {
+	input      string // URL or local path to process
+	label      string // identifies the file in progress updates, the journal and SourceURL
+	source     analysis.DocumentSource
+	inputIndex int
+	parentURL  string // SourceURL of the archive the file came from, if any
+	member     string // path of the file inside that archive
+}
+
+// link records the job's position in the batch, and the archive it came from,
+// on every result of its outcome
+func (job batchJob) link(outcome *fileOutcome) {
+	results := []*types.FileResult{&outcome.result}
+	for i := range outcome.segments {
+		results = append(results, &outcome.segments[i].result)
+	}
+	for _, r := range results {
+		r.InputIndex = job.inputIndex
+		if job.parentURL != "" {
+			r.SourceURL = job.label
+			r.FileName = path.Base(job.member)
+			r.ParentSourceURL = job.parentURL
+			r.ArchiveMember = job.member
+		}
+	}
+}
+
+// fileOutcome is the result of processing one file
+type fileOutcome struct {
+	result     types.FileResult
+	extracted  map[string]interface{} // raw analysis output, merged later in input order
+	children   []archive.Entry        // files extracted from an archive input
+	extractDir string                 // temp dir holding children, removed after the batch
+	segments   []fileOutcome          // documents of a PDF split into several documents
+}
+
+// documents returns the logical documents of an outcome: its segments if the
+// file was split, or else the file itself
+func (o fileOutcome) documents() []fileOutcome {
+	if len(o.segments) > 0 {
+		return o.segments
+	}
+	return []fileOutcome{o}
+}
+
+// runJobs processes jobs concurrently, up to MaxConcurrency at a time, and
+// returns their outcomes in job order
+func (p *Processor) runJobs(ctx context.Context, jobs []batchJob) []fileOutcome {
+	// Create a semaphore to limit concurrent processing
+	semaphore := make(chan struct{}, p.MaxConcurrency)
+	
+	// Each goroutine writes only its own slot, so outcomes stay in job order
+	outcomes := make([]fileOutcome, len(jobs))
+	
+	var wg sync.WaitGroup
+	
+	// Process files concurrently
+	for i, job := range jobs {
+		wg.Add(1)
+		go func(index int, job batchJob) {
+			defer wg.Done()
+			
+			// Acquire semaphore
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			
+			// Send progress update
+			p.sendProgress(ProgressUpdate{
+				CurrentFile:    index + 1,
+				TotalFiles:     len(jobs),
+				CurrentFileURL: job.label,
+				Status:         "processing",
+			})
+			
+			// Process the file, unless an earlier run already completed it
+			var outcome fileOutcome
+			if entry, done := p.Resumed[journalKey(job.label, job.source)]; done {
+				outcome.result, outcome.extracted = entry.Result, entry.Extracted
+				for _, seg := range entry.Segments {
+					outcome.segments = append(outcome.segments, fileOutcome{result: seg.Result, extracted: seg.Extracted})
+				}
+				job.link(&outcome)
+			} else {
+				outcome = p.processOneFileWithSource(ctx, job.input, job.source)
+				job.link(&outcome)
+				// Archives are expanded again on resume, so only their files are journaled
+				if p.Journal != nil && outcome.children == nil {
+					entry := JournalEntry{Input: job.label, Source: job.source, Result: outcome.result, Extracted: outcome.extracted}
+					for _, seg := range outcome.segments {
+						entry.Segments = append(entry.Segments, JournalSegment{Result: seg.result, Extracted: seg.extracted})
+					}
+					if err := p.Journal.Append(entry); err != nil {
+						fmt.Printf("Warning: failed to write journal entry for %s: %v\n", job.label, err)
+					}
+				}
+			}
+			outcomes[index] = outcome
+			result := outcome.result
+			for _, doc := range outcome.documents() {
+				if doc.result.Error != "" {
+					result = doc.result
+				}
+			}
+			
+			// Send completion update
+			status := "completed"
+			if result.Error != "" {
+				status = "failed"
+			}
+			p.sendProgress(ProgressUpdate{
+				CurrentFile:    index + 1,
+				TotalFiles:     len(jobs),
+				CurrentFileURL: job.label,
+				Status:         status,
+				Error:          func() error {
+					if result.Error != "" {
+						return fmt.Errorf(result.Error)
+					}
+					return nil
+				}(),
+			})
+		}(i, job)
+	}
+	
+	// Wait for all goroutines to complete
+	wg.Wait()
+	return outcomes
+}
+
+// sendProgress reports an update on ProgressChan without waiting. Nothing may
+// be reading the channel, so updates are dropped once its buffer is full.
+func (p *Processor) sendProgress(update ProgressUpdate) {
+	if p.ProgressChan == nil {
+		return
+	}
+	select {
+	case p.ProgressChan <- update:
+	default:
+	}
+}
+
 // processOneFile processes a single file
-func (p *Processor) processOneFile(ctx context.Context, input string, check *models.CustomerCheck) types.FileResult {
-	return p.processOneFileWithSource(ctx, input, check, p.Source, nil)
+func (p *Processor) processOneFile(ctx context.Context, input string) (types.FileResult, map[string]interface{}) {
+	outcome := p.processOneFileWithSource(ctx, input, p.Source)
+	return outcome.result, outcome.extracted
 }
 
 // processOneFileWithSource processes a single file with a specific document source
-func (p *Processor) processOneFileWithSource(ctx context.Context, input string, check *models.CustomerCheck, source analysis.DocumentSource, checkMutex *sync.Mutex) types.FileResult {
+// and returns the raw analysis output, which the caller merges into the customer check.
+// Archives are expanded rather than analyzed; the outcome lists their files.
+func (p *Processor) processOneFileWithSource(ctx context.Context, input string, source analysis.DocumentSource) fileOutcome {
 	startTime := time.Now()
 	
 	localPath, sourceURL, filename, mediaType, err := xfer.DownloadToTemp(ctx, input)
 	if err != nil {
-		return types.FileResult{
+		return fileOutcome{result: types.FileResult{
 			SourceURL:     sourceURL,
 			FileName:      filename,
 			FileType:      mediaType,
 			Error:         err.Error(),
 			ProcessedAt:   time.Now(),
 			ProcessingTime: time.Since(startTime),
-		}
+		}}
 	}
 	
 	// Get file size
@@ -217,6 +410,7 @@ func (p *Processor) processOneFileWithSource(ctx context.Context, input string,
 	
 	var text string
 	var extractErr error
+	var extractWarnings []string
 	
 	ft := files.DetectFileType(filename, mediaType)
 	
@@ -225,13 +419,66 @@ func (p *Processor) processOneFileWithSource(ctx context.Context, input string,
 		ft = files.FileTypeImage
 	}
 	
+	if ft == files.FileTypeArchive {
+		return p.expandArchive(ctx, types.FileResult{
+			SourceURL:      sourceURL,
+			LocalPath:      localPath,
+			FileName:       filename,
+			FileType:       ft.String(),
+			FileSize:       fileSize,
+			DocumentSource: string(source),
+		}, startTime)
+	}
+	
+	// PDFs and TIFFs are OCR'd page by page
+	paged := ft == files.FileTypePDF || isTIFF(filename, mediaType)
+	
+	// Reuse OCR text from an earlier run on the same file contents
+	var ocrKey string
+	cachedOCR := false
+	cacheOCR := true
+	var pdfText ocr.PDFText
+	var imageText cachedImage
+	if p.Cache != nil && (ft == files.FileTypeImage || ft == files.FileTypePDF) {
+		if hash, err := cache.FileHash(localPath); err == nil {
+			if paged {
+				ocrKey = cache.Key(hash, p.ocrEngine().Name(), p.Lang, strconv.Itoa(p.DPI))
+				cachedOCR, err = p.Cache.Get(cacheKindPDF, ocrKey, &pdfText)
+				text = pdfText.Text
+			} else {
+				ocrKey = cache.Key(hash, p.ocrEngine().Name(), p.Lang, strconv.Itoa(p.DPI), p.preprocessSteps(source).String())
+				cachedOCR, err = p.Cache.Get(cacheKindImage, ocrKey, &imageText)
+				text = imageText.Text
+			}
+			if err != nil {
+				fmt.Printf("Warning: ignoring OCR cache entry for %s: %v\n", filename, err)
+			}
+		}
+	}
+	
 	// Check if file type is processable
-	if !files.IsProcessableFileType(ft) {
+	if cachedOCR {
+		fmt.Printf("Using cached OCR text for %s\n", filename)
+	} else if !files.IsProcessableFileType(ft) {
 		extractErr = fmt.Errorf("unsupported file type: %s", ft.String())
 	} else {
 		switch ft {
 		case files.FileTypeImage:
-			text, extractErr = ocr.ExtractTextFromImageVision(ctx, localPath, p.Lang)
+			if paged {
+				pdfText, extractErr = ocr.ExtractPagesFromTIFF(ctx, p.ocrEngine(), localPath, p.Lang, p.PageConcurrency)
+				text = pdfText.Text
+				if extractErr == nil {
+					var pageWarnings []string
+					pageWarnings, extractErr = failedPages(pdfText.Pages)
+					extractWarnings = append(extractWarnings, pageWarnings...)
+					cacheOCR = len(pageWarnings) == 0 // Retry failed pages next run
+				}
+				break
+			}
+			var prepWarnings []string
+			imageText.ImageText, imageText.Preprocessed, prepWarnings, extractErr = p.ocrImage(ctx, localPath, source)
+			text = imageText.Text
+			extractWarnings = append(extractWarnings, prepWarnings...)
 			// If vision processing fails due to bad image data, try alternative approaches
 			if extractErr != nil && strings.Contains(extractErr.Error(), "Bad image data") {
 				fmt.Printf("Image appears corrupted, trying alternative processing methods...\n")
@@ -240,7 +487,8 @@ func (p *Processor) processOneFileWithSource(ctx context.Context, input string,
 				convertedPath, convertErr := p.convertImageToStandardFormat(ctx, localPath)
 				if convertErr == nil && convertedPath != "" {
 					fmt.Printf("Successfully converted image, retrying OCR...\n")
-					text, extractErr = ocr.ExtractTextFromImageVision(ctx, convertedPath, p.Lang)
+					imageText.ImageText, extractErr = ocr.OCRImage(ctx, p.ocrEngine(), convertedPath, p.Lang)
+					text = imageText.Text
 					// Clean up converted file
 					os.Remove(convertedPath)
 				}
@@ -251,6 +499,7 @@ func (p *Processor) processOneFileWithSource(ctx context.Context, input string,
 					tesseractText, tesseractErr := ocr.ExtractTextFromImageTesseract(ctx, localPath, p.Lang)
 					if tesseractErr == nil && strings.TrimSpace(tesseractText) != "" {
 						text = tesseractText
+						imageText.ImageText = ocr.ImageText{Text: tesseractText, Engine: ocr.EngineTesseract}
 						extractErr = nil
 						fmt.Printf("Successfully extracted text using Tesseract fallback\n")
 					}
@@ -263,6 +512,7 @@ func (p *Processor) processOneFileWithSource(ctx context.Context, input string,
 						fmt.Printf("Site visit photo processing failed, using default value for company signboard\n")
 						text = "No signboard visible or signboard unclear in site visit photos"
 						extractErr = nil // Clear the error so processing can continue
+						cacheOCR = false // Don't let the placeholder outlive this run
 					} else {
 						extractErr = fmt.Errorf("image file appears to be corrupted or in an unsupported format, tried multiple processing methods: %w", extractErr)
 					}
@@ -276,15 +526,61 @@ func (p *Processor) processOneFileWithSource(ctx context.Context, input string,
 				text = string(b)
 			}
 		case files.FileTypePDF:
-			text, extractErr = ocr.ExtractTextFromPDF(ctx, localPath, p.Lang, p.DPI)
-		case files.FileTypeWord, files.FileTypeExcel, files.FileTypePowerPoint:
-			// For now, these are not supported but we can add support later
-			extractErr = fmt.Errorf("office document processing not yet implemented for %s", ft.String())
+			pdfText, extractErr = ocr.ExtractPagesFromPDF(ctx, p.ocrEngine(), localPath, p.Lang, p.DPI, p.PageConcurrency)
+			text = pdfText.Text
+			if extractErr == nil {
+				var pageWarnings []string
+				pageWarnings, extractErr = failedPages(pdfText.Pages)
+				extractWarnings = append(extractWarnings, pageWarnings...)
+				cacheOCR = len(pageWarnings) == 0 // Retry failed pages next run
+			}
+		case files.FileTypeWord:
+			text, extractErr = office.ExtractTextFromWord(ctx, localPath)
+		case files.FileTypeExcel:
+			text, extractErr = office.ExtractTextFromExcel(ctx, localPath)
+		case files.FileTypePowerPoint:
+			ocrImage := func(ctx context.Context, imagePath string) (string, error) {
+				image, err := ocr.OCRImage(ctx, p.ocrEngine(), imagePath, p.Lang)
+				return image.Text, err
+			}
+			text, extractWarnings, extractErr = office.ExtractTextFromPowerPoint(ctx, localPath, ocrImage)
 		default:
 			extractErr = fmt.Errorf("unsupported file type: %s", ft.String())
 		}
 	}
 	
+	if ocrKey != "" && !cachedOCR && cacheOCR && extractErr == nil && strings.TrimSpace(text) != "" {
+		var err error
+		if paged {
+			err = p.Cache.Put(cacheKindPDF, ocrKey, pdfText)
+		} else {
+			err = p.Cache.Put(cacheKindImage, ocrKey, imageText)
+		}
+		if err != nil {
+			fmt.Printf("Warning: failed to cache OCR text for %s: %v\n", filename, err)
+		}
+	}
+	
+	// Guess the document type of files that came without one. PDFs may be
+	// scanned bundles of several documents, which are split by page.
+	var guess analysis.Classification
+	var segments []analysis.Segment
+	if source == analysis.SourceUnknown && strings.TrimSpace(text) != "" {
+		var classifyWarnings []string
+		if paged && !p.NoSplit && nonEmptyPages(pdfText.PageTexts()) > 1 {
+			segments, classifyWarnings = p.segment(ctx, pdfText.PageTexts())
+			if len(segments) == 1 {
+				guess = segments[0].Classification
+				var resolveWarnings []string
+				source, resolveWarnings = p.resolveGuess(filename, guess)
+				classifyWarnings = append(classifyWarnings, resolveWarnings...)
+			}
+		} else {
+			source, guess, classifyWarnings = p.classify(ctx, filename, text)
+		}
+		extractWarnings = append(extractWarnings, classifyWarnings...)
+	}
+	
 	res := types.FileResult{
 		SourceURL:      sourceURL,
 		LocalPath:      localPath,
@@ -295,41 +591,271 @@ func (p *Processor) processOneFileWithSource(ctx context.Context, input string,
 		ProcessingTime: time.Since(startTime),
 		FileSize:       fileSize,
 		DocumentSource: string(source),
+		Warnings:       extractWarnings,
+		GuessedSource:  string(guess.Source),
+		SourceConfidence: guess.Confidence,
+		Pages:          pdfText.Pages,
+		Layout:         pdfText.Layout,
+		OCREngine:      pageEngines(pdfText.Pages),
+		Preprocessed:   imageText.Preprocessed,
+	}
+	if imageText.Layout != nil {
+		res.Layout = []types.PageLayout{*imageText.Layout}
+	}
+	if imageText.Engine != "" {
+		res.OCREngine = imageText.Engine
+		res.OCRScores = imageText.Scores
 	}
 	
 	if extractErr != nil {
 		res.Error = extractErr.Error()
 	}
 	
+	if len(segments) > 1 {
+		return p.analyzeSegments(ctx, res, ft, localPath, pdfText.Pages, segments)
+	}
+	return p.analyzeText(ctx, res, ft, localPath)
+}
+
+// analyzeText analyzes the extracted text of a file with AI, unless there is
+// no text or analysis is skipped
+func (p *Processor) analyzeText(ctx context.Context, res types.FileResult, ft files.FileType, localPath string) fileOutcome {
+	text := res.ExtractedText
+	source := analysis.DocumentSource(res.DocumentSource)
+	
 	// Analyze with AI if text was extracted successfully and analysis is not skipped
 	if text != "" && !p.SkipAnalysis {
 		var extractedData map[string]interface{}
 		var err error
 		
-		// Use Gemini API
-		client, clientErr := analysis.NewGeminiClient()
-		if clientErr != nil {
-			res.Error = fmt.Sprintf("Gemini client initialization error: %v", clientErr)
-			return res
+		// Financial statement workbooks can be mapped from their cells directly
+		if p.ExcelDirect && ft == files.FileTypeExcel && source == analysis.SourceFinancialStatement {
+			mapped, ok, err := office.MapFinancialStatement(ctx, localPath)
+			if err != nil {
+				res.Warnings = append(res.Warnings, fmt.Sprintf("direct cell mapping failed, using LLM: %v", err))
+			} else if ok {
+				return fileOutcome{result: res, extracted: mapped}
+			} else {
+				res.Warnings = append(res.Warnings, "no known rows or period headers for direct cell mapping, using LLM")
+			}
+		}
+		
+		// Use the configured LLM backend
+		analyzer, analyzerErr := p.getAnalyzer()
+		if analyzerErr != nil {
+			res.Error = fmt.Sprintf("LLM client initialization error: %v", analyzerErr)
+			return fileOutcome{result: res}
 		}
 		
-		extractedData, err = client.AnalyzeDocument(ctx, text, source)
+		extractedData, err = analyzer.AnalyzeDocument(ctx, text, source)
 		if err != nil {
-			res.Error = fmt.Sprintf("Gemini analysis error: %v", err)
-			return res
+			res.Error = fmt.Sprintf("%s analysis error: %v", analyzer.Name(), err)
+			return fileOutcome{result: res}
 		}
 		
-		// Update customer check with extracted data (thread-safe)
-		if checkMutex != nil {
-			checkMutex.Lock()
+		return fileOutcome{result: res, extracted: extractedData}
+	}
+	
+	return fileOutcome{result: res}
+}
+
+// analyzeSegments analyzes each document of a multi-document PDF as a result
+// of its own, carrying its page range
+func (p *Processor) analyzeSegments(ctx context.Context, res types.FileResult, ft files.FileType, localPath string, pages []types.PageResult, segments []analysis.Segment) fileOutcome {
+	fmt.Printf("Split %s into %d documents\n", res.FileName, len(segments))
+	outcome := fileOutcome{result: res}
+	for _, seg := range segments {
+		segRes := res
+		segRes.PageStart = seg.PageStart
+		segRes.PageEnd = seg.PageEnd
+		segRes.Pages = pages[seg.PageStart-1 : seg.PageEnd]
+		segRes.Layout = ocr.LayoutOf(res.Layout, seg.PageStart, seg.PageEnd)
+		segRes.OCREngine = pageEngines(segRes.Pages)
+		segRes.ExtractedText = ocr.JoinPages(ocr.PDFText{Pages: segRes.Pages}.PageTexts())
+		segRes.GuessedSource = string(seg.Source)
+		segRes.SourceConfidence = seg.Confidence
+		segRes.Warnings = append([]string(nil), res.Warnings...)
+		
+		source, warnings := p.resolveGuess(fmt.Sprintf("%s %s", res.FileName, pageRange(seg.PageStart, seg.PageEnd)), seg.Classification)
+		segRes.DocumentSource = string(source)
+		segRes.Warnings = append(segRes.Warnings, warnings...)
+		outcome.segments = append(outcome.segments, p.analyzeText(ctx, segRes, ft, localPath))
+	}
+	return outcome
+}
+
+// segment splits the pages of a PDF into documents
+func (p *Processor) segment(ctx context.Context, pages []string) ([]analysis.Segment, []string) {
+	analyzer, warnings := p.classificationAnalyzer()
+	segments, err := analysis.SegmentPages(ctx, analyzer, pages)
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("splitting pages by keywords only: %v", err))
+	}
+	return segments, warnings
+}
+
+// failedPages reports the pages OCR failed on as a warning, or as an error if
+// it failed on every page
+func failedPages(pages []types.PageResult) ([]string, error) {
+	var failed []string
+	var firstErr string
+	for _, page := range pages {
+		if page.Error == "" {
+			continue
 		}
-		analysis.UpdateCustomerCheck(check, extractedData, source)
-		if checkMutex != nil {
-			checkMutex.Unlock()
+		failed = append(failed, strconv.Itoa(page.Page))
+		if firstErr == "" {
+			firstErr = page.Error
+		}
+	}
+	switch {
+	case len(failed) == 0:
+		return nil, nil
+	case len(failed) == len(pages):
+		return nil, fmt.Errorf("OCR failed on all %d pages: %s", len(pages), firstErr)
+	default:
+		return []string{fmt.Sprintf("OCR failed on page(s) %s of %d: %s", strings.Join(failed, ", "), len(pages), firstErr)}, nil
+	}
+}
+
+// pageEngines lists the OCR engines that read the pages, e.g. "vision,tesseract"
+func pageEngines(pages []types.PageResult) string {
+	var engines []string
+	for _, page := range pages {
+		if page.Method != "" && page.Method != ocr.PageMethodTextLayer && !slices.Contains(engines, page.Method) {
+			engines = append(engines, page.Method)
+		}
+	}
+	return strings.Join(engines, ",")
+}
+
+// isTIFF reports whether an image is a TIFF, which may hold several pages
+func isTIFF(filename, mediaType string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return ext == ".tif" || ext == ".tiff" || mediaType == "image/tiff"
+}
+
+// nonEmptyPages counts the pages that have text
+func nonEmptyPages(pages []string) int {
+	n := 0
+	for _, page := range pages {
+		if strings.TrimSpace(page) != "" {
+			n++
 		}
 	}
+	return n
+}
+
+// pageRange formats a page range as "p. 3" or "pp. 3-5"
+func pageRange(start, end int) string {
+	if start == end {
+		return fmt.Sprintf("p. %d", start)
+	}
+	return fmt.Sprintf("pp. %d-%d", start, end)
+}
+
+// expandArchive extracts an archive input into a temp dir. The archive's own
+// result carries no text; its files are returned for processing.
+func (p *Processor) expandArchive(ctx context.Context, res types.FileResult, startTime time.Time) fileOutcome {
+	dir, err := os.MkdirTemp("", "extraction-archive-*")
+	if err != nil {
+		res.Error = fmt.Sprintf("failed to create archive directory: %v", err)
+		res.ProcessedAt = time.Now()
+		res.ProcessingTime = time.Since(startTime)
+		return fileOutcome{result: res}
+	}
 	
-	return res
+	entries, warnings, err := archive.ExpandNamed(ctx, res.LocalPath, res.FileName, dir, p.ArchiveLimits)
+	res.Warnings = append(res.Warnings, warnings...)
+	res.ProcessedAt = time.Now()
+	res.ProcessingTime = time.Since(startTime)
+	if err != nil {
+		os.RemoveAll(dir)
+		res.Error = fmt.Sprintf("failed to expand archive: %v", err)
+		return fileOutcome{result: res}
+	}
+	if len(entries) == 0 {
+		res.Warnings = append(res.Warnings, "archive contains no files")
+	}
+	fmt.Printf("Expanded %s into %d files\n", res.FileName, len(entries))
+	return fileOutcome{result: res, children: entries, extractDir: dir}
+}
+
+// classify guesses the document type of a file from its text
+func (p *Processor) classify(ctx context.Context, filename, text string) (analysis.DocumentSource, analysis.Classification, []string) {
+	analyzer, warnings := p.classificationAnalyzer()
+	guess, err := analysis.ClassifyDocument(ctx, analyzer, text)
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("classifying by keywords only: %v", err))
+	}
+	source, resolveWarnings := p.resolveGuess(filename, guess)
+	return source, guess, append(warnings, resolveWarnings...)
+}
+
+// classificationAnalyzer returns the analyzer used to classify documents, or
+// nil if only keywords can be used
+func (p *Processor) classificationAnalyzer() (analysis.Analyzer, []string) {
+	if p.SkipAnalysis {
+		return nil, nil
+	}
+	analyzer, err := p.getAnalyzer()
+	if err != nil {
+		return nil, []string{fmt.Sprintf("classifying by keywords only: LLM client initialization error: %v", err)}
+	}
+	return analyzer, nil
+}
+
+// resolveGuess decides which document type to use for a guess. Guesses below
+// the confidence threshold are put to ConfirmSource, or else left unused.
+func (p *Processor) resolveGuess(name string, guess analysis.Classification) (analysis.DocumentSource, []string) {
+	var warnings []string
+	threshold := p.ClassifyThreshold
+	if threshold <= 0 {
+		threshold = analysis.DefaultClassifyThreshold
+	}
+	source := guess.Source
+	if guess.Source == analysis.SourceUnknown || guess.Confidence < threshold {
+		source = analysis.SourceUnknown
+		if p.ConfirmSource != nil {
+			source = p.ConfirmSource(name, guess)
+		}
+		if source == analysis.SourceUnknown {
+			warnings = append(warnings, fmt.Sprintf("document type unclear (best guess %s, confidence %.2f); set it with --file-source", guess.Source, guess.Confidence))
+		}
+	}
+	switch {
+	case source == guess.Source && source != analysis.SourceUnknown:
+		fmt.Printf("Classified %s as %s (%s, confidence %.2f)\n", name, source, guess.Method, guess.Confidence)
+	case source != analysis.SourceUnknown:
+		fmt.Printf("Using document type %s for %s instead of the guessed %s\n", source, name, guess.Source)
+	}
+	return source, warnings
+}
+
+// ocrEngine returns the configured OCR engine, Vision by default
+func (p *Processor) ocrEngine() ocr.OCREngine {
+	if p.OCREngine == nil {
+		return ocr.VisionEngine{}
+	}
+	return p.OCREngine
+}
+
+// getAnalyzer returns the shared analyzer, creating it from Provider on first use
+func (p *Processor) getAnalyzer() (analysis.Analyzer, error) {
+	p.analyzerMutex.Lock()
+	defer p.analyzerMutex.Unlock()
+	
+	if p.Analyzer == nil {
+		analyzer, err := analysis.NewAnalyzer(p.Provider)
+		if err != nil {
+			return nil, err
+		}
+		if p.Cache != nil {
+			analyzer = analysis.NewCachedAnalyzer(analyzer, p.Cache)
+		}
+		p.Analyzer = analyzer
+	}
+	return p.Analyzer, nil
 }
 
 // GetProcessingStats calculates processing statistics
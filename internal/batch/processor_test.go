@@ -0,0 +1,92 @@
+package batch
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"extraction/internal/analysis"
+)
+
+// processArchive runs a batch of one archive without analysis and fails the
+// test if it doesn't finish in time
+func processArchive(t *testing.T, p *Processor, archivePath string) []string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	done := make(chan []string, 1)
+	go func() {
+		result, err := p.ProcessFiles(ctx, []string{archivePath})
+		if err != nil {
+			t.Error(err)
+			done <- nil
+			return
+		}
+		var texts []string
+		for _, r := range result.Results {
+			if r.Error != "" {
+				t.Errorf("%s: %s", r.SourceURL, r.Error)
+			}
+			texts = append(texts, r.ExtractedText)
+		}
+		done <- texts
+	}()
+	select {
+	case texts := <-done:
+		return texts
+	case <-ctx.Done():
+		t.Fatalf("batch did not finish")
+		return nil
+	}
+}
+
+func TestProcessFilesUnreadProgress(t *testing.T) {
+	// Two updates per file overflow the channel's buffer when nothing reads it
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i < 120; i++ {
+		w, err := zw.Create(fmt.Sprintf("notes/%03d.txt", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(w, "note %d", i)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archivePath := filepath.Join(t.TempDir(), "notes.zip")
+	if err := os.WriteFile(archivePath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewProcessor(4, true, "vie", 300, analysis.SourceSiteVisitPhotos)
+	defer p.Close()
+	texts := processArchive(t, p, archivePath)
+	if len(texts) != 121 || texts[120] != "note 119" {
+		t.Errorf("%d results, want the archive and its 120 files", len(texts))
+	}
+}
+
+func TestProcessFilesGzippedText(t *testing.T) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Write([]byte("Giấy chứng nhận đăng ký doanh nghiệp"))
+	gw.Close()
+	archivePath := filepath.Join(t.TempDir(), "license.txt.gz")
+	if err := os.WriteFile(archivePath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewProcessor(1, true, "vie", 300, analysis.SourceBusinessLicense)
+	defer p.Close()
+	texts := processArchive(t, p, archivePath)
+	if len(texts) != 2 || texts[1] != "Giấy chứng nhận đăng ký doanh nghiệp" {
+		t.Errorf("texts = %q, want the archive and the text of license.txt", texts)
+	}
+}
@@ -0,0 +1,143 @@
+package batch
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"extraction/internal/analysis"
+	"extraction/internal/export"
+	"extraction/internal/models"
+	"github.com/xuri/excelize/v2"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// replayDir holds the end-to-end test: text inputs, LLM fixtures recorded
+// with --record-dir, and the golden dump of the customer check workbook
+const replayDir = "testdata/replay"
+
+// replayDocuments are the inputs of the end-to-end test and their sources
+var replayDocuments = []struct {
+	file   string
+	source analysis.DocumentSource
+}{
+	{"business_license.txt", analysis.SourceBusinessLicense},
+	{"evn_bill.txt", analysis.SourceEVNBill},
+	{"id_check.txt", analysis.SourceIDCheck},
+	{"land_certificate.txt", analysis.SourceLandCertificate},
+}
+
+func replayInputs() []string {
+	var inputs []string
+	for _, doc := range replayDocuments {
+		inputs = append(inputs, filepath.Join(replayDir, "inputs", doc.file))
+	}
+	return inputs
+}
+
+func replaySources(inputs []string) map[string]analysis.DocumentSource {
+	sources := map[string]analysis.DocumentSource{}
+	for i, doc := range replayDocuments {
+		sources[inputs[i]] = doc.source
+	}
+	return sources
+}
+
+// TestReplayEndToEnd runs text inputs through the batch processor, the merger
+// and the workbook export with recorded LLM responses, without network access
+func TestReplayEndToEnd(t *testing.T) {
+	replay, err := analysis.NewReplayAnalyzer(filepath.Join(replayDir, "fixtures"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewProcessor(2, false, "vie", 300, analysis.SourceUnknown)
+	p.Analyzer = replay
+	defer p.Close()
+
+	inputs := replayInputs()
+	result, err := p.ProcessFilesWithSources(context.Background(), inputs, replaySources(inputs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range result.Results {
+		if r.Error != "" {
+			t.Errorf("%s: %s", r.FileName, r.Error)
+		}
+	}
+	check, ok := result.CustomerCheck.(*models.CustomerCheck)
+	if !ok {
+		t.Fatalf("no customer check in the batch result")
+	}
+	if check.Land.EVN.BillingAddressMatchesClient != models.Yes {
+		t.Errorf("billing address match = %q, want the recorded LLM comparison (yes)", check.Land.EVN.BillingAddressMatchesClient)
+	}
+
+	out := filepath.Join(t.TempDir(), "customer_check.xlsx")
+	if err := export.WriteCustomerCheck(check, out); err != nil {
+		t.Fatal(err)
+	}
+	got := dumpWorkbook(t, out)
+
+	golden := filepath.Join(replayDir, "customer_check.golden")
+	if *update {
+		if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("workbook differs from %s (run with -update to accept):\n%s", golden, lineDiff(string(want), got))
+	}
+}
+
+// dumpWorkbook renders every sheet of a workbook as tab-separated rows. The
+// check's completion time changes with every run and is masked.
+func dumpWorkbook(t *testing.T, path string) string {
+	t.Helper()
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var b strings.Builder
+	for _, sheet := range f.GetSheetList() {
+		rows, err := f.GetRows(sheet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.WriteString("== " + sheet + " ==\n")
+		for _, row := range rows {
+			if len(row) > 1 && row[0] == "Check Completed At" {
+				row[1] = "<completed at>"
+			}
+			b.WriteString(strings.Join(row, "\t") + "\n")
+		}
+	}
+	return b.String()
+}
+
+// lineDiff lists the lines of want and got that differ
+func lineDiff(want, got string) string {
+	w, g := strings.Split(want, "\n"), strings.Split(got, "\n")
+	var b strings.Builder
+	for i := 0; i < max(len(w), len(g)); i++ {
+		var wl, gl string
+		if i < len(w) {
+			wl = w[i]
+		}
+		if i < len(g) {
+			gl = g[i]
+		}
+		if wl != gl {
+			b.WriteString("- " + wl + "\n+ " + gl + "\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Cache is a content-addressed on-disk store for expensive results such as
+// OCR text and LLM output. Entries are JSON files under dir/<kind>/, named by key.
+type Cache struct {
+	dir     string
+	refresh bool
+}
+
+// New creates a cache rooted at dir. With refresh set, lookups always miss
+// but new results are still stored, replacing stale entries.
+func New(dir string, refresh bool) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("cache dir: %w", err)
+	}
+	return &Cache{dir: dir, refresh: refresh}, nil
+}
+
+// DefaultDir returns the cache location under the user's cache directory,
+// e.g. ~/.cache/extraction on Linux
+func DefaultDir() string {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		base = os.TempDir()
+	}
+	return filepath.Join(base, "extraction")
+}
+
+// Key hashes the given parts into a cache key. Parts are length-prefixed so
+// ("ab", "c") and ("a", "bc") produce different keys.
+func Key(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		fmt.Fprintf(h, "%d:%s", len(p), p)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// FileHash returns the SHA-256 of a file's contents
+func FileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Get loads the entry for kind and key into v. It reports false on a miss
+// or when the cache is refreshing.
+func (c *Cache) Get(kind, key string, v interface{}) (bool, error) {
+	if c.refresh {
+		return false, nil
+	}
+	data, err := os.ReadFile(c.path(kind, key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("read cache entry: %w", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("decode cache entry %s/%s: %w", kind, key, err)
+	}
+	return true, nil
+}
+
+// Put stores v as the entry for kind and key
+func (c *Cache) Put(kind, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode cache entry: %w", err)
+	}
+	path := c.path(kind, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("write cache entry: %w", err)
+	}
+
+	// Write to a temp file first so concurrent readers never see a partial entry
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("write cache entry: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write cache entry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write cache entry: %w", err)
+	}
+	return nil
+}
+
+// path shards entries by the first two key characters to keep directories small
+func (c *Cache) path(kind, key string) string {
+	if len(key) < 2 {
+		return filepath.Join(c.dir, kind, key+".json")
+	}
+	return filepath.Join(c.dir, kind, key[:2], key+".json")
+}
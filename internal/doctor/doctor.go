@@ -0,0 +1,115 @@
+// Package doctor reports which of the optional external tools the extractor
+// can use are installed, and what is lost without them.
+package doctor
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// Tool is an external program, or a set of interchangeable ones
+type Tool struct {
+	Name     string
+	Commands []string // the first one found on PATH is used
+	Purpose  string
+	Without  string // what happens when none of Commands is installed
+	Path     string // where the command was found; empty if missing
+}
+
+// Found reports whether one of the tool's commands is on PATH
+func (t Tool) Found() bool { return t.Path != "" }
+
+// tools lists the external programs the extractor calls, in report order
+var tools = []Tool{
+	{
+		Name:     "Poppler pdftotext",
+		Commands: []string{"pdftotext"},
+		Purpose:  "PDF text layers",
+		Without:  "text layers are read by the built-in PDF reader",
+	},
+	{
+		Name:     "Poppler pdftoppm",
+		Commands: []string{"pdftoppm"},
+		Purpose:  "rendering PDF pages for OCR",
+		Without:  "only scanned pages are OCR'd, from the image they embed",
+	},
+	{
+		Name:     "Tesseract",
+		Commands: []string{"tesseract"},
+		Purpose:  "local OCR (--ocr-engine tesseract)",
+		Without:  "only Google Vision can OCR",
+	},
+	{
+		Name:     "LibreOffice",
+		Commands: []string{"soffice", "libreoffice"},
+		Purpose:  "legacy .xls and .ppt files",
+		Without:  "those files can't be read",
+	},
+	{
+		Name:     "antiword/catdoc",
+		Commands: []string{"antiword", "catdoc"},
+		Purpose:  "legacy .doc files",
+		Without:  ".doc files need LibreOffice",
+	},
+	{
+		Name:     "unrar",
+		Commands: []string{"unrar", "7zz", "7z"},
+		Purpose:  ".rar archives (unrar, or a full 7-Zip)",
+		Without:  ".rar archives can't be opened",
+	},
+	{
+		Name:     "7-Zip",
+		Commands: []string{"7zz", "7z", "7za"},
+		Purpose:  ".7z archives",
+		Without:  ".7z archives can't be opened",
+	},
+	{
+		Name:     "ImageMagick/ffmpeg",
+		Commands: []string{"convert", "ffmpeg"},
+		Purpose:  "converting HEIC and other images Go can't decode",
+		Without:  "those images are OCR'd as they are, without preprocessing",
+	},
+}
+
+// Check looks up every tool on PATH
+func Check() []Tool {
+	checked := make([]Tool, len(tools))
+	for i, t := range tools {
+		for _, cmd := range t.Commands {
+			if p, err := exec.LookPath(cmd); err == nil {
+				t.Path = p
+				break
+			}
+		}
+		checked[i] = t
+	}
+	return checked
+}
+
+// Missing returns the names of the tools that weren't found
+func Missing(checked []Tool) []string {
+	var names []string
+	for _, t := range checked {
+		if !t.Found() {
+			names = append(names, t.Name)
+		}
+	}
+	return names
+}
+
+// Report writes one line per tool: where it was found, or what is lost without it
+func Report(w io.Writer, checked []Tool) {
+	width := 0
+	for _, t := range checked {
+		width = max(width, len(t.Name))
+	}
+	for _, t := range checked {
+		if t.Found() {
+			fmt.Fprintf(w, "  ok       %-*s  %s (%s)\n", width, t.Name, t.Path, t.Purpose)
+		} else {
+			fmt.Fprintf(w, "  missing  %-*s  %s: %s (looked for %s)\n", width, t.Name, t.Purpose, t.Without, strings.Join(t.Commands, ", "))
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package doctor
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCheckArchiveTools(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs executable files without an extension")
+	}
+	for _, tt := range []struct {
+		installed       []string
+		wantRar, want7z bool
+	}{
+		{nil, false, false},
+		{[]string{"unrar"}, true, false},
+		{[]string{"7za"}, false, true},
+		{[]string{"7zz"}, true, true},
+		{[]string{"unrar", "7z"}, true, true},
+	} {
+		bin := t.TempDir()
+		for _, name := range tt.installed {
+			if err := os.WriteFile(filepath.Join(bin, name), []byte("#!/bin/sh\n"), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		t.Setenv("PATH", bin)
+		found := map[string]bool{}
+		for _, tool := range Check() {
+			found[tool.Name] = tool.Found()
+		}
+		if found["unrar"] != tt.wantRar || found["7-Zip"] != tt.want7z {
+			t.Errorf("with %v installed: rar %v, 7z %v, want %v, %v", tt.installed, found["unrar"], found["7-Zip"], tt.wantRar, tt.want7z)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package export
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
 	"time"
 
 	"extraction/internal/models"
@@ -27,6 +29,11 @@ func WriteCustomerCheck(check *models.CustomerCheck, outPath string) error {
 	writeCorporateInfo(f, corporateSheet, check)
 	writeLandInfo(f, landSheet, check)
 	writeAdditionalInfo(f, additionalSheet, check)
+	if len(check.Conflicts) > 0 {
+		conflictsSheet := "Conflicts"
+		f.NewSheet(conflictsSheet)
+		writeConflicts(f, conflictsSheet, check)
+	}
 
 	if err := f.SaveAs(outPath); err != nil {
 		return fmt.Errorf("save xlsx: %w", err)
@@ -53,25 +60,25 @@ func writeCorporateInfo(f *excelize.File, sheet string, check *models.CustomerCh
 	_ = f.MergeCell(sheet, cell, "C2")
 	_ = f.SetCellStyle(sheet, cell, "C2", sectionStyle)
 	row++
-	writeField(f, sheet, row, "Client Name", check.Corporate.General.ClientName, "Business License")
+	writeField(f, sheet, row, "Client Name", check.Corporate.General.ClientName, sourceFor(check, "corporate.general.client_name", "Business License"))
 	row++
-	writeField(f, sheet, row, "Client Type", string(check.Corporate.General.ClientType), "Business License")
+	writeField(f, sheet, row, "Client Type", string(check.Corporate.General.ClientType), sourceFor(check, "corporate.general.client_type", "Business License"))
 	row++
-	writeField(f, sheet, row, "Tax Code (MST)", check.Corporate.General.TaxCodeMST, "Business License")
+	writeField(f, sheet, row, "Tax Code (MST)", check.Corporate.General.TaxCodeMST, sourceFor(check, "corporate.general.tax_code_mst", "Business License"))
 	row++
-	writeField(f, sheet, row, "Business License GPKD", string(check.Corporate.General.BusinessLicenseGPKD), "Business License")
+	writeField(f, sheet, row, "Business License GPKD", string(check.Corporate.General.BusinessLicenseGPKD), sourceFor(check, "corporate.general.business_license_gpkd", "Business License"))
 	row++
-	writeField(f, sheet, row, "Business Address", check.Corporate.General.BusinessAddress, "Business License")
+	writeField(f, sheet, row, "Business Address", check.Corporate.General.BusinessAddress, sourceFor(check, "corporate.general.business_address", "Business License"))
 	row++
 	var capitalStr string
 	if check.Corporate.General.RegisteredShareCapital != nil {
 		capitalStr = fmt.Sprintf("%d VND", *check.Corporate.General.RegisteredShareCapital)
 	}
-	writeField(f, sheet, row, "Registered Share Capital", capitalStr, "Business License")
+	writeField(f, sheet, row, "Registered Share Capital", capitalStr, sourceFor(check, "corporate.general.registered_share_capital", "Business License"))
 	row++
-	writeField(f, sheet, row, "Customer Type", string(check.Corporate.General.CustomerType), "Business License")
+	writeField(f, sheet, row, "Customer Type", string(check.Corporate.General.CustomerType), sourceFor(check, "corporate.general.customer_type", "Business License"))
 	row++
-	writeField(f, sheet, row, "Business Operations", check.Corporate.General.BusinessOperations, "Business License")
+	writeField(f, sheet, row, "Business Operations", check.Corporate.General.BusinessOperations, sourceFor(check, "corporate.general.business_operations", "Business License"))
 
 	row += 2
 	cell, _ = excelize.CoordinatesToCellName(1, row)
@@ -83,9 +90,9 @@ func writeCorporateInfo(f *excelize.File, sheet string, check *models.CustomerCh
 	if check.Corporate.History.IncorporationDate != nil {
 		dateStr = check.Corporate.History.IncorporationDate.Format("2006-01-02")
 	}
-	writeField(f, sheet, row, "Incorporation Date", dateStr, "Business License")
+	writeField(f, sheet, row, "Incorporation Date", dateStr, sourceFor(check, "corporate.history.incorporation_date", "Business License"))
 	row++
-	writeField(f, sheet, row, "History Description", check.Corporate.History.HistoryDescription, "CIC Report")
+	writeField(f, sheet, row, "History Description", check.Corporate.History.HistoryDescription, sourceFor(check, "corporate.history.history_description", "CIC Report"))
 
 	row += 2
 	cell, _ = excelize.CoordinatesToCellName(1, row)
@@ -93,13 +100,13 @@ func writeCorporateInfo(f *excelize.File, sheet string, check *models.CustomerCh
 	_ = f.MergeCell(sheet, cell, fmt.Sprintf("%s%d", "C", row))
 	_ = f.SetCellStyle(sheet, cell, fmt.Sprintf("%s%d", "C", row), sectionStyle)
 	row++
-	writeField(f, sheet, row, "Owner's Name", check.Corporate.Ownership.OwnersName, "Business License")
+	writeField(f, sheet, row, "Owner's Name", check.Corporate.Ownership.OwnersName, sourceFor(check, "corporate.ownership.owners_name", "Business License"))
 	row++
-	writeField(f, sheet, row, "Ownership Category", string(check.Corporate.Ownership.OwnershipCategory), "Business License")
+	writeField(f, sheet, row, "Ownership Category", string(check.Corporate.Ownership.OwnershipCategory), sourceFor(check, "corporate.ownership.ownership_category", "Business License"))
 	row++
-	writeField(f, sheet, row, "Company Director Name", check.Corporate.Ownership.CompanyDirectorName, "ID Check")
+	writeField(f, sheet, row, "Company Director Name", check.Corporate.Ownership.CompanyDirectorName, sourceFor(check, "corporate.ownership.company_director_name", "ID Check"))
 	row++
-	writeField(f, sheet, row, "Key Decision Maker", check.Corporate.Ownership.KeyDecisionMaker, "ID Check")
+	writeField(f, sheet, row, "Key Decision Maker", check.Corporate.Ownership.KeyDecisionMaker, sourceFor(check, "corporate.ownership.key_decision_maker", "ID Check"))
 }
 
 func writeLandInfo(f *excelize.File, sheet string, check *models.CustomerCheck) {
@@ -121,17 +128,17 @@ func writeLandInfo(f *excelize.File, sheet string, check *models.CustomerCheck)
 	_ = f.MergeCell(sheet, cell, "C2")
 	_ = f.SetCellStyle(sheet, cell, "C2", sectionStyle)
 	row++
-	writeField(f, sheet, row, "Billing Address", check.Land.EVN.BillingAddress, "EVN Bill")
+	writeField(f, sheet, row, "Billing Address", check.Land.EVN.BillingAddress, sourceFor(check, "land.evn.billing_address", "EVN Bill"))
 	row++
-	writeField(f, sheet, row, "Billing Address Matches Client", string(check.Land.EVN.BillingAddressMatchesClient), "EVN Bill")
+	writeField(f, sheet, row, "Billing Address Matches Client", string(check.Land.EVN.BillingAddressMatchesClient), sourceFor(check, "land.evn.billing_address_matches_client", "EVN Bill"))
 	row++
 	var amountStr string
 	if check.Land.EVN.BillingAmount != nil {
 		amountStr = fmt.Sprintf("%d VND", *check.Land.EVN.BillingAmount)
 	}
-	writeField(f, sheet, row, "Billing Amount", amountStr, "EVN Bill")
+	writeField(f, sheet, row, "Billing Amount", amountStr, sourceFor(check, "land.evn.billing_amount", "EVN Bill"))
 	row++
-	writeField(f, sheet, row, "Billed Amounts Match Expenses", string(check.Land.EVN.BilledAmountsMatchExpenses), "Financial Statement")
+	writeField(f, sheet, row, "Billed Amounts Match Expenses", string(check.Land.EVN.BilledAmountsMatchExpenses), sourceFor(check, "land.evn.billed_amounts_match_expenses", "Financial Statement"))
 
 	row += 2
 	cell, _ = excelize.CoordinatesToCellName(1, row)
@@ -145,18 +152,18 @@ func writeLandInfo(f *excelize.File, sheet string, check *models.CustomerCheck)
 	} else {
 		sourceDoc = "Rental Agreement"
 	}
-	writeField(f, sheet, row, "Situation", string(check.Land.Ownership.Situation), sourceDoc)
+	writeField(f, sheet, row, "Situation", string(check.Land.Ownership.Situation), sourceFor(check, "land.ownership.situation", sourceDoc))
 	row++
 	if check.Land.Ownership.Situation == models.RentalAgreement {
-		writeField(f, sheet, row, "Landowner Is Signatory", string(check.Land.Ownership.LandownerIsSignatory), "Rental Agreement")
+		writeField(f, sheet, row, "Landowner Is Signatory", string(check.Land.Ownership.LandownerIsSignatory), sourceFor(check, "land.ownership.landowner_is_signatory", "Rental Agreement"))
 		row++
 		var expirationStr string
 		if check.Land.Ownership.LeaseExpirationDate != nil {
 			expirationStr = check.Land.Ownership.LeaseExpirationDate.Format("2006-01-02")
 		}
-		writeField(f, sheet, row, "Lease Expiration Date", expirationStr, "Rental Agreement")
+		writeField(f, sheet, row, "Lease Expiration Date", expirationStr, sourceFor(check, "land.ownership.lease_expiration_date", "Rental Agreement"))
 	} else if check.Land.Ownership.Situation == models.LandOwner {
-		writeField(f, sheet, row, "Owned Docs Complete", string(check.Land.Ownership.OwnedDocsComplete), "Land Certificate")
+		writeField(f, sheet, row, "Owned Docs Complete", string(check.Land.Ownership.OwnedDocsComplete), sourceFor(check, "land.ownership.owned_docs_complete", "Land Certificate"))
 	}
 }
 
@@ -179,7 +186,7 @@ func writeAdditionalInfo(f *excelize.File, sheet string, check *models.CustomerC
 	_ = f.MergeCell(sheet, cell, "C2")
 	_ = f.SetCellStyle(sheet, cell, "C2", sectionStyle)
 	row++
-	writeField(f, sheet, row, "Company Signboard", string(check.Additional.SiteVisit.CompanySignboard), "Site Visit Photos")
+	writeField(f, sheet, row, "Company Signboard", string(check.Additional.SiteVisit.CompanySignboard), sourceFor(check, "additional.site_visit.company_signboard", "Site Visit Photos"))
 
 	row += 2
 	cell, _ = excelize.CoordinatesToCellName(1, row)
@@ -193,64 +200,64 @@ func writeAdditionalInfo(f *excelize.File, sheet string, check *models.CustomerC
 	if check.Financial.FinancialStatementDate != nil {
 		financialDateStr = check.Financial.FinancialStatementDate.Format("2006-01-02")
 	}
-	writeField(f, sheet, row, "Date of Financial Statements", financialDateStr, "Financial Statement")
+	writeField(f, sheet, row, "Date of Financial Statements", financialDateStr, sourceFor(check, "financial.financial_statement_date", "Financial Statement"))
 	row++
 	
 	// P&L Section
-	writeField(f, sheet, row, "P&L - Total Revenues (30/06/25)", formatMoneyVND(check.Financial.PL.TotalRevenues[0]), "Financial Statement")
+	writeField(f, sheet, row, "P&L - Total Revenues (30/06/25)", formatMoneyVND(check.Financial.PL.TotalRevenues[0]), sourceFor(check, "financial.pl.total_revenues", "Financial Statement"))
 	row++
-	writeField(f, sheet, row, "P&L - Total Revenues (31/12/24)", formatMoneyVND(check.Financial.PL.TotalRevenues[1]), "Financial Statement")
+	writeField(f, sheet, row, "P&L - Total Revenues (31/12/24)", formatMoneyVND(check.Financial.PL.TotalRevenues[1]), sourceFor(check, "financial.pl.total_revenues", "Financial Statement"))
 	row++
-	writeField(f, sheet, row, "P&L - Total Revenues (30/6/24)", formatMoneyVND(check.Financial.PL.TotalRevenues[2]), "Financial Statement")
+	writeField(f, sheet, row, "P&L - Total Revenues (30/6/24)", formatMoneyVND(check.Financial.PL.TotalRevenues[2]), sourceFor(check, "financial.pl.total_revenues", "Financial Statement"))
 	row++
-	writeField(f, sheet, row, "P&L - Total Revenues (31/12/23)", formatMoneyVND(check.Financial.PL.TotalRevenues[3]), "Financial Statement")
+	writeField(f, sheet, row, "P&L - Total Revenues (31/12/23)", formatMoneyVND(check.Financial.PL.TotalRevenues[3]), sourceFor(check, "financial.pl.total_revenues", "Financial Statement"))
 	row++
-	writeField(f, sheet, row, "P&L - Total Revenues (30/6/23)", formatMoneyVND(check.Financial.PL.TotalRevenues[4]), "Financial Statement")
+	writeField(f, sheet, row, "P&L - Total Revenues (30/6/23)", formatMoneyVND(check.Financial.PL.TotalRevenues[4]), sourceFor(check, "financial.pl.total_revenues", "Financial Statement"))
 	row++
 	
-	writeField(f, sheet, row, "P&L - Total Costs (30/06/25)", formatMoneyVND(check.Financial.PL.TotalCosts[0]), "Financial Statement")
+	writeField(f, sheet, row, "P&L - Total Costs (30/06/25)", formatMoneyVND(check.Financial.PL.TotalCosts[0]), sourceFor(check, "financial.pl.total_costs", "Financial Statement"))
 	row++
-	writeField(f, sheet, row, "P&L - Total Costs (31/12/24)", formatMoneyVND(check.Financial.PL.TotalCosts[1]), "Financial Statement")
+	writeField(f, sheet, row, "P&L - Total Costs (31/12/24)", formatMoneyVND(check.Financial.PL.TotalCosts[1]), sourceFor(check, "financial.pl.total_costs", "Financial Statement"))
 	row++
-	writeField(f, sheet, row, "P&L - Total Costs (30/6/24)", formatMoneyVND(check.Financial.PL.TotalCosts[2]), "Financial Statement")
+	writeField(f, sheet, row, "P&L - Total Costs (30/6/24)", formatMoneyVND(check.Financial.PL.TotalCosts[2]), sourceFor(check, "financial.pl.total_costs", "Financial Statement"))
 	row++
-	writeField(f, sheet, row, "P&L - Total Costs (31/12/23)", formatMoneyVND(check.Financial.PL.TotalCosts[3]), "Financial Statement")
+	writeField(f, sheet, row, "P&L - Total Costs (31/12/23)", formatMoneyVND(check.Financial.PL.TotalCosts[3]), sourceFor(check, "financial.pl.total_costs", "Financial Statement"))
 	row++
-	writeField(f, sheet, row, "P&L - Total Costs (30/6/23)", formatMoneyVND(check.Financial.PL.TotalCosts[4]), "Financial Statement")
+	writeField(f, sheet, row, "P&L - Total Costs (30/6/23)", formatMoneyVND(check.Financial.PL.TotalCosts[4]), sourceFor(check, "financial.pl.total_costs", "Financial Statement"))
 	row++
 	
-	writeField(f, sheet, row, "P&L - Total Energy Costs (30/06/25)", formatMoneyVND(check.Financial.PL.TotalEnergyCosts[0]), "Financial Statement")
+	writeField(f, sheet, row, "P&L - Total Energy Costs (30/06/25)", formatMoneyVND(check.Financial.PL.TotalEnergyCosts[0]), sourceFor(check, "financial.pl.total_energy_costs", "Financial Statement"))
 	row++
-	writeField(f, sheet, row, "P&L - Total Energy Costs (31/12/24)", formatMoneyVND(check.Financial.PL.TotalEnergyCosts[1]), "Financial Statement")
+	writeField(f, sheet, row, "P&L - Total Energy Costs (31/12/24)", formatMoneyVND(check.Financial.PL.TotalEnergyCosts[1]), sourceFor(check, "financial.pl.total_energy_costs", "Financial Statement"))
 	row++
-	writeField(f, sheet, row, "P&L - Total Energy Costs (30/6/24)", formatMoneyVND(check.Financial.PL.TotalEnergyCosts[2]), "Financial Statement")
+	writeField(f, sheet, row, "P&L - Total Energy Costs (30/6/24)", formatMoneyVND(check.Financial.PL.TotalEnergyCosts[2]), sourceFor(check, "financial.pl.total_energy_costs", "Financial Statement"))
 	row++
-	writeField(f, sheet, row, "P&L - Total Energy Costs (31/12/23)", formatMoneyVND(check.Financial.PL.TotalEnergyCosts[3]), "Financial Statement")
+	writeField(f, sheet, row, "P&L - Total Energy Costs (31/12/23)", formatMoneyVND(check.Financial.PL.TotalEnergyCosts[3]), sourceFor(check, "financial.pl.total_energy_costs", "Financial Statement"))
 	row++
-	writeField(f, sheet, row, "P&L - Total Energy Costs (30/6/23)", formatMoneyVND(check.Financial.PL.TotalEnergyCosts[4]), "Financial Statement")
+	writeField(f, sheet, row, "P&L - Total Energy Costs (30/6/23)", formatMoneyVND(check.Financial.PL.TotalEnergyCosts[4]), sourceFor(check, "financial.pl.total_energy_costs", "Financial Statement"))
 	row++
 	
 	// Balance Sheet Section
-	writeField(f, sheet, row, "Balance Sheet - Total Assets (30/06/25)", formatMoneyVND(check.Financial.BalanceSheet.TotalAssets[0]), "Financial Statement")
+	writeField(f, sheet, row, "Balance Sheet - Total Assets (30/06/25)", formatMoneyVND(check.Financial.BalanceSheet.TotalAssets[0]), sourceFor(check, "financial.balance_sheet.total_assets", "Financial Statement"))
 	row++
-	writeField(f, sheet, row, "Balance Sheet - Total Assets (31/12/24)", formatMoneyVND(check.Financial.BalanceSheet.TotalAssets[1]), "Financial Statement")
+	writeField(f, sheet, row, "Balance Sheet - Total Assets (31/12/24)", formatMoneyVND(check.Financial.BalanceSheet.TotalAssets[1]), sourceFor(check, "financial.balance_sheet.total_assets", "Financial Statement"))
 	row++
-	writeField(f, sheet, row, "Balance Sheet - Total Assets (30/6/24)", formatMoneyVND(check.Financial.BalanceSheet.TotalAssets[2]), "Financial Statement")
+	writeField(f, sheet, row, "Balance Sheet - Total Assets (30/6/24)", formatMoneyVND(check.Financial.BalanceSheet.TotalAssets[2]), sourceFor(check, "financial.balance_sheet.total_assets", "Financial Statement"))
 	row++
-	writeField(f, sheet, row, "Balance Sheet - Total Assets (31/12/23)", formatMoneyVND(check.Financial.BalanceSheet.TotalAssets[3]), "Financial Statement")
+	writeField(f, sheet, row, "Balance Sheet - Total Assets (31/12/23)", formatMoneyVND(check.Financial.BalanceSheet.TotalAssets[3]), sourceFor(check, "financial.balance_sheet.total_assets", "Financial Statement"))
 	row++
-	writeField(f, sheet, row, "Balance Sheet - Total Assets (30/6/23)", formatMoneyVND(check.Financial.BalanceSheet.TotalAssets[4]), "Financial Statement")
+	writeField(f, sheet, row, "Balance Sheet - Total Assets (30/6/23)", formatMoneyVND(check.Financial.BalanceSheet.TotalAssets[4]), sourceFor(check, "financial.balance_sheet.total_assets", "Financial Statement"))
 	row++
 	
-	writeField(f, sheet, row, "Balance Sheet - Total Debt (30/06/25)", formatMoneyVND(check.Financial.BalanceSheet.TotalDebt[0]), "Financial Statement")
+	writeField(f, sheet, row, "Balance Sheet - Total Debt (30/06/25)", formatMoneyVND(check.Financial.BalanceSheet.TotalDebt[0]), sourceFor(check, "financial.balance_sheet.total_debt", "Financial Statement"))
 	row++
-	writeField(f, sheet, row, "Balance Sheet - Total Debt (31/12/24)", formatMoneyVND(check.Financial.BalanceSheet.TotalDebt[1]), "Financial Statement")
+	writeField(f, sheet, row, "Balance Sheet - Total Debt (31/12/24)", formatMoneyVND(check.Financial.BalanceSheet.TotalDebt[1]), sourceFor(check, "financial.balance_sheet.total_debt", "Financial Statement"))
 	row++
-	writeField(f, sheet, row, "Balance Sheet - Total Debt (30/6/24)", formatMoneyVND(check.Financial.BalanceSheet.TotalDebt[2]), "Financial Statement")
+	writeField(f, sheet, row, "Balance Sheet - Total Debt (30/6/24)", formatMoneyVND(check.Financial.BalanceSheet.TotalDebt[2]), sourceFor(check, "financial.balance_sheet.total_debt", "Financial Statement"))
 	row++
-	writeField(f, sheet, row, "Balance Sheet - Total Debt (31/12/23)", formatMoneyVND(check.Financial.BalanceSheet.TotalDebt[3]), "Financial Statement")
+	writeField(f, sheet, row, "Balance Sheet - Total Debt (31/12/23)", formatMoneyVND(check.Financial.BalanceSheet.TotalDebt[3]), sourceFor(check, "financial.balance_sheet.total_debt", "Financial Statement"))
 	row++
-	writeField(f, sheet, row, "Balance Sheet - Total Debt (30/6/23)", formatMoneyVND(check.Financial.BalanceSheet.TotalDebt[4]), "Financial Statement")
+	writeField(f, sheet, row, "Balance Sheet - Total Debt (30/6/23)", formatMoneyVND(check.Financial.BalanceSheet.TotalDebt[4]), sourceFor(check, "financial.balance_sheet.total_debt", "Financial Statement"))
 	row++
 	
 	// Dynamic Loans Section
@@ -266,16 +273,17 @@ func writeAdditionalInfo(f *excelize.File, sheet string, check *models.CustomerC
 		for i, loan := range check.Financial.Loans {
 			loanNum := i + 1
 			loanPrefix := fmt.Sprintf("Loan %d", loanNum)
+			loanPath := fmt.Sprintf("financial.loans[%d]", i)
 			
-			writeField(f, sheet, row, loanPrefix+" - Loan Type", string(loan.LoanType), "CIC Report")
+			writeField(f, sheet, row, loanPrefix+" - Loan Type", string(loan.LoanType), sourceFor(check, loanPath, "CIC Report"))
 			row++
-			writeField(f, sheet, row, loanPrefix+" - Debt Classification", string(loan.DebtClassification), "CIC Report")
+			writeField(f, sheet, row, loanPrefix+" - Debt Classification", string(loan.DebtClassification), sourceFor(check, loanPath, "CIC Report"))
 			row++
-			writeField(f, sheet, row, loanPrefix+" - Outstanding Amount", formatMoneyVNDPtr(loan.OutstandingAmount), "CIC Report")
+			writeField(f, sheet, row, loanPrefix+" - Outstanding Amount", formatMoneyVNDPtr(loan.OutstandingAmount), sourceFor(check, loanPath, "CIC Report"))
 			row++
-			writeField(f, sheet, row, loanPrefix+" - Annual Interest Cost", formatMoneyVNDPtr(loan.AnnualInterestCost), "CIC Report")
+			writeField(f, sheet, row, loanPrefix+" - Annual Interest Cost", formatMoneyVNDPtr(loan.AnnualInterestCost), sourceFor(check, loanPath, "CIC Report"))
 			row++
-			writeField(f, sheet, row, loanPrefix+" - Annual Amortization", formatMoneyVNDPtr(loan.AnnualAmortization), "CIC Report")
+			writeField(f, sheet, row, loanPrefix+" - Annual Amortization", formatMoneyVNDPtr(loan.AnnualAmortization), sourceFor(check, loanPath, "CIC Report"))
 			row++
 			var maturityStr string
 			if loan.Maturity != nil {
@@ -283,9 +291,9 @@ func writeAdditionalInfo(f *excelize.File, sheet string, check *models.CustomerC
 			} else {
 				maturityStr = "Not available"
 			}
-			writeField(f, sheet, row, loanPrefix+" - Maturity", maturityStr, "CIC Report")
+			writeField(f, sheet, row, loanPrefix+" - Maturity", maturityStr, sourceFor(check, loanPath, "CIC Report"))
 			row++
-			writeField(f, sheet, row, loanPrefix+" - Payment History", loan.PaymentHistory, "CIC Report")
+			writeField(f, sheet, row, loanPrefix+" - Payment History", loan.PaymentHistory, sourceFor(check, loanPath, "CIC Report"))
 			row++
 		}
 	}
@@ -303,6 +311,69 @@ func writeAdditionalInfo(f *excelize.File, sheet string, check *models.CustomerC
 	writeField(f, sheet, row, "Check Completed At", completedAtStr, "System")
 }
 
+// writeConflicts lists every field for which documents disagreed, one row per candidate value
+func writeConflicts(f *excelize.File, sheet string, check *models.CustomerCheck) {
+	headers := []string{"Field", "Status", "Policy", "Candidate Value", "Source Document", "Document Date", "Confidence"}
+	headerStyle, _ := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}, Fill: excelize.Fill{Type: "pattern", Color: []string{"#DDEBF7"}, Pattern: 1}})
+	for i, h := range headers {
+		cell, _ := excelize.CoordinatesToCellName(i+1, 1)
+		_ = f.SetCellValue(sheet, cell, h)
+		_ = f.SetCellStyle(sheet, cell, cell, headerStyle)
+	}
+	unresolvedStyle, _ := f.NewStyle(&excelize.Style{Fill: excelize.Fill{Type: "pattern", Color: []string{"#FCE4D6"}, Pattern: 1}})
+
+	row := 2
+	for _, conflict := range check.Conflicts {
+		for _, candidate := range conflict.Candidates {
+			status := "unresolved"
+			if conflict.Resolved {
+				status = "discarded"
+				if reflect.DeepEqual(candidate.Value, conflict.Chosen) {
+					status = "kept"
+				}
+			}
+			source := provenanceLabel(candidate.Provenance)
+			var docDate, confidence string
+			if candidate.Provenance.DocumentDate != nil {
+				docDate = candidate.Provenance.DocumentDate.Format("2006-01-02")
+			}
+			if candidate.Provenance.Confidence > 0 {
+				confidence = fmt.Sprintf("%.2f", candidate.Provenance.Confidence)
+			}
+
+			values := []interface{}{conflict.Field, status, conflict.Policy, formatConflictValue(candidate.Value), source, docDate, confidence}
+			for i, v := range values {
+				cell, _ := excelize.CoordinatesToCellName(i+1, row)
+				_ = f.SetCellValue(sheet, cell, v)
+			}
+			if !conflict.Resolved {
+				start, _ := excelize.CoordinatesToCellName(1, row)
+				end, _ := excelize.CoordinatesToCellName(len(headers), row)
+				_ = f.SetCellStyle(sheet, start, end, unresolvedStyle)
+			}
+			row++
+		}
+	}
+}
+
+// formatConflictValue renders a candidate value for display
+func formatConflictValue(v interface{}) string {
+	switch val := v.(type) {
+	case models.MoneyVND:
+		return formatMoneyVND(val)
+	case time.Time:
+		return val.Format("2006-01-02")
+	case [5]models.MoneyVND:
+		parts := make([]string, len(val))
+		for i, m := range val {
+			parts[i] = formatMoneyVND(m)
+		}
+		return strings.Join(parts, "; ")
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
 func writeField(f *excelize.File, sheet string, row int, fieldName, value, source string) {
 	cell1, _ := excelize.CoordinatesToCellName(1, row)
 	_ = f.SetCellValue(sheet, cell1, fieldName)
@@ -312,6 +383,57 @@ func writeField(f *excelize.File, sheet string, row int, fieldName, value, sourc
 	_ = f.SetCellValue(sheet, cell3, source)
 }
 
+// sourceFor describes the document that supplied a field, falling back to
+// the expected document type when no provenance was recorded
+func sourceFor(check *models.CustomerCheck, path, fallback string) string {
+	p, ok := check.ProvenanceFor(path)
+	if !ok {
+		return fallback
+	}
+	return provenanceLabel(p)
+}
+
+// provenanceLabel names the file, document type and pages a value came from
+func provenanceLabel(p models.FieldProvenance) string {
+	label := documentSourceLabel(p.DocumentSource)
+	if p.FileName != "" {
+		label = fmt.Sprintf("%s (%s)", p.FileName, label)
+	}
+	switch {
+	case p.PageStart > 0 && p.PageEnd > p.PageStart:
+		label += fmt.Sprintf(", pp. %d-%d", p.PageStart, p.PageEnd)
+	case p.PageStart > 0:
+		label += fmt.Sprintf(", p. %d", p.PageStart)
+	}
+	return label
+}
+
+// documentSourceLabel formats a document source for display
+func documentSourceLabel(source string) string {
+	switch source {
+	case "business_license":
+		return "Business License"
+	case "evn_bill":
+		return "EVN Bill"
+	case "land_certificate":
+		return "Land Certificate"
+	case "rental_agreement":
+		return "Rental Agreement"
+	case "id_check":
+		return "ID Check"
+	case "financial_statement":
+		return "Financial Statement"
+	case "site_visit_photos":
+		return "Site Visit Photos"
+	case "cic_report", "cic_report_2":
+		return "CIC Report"
+	case "address_comparison":
+		return "System (address comparison)"
+	default:
+		return source
+	}
+}
+
 func formatMoneyVND(amount models.MoneyVND) string {
 	return fmt.Sprintf("%.0f", float64(amount))
 }
@@ -2,31 +2,84 @@ package export
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"extraction/internal/types"
 	"github.com/xuri/excelize/v2"
 )
 
-func WriteResults(results []types.FileResult, outPath string) error {
+// WriteResults writes one row per result. With pageRows, a Pages sheet lists
+// every page of each PDF with its OCR confidence and error.
+func WriteResults(results []types.FileResult, outPath string, pageRows bool) error {
 	f := excelize.NewFile()
 	sheet := f.GetSheetName(f.GetActiveSheetIndex())
-	headers := []string{"SourceURL", "LocalPath", "FileName", "FileType", "Error", "ExtractedText"}
+	headers := []string{"SourceURL", "LocalPath", "FileName", "FileType", "Error", "ExtractedText", "Warnings", "ParentSourceURL", "DocumentSource", "GuessedSource", "SourceConfidence", "Pages", "OCREngine", "OCRScores", "Preprocessed"}
 	for i, h := range headers {
 		cell, _ := excelize.CoordinatesToCellName(i+1, 1)
 		_ = f.SetCellValue(sheet, cell, h)
 	}
 	for rowIdx, r := range results {
 		row := rowIdx + 2
-		cells := []any{r.SourceURL, r.LocalPath, r.FileName, r.FileType, r.Error, r.ExtractedText}
+		cells := []any{r.SourceURL, r.LocalPath, r.FileName, r.FileType, r.Error, r.ExtractedText, strings.Join(r.Warnings, "\n"), r.ParentSourceURL, r.DocumentSource, r.GuessedSource, r.SourceConfidence, pages(r), r.OCREngine, scores(r.OCRScores), strings.Join(r.Preprocessed, ", ")}
 		for colIdx, v := range cells {
 			cell, _ := excelize.CoordinatesToCellName(colIdx+1, row)
 			_ = f.SetCellValue(sheet, cell, v)
 		}
 	}
+	if pageRows {
+		writePageRows(f, results)
+	}
 	if err := f.SaveAs(outPath); err != nil {
 		return fmt.Errorf("save xlsx: %w", err)
 	}
 	return nil
 }
 
+// writePageRows adds the Pages sheet
+func writePageRows(f *excelize.File, results []types.FileResult) {
+	const sheet = "Pages"
+	_, _ = f.NewSheet(sheet)
+	headers := []string{"SourceURL", "FileName", "Page", "Method", "Confidence", "Scores", "DPI", "Error", "TextLayerIssue", "Text"}
+	for i, h := range headers {
+		cell, _ := excelize.CoordinatesToCellName(i+1, 1)
+		_ = f.SetCellValue(sheet, cell, h)
+	}
+	row := 2
+	for _, r := range results {
+		for _, page := range r.Pages {
+			cells := []any{r.SourceURL, r.FileName, page.Page, page.Method, page.Confidence, scores(page.Scores), page.DPI, page.Error, page.TextLayerIssue, page.Text}
+			for colIdx, v := range cells {
+				cell, _ := excelize.CoordinatesToCellName(colIdx+1, row)
+				_ = f.SetCellValue(sheet, cell, v)
+			}
+			row++
+		}
+	}
+}
+
+// pages formats the page range of a document split out of a PDF, e.g. "3-5"
+func pages(r types.FileResult) string {
+	switch {
+	case r.PageStart == 0:
+		return ""
+	case r.PageEnd <= r.PageStart:
+		return fmt.Sprint(r.PageStart)
+	default:
+		return fmt.Sprintf("%d-%d", r.PageStart, r.PageEnd)
+	}
+}
 
+// scores formats the ensemble score of each OCR engine, e.g. "tesseract=0.61, vision=0.83"
+func scores(byEngine map[string]float64) string {
+	engines := make([]string, 0, len(byEngine))
+	for engine := range byEngine {
+		engines = append(engines, engine)
+	}
+	sort.Strings(engines)
+	parts := make([]string, len(engines))
+	for i, engine := range engines {
+		parts[i] = fmt.Sprintf("%s=%.3f", engine, byEngine[engine])
+	}
+	return strings.Join(parts, ", ")
+}
@@ -100,7 +100,7 @@ func DetectFileType(filename string, mediaType string) FileType {
 		return FileTypeExcel
 	case ".ppt", ".pptx", ".pptm":
 		return FileTypePowerPoint
-	case ".zip", ".rar", ".7z", ".tar", ".gz", ".bz2":
+	case ".zip", ".rar", ".7z", ".tar", ".gz", ".tgz", ".bz2", ".tbz2":
 		return FileTypeArchive
 	case ".mp4", ".avi", ".mov", ".wmv", ".flv", ".webm", ".mkv":
 		return FileTypeVideo
@@ -2,6 +2,7 @@ package grouping
 
 import (
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -46,11 +47,13 @@ func (ga *GroupingAnalyzer) AnalyzeAndGroup(results []types.FileResult) []types.
 		}
 	}
 	
-	// Convert map to slice
+	// Convert map to slice, ordered by key so the output is stable between runs.
+	// Files within a group keep their input order.
 	var groupSlice []types.FileGroup
 	for _, group := range groups {
 		groupSlice = append(groupSlice, *group)
 	}
+	sort.Slice(groupSlice, func(i, j int) bool { return groupSlice[i].ID < groupSlice[j].ID })
 	
 	return groupSlice
 }
@@ -0,0 +1,275 @@
+package imageprep
+
+import (
+	"image"
+	"math"
+)
+
+// analysisDimension is the longest side of the images orientation and skew
+// are measured on; text lines are still well resolved at this size
+const analysisDimension = 1000
+
+// Skew search: angles from -maxSkew to maxSkew in skewStep steps. Angles
+// smaller than minSkew aren't worth resampling the image for, and the best
+// angle must beat the unrotated profile by minSkewGain to count.
+const (
+	maxSkew     = 10.0
+	skewStep    = 0.25
+	minSkew     = 0.3
+	minSkewGain = 1.05
+)
+
+// Orientation detection: text is sideways if the column profile varies
+// sidewaysMargin times more than the row profile, and upside down if the ink
+// below the lines' x-height band outweighs the ink above it by flipMargin.
+// Both need at least minLines text lines.
+const (
+	sidewaysMargin = 1.5
+	flipMargin     = 1.4
+	minLines       = 3
+)
+
+// minInk is the share of ink pixels below which an image is treated as blank
+const minInk = 0.002
+
+// inkMask is a binarized analysis image: true where there is ink
+type inkMask struct {
+	w, h int
+	ink  []bool
+}
+
+func (m inkMask) at(x, y int) bool { return m.ink[y*m.w+x] }
+
+// inkShare is the share of ink pixels
+func (m inkMask) inkShare() float64 {
+	n := 0
+	for _, ink := range m.ink {
+		if ink {
+			n++
+		}
+	}
+	return float64(n) / float64(len(m.ink))
+}
+
+// turn returns the mask turned 90° clockwise
+func (m inkMask) turn() inkMask {
+	out := inkMask{w: m.h, h: m.w, ink: make([]bool, len(m.ink))}
+	for y := 0; y < out.h; y++ {
+		for x := 0; x < out.w; x++ {
+			out.ink[y*out.w+x] = m.at(y, m.h-1-x)
+		}
+	}
+	return out
+}
+
+// rows returns the number of ink pixels of each row
+func (m inkMask) rows() []int {
+	counts := make([]int, m.h)
+	for y := 0; y < m.h; y++ {
+		for x := 0; x < m.w; x++ {
+			if m.at(x, y) {
+				counts[y]++
+			}
+		}
+	}
+	return counts
+}
+
+// newInkMask shrinks img to at most analysisDimension by box averaging and
+// binarizes it with Otsu's threshold. Ink is the minority class, so light
+// text on a dark background works too.
+func newInkMask(img *image.NRGBA) inkMask {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	factor := max(1, int(math.Ceil(float64(max(w, h))/analysisDimension)))
+	mw, mh := max(1, w/factor), max(1, h/factor)
+
+	gray := make([]uint8, mw*mh)
+	var histogram [256]int
+	for my := 0; my < mh; my++ {
+		for mx := 0; mx < mw; mx++ {
+			sum, n := 0, 0
+			for y := my * factor; y < min(h, (my+1)*factor); y++ {
+				for x := mx * factor; x < min(w, (mx+1)*factor); x++ {
+					i := img.PixOffset(x, y)
+					sum += int(luminance(img.Pix[i], img.Pix[i+1], img.Pix[i+2]))
+					n++
+				}
+			}
+			v := uint8(sum / n)
+			gray[my*mw+mx] = v
+			histogram[v]++
+		}
+	}
+
+	threshold := otsu(histogram, len(gray))
+	dark := 0
+	for v := 0; v <= threshold; v++ {
+		dark += histogram[v]
+	}
+	inkIsDark := dark*2 <= len(gray)
+	mask := inkMask{w: mw, h: mh, ink: make([]bool, len(gray))}
+	for i, v := range gray {
+		mask.ink[i] = (int(v) <= threshold) == inkIsDark
+	}
+	return mask
+}
+
+// otsu returns the threshold that best separates the histogram into two classes
+func otsu(histogram [256]int, pixels int) int {
+	var total float64
+	for v, count := range histogram {
+		total += float64(v * count)
+	}
+	var sumBelow float64
+	below := 0
+	best, bestVariance := 0, -1.0
+	for v, count := range histogram {
+		below += count
+		if below == 0 {
+			continue
+		}
+		above := pixels - below
+		if above == 0 {
+			break
+		}
+		sumBelow += float64(v * count)
+		meanBelow := sumBelow / float64(below)
+		meanAbove := (total - sumBelow) / float64(above)
+		variance := float64(below) * float64(above) * (meanBelow - meanAbove) * (meanBelow - meanAbove)
+		if variance > bestVariance {
+			best, bestVariance = v, variance
+		}
+	}
+	return best
+}
+
+// skewAngle estimates how far text lines are turned clockwise, in degrees,
+// from the projection profile: at the right angle the ink falls into sharp
+// lines separated by empty gaps. It returns 0 for straight or blank images.
+func skewAngle(img *image.NRGBA) float64 {
+	mask := newInkMask(img)
+	if mask.inkShare() < minInk {
+		return 0
+	}
+	var inkX, inkY []float64
+	for y := 0; y < mask.h; y++ {
+		for x := 0; x < mask.w; x++ {
+			if mask.at(x, y) {
+				inkX = append(inkX, float64(x))
+				inkY = append(inkY, float64(y))
+			}
+		}
+	}
+
+	// profileScore is the sum of squared ink counts of the lines at the
+	// given slope, which is largest when lines and gaps are crisp
+	margin := int(math.Ceil(float64(mask.w) * math.Tan(maxSkew*math.Pi/180)))
+	bins := make([]int, mask.h+2*margin+1)
+	profileScore := func(degrees float64) float64 {
+		clear(bins)
+		slope := math.Tan(degrees * math.Pi / 180)
+		for i := range inkX {
+			bins[int(math.Round(inkY[i]-inkX[i]*slope))+margin]++
+		}
+		var score float64
+		for _, count := range bins {
+			score += float64(count) * float64(count)
+		}
+		return score
+	}
+
+	straight := profileScore(0)
+	best, bestScore := 0.0, straight
+	steps := int(maxSkew / skewStep)
+	for i := -steps; i <= steps; i++ {
+		degrees := float64(i) * skewStep
+		if score := profileScore(degrees); score > bestScore {
+			best, bestScore = degrees, score
+		}
+	}
+	if math.Abs(best) < minSkew || bestScore < straight*minSkewGain {
+		return 0
+	}
+	return best
+}
+
+// uprightTurns returns the number of clockwise quarter turns (0 to 3) that
+// make the text of img upright, or 0 if that can't be told
+func uprightTurns(img *image.NRGBA) int {
+	mask := newInkMask(img)
+	if mask.inkShare() < minInk {
+		return 0
+	}
+	turns := 0
+	if profileVariation(mask.turn().rows()) > sidewaysMargin*profileVariation(mask.rows()) {
+		mask = mask.turn()
+		turns = 1
+	}
+	above, below, lines := ascenderBalance(mask.rows())
+	if lines < minLines {
+		return 0
+	}
+	if below > flipMargin*above {
+		turns += 2
+	}
+	return turns
+}
+
+// profileVariation is the squared coefficient of variation of a projection
+// profile: high for rows across text lines, low for columns across them
+func profileVariation(profile []int) float64 {
+	var sum, squares float64
+	for _, count := range profile {
+		sum += float64(count)
+		squares += float64(count) * float64(count)
+	}
+	if sum == 0 {
+		return 0
+	}
+	mean := sum / float64(len(profile))
+	return (squares/float64(len(profile)) - mean*mean) / (mean * mean)
+}
+
+// ascenderBalance splits the row profile into text lines and sums the ink
+// above and below each line's core band, the rows with at least half the ink
+// of the line's fullest row. Upright Latin and Vietnamese text has more ink
+// above the core (ascenders, capitals, diacritics) than below (descenders).
+func ascenderBalance(rows []int) (above, below float64, lines int) {
+	peak := 0
+	for _, count := range rows {
+		peak = max(peak, count)
+	}
+	threshold := max(1, peak/50)
+	for start := 0; start < len(rows); {
+		if rows[start] < threshold {
+			start++
+			continue
+		}
+		end := start
+		lineMax := 0
+		for end < len(rows) && rows[end] >= threshold {
+			lineMax = max(lineMax, rows[end])
+			end++
+		}
+		if end-start >= 3 {
+			coreStart, coreEnd := -1, -1
+			for y := start; y < end; y++ {
+				if rows[y]*2 >= lineMax {
+					if coreStart < 0 {
+						coreStart = y
+					}
+					coreEnd = y
+				}
+			}
+			for y := start; y < coreStart; y++ {
+				above += float64(rows[y])
+			}
+			for y := coreEnd + 1; y < end; y++ {
+				below += float64(rows[y])
+			}
+			lines++
+		}
+		start = end
+	}
+	return above, below, lines
+}
@@ -0,0 +1,131 @@
+package imageprep
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	_ "image/gif"  // register GIF decoding
+	_ "image/jpeg" // register JPEG decoding
+	_ "image/png"  // register PNG decoding
+
+	_ "golang.org/x/image/bmp"  // register BMP decoding
+	_ "golang.org/x/image/tiff" // register TIFF decoding
+	_ "golang.org/x/image/webp" // register WebP decoding
+)
+
+// Decode decodes a JPEG, PNG, GIF, BMP, TIFF or WebP image and returns its format
+func Decode(data []byte) (image.Image, string, error) {
+	if isHEIC(data) {
+		return nil, "heic", fmt.Errorf("%w: HEIC", ErrUnsupportedFormat)
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err == image.ErrFormat {
+		return nil, "", ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, format, fmt.Errorf("decode %s image: %w", format, err)
+	}
+	return img, format, nil
+}
+
+// isHEIC reports whether data is a HEIF/HEIC image, which starts with an ftyp box
+func isHEIC(data []byte) bool {
+	if len(data) < 12 || string(data[4:8]) != "ftyp" {
+		return false
+	}
+	switch string(data[8:12]) {
+	case "heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1", "avif":
+		return true
+	}
+	return false
+}
+
+// Orientation returns the EXIF orientation (1 to 8) of a JPEG or WebP image,
+// or 1 if it has none
+func Orientation(data []byte) int {
+	var exif []byte
+	switch {
+	case len(data) > 2 && data[0] == 0xFF && data[1] == 0xD8:
+		exif = jpegExif(data)
+	case len(data) > 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		exif = webpExif(data)
+	}
+	if o := tiffOrientation(bytes.TrimPrefix(exif, []byte("Exif\x00\x00"))); o >= 1 && o <= 8 {
+		return o
+	}
+	return 1
+}
+
+// jpegExif returns the payload of the APP1 Exif segment
+func jpegExif(data []byte) []byte {
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return nil
+		}
+		marker := data[i+1]
+		if marker == 0xD8 || (marker >= 0xD0 && marker <= 0xD7) || marker == 0x01 {
+			i += 2
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 { // image data follows: no more metadata
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return nil
+		}
+		payload := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+			return payload
+		}
+		i += 2 + length
+	}
+	return nil
+}
+
+// webpExif returns the payload of the EXIF chunk
+func webpExif(data []byte) []byte {
+	for i := 12; i+8 <= len(data); {
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		if size < 0 || i+8+size > len(data) {
+			return nil
+		}
+		if string(data[i:i+4]) == "EXIF" {
+			return data[i+8 : i+8+size]
+		}
+		i += 8 + size + size%2 // chunks are padded to even sizes
+	}
+	return nil
+}
+
+// tiffOrientation reads the Orientation tag (0x0112) of IFD0 of TIFF-structured EXIF data
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for e := 0; e < entries; e++ {
+		entry := ifd + 2 + e*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 0
+}
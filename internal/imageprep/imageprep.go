@@ -0,0 +1,199 @@
+// Package imageprep cleans up photos and phone scans before OCR: it applies
+// the EXIF orientation, turns sideways or upside-down text upright,
+// straightens skewed pages, stretches dull contrast and shrinks oversize
+// images. Everything is done in pure Go on decoded images, so the same input
+// always gives the same output.
+package imageprep
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultMaxDimension is the longest side images are shrunk to. Larger
+// images don't OCR better but are slower to send and may exceed request limits.
+const DefaultMaxDimension = 3500
+
+// Steps selects the preprocessing applied to an image
+type Steps struct {
+	Orient       bool // apply the EXIF orientation
+	Rotate       bool // turn sideways or upside-down text upright
+	Deskew       bool // straighten text lines up to 10° off
+	Contrast     bool // stretch dull or washed-out contrast
+	MaxDimension int  // shrink images whose longest side is larger; 0 keeps the size
+}
+
+// All is every preprocessing step
+var All = Steps{Orient: true, Rotate: true, Deskew: true, Contrast: true, MaxDimension: DefaultMaxDimension}
+
+// Step names, as used by ParseSteps
+const (
+	StepOrient    = "orient"
+	StepRotate    = "rotate"
+	StepDeskew    = "deskew"
+	StepContrast  = "contrast"
+	StepDownscale = "downscale"
+)
+
+// ParseSteps reads a comma-separated list of step names, or "all" or "none"
+func ParseSteps(spec string) (Steps, error) {
+	var steps Steps
+	for _, name := range strings.Split(strings.ToLower(spec), ",") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "all":
+			steps = All
+		case "none", "":
+		case StepOrient:
+			steps.Orient = true
+		case StepRotate:
+			steps.Rotate = true
+		case StepDeskew:
+			steps.Deskew = true
+		case StepContrast:
+			steps.Contrast = true
+		case StepDownscale:
+			steps.MaxDimension = DefaultMaxDimension
+		default:
+			return Steps{}, fmt.Errorf("unknown preprocessing step %q (supported: %s, %s, %s, %s, %s, all, none)", name, StepOrient, StepRotate, StepDeskew, StepContrast, StepDownscale)
+		}
+	}
+	return steps, nil
+}
+
+// String lists the enabled steps in ParseSteps form, e.g. "orient,contrast"
+func (s Steps) String() string {
+	var names []string
+	if s.Orient {
+		names = append(names, StepOrient)
+	}
+	if s.Rotate {
+		names = append(names, StepRotate)
+	}
+	if s.Deskew {
+		names = append(names, StepDeskew)
+	}
+	if s.Contrast {
+		names = append(names, StepContrast)
+	}
+	if s.MaxDimension > 0 {
+		names = append(names, fmt.Sprintf("%s=%d", StepDownscale, s.MaxDimension))
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// Enabled reports whether any step is enabled
+func (s Steps) Enabled() bool {
+	return s != Steps{}
+}
+
+// Result is a preprocessed image
+type Result struct {
+	Path    string   // the preprocessed image, or the original if nothing was changed
+	Applied []string // what was done, e.g. "exif orientation 6", "deskew -2.25°"
+}
+
+// Process decodes the image at path, applies the steps and, if anything
+// changed, writes the result into dir as PNG (for PNG, GIF, BMP and TIFF
+// sources) or JPEG (for photos). WebP and BMP images are always converted.
+// HEIC images can't be decoded in pure Go and fail with ErrUnsupportedFormat.
+func Process(path string, steps Steps, dir string) (Result, error) {
+	if !steps.Enabled() {
+		return Result{Path: path}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Result{}, fmt.Errorf("read image: %w", err)
+	}
+	img, format, err := Decode(data)
+	if err != nil {
+		return Result{}, err
+	}
+
+	orientation := 1
+	if steps.Orient {
+		orientation = Orientation(data)
+	}
+	out, applied := Apply(img, orientation, steps)
+	if len(applied) == 0 && format != "webp" && format != "bmp" {
+		return Result{Path: path}, nil
+	}
+	if len(applied) == 0 {
+		// Not every OCR engine reads WebP and BMP
+		applied = append(applied, "convert "+format)
+	}
+
+	ext := ".jpg"
+	if format == "png" || format == "gif" || format == "bmp" || format == "tiff" {
+		ext = ".png"
+	}
+	outPath := filepath.Join(dir, "prep_"+strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))+ext)
+	f, err := os.Create(outPath)
+	if err != nil {
+		return Result{}, fmt.Errorf("write preprocessed image: %w", err)
+	}
+	if ext == ".png" {
+		err = png.Encode(f, out)
+	} else {
+		err = jpeg.Encode(f, out, &jpeg.Options{Quality: 92})
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(outPath)
+		return Result{}, fmt.Errorf("encode preprocessed image: %w", err)
+	}
+	return Result{Path: outPath, Applied: applied}, nil
+}
+
+// Apply runs the steps on a decoded image. orientation is the EXIF
+// orientation (1 to 8) to undo; 1 or 0 means none. It returns the new image
+// and what was done, which is empty if the image was left as it was.
+func Apply(img image.Image, orientation int, steps Steps) (image.Image, []string) {
+	var applied []string
+	out := toNRGBA(img)
+
+	if steps.Orient && orientation > 1 && orientation <= 8 {
+		out = orient(out, orientation)
+		applied = append(applied, fmt.Sprintf("exif orientation %d", orientation))
+	}
+	// Shrink first so the analysis below works on fewer pixels
+	if steps.MaxDimension > 0 {
+		if b := out.Bounds(); b.Dx() > steps.MaxDimension || b.Dy() > steps.MaxDimension {
+			out = downscale(out, steps.MaxDimension)
+			applied = append(applied, fmt.Sprintf("downscale %dx%d to %dx%d", b.Dx(), b.Dy(), out.Bounds().Dx(), out.Bounds().Dy()))
+		}
+	}
+	if steps.Rotate {
+		if quarterTurns := uprightTurns(out); quarterTurns != 0 {
+			out = orient(out, turnsOrientation[quarterTurns])
+			applied = append(applied, fmt.Sprintf("rotate %d°", quarterTurns*90))
+		}
+	}
+	if steps.Deskew {
+		if angle := skewAngle(out); angle != 0 {
+			out = rotate(out, -angle)
+			applied = append(applied, fmt.Sprintf("deskew %.2f°", angle))
+		}
+	}
+	if steps.Contrast {
+		if stretched, ok := stretchContrast(out); ok {
+			out = stretched
+			applied = append(applied, "contrast")
+		}
+	}
+	return out, applied
+}
+
+// ErrUnsupportedFormat is returned for images that can't be decoded in pure Go
+var ErrUnsupportedFormat = errors.New("unsupported image format")
@@ -0,0 +1,297 @@
+package imageprep
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+var update = flag.Bool("update", false, "regenerate the test images in testdata and their golden hashes")
+
+// goldenCases are the images in testdata, all made from upright.png, and the
+// steps All applies to them
+var goldenCases = []struct {
+	file    string
+	applied []string
+}{
+	{"upright.png", nil},
+	{"exif6.jpg", []string{"exif orientation 6"}},
+	{"exif8.jpg", []string{"exif orientation 8"}},
+	{"rotated90.png", []string{"rotate 90°"}},
+	{"rotated180.png", []string{"rotate 180°"}},
+	{"skew3.png", []string{"deskew 3.00°"}},
+	{"low_contrast.png", []string{"contrast"}},
+}
+
+const goldenFile = "testdata/golden.txt"
+
+func TestProcessGolden(t *testing.T) {
+	if *update {
+		writeTestImages(t)
+	}
+	upright := decodeFile(t, filepath.Join("testdata", "upright.png"))
+
+	hashes := map[string]string{}
+	for _, tc := range goldenCases {
+		res, err := Process(filepath.Join("testdata", tc.file), All, t.TempDir())
+		if err != nil {
+			t.Fatalf("%s: %v", tc.file, err)
+		}
+		if strings.Join(res.Applied, ", ") != strings.Join(tc.applied, ", ") {
+			t.Errorf("%s: applied %q, want %q", tc.file, res.Applied, tc.applied)
+		}
+		out := decodeFile(t, res.Path)
+		hashes[tc.file] = pixelHash(out)
+
+		switch {
+		case strings.HasPrefix(tc.file, "rotated"):
+			// Quarter turns move pixels without resampling
+			if pixelHash(out) != pixelHash(upright) {
+				t.Errorf("%s: not turned back to upright.png", tc.file)
+			}
+		case strings.HasPrefix(tc.file, "exif"):
+			if diff := meanDifference(out, upright); diff < 0 || diff > 4 {
+				t.Errorf("%s: differs from upright.png by %.1f on average", tc.file, diff)
+			}
+		}
+	}
+
+	if *update {
+		var b strings.Builder
+		for _, tc := range goldenCases {
+			fmt.Fprintf(&b, "%s %s\n", tc.file, hashes[tc.file])
+		}
+		if err := os.WriteFile(goldenFile, []byte(b.String()), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := readGolden(t)
+	for _, tc := range goldenCases {
+		if hashes[tc.file] != want[tc.file] {
+			t.Errorf("%s: output pixels %s, want %s (run with -update to accept)", tc.file, hashes[tc.file], want[tc.file])
+		}
+	}
+}
+
+func TestProcessUnchanged(t *testing.T) {
+	path := filepath.Join("testdata", "skew3.png")
+	res, err := Process(path, Steps{}, t.TempDir())
+	if err != nil || res.Path != path || len(res.Applied) > 0 {
+		t.Errorf("no steps: %+v, %v", res, err)
+	}
+	res, err = Process(path, Steps{Orient: true, Rotate: true, Contrast: true}, t.TempDir())
+	if err != nil || res.Path != path || len(res.Applied) > 0 {
+		t.Errorf("steps that don't apply: %+v, %v", res, err)
+	}
+}
+
+func TestApplyDownscale(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4000, 1000))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	out, applied := Apply(img, 1, Steps{MaxDimension: 1000})
+	if b := out.Bounds(); b.Dx() != 1000 || b.Dy() != 250 {
+		t.Errorf("downscaled to %v", b)
+	}
+	if strings.Join(applied, ", ") != "downscale 4000x1000 to 1000x250" {
+		t.Errorf("applied %q", applied)
+	}
+}
+
+func TestOrientation(t *testing.T) {
+	for _, tc := range []struct {
+		file string
+		want int
+	}{
+		{"exif6.jpg", 6},
+		{"exif8.jpg", 8},
+		{"upright.png", 1},
+	} {
+		data, err := os.ReadFile(filepath.Join("testdata", tc.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Orientation(data); got != tc.want {
+			t.Errorf("Orientation(%s) = %d, want %d", tc.file, got, tc.want)
+		}
+	}
+	if got := Orientation([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00}); got != 1 {
+		t.Errorf("Orientation of a truncated JPEG = %d, want 1", got)
+	}
+}
+
+func TestParseSteps(t *testing.T) {
+	for spec, want := range map[string]string{
+		"":                "none",
+		"none":            "none",
+		"all":             "orient,rotate,deskew,contrast,downscale=3500",
+		"Orient, deskew":  "orient,deskew",
+		"contrast,rotate": "rotate,contrast",
+		"downscale":       "downscale=3500",
+	} {
+		steps, err := ParseSteps(spec)
+		if err != nil || steps.String() != want {
+			t.Errorf("ParseSteps(%q) = %s, %v, want %s", spec, steps, err, want)
+		}
+	}
+	if _, err := ParseSteps("orient,sharpen"); err == nil {
+		t.Errorf("no error for an unknown step")
+	}
+}
+
+// decodeFile decodes an image file into NRGBA
+func decodeFile(t *testing.T, path string) *image.NRGBA {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, _, err := Decode(data)
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return toNRGBA(img)
+}
+
+// pixelHash identifies an image by its size and pixels
+func pixelHash(img *image.NRGBA) string {
+	h := sha256.New()
+	binary.Write(h, binary.BigEndian, [2]int32{int32(img.Rect.Dx()), int32(img.Rect.Dy())})
+	for y := 0; y < img.Rect.Dy(); y++ {
+		i := img.PixOffset(0, y)
+		h.Write(img.Pix[i : i+4*img.Rect.Dx()])
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// meanDifference is the mean absolute difference of the luminance of two
+// images, or -1 if their sizes differ
+func meanDifference(a, b *image.NRGBA) float64 {
+	if a.Rect.Size() != b.Rect.Size() {
+		return -1
+	}
+	var sum int
+	for i := 0; i+3 < len(a.Pix); i += 4 {
+		la, lb := int(luminance(a.Pix[i], a.Pix[i+1], a.Pix[i+2])), int(luminance(b.Pix[i], b.Pix[i+1], b.Pix[i+2]))
+		sum += max(la-lb, lb-la)
+	}
+	return float64(sum) / float64(len(a.Pix)/4)
+}
+
+func readGolden(t *testing.T) map[string]string {
+	t.Helper()
+	f, err := os.Open(goldenFile)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	defer f.Close()
+	golden := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if name, hash, ok := strings.Cut(scanner.Text(), " "); ok {
+			golden[name] = hash
+		}
+	}
+	return golden
+}
+
+// pageText is the text of the generated page
+var pageText = []string{
+	"Giay chung nhan dang ky doanh nghiep",
+	"Cong ty trach nhiem huu han hai thanh vien",
+	"Ma so doanh nghiep: 0312345678",
+	"Dang ky lan dau: ngay 15 thang 03 nam 2019",
+	"Dia chi tru so chinh: So 12 duong Nguyen",
+	"Thi Minh Khai, phuong Da Kao, quan 1,",
+	"thanh pho Ho Chi Minh. Dien thoai: 028",
+	"Von dieu le: 5.000.000.000 dong (Nam ty",
+	"dong). Nguoi dai dien theo phap luat:",
+	"ong Tran Van Binh, giam doc, sinh ngay",
+	"02 thang 09 nam 1980, quoc tich Viet Nam.",
+	"Loai giay to phap ly: can cuoc cong dan,",
+	"so 079080001234 cap ngay 10 thang 07 nam",
+	"2021 tai Cuc canh sat quan ly hanh chinh.",
+}
+
+// writeTestImages draws upright.png and derives the other test images from it
+func writeTestImages(t *testing.T) {
+	t.Helper()
+	face, err := opentype.Parse(gobold.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fontFace, err := opentype.NewFace(face, &opentype.FaceOptions{Size: 16, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := image.NewNRGBA(image.Rect(0, 0, 420, 560))
+	draw.Draw(page, page.Bounds(), image.White, image.Point{}, draw.Src)
+	d := font.Drawer{Dst: page, Src: image.Black, Face: fontFace}
+	for i, line := range pageText {
+		d.Dot = fixed.P(36, 60+i*32)
+		d.DrawString(line)
+	}
+
+	lowContrast := image.NewNRGBA(page.Rect)
+	for i := range page.Pix {
+		lowContrast.Pix[i] = page.Pix[i]
+		if i%4 != 3 {
+			lowContrast.Pix[i] = uint8(110 + int(page.Pix[i])*90/255) // black is 110, white 200
+		}
+	}
+
+	// EXIF orientation 6 means the stored image must be turned 90° clockwise
+	// to be upright, so it is stored turned the other way, and vice versa
+	writePNG(t, "upright.png", page)
+	writeJPEG(t, "exif6.jpg", orient(page, 8), 6)
+	writeJPEG(t, "exif8.jpg", orient(page, 6), 8)
+	writePNG(t, "rotated90.png", orient(page, 8))
+	writePNG(t, "rotated180.png", orient(page, 3))
+	writePNG(t, "skew3.png", rotate(page, 3))
+	writePNG(t, "low_contrast.png", lowContrast)
+}
+
+func writePNG(t *testing.T, name string, img image.Image) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("testdata", name), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeJPEG writes img as a JPEG with an EXIF orientation tag
+func writeJPEG(t *testing.T, name string, img image.Image, orientation uint16) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	// A big-endian TIFF header with one IFD0 entry: Orientation, SHORT, 1 value
+	exif := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00")
+	binary.BigEndian.PutUint16(exif[6+8+2+8:], orientation)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(exif)+2))
+	data := append(append(append([]byte{0xFF, 0xD8}, app1...), exif...), buf.Bytes()[2:]...)
+	if err := os.WriteFile(filepath.Join("testdata", name), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,148 @@
+package imageprep
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+// toNRGBA converts img to an NRGBA image whose bounds start at the origin
+func toNRGBA(img image.Image) *image.NRGBA {
+	if n, ok := img.(*image.NRGBA); ok && n.Rect.Min == (image.Point{}) {
+		return n
+	}
+	b := img.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(out, out.Bounds(), img, b.Min, draw.Src)
+	return out
+}
+
+// orient undoes an EXIF orientation (2 to 8), e.g. 6 turns the image 90° clockwise
+func orient(img *image.NRGBA, orientation int) *image.NRGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	out := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			// (sx, sy) is the source pixel shown at (x, y)
+			sx, sy := x, y
+			switch orientation {
+			case 2:
+				sx = w - 1 - x
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sy = h - 1 - y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			copy(out.Pix[out.PixOffset(x, y):out.PixOffset(x, y)+4], img.Pix[img.PixOffset(sx, sy):img.PixOffset(sx, sy)+4])
+		}
+	}
+	return out
+}
+
+// turnsOrientation is the EXIF orientation that turns an image clockwise by
+// the given number of quarter turns
+var turnsOrientation = map[int]int{1: 6, 2: 3, 3: 8}
+
+// downscale shrinks img so its longest side is maxDimension
+func downscale(img *image.NRGBA, maxDimension int) *image.NRGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	scale := float64(maxDimension) / float64(max(w, h))
+	dw := max(1, int(math.Round(float64(w)*scale)))
+	dh := max(1, int(math.Round(float64(h)*scale)))
+	out := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	draw.CatmullRom.Scale(out, out.Bounds(), img, img.Rect, draw.Src, nil)
+	return out
+}
+
+// rotate turns img clockwise by degrees around its center. The canvas grows
+// to hold the whole image and the uncovered corners are white, like paper.
+func rotate(img *image.NRGBA, degrees float64) *image.NRGBA {
+	rad := degrees * math.Pi / 180
+	sin, cos := math.Sincos(rad)
+	w, h := float64(img.Rect.Dx()), float64(img.Rect.Dy())
+	dw := int(math.Ceil(math.Abs(w*cos) + math.Abs(h*sin)))
+	dh := int(math.Ceil(math.Abs(w*sin) + math.Abs(h*cos)))
+	out := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	draw.Draw(out, out.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	// Map source to destination: move the source center to the origin,
+	// rotate, then move it to the destination center
+	scx, scy := w/2, h/2
+	dcx, dcy := float64(dw)/2, float64(dh)/2
+	s2d := f64.Aff3{
+		cos, -sin, dcx - (cos*scx - sin*scy),
+		sin, cos, dcy - (sin*scx + cos*scy),
+	}
+	draw.BiLinear.Transform(out, s2d, img, img.Rect, draw.Over, nil)
+	return out
+}
+
+// Contrast stretching: images whose 1st to 99th luminance percentiles span
+// less than minContrastRange are stretched to the full range; nearly blank
+// images (less than minContentRange) are left alone.
+const (
+	minContrastRange = 200
+	minContentRange  = 24
+)
+
+// stretchContrast maps the 1st luminance percentile to black and the 99th to
+// white. It reports false if the image already has enough contrast.
+func stretchContrast(img *image.NRGBA) (*image.NRGBA, bool) {
+	var histogram [256]int
+	pixels := 0
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		histogram[luminance(img.Pix[i], img.Pix[i+1], img.Pix[i+2])]++
+		pixels++
+	}
+	lo, hi := percentile(histogram, pixels, 0.01), percentile(histogram, pixels, 0.99)
+	if hi-lo >= minContrastRange || hi-lo < minContentRange {
+		return img, false
+	}
+
+	var lookup [256]uint8
+	for v := range lookup {
+		stretched := (v - lo) * 255 / (hi - lo)
+		lookup[v] = uint8(min(255, max(0, stretched)))
+	}
+	out := image.NewNRGBA(img.Rect)
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		out.Pix[i] = lookup[img.Pix[i]]
+		out.Pix[i+1] = lookup[img.Pix[i+1]]
+		out.Pix[i+2] = lookup[img.Pix[i+2]]
+		out.Pix[i+3] = img.Pix[i+3]
+	}
+	return out, true
+}
+
+// luminance is the Rec. 601 luma of an RGB color
+func luminance(r, g, b uint8) uint8 {
+	return uint8((299*int(r) + 587*int(g) + 114*int(b) + 500) / 1000)
+}
+
+// percentile returns the smallest value with at least fraction of the pixels at or below it
+func percentile(histogram [256]int, pixels int, fraction float64) int {
+	target := int(math.Ceil(float64(pixels) * fraction))
+	seen := 0
+	for v, count := range histogram {
+		seen += count
+		if seen >= target {
+			return v
+		}
+	}
+	return 255
+}
@@ -90,6 +90,55 @@ type CustomerCheck struct {
 	Land             LandInfo       `json:"land"`
 	Financial        FinancialInfo  `json:"financial"`
 	Additional       AdditionalInfo `json:"additional"`
+
+	// Provenance maps a field path (e.g. "corporate.general.client_name",
+	// "financial.loans[0]") to the document that supplied its value
+	Provenance map[string]FieldProvenance `json:"provenance,omitempty"`
+
+	// Conflicts lists fields for which documents disagreed, for review by the credit officer
+	Conflicts []FieldConflict `json:"conflicts,omitempty"`
+}
+
+// FieldProvenance records where a populated field value came from
+type FieldProvenance struct {
+	SourceURL      string      `json:"source_url,omitempty"`
+	FileName       string      `json:"file_name,omitempty"`
+	DocumentSource string      `json:"document_source,omitempty"`
+	PageStart      int         `json:"page_start,omitempty"` // 1-based, 0 if unknown
+	PageEnd        int         `json:"page_end,omitempty"`
+	RawValue       interface{} `json:"raw_value,omitempty"` // model output before coercion
+	DocumentDate   *time.Time  `json:"document_date,omitempty"`
+	Confidence     float64     `json:"confidence,omitempty"` // model's self-reported confidence, 0-1
+	RecordedAt     time.Time   `json:"recorded_at"`
+}
+
+// FieldCandidate is one document's value for a field
+type FieldCandidate struct {
+	Value      interface{}     `json:"value"`
+	Provenance FieldProvenance `json:"provenance"`
+}
+
+// FieldConflict records documents that supplied different values for the same field
+type FieldConflict struct {
+	Field      string           `json:"field"`
+	Policy     string           `json:"policy"`
+	Resolved   bool             `json:"resolved"`
+	Chosen     interface{}      `json:"chosen,omitempty"` // value kept by the policy, if resolved
+	Candidates []FieldCandidate `json:"candidates"`
+}
+
+// SetProvenance records the provenance of a field, replacing any earlier entry
+func (c *CustomerCheck) SetProvenance(path string, p FieldProvenance) {
+	if c.Provenance == nil {
+		c.Provenance = make(map[string]FieldProvenance)
+	}
+	c.Provenance[path] = p
+}
+
+// ProvenanceFor returns the provenance of a field, if known
+func (c *CustomerCheck) ProvenanceFor(path string) (FieldProvenance, bool) {
+	p, ok := c.Provenance[path]
+	return p, ok
 }
 
 // ==================== Corporate ====================
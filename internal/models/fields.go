@@ -0,0 +1,103 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Fields that describe the check itself rather than the customer
+var metadataFields = map[string]bool{
+	"check_completed_at": true,
+	"provenance":         true,
+	"conflicts":          true,
+}
+
+// FieldValues returns every populated field of the check keyed by its JSON
+// path, e.g. "corporate.general.client_name". Pointers are dereferenced, and
+// each loan is a single entry ("financial.loans[0]").
+func (c *CustomerCheck) FieldValues() map[string]interface{} {
+	values := make(map[string]interface{})
+	collectFields(reflect.ValueOf(c).Elem(), "", values)
+	return values
+}
+
+func collectFields(v reflect.Value, prefix string, values map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := jsonName(t.Field(i))
+		if name == "" || (prefix == "" && metadataFields[name]) {
+			continue
+		}
+		path := prefix + name
+		fv := v.Field(i)
+
+		switch {
+		case fv.Kind() == reflect.Struct && fv.Type().PkgPath() == t.PkgPath():
+			collectFields(fv, path+".", values)
+		case fv.Kind() == reflect.Slice:
+			for j := 0; j < fv.Len(); j++ {
+				values[fmt.Sprintf("%s[%d]", path, j)] = fv.Index(j).Interface()
+			}
+		case fv.Kind() == reflect.Ptr:
+			if !fv.IsNil() {
+				values[path] = fv.Elem().Interface()
+			}
+		default:
+			if !fv.IsZero() {
+				values[path] = fv.Interface()
+			}
+		}
+	}
+}
+
+// jsonName returns the JSON field name of a struct field, or "" if it isn't serialized
+func jsonName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// SetFieldValue sets the field at a JSON path as returned by FieldValues.
+// Pointer fields are allocated as needed; slice entries ("financial.loans[0]")
+// are not addressable by path.
+func (c *CustomerCheck) SetFieldValue(path string, value interface{}) error {
+	v := reflect.ValueOf(c).Elem()
+	for _, name := range strings.Split(path, ".") {
+		if v.Kind() != reflect.Struct {
+			return fmt.Errorf("field %s: %s is not an object", path, name)
+		}
+		field, ok := fieldByJSONName(v, name)
+		if !ok {
+			return fmt.Errorf("field %s: no field named %s", path, name)
+		}
+		v = field
+	}
+
+	rv := reflect.ValueOf(value)
+	switch {
+	case !rv.IsValid():
+		v.Set(reflect.Zero(v.Type()))
+	case v.Kind() == reflect.Ptr && rv.Type().AssignableTo(v.Type().Elem()):
+		ptr := reflect.New(v.Type().Elem())
+		ptr.Elem().Set(rv)
+		v.Set(ptr)
+	case rv.Type().AssignableTo(v.Type()):
+		v.Set(rv)
+	default:
+		return fmt.Errorf("field %s: cannot assign %T to %s", path, value, v.Type())
+	}
+	return nil
+}
+
+func fieldByJSONName(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if jsonName(t.Field(i)) == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
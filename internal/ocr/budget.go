@@ -0,0 +1,46 @@
+package ocr
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultVisionBudget is the default number of Vision requests allowed in flight at once
+const DefaultVisionBudget = 8
+
+// DefaultPageConcurrency is the default number of PDF pages OCR'd in parallel
+const DefaultPageConcurrency = 4
+
+// The Vision request budget is shared by every caller in the process: images,
+// slide pictures and PDF pages of all files being processed at once.
+var (
+	visionBudgetMu sync.Mutex
+	visionBudget   = make(chan struct{}, DefaultVisionBudget)
+)
+
+// SetVisionBudget limits the number of Vision requests in flight across the
+// whole process. Zero or negative means DefaultVisionBudget. Requests already
+// waiting keep the previous limit.
+func SetVisionBudget(n int) {
+	if n <= 0 {
+		n = DefaultVisionBudget
+	}
+	visionBudgetMu.Lock()
+	defer visionBudgetMu.Unlock()
+	visionBudget = make(chan struct{}, n)
+}
+
+// acquireVision waits for a slot in the Vision request budget and returns the
+// function that releases it
+func acquireVision(ctx context.Context) (func(), error) {
+	visionBudgetMu.Lock()
+	budget := visionBudget
+	visionBudgetMu.Unlock()
+
+	select {
+	case budget <- struct{}{}:
+		return func() { <-budget }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,233 @@
+package ocr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"extraction/internal/types"
+)
+
+// OCREngine recognizes the text of images. Vision and Tesseract implement it,
+// and a chain of engines tries each in turn, so every OCR path (images, PDF
+// pages, slide pictures) can run on any of them.
+type OCREngine interface {
+	// OCRImages OCRs the images, up to concurrency at once, returning one
+	// result per image in input order. An image that fails carries its error;
+	// the returned error is for failures of the whole call.
+	OCRImages(ctx context.Context, imagePaths []string, lang string, concurrency int) ([]ImageText, error)
+	// Name identifies the engine, e.g. "vision"
+	Name() string
+}
+
+// ImageText is the OCR result for one image of a batch
+type ImageText struct {
+	Text       string
+	Confidence float64            // 0 to 1, or 0 if not reported
+	Layout     *types.PageLayout  // blocks, paragraphs and words found, if any
+	Engine     string             // OCR engine that produced the text
+	Scores     map[string]float64 // score of each engine's text, if an ensemble compared several
+	Err        error              `json:"-"` // set if the engine couldn't read this image
+}
+
+// fileReader is implemented by engines that read PDFs or multi-page TIFFs
+// without their pages being rendered to images first
+type fileReader interface {
+	ocrFile(ctx context.Context, path string, mimeType string, lang string, concurrency int) (PDFText, error)
+}
+
+// Supported OCR engines
+const (
+	EngineVision    = "vision"
+	EngineTesseract = "tesseract"
+	EngineEnsemble  = "ensemble" // Vision and Tesseract, keeping the best text of each page
+)
+
+// ErrEngineUnavailable is returned by an engine that can't run at all, e.g.
+// without its API key or binary
+var ErrEngineUnavailable = errors.New("OCR engine unavailable")
+
+// NewEngine creates the OCR engine for the given name: a chain for a
+// comma-separated list such as "vision,tesseract", an ensemble for a list
+// joined by "+" such as "vision+tesseract", or "ensemble" for the ensemble of
+// Vision and Tesseract. An empty name falls back to the OCR_ENGINE environment
+// variable and then to Vision.
+func NewEngine(name string) (OCREngine, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = strings.ToLower(strings.TrimSpace(os.Getenv("OCR_ENGINE")))
+	}
+	if name == "" {
+		name = EngineVision
+	}
+	if name == EngineEnsemble {
+		name = EngineVision + "+" + EngineTesseract
+	}
+
+	var chain []OCREngine
+	for _, link := range strings.Split(name, ",") {
+		var ensemble []OCREngine
+		for _, part := range strings.Split(link, "+") {
+			switch strings.TrimSpace(part) {
+			case EngineVision:
+				ensemble = append(ensemble, VisionEngine{})
+			case EngineTesseract:
+				ensemble = append(ensemble, TesseractEngine{})
+			default:
+				return nil, fmt.Errorf("unknown OCR engine %q (supported: %s, %s, %s, a comma-separated fallback chain or a +-joined ensemble)", part, EngineVision, EngineTesseract, EngineEnsemble)
+			}
+		}
+		if len(ensemble) == 1 {
+			chain = append(chain, ensemble[0])
+		} else {
+			chain = append(chain, NewEnsembleEngine(ensemble...))
+		}
+	}
+	if len(chain) == 1 {
+		return chain[0], nil
+	}
+	return NewChainEngine(chain...), nil
+}
+
+// OCRImage OCRs a single image with the engine
+func OCRImage(ctx context.Context, engine OCREngine, imagePath string, lang string) (ImageText, error) {
+	if imagePath == "" {
+		return ImageText{}, errors.New("image path is empty")
+	}
+	results, err := engine.OCRImages(ctx, []string{imagePath}, lang, 1)
+	if err != nil {
+		return ImageText{}, err
+	}
+	if results[0].Err != nil {
+		return ImageText{}, results[0].Err
+	}
+	return results[0], nil
+}
+
+// VisionEngine OCRs with Google Cloud Vision. Requires GOOGLE_VISION_API_KEY.
+type VisionEngine struct{}
+
+// Name returns "vision"
+func (VisionEngine) Name() string { return EngineVision }
+
+// OCRImages sends the images to Vision in batches (see OCRImagesVision)
+func (VisionEngine) OCRImages(ctx context.Context, imagePaths []string, lang string, concurrency int) ([]ImageText, error) {
+	return OCRImagesVision(ctx, imagePaths, lang, concurrency)
+}
+
+func (VisionEngine) ocrFile(ctx context.Context, path string, mimeType string, lang string, concurrency int) (PDFText, error) {
+	return extractPagesVisionFile(ctx, path, mimeType, lang, concurrency)
+}
+
+// ChainEngine tries its engines in order: images the first engine fails on or
+// finds no text in are passed to the next, and so on. The result of the last
+// engine tried is kept.
+type ChainEngine struct {
+	engines []OCREngine
+}
+
+// NewChainEngine creates an engine falling back through the given engines
+func NewChainEngine(engines ...OCREngine) *ChainEngine {
+	return &ChainEngine{engines: engines}
+}
+
+// Name joins the names of the engines, e.g. "vision,tesseract"
+func (c *ChainEngine) Name() string {
+	names := make([]string, len(c.engines))
+	for i, e := range c.engines {
+		names[i] = e.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// OCRImages OCRs the images with each engine in turn, passing on the images
+// the previous engines couldn't read. Engines that are unavailable are skipped.
+func (c *ChainEngine) OCRImages(ctx context.Context, imagePaths []string, lang string, concurrency int) ([]ImageText, error) {
+	results := make([]ImageText, len(imagePaths))
+	pending := make([]int, len(imagePaths)) // indexes of images without text yet
+	for i := range pending {
+		pending[i] = i
+	}
+
+	var errs []error
+	ran := false
+	for _, engine := range c.engines {
+		if len(pending) == 0 {
+			break
+		}
+		paths := make([]string, len(pending))
+		for j, i := range pending {
+			paths[j] = imagePaths[i]
+		}
+		engineResults, err := engine.OCRImages(ctx, paths, lang, concurrency)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", engine.Name(), err))
+			continue
+		}
+		ran = true
+
+		var next []int
+		for j, i := range pending {
+			results[i] = engineResults[j]
+			if engineResults[j].Err != nil || strings.TrimSpace(engineResults[j].Text) == "" {
+				next = append(next, i)
+			}
+		}
+		pending = next
+	}
+	if !ran {
+		return nil, joinErrors(errs)
+	}
+	return results, nil
+}
+
+// ocrFile reads the file with the first engine that can read it whole. The
+// caller renders the pages for the other engines if none can.
+func (c *ChainEngine) ocrFile(ctx context.Context, path string, mimeType string, lang string, concurrency int) (PDFText, error) {
+	var errs []error
+	allUnavailable := true
+	for _, engine := range c.engines {
+		reader, ok := engine.(fileReader)
+		if !ok {
+			allUnavailable = false
+			continue
+		}
+		doc, err := reader.ocrFile(ctx, path, mimeType, lang, concurrency)
+		if err == nil {
+			return doc, nil
+		}
+		if ctx.Err() != nil {
+			return PDFText{}, err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", engine.Name(), err))
+		if !errors.Is(err, ErrEngineUnavailable) {
+			allUnavailable = false
+		}
+	}
+	if allUnavailable {
+		return PDFText{}, joinErrors(errs)
+	}
+	return PDFText{}, fmt.Errorf("no engine could read the file whole: %s", joinErrors(errs))
+}
+
+// multiError reports the failures of several engines on one line
+type multiError []error
+
+func (m multiError) Error() string {
+	msgs := make([]string, len(m))
+	for i, err := range m {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (m multiError) Unwrap() []error { return m }
+
+func joinErrors(errs []error) error {
+	if len(errs) == 0 {
+		return errors.New("no OCR engine configured")
+	}
+	return multiError(errs)
+}
@@ -0,0 +1,272 @@
+package ocr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestNewEngine(t *testing.T) {
+	tests := []struct {
+		name, env string
+		wantType  string
+		wantName  string
+		wantErr   bool
+	}{
+		{name: "", wantType: "ocr.VisionEngine", wantName: "vision"},
+		{name: "", env: "tesseract", wantType: "ocr.TesseractEngine", wantName: "tesseract"},
+		{name: "vision", env: "tesseract", wantType: "ocr.VisionEngine", wantName: "vision"},
+		{name: " Tesseract ", wantType: "ocr.TesseractEngine", wantName: "tesseract"},
+		{name: "vision,tesseract", wantType: "*ocr.ChainEngine", wantName: "vision,tesseract"},
+		{name: "vision+tesseract", wantType: "*ocr.EnsembleEngine", wantName: "vision+tesseract"},
+		{name: "ensemble", wantType: "*ocr.EnsembleEngine", wantName: "vision+tesseract"},
+		{name: "", env: "ensemble", wantType: "*ocr.EnsembleEngine", wantName: "vision+tesseract"},
+		{name: "vision+tesseract, tesseract", wantType: "*ocr.ChainEngine", wantName: "vision+tesseract,tesseract"},
+		{name: "abbyy", wantErr: true},
+		{name: "vision,abbyy", wantErr: true},
+		{name: "vision,", wantErr: true},
+		{name: "vision++tesseract", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Setenv("OCR_ENGINE", tt.env)
+		engine, err := NewEngine(tt.name)
+		if tt.wantErr {
+			if err == nil || !strings.Contains(err.Error(), "unknown OCR engine") {
+				t.Errorf("NewEngine(%q): err = %v, want an unknown engine error", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewEngine(%q): %v", tt.name, err)
+			continue
+		}
+		if got := fmt.Sprintf("%T", engine); got != tt.wantType || engine.Name() != tt.wantName {
+			t.Errorf("NewEngine(%q) with OCR_ENGINE=%q = %s %q, want %s %q", tt.name, tt.env, got, engine.Name(), tt.wantType, tt.wantName)
+		}
+	}
+}
+
+// fakeEngine reads an image as the text its results map gives for its path;
+// paths missing from the map fail. err fails the whole call.
+type fakeEngine struct {
+	name    string
+	results map[string]string
+	err     error
+	calls   [][]string // image paths of each call
+}
+
+func (f *fakeEngine) Name() string { return f.name }
+
+func (f *fakeEngine) OCRImages(ctx context.Context, imagePaths []string, lang string, concurrency int) ([]ImageText, error) {
+	f.calls = append(f.calls, imagePaths)
+	if f.err != nil {
+		return nil, f.err
+	}
+	results := make([]ImageText, len(imagePaths))
+	for i, path := range imagePaths {
+		text, ok := f.results[path]
+		if !ok {
+			results[i] = ImageText{Engine: f.name, Err: fmt.Errorf("%s can't read %s", f.name, path)}
+			continue
+		}
+		results[i] = ImageText{Engine: f.name, Text: text}
+	}
+	return results, nil
+}
+
+func TestChainEngineOCRImages(t *testing.T) {
+	unavailable := fmt.Errorf("%w: no API key", ErrEngineUnavailable)
+	tests := []struct {
+		name    string
+		engines []*fakeEngine
+		want    []string // engine: text, or engine error, per image
+		calls   []string // images passed to each engine
+		wantErr bool
+	}{
+		{
+			name: "first engine reads everything",
+			engines: []*fakeEngine{
+				{name: "vision", results: map[string]string{"a": "A", "b": "B"}},
+				{name: "tesseract", results: map[string]string{"a": "a", "b": "b"}},
+			},
+			want:  []string{"vision: A", "vision: B"},
+			calls: []string{"vision [a b]", "tesseract []"},
+		},
+		{
+			name: "failed and empty images fall through",
+			engines: []*fakeEngine{
+				{name: "vision", results: map[string]string{"a": "A", "c": " \n"}},
+				{name: "tesseract", results: map[string]string{"b": "b", "c": "c"}},
+			},
+			want:  []string{"vision: A", "tesseract: b", "tesseract: c"},
+			calls: []string{"vision [a b c]", "tesseract [b c]"},
+		},
+		{
+			name: "the last engine's failure is kept",
+			engines: []*fakeEngine{
+				{name: "vision", results: map[string]string{"a": "A"}},
+				{name: "tesseract", results: map[string]string{"a": "a"}},
+			},
+			want:  []string{"vision: A", "error: tesseract can't read b"},
+			calls: []string{"vision [a b]", "tesseract [b]"},
+		},
+		{
+			name: "empty text is kept when no engine finds more",
+			engines: []*fakeEngine{
+				{name: "vision", results: map[string]string{"a": ""}},
+				{name: "tesseract", results: map[string]string{"a": ""}},
+			},
+			want:  []string{"tesseract: "},
+			calls: []string{"vision [a]", "tesseract [a]"},
+		},
+		{
+			name: "unavailable engines are skipped",
+			engines: []*fakeEngine{
+				{name: "vision", err: unavailable},
+				{name: "tesseract", results: map[string]string{"a": "a", "b": "b"}},
+			},
+			want:  []string{"tesseract: a", "tesseract: b"},
+			calls: []string{"vision [a b]", "tesseract [a b]"},
+		},
+		{
+			name: "no engine available",
+			engines: []*fakeEngine{
+				{name: "vision", err: unavailable},
+				{name: "tesseract", err: fmt.Errorf("%w: not installed", ErrEngineUnavailable)},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		var engines []OCREngine
+		for _, e := range tt.engines {
+			engines = append(engines, e)
+		}
+		paths := []string{"a", "b", "c"}[:max(len(tt.want), 1)]
+		results, err := NewChainEngine(engines...).OCRImages(context.Background(), paths, "vie", 1)
+		if tt.wantErr {
+			if !errors.Is(err, ErrEngineUnavailable) || !strings.Contains(err.Error(), "vision: ") || !strings.Contains(err.Error(), "tesseract: ") {
+				t.Errorf("%s: err = %v, want both engines unavailable", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var got []string
+		for _, r := range results {
+			if r.Err != nil {
+				got = append(got, "error: "+r.Err.Error())
+			} else {
+				got = append(got, r.Engine+": "+r.Text)
+			}
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%s: results = %q, want %q", tt.name, got, tt.want)
+		}
+		var calls []string
+		for _, e := range tt.engines {
+			var call []string
+			for _, c := range e.calls {
+				call = append(call, c...)
+			}
+			calls = append(calls, fmt.Sprintf("%s %v", e.name, call))
+		}
+		if strings.Join(calls, "|") != strings.Join(tt.calls, "|") {
+			t.Errorf("%s: calls = %q, want %q", tt.name, calls, tt.calls)
+		}
+	}
+}
+
+// tsvRows builds tesseract TSV output from rows of level, page, block,
+// paragraph, line and word numbers, box, confidence and text
+func tsvRows(rows ...string) string {
+	header := "level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext"
+	return header + "\n" + strings.ReplaceAll(strings.Join(rows, "\n"), " ", "\t") + "\n"
+}
+
+func TestParseTesseractTSV(t *testing.T) {
+	tsv := tsvRows(
+		"1 1 0 0 0 0 0 0 1240 1754 -1 ",
+		"2 1 1 0 0 0 100 80 900 120 -1 ",
+		"3 1 1 1 0 0 100 80 900 120 -1 ",
+		"4 1 1 1 1 0 100 80 900 50 -1 ",
+		"5 1 1 1 1 1 100 80 200 50 96 CỘNG",
+		"5 1 1 1 1 2 320 80 200 50 94 HÒA",
+		"4 1 1 1 2 0 100 150 900 50 -1 ",
+		"5 1 1 1 2 1 100 150 300 50 90 Độc",
+		"5 1 1 1 2 2 420 150 300 50 80 lập",
+		"3 1 1 2 0 0 100 300 900 50 -1 ",
+		"4 1 1 2 1 0 100 300 900 50 -1 ",
+		"5 1 1 2 1 1 100 300 200 50 70 Mã",
+		"5 1 1 2 1 2 320 300 200 50 -1  ",
+		"5 1 1 2 1 3 540 300 200 50 50 số",
+		"2 1 2 0 0 0 100 1500 900 100 -1 ",
+		"3 1 2 1 0 0 100 1500 900 100 -1 ",
+		"4 1 2 1 1 0 100 1500 900 100 -1 ",
+		"5 1 2 1 1 1 100 1500 400 100 40 Ký",
+		"1 2 0 0 0 0 0 0 800 600 -1 ",
+		"2 2 1 0 0 0 10 10 100 20 -1 ",
+		"3 2 1 1 0 0 10 10 100 20 -1 ",
+		"4 2 1 1 1 0 10 10 100 20 -1 ",
+		"5 2 1 1 1 1 10 10 100 20 88 Trang",
+		"5 2 1 1 1 2 10 10 100 20 92 hai",
+		"1 3 0 0 0 0 0 0 800 600 -1 ",
+	)
+	pages := parseTesseractTSV(tsv)
+	if len(pages) != 3 {
+		t.Fatalf("%d pages, want 3", len(pages))
+	}
+
+	first := pages[0]
+	if want := "CỘNG HÒA\nĐộc lập\n\nMã số\n\nKý"; first.Text != want {
+		t.Errorf("page 1 text = %q, want %q", first.Text, want)
+	}
+	layout := first.Layout
+	if layout.Page != 1 || layout.Width != 1240 || layout.Height != 1754 || len(layout.Blocks) != 2 {
+		t.Fatalf("page 1 layout = %+v", layout)
+	}
+	block := layout.Blocks[0]
+	if len(block.Paragraphs) != 2 || block.Paragraphs[0].Text != "CỘNG HÒA\nĐộc lập" || block.Paragraphs[1].Text != "Mã số" {
+		t.Errorf("block 1 paragraphs = %+v", block.Paragraphs)
+	}
+	word := block.Paragraphs[0].Words[1]
+	if word.Text != "HÒA" || !near(word.Confidence, 0.94) || word.BoundingBox[2].X != 520 || word.BoundingBox[2].Y != 130 {
+		t.Errorf("word HÒA = %+v", word)
+	}
+	for _, c := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"paragraph 1", block.Paragraphs[0].Confidence, (0.96 + 0.94 + 0.90 + 0.80) / 4},
+		{"paragraph 2", block.Paragraphs[1].Confidence, (0.70 + 0.50) / 2},
+		{"block 1", block.Confidence, (0.96 + 0.94 + 0.90 + 0.80 + 0.70 + 0.50) / 6},
+		{"block 2", layout.Blocks[1].Confidence, 0.40},
+		{"page 1", first.Confidence, (0.96 + 0.94 + 0.90 + 0.80 + 0.70 + 0.50 + 0.40) / 7},
+		{"page 1 layout", layout.Confidence, first.Confidence},
+		{"page 2", pages[1].Confidence, 0.90},
+	} {
+		if !near(c.got, c.want) {
+			t.Errorf("%s confidence = %.4f, want %.4f", c.name, c.got, c.want)
+		}
+	}
+
+	if pages[1].Text != "Trang hai" || pages[1].Layout.Page != 2 || pages[1].Engine != EngineTesseract {
+		t.Errorf("page 2 = %+v", pages[1])
+	}
+	if pages[2].Text != "" || pages[2].Confidence != 0 || len(pages[2].Layout.Blocks) != 0 {
+		t.Errorf("blank page 3 = %+v", pages[2])
+	}
+
+	if pages := parseTesseractTSV(""); len(pages) != 0 {
+		t.Errorf("empty output: %d pages", len(pages))
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
@@ -0,0 +1,197 @@
+package ocr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"extraction/internal/types"
+)
+
+// EnsembleEngine runs all its engines on every image or page and keeps the
+// text that scores best (see ScoreText). The winning engine and every engine's
+// score are recorded with the result so OCR quality can be audited.
+type EnsembleEngine struct {
+	engines []OCREngine
+}
+
+// NewEnsembleEngine creates an engine comparing the given engines
+func NewEnsembleEngine(engines ...OCREngine) *EnsembleEngine {
+	return &EnsembleEngine{engines: engines}
+}
+
+// Name joins the names of the engines with "+", e.g. "vision+tesseract"
+func (e *EnsembleEngine) Name() string {
+	names := make([]string, len(e.engines))
+	for i, engine := range e.engines {
+		names[i] = engine.Name()
+	}
+	return strings.Join(names, "+")
+}
+
+// OCRImages runs every engine on the images at the same time and keeps the
+// best result for each image. Engines that fail as a whole are left out; the
+// call only fails if all of them do.
+func (e *EnsembleEngine) OCRImages(ctx context.Context, imagePaths []string, lang string, concurrency int) ([]ImageText, error) {
+	all := make([][]ImageText, len(e.engines))
+	errs := make([]error, len(e.engines))
+	var wg sync.WaitGroup
+	for i, engine := range e.engines {
+		wg.Add(1)
+		go func(i int, engine OCREngine) {
+			defer wg.Done()
+			all[i], errs[i] = engine.OCRImages(ctx, imagePaths, lang, concurrency)
+			if errs[i] != nil {
+				errs[i] = fmt.Errorf("%s: %w", engine.Name(), errs[i])
+			}
+		}(i, engine)
+	}
+	wg.Wait()
+
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) == len(e.engines) {
+		return nil, joinErrors(failed)
+	}
+
+	results := make([]ImageText, len(imagePaths))
+	for img := range imagePaths {
+		var candidates []ImageText
+		for i, engine := range e.engines {
+			if errs[i] != nil {
+				continue
+			}
+			candidate := all[i][img]
+			if candidate.Engine == "" {
+				candidate.Engine = engine.Name()
+			}
+			candidates = append(candidates, candidate)
+		}
+		results[img] = pickBest(candidates)
+	}
+	return results, nil
+}
+
+// ocrFile reads the file whole with every engine and keeps the best text for
+// each page. It fails unless every engine can read the file whole, so the
+// caller renders the pages instead.
+func (e *EnsembleEngine) ocrFile(ctx context.Context, path string, mimeType string, lang string, concurrency int) (PDFText, error) {
+	docs := make([]PDFText, len(e.engines))
+	var errs []error
+	allUnavailable := true
+	for i, engine := range e.engines {
+		reader, ok := engine.(fileReader)
+		if !ok {
+			return PDFText{}, fmt.Errorf("%s can't read files whole", engine.Name())
+		}
+		doc, err := reader.ocrFile(ctx, path, mimeType, lang, concurrency)
+		if err != nil {
+			if ctx.Err() != nil {
+				return PDFText{}, err
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", engine.Name(), err))
+			if !errors.Is(err, ErrEngineUnavailable) {
+				allUnavailable = false
+			}
+			continue
+		}
+		docs[i] = doc
+	}
+	if len(errs) > 0 {
+		if allUnavailable && len(errs) == len(e.engines) {
+			return PDFText{}, joinErrors(errs)
+		}
+		return PDFText{}, fmt.Errorf("not every engine could read the file whole: %s", joinErrors(errs))
+	}
+
+	pageCount := 0
+	for _, doc := range docs {
+		if len(doc.Pages) > pageCount {
+			pageCount = len(doc.Pages)
+		}
+	}
+	pages := make([]types.PageResult, pageCount)
+	layouts := make([]*types.PageLayout, pageCount)
+	for p := range pages {
+		var candidates []ImageText
+		for i, doc := range docs {
+			if p >= len(doc.Pages) {
+				continue
+			}
+			page := doc.Pages[p]
+			candidate := ImageText{Text: page.Text, Confidence: page.Confidence, Engine: page.Method}
+			if candidate.Engine == "" {
+				candidate.Engine = e.engines[i].Name()
+			}
+			if page.Error != "" {
+				candidate.Err = errors.New(page.Error)
+			}
+			if layout := LayoutOf(doc.Layout, p+1, p+1); len(layout) > 0 {
+				candidate.Layout = &layout[0]
+			}
+			candidates = append(candidates, candidate)
+		}
+		best := pickBest(candidates)
+		pages[p] = types.PageResult{Page: p + 1, Text: best.Text, Method: best.Engine, Confidence: best.Confidence, Scores: best.Scores}
+		if best.Err != nil {
+			pages[p].Error = best.Err.Error()
+			continue
+		}
+		layouts[p] = best.Layout
+	}
+	return newPDFText(pages, layouts), nil
+}
+
+// pickBest returns the candidate whose text scores best, with the scores of
+// all candidates. Text from fewer words than the longest candidate is scored
+// down, so an engine that read only a fragment doesn't win on its clean text.
+// Scores are keyed by engine; a second candidate from the same engine is
+// keyed by engine and position, as in "tesseract#2". If every candidate
+// failed, the first failure is returned.
+func pickBest(candidates []ImageText) ImageText {
+	if len(candidates) == 0 {
+		return ImageText{Err: errors.New("no OCR result")}
+	}
+	maxWords := 0
+	for _, c := range candidates {
+		if c.Err == nil {
+			if n := len(scoreWords(c.Text)); n > maxWords {
+				maxWords = n
+			}
+		}
+	}
+
+	scores := make(map[string]float64, len(candidates))
+	best, bestScore := -1, 0.0
+	for i, c := range candidates {
+		if c.Err != nil {
+			continue
+		}
+		score := ScoreText(c.Text, c.Confidence)
+		if maxWords > 0 {
+			score *= math.Sqrt(float64(len(scoreWords(c.Text))) / float64(maxWords))
+		}
+		score = math.Round(score*1000) / 1000
+		name := c.Engine
+		if _, taken := scores[name]; taken {
+			name = fmt.Sprintf("%s#%d", c.Engine, i+1)
+		}
+		scores[name] = score
+		if best < 0 || score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	if best < 0 {
+		return candidates[0]
+	}
+	winner := candidates[best]
+	winner.Scores = scores
+	return winner
+}
@@ -0,0 +1,63 @@
+package ocr
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPickBest(t *testing.T) {
+	good := "Giấy chứng nhận đăng ký doanh nghiệp công ty trách nhiệm hữu hạn"
+	garbled := "Giav chimg nhan dang kv doanh nphiep cong ty trach nhiem huu han"
+	fragment := "doanh nghiệp"
+
+	tests := []struct {
+		name       string
+		candidates []ImageText
+		wantText   string
+		wantScores []string
+	}{
+		{
+			name:       "clean text wins",
+			candidates: []ImageText{{Engine: "tesseract", Text: garbled}, {Engine: "vision", Text: good, Confidence: 0.9}},
+			wantText:   good,
+			wantScores: []string{"tesseract", "vision"},
+		},
+		{
+			name:       "a fragment doesn't win on clean text",
+			candidates: []ImageText{{Engine: "vision", Text: fragment, Confidence: 0.99}, {Engine: "tesseract", Text: good}},
+			wantText:   good,
+			wantScores: []string{"vision", "tesseract"},
+		},
+		{
+			name:       "same engine twice",
+			candidates: []ImageText{{Engine: "tesseract", Text: garbled}, {Engine: "tesseract", Text: good}},
+			wantText:   good,
+			wantScores: []string{"tesseract", "tesseract#2"},
+		},
+		{
+			name:       "failures are skipped",
+			candidates: []ImageText{{Engine: "vision", Err: errors.New("quota")}, {Engine: "tesseract", Text: garbled}},
+			wantText:   garbled,
+			wantScores: []string{"tesseract"},
+		},
+	}
+	for _, tt := range tests {
+		got := pickBest(tt.candidates)
+		if got.Err != nil || got.Text != tt.wantText {
+			t.Errorf("%s: picked %q (%v), want %q", tt.name, got.Text, got.Err, tt.wantText)
+		}
+		if len(got.Scores) != len(tt.wantScores) {
+			t.Errorf("%s: scores = %v, want %v", tt.name, got.Scores, tt.wantScores)
+		}
+		for _, engine := range tt.wantScores {
+			if _, ok := got.Scores[engine]; !ok {
+				t.Errorf("%s: no score for %s in %v", tt.name, engine, got.Scores)
+			}
+		}
+	}
+
+	failed := pickBest([]ImageText{{Engine: "vision", Err: errors.New("quota")}, {Engine: "tesseract", Err: errors.New("missing")}})
+	if failed.Err == nil || failed.Err.Error() != "quota" {
+		t.Errorf("all failed: err = %v, want the first failure", failed.Err)
+	}
+}
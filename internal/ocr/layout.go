@@ -0,0 +1,133 @@
+package ocr
+
+import (
+	"strings"
+
+	"extraction/internal/types"
+)
+
+// Vision's text hierarchy: pages of blocks of paragraphs of words of symbols
+
+type visionPage struct {
+	Width      int           `json:"width"`
+	Height     int           `json:"height"`
+	Confidence float64       `json:"confidence"`
+	Blocks     []visionBlock `json:"blocks"`
+}
+
+type visionBlock struct {
+	BlockType   string            `json:"blockType"`
+	BoundingBox visionBoundingBox `json:"boundingBox"`
+	Confidence  float64           `json:"confidence"`
+	Paragraphs  []visionParagraph `json:"paragraphs"`
+}
+
+type visionParagraph struct {
+	BoundingBox visionBoundingBox `json:"boundingBox"`
+	Confidence  float64           `json:"confidence"`
+	Words       []visionWord      `json:"words"`
+}
+
+type visionWord struct {
+	BoundingBox visionBoundingBox `json:"boundingBox"`
+	Confidence  float64           `json:"confidence"`
+	Symbols     []visionSymbol    `json:"symbols"`
+}
+
+type visionSymbol struct {
+	Text     string `json:"text"`
+	Property struct {
+		DetectedBreak struct {
+			Type string `json:"type"`
+		} `json:"detectedBreak"`
+	} `json:"property"`
+}
+
+// visionBoundingBox has pixel vertices for images and normalized (0 to 1)
+// vertices for pages of PDFs and TIFFs
+type visionBoundingBox struct {
+	Vertices           []visionVertex `json:"vertices"`
+	NormalizedVertices []visionVertex `json:"normalizedVertices"`
+}
+
+type visionVertex struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// layout converts the text hierarchy of a response to the layout of the given
+// page. An image Vision saw as several pages is returned as one page holding
+// all their blocks. Returns nil if the response has no structure.
+func (r visionSingleResponse) layout(page int) *types.PageLayout {
+	if len(r.FullTextAnnotation.Pages) == 0 {
+		return nil
+	}
+	result := &types.PageLayout{Page: page, Confidence: r.confidence()}
+	for _, vp := range r.FullTextAnnotation.Pages {
+		if vp.Width > result.Width {
+			result.Width = vp.Width
+		}
+		if vp.Height > result.Height {
+			result.Height = vp.Height
+		}
+		for _, vb := range vp.Blocks {
+			block := types.LayoutBlock{
+				Type:        strings.ToLower(vb.BlockType),
+				BoundingBox: vb.BoundingBox.points(vp),
+				Confidence:  vb.Confidence,
+			}
+			if block.Type == "" {
+				block.Type = "unknown"
+			}
+			for _, vpar := range vb.Paragraphs {
+				paragraph := types.LayoutParagraph{BoundingBox: vpar.BoundingBox.points(vp), Confidence: vpar.Confidence}
+				var text strings.Builder
+				for _, vw := range vpar.Words {
+					var word strings.Builder
+					for _, sym := range vw.Symbols {
+						word.WriteString(sym.Text)
+						text.WriteString(sym.Text)
+						text.WriteString(breakText(sym.Property.DetectedBreak.Type))
+					}
+					paragraph.Words = append(paragraph.Words, types.LayoutWord{
+						Text:        word.String(),
+						BoundingBox: vw.BoundingBox.points(vp),
+						Confidence:  vw.Confidence,
+					})
+				}
+				paragraph.Text = strings.TrimSpace(text.String())
+				block.Paragraphs = append(block.Paragraphs, paragraph)
+			}
+			result.Blocks = append(result.Blocks, block)
+		}
+	}
+	return result
+}
+
+// points returns the polygon in page units, scaling normalized vertices by the page size
+func (b visionBoundingBox) points(page visionPage) []types.Point {
+	var points []types.Point
+	if len(b.Vertices) > 0 {
+		for _, v := range b.Vertices {
+			points = append(points, types.Point{X: v.X, Y: v.Y})
+		}
+		return points
+	}
+	for _, v := range b.NormalizedVertices {
+		points = append(points, types.Point{X: v.X * float64(page.Width), Y: v.Y * float64(page.Height)})
+	}
+	return points
+}
+
+// breakText is the text Vision's detected break after a symbol stands for
+func breakText(breakType string) string {
+	switch breakType {
+	case "SPACE", "SURE_SPACE":
+		return " "
+	case "EOL_SURE_SPACE", "LINE_BREAK":
+		return "\n"
+	case "HYPHEN":
+		return "-\n"
+	}
+	return ""
+}
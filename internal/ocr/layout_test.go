@@ -0,0 +1,144 @@
+package ocr
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// symbols renders the symbols of a word as Vision JSON, with a detected break
+// after the last one
+func symbols(word, breakType string) string {
+	runes := []rune(word)
+	var s []string
+	for i, r := range runes {
+		if i == len(runes)-1 && breakType != "" {
+			s = append(s, fmt.Sprintf(`{"text": %q, "property": {"detectedBreak": {"type": %q}}}`, string(r), breakType))
+			continue
+		}
+		s = append(s, fmt.Sprintf(`{"text": %q}`, string(r)))
+	}
+	return "[" + strings.Join(s, ", ") + "]"
+}
+
+func TestVisionLayout(t *testing.T) {
+	word := func(text, breakType string, confidence float64, vertices string) string {
+		return fmt.Sprintf(`{"boundingBox": %s, "confidence": %g, "symbols": %s}`, vertices, confidence, symbols(text, breakType))
+	}
+	box := func(x0, y0, x1, y1 int) string {
+		return fmt.Sprintf(`{"vertices": [{"x": %d, "y": %d}, {"x": %d, "y": %d}, {"x": %d, "y": %d}, {"x": %d, "y": %d}]}`, x0, y0, x1, y0, x1, y1, x0, y1)
+	}
+	response := `{
+	"fullTextAnnotation": {
+		"text": "Số 12\nNguy-\nễn Huệ\nMST 0312345678",
+		"pages": [{
+			"width": 1000, "height": 1400, "confidence": 0.9,
+			"blocks": [
+				{
+					"blockType": "TEXT", "boundingBox": ` + box(100, 100, 600, 300) + `, "confidence": 0.93,
+					"paragraphs": [
+						{
+							"boundingBox": ` + box(100, 100, 600, 300) + `, "confidence": 0.92,
+							"words": [
+								` + word("Số", "SPACE", 0.99, box(100, 100, 160, 140)) + `,
+								` + word("12", "EOL_SURE_SPACE", 0.97, box(170, 100, 220, 140)) + `,
+								` + word("Nguy", "HYPHEN", 0.81, box(100, 150, 200, 190)) + `,
+								` + word("ễn", "SPACE", 0.8, box(100, 200, 150, 240)) + `,
+								` + word("Huệ", "LINE_BREAK", 0.95, box(160, 200, 240, 240)) + `
+							]
+						},
+						{
+							"boundingBox": ` + box(100, 250, 600, 300) + `, "confidence": 0.9,
+							"words": [
+								` + word("MST", "SURE_SPACE", 0.9, box(100, 250, 180, 300)) + `,
+								` + word("0312345678", "", 0.9, box(190, 250, 600, 300)) + `
+							]
+						}
+					]
+				},
+				{"blockType": "TABLE", "boundingBox": ` + box(100, 400, 900, 900) + `, "confidence": 0.7, "paragraphs": []},
+				{"boundingBox": ` + box(0, 0, 10, 10) + `}
+			]
+		}]
+	}
+}`
+	var r visionSingleResponse
+	if err := json.Unmarshal([]byte(response), &r); err != nil {
+		t.Fatal(err)
+	}
+	layout := r.layout(1)
+	if layout == nil || layout.Page != 1 || layout.Width != 1000 || layout.Height != 1400 || layout.Confidence != 0.9 {
+		t.Fatalf("layout = %+v", layout)
+	}
+	var types []string
+	for _, b := range layout.Blocks {
+		types = append(types, b.Type)
+	}
+	if fmt.Sprint(types) != "[text table unknown]" {
+		t.Errorf("block types = %v, want [text table unknown]", types)
+	}
+
+	text := layout.Blocks[0]
+	if text.Confidence != 0.93 || len(text.Paragraphs) != 2 {
+		t.Fatalf("text block = %+v", text)
+	}
+	if got, want := text.Paragraphs[0].Text, "Số 12\nNguy-\nễn Huệ"; got != want {
+		t.Errorf("paragraph 1 = %q, want %q", got, want)
+	}
+	if got, want := text.Paragraphs[1].Text, "MST 0312345678"; got != want {
+		t.Errorf("paragraph 2 = %q, want %q", got, want)
+	}
+	var words []string
+	for _, w := range text.Paragraphs[0].Words {
+		words = append(words, fmt.Sprintf("%s:%g", w.Text, w.Confidence))
+	}
+	if got := fmt.Sprint(words); got != "[Số:0.99 12:0.97 Nguy:0.81 ễn:0.8 Huệ:0.95]" {
+		t.Errorf("words = %s", got)
+	}
+	if got := fmt.Sprint(text.Paragraphs[0].Words[1].BoundingBox); got != "[{170 100} {220 100} {220 140} {170 140}]" {
+		t.Errorf("pixel box of 12 = %s", got)
+	}
+
+	// PDF and TIFF pages come with normalized vertices, scaled by the page size
+	pdfPage := `{
+	"context": {"pageNumber": 3},
+	"fullTextAnnotation": {
+		"text": "Trang 3",
+		"pages": [{
+			"width": 612, "height": 792, "confidence": 0.8,
+			"blocks": [{
+				"blockType": "TEXT",
+				"boundingBox": {"normalizedVertices": [{"x": 0.1, "y": 0.25}, {"x": 0.5, "y": 0.25}, {"x": 0.5, "y": 0.5}, {"x": 0.1, "y": 0.5}]},
+				"paragraphs": [{
+					"boundingBox": {"normalizedVertices": [{"x": 0.1, "y": 0.25}, {"x": 0.5, "y": 0.5}]},
+					"words": [{
+						"boundingBox": {"normalizedVertices": [{"x": 0.25, "y": 0.125}, {"x": 1, "y": 1}]},
+						"confidence": 0.8,
+						"symbols": ` + symbols("Trang", "") + `
+					}]
+				}]
+			}]
+		}]
+	}
+}`
+	r = visionSingleResponse{}
+	if err := json.Unmarshal([]byte(pdfPage), &r); err != nil {
+		t.Fatal(err)
+	}
+	layout = r.layout(3)
+	if layout == nil || layout.Page != 3 || layout.Width != 612 || layout.Height != 792 {
+		t.Fatalf("PDF page layout = %+v", layout)
+	}
+	block := layout.Blocks[0]
+	if got := fmt.Sprint(block.BoundingBox); got != "[{61.2 198} {306 198} {306 396} {61.2 396}]" {
+		t.Errorf("block box = %s", got)
+	}
+	if got := fmt.Sprint(block.Paragraphs[0].Words[0].BoundingBox); got != "[{153 99} {612 792}]" {
+		t.Errorf("word box = %s", got)
+	}
+
+	if layout := (visionSingleResponse{}).layout(1); layout != nil {
+		t.Errorf("layout of a response without pages = %+v, want nil", layout)
+	}
+}
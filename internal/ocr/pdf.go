@@ -3,26 +3,356 @@ package ocr
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode"
+
+	"extraction/internal/pdf"
+	"extraction/internal/types"
+)
+
+// How the text of a page was obtained: the text layer or the OCR engine
+const (
+	PageMethodTextLayer = "text-layer"
+	PageMethodVision    = "vision"
+	PageMethodTesseract = "tesseract"
 )
 
-// ExtractTextFromPDF first tries `pdftotext` (embedded text). If empty, it falls back
-// to rendering pages with `pdftoppm` and OCRing them with Google Cloud Vision.
-// Requires Poppler tools (pdftotext, pdftoppm) on PATH.
+// ExtractTextFromPDF first extracts the embedded text layer. If empty, it falls back
+// to OCRing the PDF with Google Cloud Vision, which reads PDFs directly; pages are
+// only rendered with `pdftoppm` if Vision can't take the file as a whole.
+// Poppler's pdftotext is used for the text layer when it is on PATH, and the
+// internal PDF reader otherwise.
 func ExtractTextFromPDF(ctx context.Context, pdfPath string, lang string, dpi int) (string, error) {
+	doc, err := ExtractPagesFromPDF(ctx, VisionEngine{}, pdfPath, lang, dpi, 0)
+	if err != nil {
+		return "", err
+	}
+	return doc.Text, nil
+}
+
+// PDFText is the text of a PDF or multi-page TIFF, as a whole and per page
+type PDFText struct {
+	Text  string             // full text, as returned by ExtractTextFromPDF
+	Pages  []types.PageResult // pages that yielded no text have empty Text
+	Layout []types.PageLayout // structure of the pages that were OCR'd, in page order
+}
+
+// newPDFText assembles the text of OCR'd pages, skipping missing layouts
+func newPDFText(pages []types.PageResult, layouts []*types.PageLayout) PDFText {
+	doc := PDFText{Pages: pages}
+	for _, layout := range layouts {
+		if layout != nil {
+			doc.Layout = append(doc.Layout, *layout)
+		}
+	}
+	doc.Text = JoinPages(doc.PageTexts())
+	return doc
+}
+
+// LayoutOf returns the layouts of the pages from start to end, inclusive
+func LayoutOf(layouts []types.PageLayout, start, end int) []types.PageLayout {
+	var selected []types.PageLayout
+	for _, layout := range layouts {
+		if layout.Page >= start && layout.Page <= end {
+			selected = append(selected, layout)
+		}
+	}
+	return selected
+}
+
+// PageTexts returns the text of each page
+func (d PDFText) PageTexts() []string {
+	texts := make([]string, len(d.Pages))
+	for i, page := range d.Pages {
+		texts[i] = page.Text
+	}
+	return texts
+}
+
+// ExtractPagesFromPDF extracts the text of each page from the embedded text
+// layer, and OCRs with the engine the pages whose text layer is missing,
+// too sparse for the page size or garbled (see TextLayerIssue). Only those
+// pages are rendered and OCR'd, unless all of them are or rendering fails, in
+// which case the whole file is (see OCRPDF). Up to pageConcurrency pages are
+// OCR'd at once (DefaultPageConcurrency if not positive). Pages that fail to
+// OCR are returned with their error rather than failing the PDF. PDFs that
+// need a password fail with an error wrapping pdf.ErrEncrypted.
+func ExtractPagesFromPDF(ctx context.Context, engine OCREngine, pdfPath string, lang string, dpi int, pageConcurrency int) (PDFText, error) {
+	doc, err := pdf.Open(pdfPath)
+	if errors.Is(err, pdf.ErrEncrypted) {
+		return PDFText{}, err
+	}
+	if err != nil {
+		doc = nil // Poppler may still read what the internal reader can't
+	}
+
 	// Try to extract embedded text
-	txt, err := runPdfToText(ctx, pdfPath)
-	if err == nil && len(strings.TrimSpace(txt)) > 10 {
-		// Only use embedded text if it has substantial content (more than 10 non-whitespace chars)
-		return txt, nil
+	txt, err := pdfTextLayer(ctx, pdfPath, doc)
+	if err != nil || strings.TrimSpace(txt) == "" {
+		// If the text layer can't be read or has no text at all, OCR the whole file
+		return OCRPDF(ctx, engine, pdfPath, lang, dpi, pageConcurrency)
+	}
+
+	// pdftotext ends every page with a form feed
+	texts := strings.Split(strings.TrimSuffix(txt, "\f"), "\f")
+	pages := make([]types.PageResult, len(texts))
+	usable := make(map[int]bool)
+	var scanned []int
+	for i, text := range texts {
+		pages[i] = types.PageResult{Page: i + 1, Text: text, Method: PageMethodTextLayer}
+		width, height := pageSize(doc, i+1)
+		if issue, ok := TextLayerIssue(text, width, height); issue != "" {
+			pages[i].TextLayerIssue = issue
+			usable[i+1] = ok
+			scanned = append(scanned, i+1)
+		}
+	}
+	if len(scanned) == 0 {
+		return PDFText{Text: txt, Pages: pages}, nil
+	}
+
+	var ocrd PDFText
+	if len(scanned) == len(pages) {
+		ocrd, err = OCRPDF(ctx, engine, pdfPath, lang, dpi, pageConcurrency)
+	} else {
+		ocrd, err = ocrRenderedPages(ctx, engine, pdfPath, lang, dpi, pageConcurrency, scanned)
+		if err != nil && ctx.Err() == nil && !errors.Is(err, ErrEngineUnavailable) {
+			// The pages may not be scans that can be OCR'd without pdftoppm;
+			// engines that read PDFs whole can still
+			if whole, wholeErr := OCRPDF(ctx, engine, pdfPath, lang, dpi, pageConcurrency); wholeErr == nil {
+				ocrd, err = whole, nil
+			}
+		}
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return PDFText{}, err
+		}
+		ocrd = PDFText{}
+		for _, page := range scanned {
+			ocrd.Pages = append(ocrd.Pages, types.PageResult{Page: page, Error: err.Error()})
+		}
+	}
+	return mergeOCRPages(pages, usable, ocrd), nil
+}
+
+// mergeOCRPages replaces the text layer of the pages in usable, whose text
+// layer has an issue, with their OCR'd text, keeping the page order. Sparse
+// but real text is kept if OCR found no more; text layers that are garbled
+// or empty are dropped, and pages that failed to OCR carry the error.
+func mergeOCRPages(pages []types.PageResult, usable map[int]bool, ocrd PDFText) PDFText {
+	layouts := make([]*types.PageLayout, len(pages))
+	done := make(map[int]bool)
+	for _, page := range ocrd.Pages {
+		keep, ok := usable[page.Page]
+		if !ok || done[page.Page] {
+			continue // not a page that needed OCR
+		}
+		done[page.Page] = true
+		layer := &pages[page.Page-1]
+		switch {
+		case page.Error != "":
+			layer.Error = page.Error
+			if !keep {
+				layer.Text = ""
+			}
+		case keep && nonSpaceChars(page.Text) <= nonSpaceChars(layer.Text):
+			// OCR found no more text than the text layer
+		default:
+			page.TextLayerIssue = layer.TextLayerIssue
+			*layer = page
+			if layout := LayoutOf(ocrd.Layout, page.Page, page.Page); len(layout) > 0 {
+				layouts[page.Page-1] = &layout[0]
+			}
+		}
+	}
+	for page, keep := range usable {
+		if !done[page] {
+			pages[page-1].Error = "no OCR result for page"
+			if !keep {
+				pages[page-1].Text = ""
+			}
+		}
 	}
-	// If pdftotext fails, returns empty text, or returns only control characters, fall back to OCR
+	return newPDFText(pages, layouts)
+}
+
+// nonSpaceChars counts the characters of text that aren't white space
+func nonSpaceChars(text string) int {
+	n := 0
+	for _, r := range text {
+		if !unicode.IsSpace(r) {
+			n++
+		}
+	}
+	return n
+}
+
+// OCRPDF OCRs every page of a PDF with the engine. Engines that read PDFs
+// whole, like Vision, are sent the file; otherwise, or if that fails (e.g. the
+// file is too large to send inline), the pages are rendered with pdftoppm at
+// dpi and OCR'd as images. Without Poppler, the images of scanned pages are
+// OCR'd instead, and other pages fail.
+func OCRPDF(ctx context.Context, engine OCREngine, pdfPath string, lang string, dpi int, pageConcurrency int) (PDFText, error) {
+	var fileErr error
+	if reader, ok := engine.(fileReader); ok {
+		doc, err := reader.ocrFile(ctx, pdfPath, "application/pdf", lang, pageConcurrency)
+		if err == nil {
+			return doc, nil
+		}
+		// Rendering the pages doesn't help an engine that can't run at all
+		if errors.Is(err, ErrEngineUnavailable) || ctx.Err() != nil {
+			return PDFText{}, err
+		}
+		fileErr = err
+	}
+	doc, err := ocrRenderedPages(ctx, engine, pdfPath, lang, dpi, pageConcurrency, nil)
+	if err != nil && fileErr != nil {
+		return PDFText{}, fmt.Errorf("%v; page rendering fallback: %w", fileErr, err)
+	}
+	return doc, err
+}
+
+// ExtractPagesFromTIFF OCRs each page of a (possibly multi-page) TIFF with the
+// engine. Engines that can't read TIFFs whole only see the first page.
+func ExtractPagesFromTIFF(ctx context.Context, engine OCREngine, tiffPath string, lang string, pageConcurrency int) (PDFText, error) {
+	if reader, ok := engine.(fileReader); ok {
+		return reader.ocrFile(ctx, tiffPath, "image/tiff", lang, pageConcurrency)
+	}
+	image, err := OCRImage(ctx, engine, tiffPath, lang)
+	if err != nil {
+		return PDFText{}, err
+	}
+	page := types.PageResult{Page: 1, Text: image.Text, Method: image.Engine, Confidence: image.Confidence}
+	return newPDFText([]types.PageResult{page}, []*types.PageLayout{image.Layout}), nil
+}
+
+// ocrRenderedPages renders the given pages of the PDF, or all of them if
+// pageNums is nil, with pdftoppm and OCRs the images with the engine, up to
+// concurrency at once. Without pdftoppm, the scanned image of each page is
+// OCR'd at its own resolution instead. Pages are returned in the order
+// rendered; those that fail to render or OCR carry their error and no text.
+func ocrRenderedPages(ctx context.Context, engine OCREngine, pdfPath string, lang string, dpi int, concurrency int, pageNums []int) (PDFText, error) {
+	tmpDir, err := os.MkdirTemp("", "pdf-ocr-*")
+	if err != nil {
+		return PDFText{}, fmt.Errorf("ocr fallback: mkdir temp: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
 	if dpi <= 0 {
 		dpi = 300
 	}
-	return ExtractTextFromPDFVision(ctx, pdfPath, lang, dpi)
+	var rendered []pageImage
+	if havePoppler("pdftoppm") {
+		rendered, err = renderPages(ctx, pdfPath, tmpDir, dpi, pageNums)
+	} else {
+		rendered, err = extractScans(ctx, pdfPath, tmpDir, pageNums)
+	}
+	if err != nil {
+		return PDFText{}, err
+	}
+	var images []string
+	for _, r := range rendered {
+		if r.err == nil {
+			images = append(images, r.path)
+		}
+	}
+
+	results, err := engine.OCRImages(ctx, images, lang, concurrency)
+	if err != nil {
+		return PDFText{}, err
+	}
+	pages := make([]types.PageResult, len(rendered))
+	layouts := make([]*types.PageLayout, len(rendered))
+	next := 0
+	for i, page := range rendered {
+		if page.err != nil {
+			pages[i] = types.PageResult{Page: page.page, Error: page.err.Error()}
+			continue
+		}
+		r := results[next]
+		next++
+		method := r.Engine
+		if method == "" {
+			method = engine.Name()
+		}
+		pages[i] = types.PageResult{Page: page.page, Text: r.Text, Method: method, Confidence: r.Confidence, DPI: page.dpi}
+		if r.Err != nil {
+			pages[i].Text = ""
+			pages[i].Error = r.Err.Error()
+			continue
+		}
+		if r.Layout != nil {
+			layouts[i] = r.Layout
+			layouts[i].Page = page.page
+		}
+	}
+	return newPDFText(pages, layouts), nil
+}
+
+// renderPages renders the given pages of the PDF, or all of them if pageNums
+// is nil, to PNG images in dir with pdftoppm at dpi
+func renderPages(ctx context.Context, pdfPath, dir string, dpi int, pageNums []int) ([]pageImage, error) {
+	var rendered []pageImage
+	if pageNums == nil {
+		prefix := filepath.Join(dir, "page")
+		if err := runPdfToPPM(ctx, "-r", fmt.Sprintf("%d", dpi), "-png", pdfPath, prefix); err != nil {
+			return nil, err
+		}
+		images, err := filepath.Glob(prefix + "-*.png")
+		if err != nil {
+			return nil, fmt.Errorf("ocr fallback: glob images: %w", err)
+		}
+		if len(images) == 0 {
+			return nil, fmt.Errorf("ocr fallback: no images produced from PDF")
+		}
+		sort.Strings(images)
+		for i, image := range images {
+			rendered = append(rendered, pageImage{page: i + 1, path: image, dpi: dpi})
+		}
+		return rendered, nil
+	}
+	for _, page := range pageNums {
+		prefix := filepath.Join(dir, fmt.Sprintf("page-%d", page))
+		n := strconv.Itoa(page)
+		if err := runPdfToPPM(ctx, "-r", fmt.Sprintf("%d", dpi), "-png", "-f", n, "-l", n, "-singlefile", pdfPath, prefix); err != nil {
+			return nil, err
+		}
+		rendered = append(rendered, pageImage{page: page, path: prefix + ".png", dpi: dpi})
+	}
+	return rendered, nil
+}
+
+// JoinPages joins the non-empty page texts with blank lines
+func JoinPages(pages []string) string {
+	var b strings.Builder
+	for _, page := range pages {
+		if s := strings.TrimSpace(page); s != "" {
+			if b.Len() > 0 {
+				b.WriteString("\n\n")
+			}
+			b.WriteString(s)
+		}
+	}
+	return b.String()
+}
+
+// runPdfToPPM renders PDF pages with Poppler's pdftoppm
+func runPdfToPPM(ctx context.Context, args ...string) error {
+	cmd := exec.CommandContext(ctx, "pdftoppm", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("pdftoppm error: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
 }
 
 func runPdfToText(ctx context.Context, pdfPath string) (string, error) {
@@ -0,0 +1,130 @@
+package ocr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"extraction/internal/pdf"
+)
+
+// Without Poppler, PDFs are read with the internal pdf package: the text
+// layer is extracted from the page content, and scanned pages are OCR'd from
+// the image they embed. Pages that are neither can't be rendered.
+
+// havePoppler reports whether a Poppler tool is on PATH
+func havePoppler(tool string) bool {
+	_, err := exec.LookPath(tool)
+	return err == nil
+}
+
+// pdfTextLayer returns the embedded text of a PDF, each page ended by a
+// form feed as pdftotext prints it: from pdftotext if Poppler is installed
+// or the internal reader couldn't parse the file (doc is nil), otherwise
+// from doc.
+func pdfTextLayer(ctx context.Context, pdfPath string, doc *pdf.Document) (string, error) {
+	if doc == nil || havePoppler("pdftotext") {
+		return runPdfToText(ctx, pdfPath)
+	}
+	var b strings.Builder
+	for _, page := range doc.Pages {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		// A page whose content can't be read has no text layer
+		text, _ := page.Text()
+		b.WriteString(text)
+		b.WriteString("\f")
+	}
+	return b.String(), nil
+}
+
+// pageImage is a page rendered or extracted for OCR, or why it couldn't be
+type pageImage struct {
+	page int
+	path string
+	dpi  int
+	err  error
+}
+
+// extractScans writes the scanned image of the given pages of a PDF, or of
+// all of them if pageNums is nil, to dir, for OCR without pdftoppm. Pages
+// that aren't a scan carry an error; if no page is, it fails.
+func extractScans(ctx context.Context, pdfPath, dir string, pageNums []int) ([]pageImage, error) {
+	doc, err := pdf.Open(pdfPath)
+	if err != nil {
+		return nil, fmt.Errorf("pdftoppm not found, and reading the PDF failed: %w", err)
+	}
+	if pageNums == nil {
+		for i := range doc.Pages {
+			pageNums = append(pageNums, i+1)
+		}
+	}
+	var images []pageImage
+	var firstErr error
+	extracted := 0
+	for _, n := range pageNums {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		img, err := scanImage(doc, n, filepath.Join(dir, fmt.Sprintf("page-%d.png", n)))
+		if err != nil {
+			images = append(images, pageImage{page: n, err: err})
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		images = append(images, img)
+		extracted++
+	}
+	if extracted == 0 {
+		if firstErr == nil {
+			firstErr = errors.New("PDF has no pages")
+		}
+		return nil, firstErr
+	}
+	return images, nil
+}
+
+// scanImage writes the scanned image of page n of doc to path as a PNG
+func scanImage(doc *pdf.Document, n int, path string) (pageImage, error) {
+	if n < 1 || n > len(doc.Pages) {
+		return pageImage{}, fmt.Errorf("page %d not found", n)
+	}
+	page := doc.Pages[n-1]
+	img, err := page.ScanImage()
+	if errors.Is(err, pdf.ErrNoScan) {
+		return pageImage{}, errors.New("page is not a plain scan; install Poppler (pdftoppm) to render it for OCR")
+	}
+	if err != nil {
+		return pageImage{}, fmt.Errorf("extract scanned image: %w", err)
+	}
+	if err := writePNG(path, img); err != nil {
+		return pageImage{}, err
+	}
+	dpi := 0
+	if page.Width > 0 {
+		dpi = int(math.Round(float64(img.Bounds().Dx()) * 72 / page.Width))
+	}
+	return pageImage{page: n, path: path, dpi: dpi}, nil
+}
+
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,127 @@
+package ocr
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Weights of the parts of a text score
+const (
+	scoreWeightDictionary = 0.45
+	scoreWeightConfidence = 0.30
+	scoreWeightClean      = 0.25
+)
+
+// unreportedConfidence stands in for the confidence of engines that don't report one
+const unreportedConfidence = 0.5
+
+// ScoreText rates how plausible OCR output is, from 0 to 1, so the outputs of
+// different engines for the same page can be compared. It combines the share
+// of words found in a Vietnamese/English dictionary, the confidence reported
+// by the engine (unreportedConfidence, 0.5, if not reported) and the absence
+// of typical OCR garbage such as letters mixed into numbers or runs of stray
+// symbols.
+func ScoreText(text string, confidence float64) float64 {
+	words := scoreWords(text)
+	if len(words) == 0 {
+		return 0
+	}
+	if confidence <= 0 {
+		confidence = unreportedConfidence
+	}
+	score := scoreWeightDictionary*dictionaryHitRate(words) +
+		scoreWeightConfidence*math.Min(confidence, 1) +
+		scoreWeightClean*(1-ocrErrorRate(text, len(words)))
+	return math.Round(score*1000) / 1000
+}
+
+// scoreWords splits text into lowercase words, trimming surrounding punctuation
+func scoreWords(text string) []string {
+	var words []string
+	for _, field := range strings.Fields(strings.ToLower(text)) {
+		word := strings.TrimFunc(field, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+		if word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// dictionaryHitRate is the share of words made of letters that are known
+// Vietnamese syllables or English words. Numbers and codes don't count either way.
+func dictionaryHitRate(words []string) float64 {
+	var letterWords, hits int
+	for _, word := range words {
+		if strings.IndexFunc(word, func(r rune) bool { return !unicode.IsLetter(r) }) >= 0 {
+			continue
+		}
+		letterWords++
+		if dictionary[word] {
+			hits++
+		}
+	}
+	if letterWords == 0 {
+		return 0.5
+	}
+	return float64(hits) / float64(letterWords)
+}
+
+// ocrErrorPatterns match typical OCR garbage, as in validation's OCR error check
+var ocrErrorPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`[0-9]+[a-zA-Z]+[0-9]+`),                   // letters inside numbers
+	regexp.MustCompile(`[^\p{L}\p{N}\s.,!?;:()\-/%'"+=&@#*]{3,}`), // runs of stray symbols
+	regexp.MustCompile(`\p{Ll}\p{Lu}`),                            // case flipping inside a word
+	regexp.MustCompile(`\x{FFFD}`),                                // replacement character
+}
+
+// ocrErrorRate is the number of suspicious matches per word, capped at 1
+func ocrErrorRate(text string, wordCount int) float64 {
+	var matches int
+	for _, re := range ocrErrorPatterns {
+		matches += len(re.FindAllStringIndex(text, -1))
+	}
+	return math.Min(1, float64(matches)/float64(wordCount))
+}
+
+// dictionary holds common Vietnamese syllables, notably those of business,
+// land, ID and financial documents, and common English words
+var dictionary = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(vietnameseSyllables + " " + englishWords) {
+		dictionary[word] = true
+	}
+}
+
+const vietnameseSyllables = `
+a à ai an anh ba bà bác bán bản bảng bao báo bảo bắc bằng bất bé bên bị biên biết bình
+bộ bởi bưu các cả cải cam cán cáo cấp cầu câu cho chỉ chi chí chiếu chính chịu chủ chú chung
+chúng chuyển chứng chức chưa chương có còn con công cộng cơ cư cứ của cục cùng cước cửa cương
+đã đại đang đánh đào đạt đăng đặc đâu đầu đầy đến để đề đền đều địa điểm điện điều định đó đoàn
+đóng đô độ đối đồng đơn đủ được đường đất giá giải giám giao giấy giữa gia gian gốc gồm
+gửi hạn hàng hành hạng hai hay hãy hết hiện hiệu hình hoá hóa hoặc họ hội hộ hồ hồng học hợp
+hơn huyện hưởng hướng hữu kế kê kết khác khai khách khẩu khi khoản khu không khối kinh ký kỳ
+là làm lãi lại lần lập lên lệ liên liệu loại lợi lực lưu lý lượng mã mại mặt mẫu mới một mục
+mức năm nam nay này nào nền ngày ngân nghĩa nghiệp ngoài người nguyên ngành nhà nhân nhận
+nhất nhiều như nhưng những nhóm nội nơi nợ nộp nước nữ phải phạm phát phần phép phí phó phố
+phòng phụ phương phường quan quản quận quê quốc quy quyền quyết ra rằng riêng sản sau sẽ số
+sở sinh sổ sự sử sức tài tại tăng tắc tên tế thành tháng thanh thay thế thêm theo thì thị
+thiết thời thông thu thuê thuế thuộc thuần thường thửa thực thứ thương tiền tiêu tin tính tình
+tỉnh tổ tổng tới trạng trả trách trên trị triệu trình trong trọng trung trúc trường trước
+tự từ tư tức tục tương tượng và văn vào vay về vi việc viên vị vốn vụ vực với vùng xã xác
+xây xuất xử ý yêu ty dân căn doanh thoại phẩm pháp luật diện đốc khẩu trú dụng tín dư toán cân
+quả hoạt động ở đỏ phiếu cũ thụ việt hà nội minh tp ngõ ấp thôn xóm tầng lô cổ phần nhiệm tnhh
+mệnh đông sáng sinh ngoại kiểm tra trụ sở giới tính ngân sách vật kiến trúc dịch
+`
+
+const englishWords = `
+a about account address after agreement all amount an and any are area as assets at balance
+bank be bill business by capital card cash certificate charter citizen city code company
+contract credit customer date debt district document electricity enterprise for from group
+has have identity in income information is it land lease license limited loan name no not
+number of on or owner page party payment period place power premises province registration
+rental report right sheet statement street tax tenant the this to total use value vietnam ward
+was which with year
+`
@@ -0,0 +1,274 @@
+package ocr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"extraction/internal/types"
+)
+
+// TesseractEngine OCRs locally with the tesseract command, so documents never
+// leave the machine. Requires tesseract and its language data on PATH.
+type TesseractEngine struct{}
+
+// Name returns "tesseract"
+func (TesseractEngine) Name() string { return EngineTesseract }
+
+// OCRImages runs tesseract on up to concurrency images at once
+// (DefaultPageConcurrency if not positive)
+func (TesseractEngine) OCRImages(ctx context.Context, imagePaths []string, lang string, concurrency int) ([]ImageText, error) {
+	if err := tesseractAvailable(); err != nil {
+		return nil, err
+	}
+	if concurrency <= 0 {
+		concurrency = DefaultPageConcurrency
+	}
+	results := make([]ImageText, len(imagePaths))
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	// Each goroutine writes only its own result
+	for i, path := range imagePaths {
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			pages, err := runTesseractTSV(ctx, path, lang)
+			if err != nil {
+				results[i].Err = err
+				return
+			}
+			results[i] = pages[0]
+			for _, page := range pages[1:] {
+				results[i].Text = JoinPages([]string{results[i].Text, page.Text})
+			}
+		}(i, path)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// ocrFile reads every page of a multi-page TIFF. Tesseract can't read PDFs,
+// whose pages have to be rendered first.
+func (TesseractEngine) ocrFile(ctx context.Context, path string, mimeType string, lang string, concurrency int) (PDFText, error) {
+	if err := tesseractAvailable(); err != nil {
+		return PDFText{}, err
+	}
+	if mimeType != "image/tiff" {
+		return PDFText{}, fmt.Errorf("tesseract can't read %s files", mimeType)
+	}
+	tiffPages, err := runTesseractTSV(ctx, path, lang)
+	if err != nil {
+		return PDFText{}, err
+	}
+	pages := make([]types.PageResult, len(tiffPages))
+	layouts := make([]*types.PageLayout, len(tiffPages))
+	for i, page := range tiffPages {
+		pages[i] = types.PageResult{Page: i + 1, Text: page.Text, Method: PageMethodTesseract, Confidence: page.Confidence}
+		layouts[i] = page.Layout
+		layouts[i].Page = i + 1
+	}
+	return newPDFText(pages, layouts), nil
+}
+
+func tesseractAvailable() error {
+	if _, err := exec.LookPath("tesseract"); err != nil {
+		return fmt.Errorf("%w: tesseract is not installed or not on PATH", ErrEngineUnavailable)
+	}
+	return nil
+}
+
+// runTesseractTSV OCRs an image with tesseract's TSV output, which gives the
+// position and confidence of every word. Multi-page images yield several pages.
+func runTesseractTSV(ctx context.Context, imagePath string, lang string) ([]ImageText, error) {
+	cmd := exec.CommandContext(ctx, "tesseract", imagePath, "stdout", "-l", tesseractLang(lang), "tsv")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("tesseract error: %v, stderr: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	pages := parseTesseractTSV(stdout.String())
+	if len(pages) == 0 {
+		return nil, errors.New("tesseract: no pages in output")
+	}
+	return pages, nil
+}
+
+// Levels of the rows of tesseract's TSV output
+const (
+	tsvLevelPage = iota + 1
+	tsvLevelBlock
+	tsvLevelParagraph
+	tsvLevelLine
+	tsvLevelWord
+)
+
+// parseTesseractTSV builds the text and layout of each page from tesseract's
+// TSV output. Words of a line are joined by spaces, lines of a paragraph by
+// newlines and paragraphs by blank lines.
+func parseTesseractTSV(tsv string) []ImageText {
+	var pages []ImageText
+	var page *types.PageLayout
+	var block *types.LayoutBlock
+	var paragraph *types.LayoutParagraph
+	var text strings.Builder
+	var confidenceSum float64
+	var words int
+	lastLine := -1
+
+	finishPage := func() {
+		if page == nil {
+			return
+		}
+		result := ImageText{Text: strings.TrimSpace(text.String()), Engine: EngineTesseract, Layout: page}
+		if words > 0 {
+			result.Confidence = confidenceSum / float64(words)
+			page.Confidence = result.Confidence
+		}
+		pages = append(pages, result)
+		text.Reset()
+		confidenceSum, words = 0, 0
+	}
+
+	for i, line := range strings.Split(tsv, "\n") {
+		cols := strings.Split(strings.TrimRight(line, "\r"), "\t")
+		if i == 0 || len(cols) < 11 {
+			continue // header or blank line
+		}
+		level, _ := strconv.Atoi(cols[0])
+		lineNum, _ := strconv.Atoi(cols[4])
+		left, _ := strconv.ParseFloat(cols[6], 64)
+		top, _ := strconv.ParseFloat(cols[7], 64)
+		width, _ := strconv.ParseFloat(cols[8], 64)
+		height, _ := strconv.ParseFloat(cols[9], 64)
+		box := []types.Point{{X: left, Y: top}, {X: left + width, Y: top}, {X: left + width, Y: top + height}, {X: left, Y: top + height}}
+
+		switch level {
+		case tsvLevelPage:
+			finishPage()
+			page = &types.PageLayout{Page: len(pages) + 1, Width: int(width), Height: int(height)}
+			block, paragraph = nil, nil
+		case tsvLevelBlock:
+			if page == nil {
+				continue
+			}
+			page.Blocks = append(page.Blocks, types.LayoutBlock{Type: "text", BoundingBox: box})
+			block = &page.Blocks[len(page.Blocks)-1]
+			paragraph = nil
+		case tsvLevelParagraph:
+			if block == nil {
+				continue
+			}
+			block.Paragraphs = append(block.Paragraphs, types.LayoutParagraph{BoundingBox: box})
+			paragraph = &block.Paragraphs[len(block.Paragraphs)-1]
+			lastLine = -1
+			if text.Len() > 0 {
+				text.WriteString("\n\n")
+			}
+		case tsvLevelWord:
+			word := ""
+			if len(cols) > 11 {
+				word = strings.TrimSpace(cols[11])
+			}
+			if paragraph == nil || word == "" {
+				continue
+			}
+			confidence, _ := strconv.ParseFloat(cols[10], 64)
+			confidence /= 100
+			switch {
+			case paragraph.Text == "":
+			case lineNum != lastLine:
+				paragraph.Text += "\n"
+				text.WriteString("\n")
+			default:
+				paragraph.Text += " "
+				text.WriteString(" ")
+			}
+			lastLine = lineNum
+			paragraph.Text += word
+			text.WriteString(word)
+			paragraph.Words = append(paragraph.Words, types.LayoutWord{Text: word, BoundingBox: box, Confidence: confidence})
+			confidenceSum += confidence
+			words++
+		}
+	}
+	finishPage()
+
+	// Block and paragraph confidence is the mean of their words
+	for _, result := range pages {
+		for b := range result.Layout.Blocks {
+			block := &result.Layout.Blocks[b]
+			var blockSum float64
+			var blockWords int
+			for p := range block.Paragraphs {
+				paragraph := &block.Paragraphs[p]
+				var sum float64
+				for _, w := range paragraph.Words {
+					sum += w.Confidence
+				}
+				if len(paragraph.Words) > 0 {
+					paragraph.Confidence = sum / float64(len(paragraph.Words))
+				}
+				blockSum += sum
+				blockWords += len(paragraph.Words)
+			}
+			if blockWords > 0 {
+				block.Confidence = blockSum / float64(blockWords)
+			}
+		}
+	}
+	return pages
+}
+
+// tesseractLang converts a language setting such as "vie+eng" to the
+// tesseract language of its first code
+func tesseractLang(lang string) string {
+	tesseractLang := "eng" // default
+	if lang != "" {
+		parts := strings.FieldsFunc(lang, func(r rune) bool { return r == '+' || r == ',' || r == ';' || r == ' ' })
+		if len(parts) > 0 {
+			switch strings.ToLower(parts[0]) {
+			case "vie", "vin":
+				tesseractLang = "vie"
+			case "jpn":
+				tesseractLang = "jpn"
+			case "chi_sim":
+				tesseractLang = "chi_sim"
+			case "chi_tra":
+				tesseractLang = "chi_tra"
+			case "spa":
+				tesseractLang = "spa"
+			case "fra", "fre":
+				tesseractLang = "fra"
+			case "deu", "ger":
+				tesseractLang = "deu"
+			case "ita":
+				tesseractLang = "ita"
+			case "rus":
+				tesseractLang = "rus"
+			case "ara":
+				tesseractLang = "ara"
+			case "hin":
+				tesseractLang = "hin"
+			case "tha":
+				tesseractLang = "tha"
+			case "kor":
+				tesseractLang = "kor"
+			case "por":
+				tesseractLang = "por"
+			default:
+				tesseractLang = "eng"
+			}
+		}
+	}
+	return tesseractLang
+}
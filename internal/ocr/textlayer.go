@@ -0,0 +1,96 @@
+package ocr
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"extraction/internal/pdf"
+)
+
+// Text layer quality: pages with fewer than minTextDensity non-space
+// characters per square inch are taken for scans with at most a printed
+// header or footer (an A4 page needs about 190 characters), and pages with
+// more than maxInvalidShare characters that don't belong in Vietnamese or
+// English text for a broken font encoding
+const (
+	minTextDensity  = 2.0
+	maxInvalidShare = 0.1
+)
+
+// A4 is the page size assumed when it isn't known, in points
+const (
+	a4Width  = 595.0
+	a4Height = 842.0
+)
+
+// TextLayerIssue tells whether the embedded text of a page of the given size
+// in points can be trusted. It returns why not, or "" if it can; usable is
+// true if the text is real but sparse, so it is worth keeping when OCR finds
+// no more.
+func TextLayerIssue(text string, width, height float64) (issue string, usable bool) {
+	if width <= 0 || height <= 0 {
+		width, height = a4Width, a4Height
+	}
+	var chars, invalid int
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		chars++
+		if !validTextRune(r) {
+			invalid++
+		}
+	}
+	if chars == 0 {
+		return "no text", false
+	}
+	if share := float64(invalid) / float64(chars); share > maxInvalidShare {
+		return fmt.Sprintf("garbled text (%.0f%% invalid characters)", share*100), false
+	}
+	squareInches := width * height / (72 * 72)
+	if density := float64(chars) / squareInches; density < minTextDensity {
+		return fmt.Sprintf("too little text for the page size (%d characters)", chars), true
+	}
+	return "", true
+}
+
+// vietnameseLetters are the Latin letters of Vietnamese beyond ASCII
+var vietnameseLetters = map[rune]bool{}
+
+func init() {
+	const letters = "àáảãạăằắẳẵặâầấẩẫậđèéẻẽẹêềếểễệìíỉĩịòóỏõọôồốổỗộơờớởỡợùúủũụưừứửữựỳýỷỹỵ"
+	for _, r := range letters + strings.ToUpper(letters) {
+		vietnameseLetters[r] = true
+	}
+}
+
+// validTextRune reports whether r is plausible in extracted text: ASCII,
+// Vietnamese letters and combining accents, letters of non-Latin scripts,
+// and common punctuation and symbols. Replacement and private use characters,
+// control characters and the Latin-1 letters and signs that legacy
+// Vietnamese font encodings (TCVN3, VNI) turn into are not.
+func validTextRune(r rune) bool {
+	switch {
+	case r < 0x80:
+		return !unicode.IsControl(r)
+	case r == unicode.ReplacementChar, unicode.Is(unicode.Co, r), unicode.IsControl(r):
+		return false
+	case unicode.Is(unicode.Latin, r):
+		return vietnameseLetters[r]
+	case unicode.Is(unicode.Mn, r):
+		return r >= 0x300 && r <= 0x36F
+	case r >= 0xA0 && r <= 0xBF:
+		return strings.ContainsRune(" °§«»©±²³½", r)
+	}
+	return true
+}
+
+// pageSize returns the size in points of page n of doc, or zeros if doc is
+// nil or has no such page
+func pageSize(doc *pdf.Document, n int) (width, height float64) {
+	if doc == nil || n < 1 || n > len(doc.Pages) {
+		return 0, 0
+	}
+	return doc.Pages[n-1].Width, doc.Pages[n-1].Height
+}
@@ -0,0 +1,151 @@
+package ocr
+
+import (
+	"strings"
+	"testing"
+
+	"extraction/internal/types"
+)
+
+func TestTextLayerIssue(t *testing.T) {
+	paragraph := "CỘNG HÒA XÃ HỘI CHỦ NGHĨA VIỆT NAM\nĐộc lập - Tự do - Hạnh phúc\n" +
+		"GIẤY CHỨNG NHẬN ĐĂNG KÝ DOANH NGHIỆP\nCÔNG TY TRÁCH NHIỆM HỮU HẠN HAI THÀNH VIÊN TRỞ LÊN\n" +
+		"Mã số doanh nghiệp: 0312345678. Đăng ký lần đầu: ngày 15 tháng 03 năm 2019.\n" +
+		"Địa chỉ trụ sở chính: Số 12 đường Nguyễn Thị Minh Khai, Phường Đa Kao, Quận 1, Thành phố Hồ Chí Minh.\n" +
+		"Vốn điều lệ: 5.000.000.000 đồng (Năm tỷ đồng). Người đại diện theo pháp luật: Ông Trần Văn Bình.\n"
+	// Cộng hòa xã hội chủ nghĩa Việt Nam, read through a TCVN3 font without its encoding
+	tcvn3 := "Céng hßa x· héi chñ nghÜa ViÖt Nam §éc lËp - Tù do - H¹nh phóc "
+	// CID glyph IDs of an Identity-H font without a ToUnicode map
+	identityH := strings.Repeat("\x01\x1f\x0e ", 40)
+
+	tests := []struct {
+		name          string
+		text          string
+		width, height float64
+		wantIssue     string
+		wantUsable    bool
+	}{
+		{name: "Vietnamese page", text: strings.Repeat(paragraph, 3), width: a4Width, height: a4Height, wantUsable: true},
+		{name: "unknown page size is A4", text: strings.Repeat(paragraph, 3), wantUsable: true},
+		{name: "decomposed accents", text: strings.Repeat("Việt Nam Cộng hòa ", 20), wantUsable: true},
+		{name: "signature page", text: "Giám đốc\n(Ký, ghi rõ họ tên, đóng dấu)\n\nNguyễn Văn An", width: a4Width, height: a4Height,
+			wantIssue: "too little text for the page size (41 characters)", wantUsable: true},
+		{name: "receipt-sized page", text: "Biên lai thu tiền điện\nSố tiền: 1.250.000 đ", width: 200, height: 300, wantUsable: true},
+		{name: "mojibake", text: strings.Repeat(tcvn3, 5), width: a4Width, height: a4Height, wantIssue: "garbled text (15% invalid characters)"},
+		{name: "Identity-H garbage", text: identityH, wantIssue: "garbled text (100% invalid characters)"},
+		{name: "replacement characters", text: strings.Repeat("Gi�y ch�ng nh�n ", 20), wantIssue: "garbled text (23% invalid characters)"},
+		{name: "empty", text: "", wantIssue: "no text"},
+		{name: "whitespace only", text: " \n\t \n ", wantIssue: "no text"},
+	}
+	for _, tt := range tests {
+		issue, usable := TextLayerIssue(tt.text, tt.width, tt.height)
+		if issue != tt.wantIssue || usable != tt.wantUsable {
+			t.Errorf("%s: TextLayerIssue = %q, %v, want %q, %v", tt.name, issue, usable, tt.wantIssue, tt.wantUsable)
+		}
+	}
+}
+
+func TestTextLayerIssueThresholds(t *testing.T) {
+	// An A4 page needs 2 characters per square inch: 194 of them
+	for n, wantSparse := range map[int]bool{193: true, 194: false} {
+		issue, usable := TextLayerIssue(strings.Repeat("a", n), a4Width, a4Height)
+		if sparse := strings.HasPrefix(issue, "too little text"); sparse != wantSparse || !usable {
+			t.Errorf("%d characters on A4: issue %q, usable %v", n, issue, usable)
+		}
+	}
+	// Up to 10% of the characters may be invalid
+	for invalid, wantGarbled := range map[int]bool{10: false, 11: true} {
+		text := strings.Repeat("ß", invalid) + strings.Repeat("a", 100-invalid)
+		issue, _ := TextLayerIssue(text, 72, 72)
+		if garbled := strings.HasPrefix(issue, "garbled text"); garbled != wantGarbled {
+			t.Errorf("%d%% invalid characters: issue %q", invalid, issue)
+		}
+	}
+}
+
+func TestValidTextRune(t *testing.T) {
+	const letters = "àáảãạăằắẳẵặâầấẩẫậđèéẻẽẹêềếểễệìíỉĩịòóỏõọôồốổỗộơờớởỡợùúủũụưừứửữựỳýỷỹỵ"
+	for _, r := range letters + strings.ToUpper(letters) + "AZaz09 .,;:-/()%&@̣̀́̃̉°§«»©±²³½€–—“”…Привет東京" {
+		if !validTextRune(r) {
+			t.Errorf("validTextRune(%q) = false, want true", r)
+		}
+	}
+	for _, r := range "ßæøåñçëïüöäÿþðÐÞ§¨·®¤�\x00\x07\u0080\u009f҃" {
+		if r == '§' {
+			continue // valid, listed above; kept here to show the Latin-1 range is not all invalid
+		}
+		if validTextRune(r) {
+			t.Errorf("validTextRune(%q) = true, want false", r)
+		}
+	}
+}
+
+func TestMergeOCRPages(t *testing.T) {
+	layer := func(page int, text, issue string) types.PageResult {
+		return types.PageResult{Page: page, Text: text, Method: PageMethodTextLayer, TextLayerIssue: issue}
+	}
+	pages := []types.PageResult{
+		layer(1, "Giấy chứng nhận đăng ký doanh nghiệp", ""),
+		layer(2, "Giám đốc Nguyễn Văn An", "too little text"),
+		layer(3, "Céng hßa x· héi", "garbled text"),
+		layer(4, "Céng hßa x· héi", "garbled text"),
+		layer(5, "Giám đốc Nguyễn Văn An", "too little text"),
+		layer(6, "Số tiền", "too little text"),
+		layer(7, "\x01\x1f\x0e", "garbled text"),
+		layer(8, "Ký tên", "too little text"),
+		layer(9, "", "no text"),
+	}
+	// Sparse text layers are usable, garbled or empty ones are not
+	usable := map[int]bool{2: true, 3: false, 4: false, 5: true, 6: true, 7: false, 8: true, 9: false}
+	ocrPage := func(page int, text string) types.PageResult {
+		return types.PageResult{Page: page, Text: text, Method: PageMethodVision, Confidence: 0.9}
+	}
+	failed := func(page int) types.PageResult {
+		return types.PageResult{Page: page, Method: PageMethodVision, Error: "quota exceeded"}
+	}
+	// Results arrive out of page order, with a page that didn't need OCR and a duplicate
+	ocrd := PDFText{
+		Pages: []types.PageResult{
+			ocrPage(6, "Số tiền: 1.250.000 đồng"),
+			ocrPage(1, "ignored"),
+			failed(5),
+			ocrPage(3, "Cộng hòa xã hội"),
+			ocrPage(2, "Giám đốc"),
+			failed(4),
+			ocrPage(9, "Trang trắng"),
+			ocrPage(3, "duplicate"),
+		},
+		Layout: []types.PageLayout{{Page: 3, Width: 595, Height: 842}, {Page: 1}, {Page: 6, Width: 595, Height: 842}},
+	}
+
+	doc := mergeOCRPages(pages, usable, ocrd)
+	want := []struct {
+		text, method, err, issue string
+	}{
+		{"Giấy chứng nhận đăng ký doanh nghiệp", PageMethodTextLayer, "", ""},
+		{"Giám đốc Nguyễn Văn An", PageMethodTextLayer, "", "too little text"}, // OCR found less
+		{"Cộng hòa xã hội", PageMethodVision, "", "garbled text"},
+		{"", PageMethodTextLayer, "quota exceeded", "garbled text"},
+		{"Giám đốc Nguyễn Văn An", PageMethodTextLayer, "quota exceeded", "too little text"},
+		{"Số tiền: 1.250.000 đồng", PageMethodVision, "", "too little text"}, // OCR found more
+		{"", PageMethodTextLayer, "no OCR result for page", "garbled text"},
+		{"Ký tên", PageMethodTextLayer, "no OCR result for page", "too little text"},
+		{"Trang trắng", PageMethodVision, "", "no text"},
+	}
+	if len(doc.Pages) != len(want) {
+		t.Fatalf("%d pages, want %d", len(doc.Pages), len(want))
+	}
+	for i, w := range want {
+		got := doc.Pages[i]
+		if got.Page != i+1 || got.Text != w.text || got.Method != w.method || got.Error != w.err || got.TextLayerIssue != w.issue {
+			t.Errorf("page %d = %+v, want text %q, method %s, error %q, issue %q", i+1, got, w.text, w.method, w.err, w.issue)
+		}
+	}
+	if doc.Text != JoinPages(doc.PageTexts()) {
+		t.Errorf("text %q isn't the merged pages", doc.Text)
+	}
+	// Only the layouts of pages whose OCR text was used are kept
+	if len(doc.Layout) != 2 || doc.Layout[0].Page != 3 || doc.Layout[1].Page != 6 {
+		t.Errorf("layouts = %+v, want pages 3 and 6", doc.Layout)
+	}
+}
@@ -8,85 +8,59 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"sort"
 	"strings"
+	"sync"
 	"time"
+
+	"extraction/internal/types"
 )
 
 // ExtractTextFromImageVision performs OCR using Google Cloud Vision's DOCUMENT_TEXT_DETECTION.
 // Requires the environment variable GOOGLE_VISION_API_KEY to be set.
 func ExtractTextFromImageVision(ctx context.Context, imagePath string, lang string) (string, error) {
-	apiKey := strings.TrimSpace(os.Getenv("GOOGLE_VISION_API_KEY"))
-	if apiKey == "" {
-		return "", errors.New("GOOGLE_VISION_API_KEY is not set; set it in your environment or .env")
-	}
-	if imagePath == "" {
-		return "", errors.New("image path is empty")
-	}
-
-	content, err := os.ReadFile(imagePath)
-	if err != nil {
-		return "", fmt.Errorf("read image: %w", err)
-	}
-	b64 := base64.StdEncoding.EncodeToString(content)
+	text, _, err := OCRImageVision(ctx, imagePath, lang)
+	return text, err
+}
 
-	langHints := tesseractLangToBCP47Hints(lang)
+// OCRImageVision is ExtractTextFromImageVision, also returning the confidence
+// Vision reports for the recognized text (0 to 1, or 0 if not reported)
+func OCRImageVision(ctx context.Context, imagePath string, lang string) (string, float64, error) {
+	result, err := ExtractImageVision(ctx, imagePath, lang)
+	return result.Text, result.Confidence, err
+}
 
-	req := visionAnnotateRequest{
-		Requests: []visionSingleRequest{
-			{
-				Image: visionImage{Content: b64},
-				Features: []visionFeature{{Type: "DOCUMENT_TEXT_DETECTION"}},
-				ImageContext: &visionImageContext{LanguageHints: langHints},
-			},
-		},
+// ExtractImageVision is ExtractTextFromImageVision, also returning the
+// confidence and the layout of the text Vision found
+func ExtractImageVision(ctx context.Context, imagePath string, lang string) (ImageText, error) {
+	if imagePath == "" {
+		return ImageText{}, errors.New("image path is empty")
 	}
-
-	body, err := json.Marshal(req)
+	results, err := OCRImagesVision(ctx, []string{imagePath}, lang, 1)
 	if err != nil {
-		return "", fmt.Errorf("marshal request: %w", err)
+		return ImageText{}, err
 	}
-
-	url := "https://vision.googleapis.com/v1/images:annotate?key=" + apiKey
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(body)))
-	if err != nil {
-		return "", fmt.Errorf("build http request: %w", err)
-	}
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{Timeout: 120 * time.Second}
-	resp, err := client.Do(httpReq)
-	if err != nil {
-		return "", fmt.Errorf("vision request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", fmt.Errorf("vision http error: %s", resp.Status)
+	if results[0].Err != nil {
+		return ImageText{}, results[0].Err
 	}
+	return results[0], nil
+}
 
-	var vr visionAnnotateResponse
-	dec := json.NewDecoder(resp.Body)
-	if err := dec.Decode(&vr); err != nil {
-		return "", fmt.Errorf("decode response: %w", err)
-	}
-	if len(vr.Responses) == 0 {
-		return "", errors.New("vision: empty response")
+// text returns the recognized text of a single image response
+func (r visionSingleResponse) text() (string, float64, error) {
+	if r.Error.Message != "" {
+		return "", 0, fmt.Errorf("vision error: %s", r.Error.Message)
 	}
-	res := vr.Responses[0]
-	if res.Error.Message != "" {
-		return "", fmt.Errorf("vision error: %s", res.Error.Message)
-	}
-	if res.FullTextAnnotation.Text != "" {
-		return res.FullTextAnnotation.Text, nil
+	if r.FullTextAnnotation.Text != "" {
+		return r.FullTextAnnotation.Text, r.confidence(), nil
 	}
-	if len(res.TextAnnotations) > 0 && strings.TrimSpace(res.TextAnnotations[0].Description) != "" {
-		return res.TextAnnotations[0].Description, nil
+	if len(r.TextAnnotations) > 0 && strings.TrimSpace(r.TextAnnotations[0].Description) != "" {
+		return r.TextAnnotations[0].Description, 0, nil
 	}
-	return "", nil
+	return "", 0, nil
 }
 
 func tesseractLangToBCP47Hints(lang string) []string {
@@ -140,6 +114,283 @@ func tesseractLangToBCP47Hints(lang string) []string {
 	return hints
 }
 
+// DefaultVisionEndpoint is the Vision API base URL, used unless the
+// VISION_API_ENDPOINT environment variable points elsewhere (e.g. a local stub)
+const DefaultVisionEndpoint = "https://vision.googleapis.com/v1"
+
+// Vision API request limits
+const (
+	visionMaxImagesPerRequest = 16      // images per images:annotate request
+	visionMaxPagesPerRequest  = 5       // pages per files:annotate request with inline content
+	visionMaxRequestBytes     = 9 << 20 // encoded content per request, below Vision's 10 MB request limit
+)
+
+// OCRImagesVision OCRs the images with Vision, packing up to 16 images into
+// each images:annotate request and sending up to concurrency requests at once
+// (DefaultPageConcurrency if not positive) within the process-wide Vision
+// budget. Results are in input order; an image that fails carries its error.
+// The returned error is for failures of the whole call, such as a missing API key.
+func OCRImagesVision(ctx context.Context, imagePaths []string, lang string, concurrency int) ([]ImageText, error) {
+	if _, err := visionAPIKey(); err != nil {
+		return nil, err
+	}
+	if concurrency <= 0 {
+		concurrency = DefaultPageConcurrency
+	}
+	hints := tesseractLangToBCP47Hints(lang)
+	results := make([]ImageText, len(imagePaths))
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	// Each goroutine writes only the results of its own batch
+	for _, batch := range imageBatches(imagePaths) {
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			annotateImages(ctx, imagePaths[start:end], hints, results[start:end])
+		}(batch[0], batch[1])
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// imageBatches splits the images into [start, end) runs that fit in one
+// images:annotate request. An image too large to share a request gets its own.
+func imageBatches(imagePaths []string) [][2]int {
+	var batches [][2]int
+	start, size := 0, 0
+	for i, path := range imagePaths {
+		var encoded int
+		if info, err := os.Stat(path); err == nil {
+			encoded = base64.StdEncoding.EncodedLen(int(info.Size()))
+		}
+		if i > start && (i-start == visionMaxImagesPerRequest || size+encoded > visionMaxRequestBytes) {
+			batches = append(batches, [2]int{start, i})
+			start, size = i, 0
+		}
+		size += encoded
+	}
+	if start < len(imagePaths) {
+		batches = append(batches, [2]int{start, len(imagePaths)})
+	}
+	return batches
+}
+
+// annotateImages sends one images:annotate request for the images and stores
+// each image's result
+func annotateImages(ctx context.Context, imagePaths []string, hints []string, results []ImageText) {
+	var req visionAnnotateRequest
+	var sent []int // index in imagePaths of each request
+	for i, path := range imagePaths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			results[i].Err = fmt.Errorf("read image: %w", err)
+			continue
+		}
+		req.Requests = append(req.Requests, visionSingleRequest{
+			Image:        visionImage{Content: base64.StdEncoding.EncodeToString(content)},
+			Features:     []visionFeature{{Type: "DOCUMENT_TEXT_DETECTION"}},
+			ImageContext: &visionImageContext{LanguageHints: hints},
+		})
+		sent = append(sent, i)
+	}
+	if len(sent) == 0 {
+		return
+	}
+
+	var vr visionAnnotateResponse
+	err := postVision(ctx, "images:annotate", req, &vr)
+	if err == nil && len(vr.Responses) != len(sent) {
+		err = fmt.Errorf("vision: expected %d responses, got %d", len(sent), len(vr.Responses))
+	}
+	for j, i := range sent {
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		results[i].Engine = EngineVision
+		results[i].Text, results[i].Confidence, results[i].Err = vr.Responses[j].text()
+		if results[i].Err == nil {
+			results[i].Layout = vr.Responses[j].layout(1)
+		}
+	}
+}
+
+// extractPagesVisionFile OCRs a PDF or TIFF with Vision's files:annotate,
+// sending the file inline and asking for 5 pages per request. The first
+// request tells how many pages there are; the rest are then requested up to
+// concurrency at once (DefaultPageConcurrency if not positive). Pages are
+// returned in page order; those that fail carry their error and no text.
+func extractPagesVisionFile(ctx context.Context, path string, mimeType string, lang string, concurrency int) (PDFText, error) {
+	if _, err := visionAPIKey(); err != nil {
+		return PDFText{}, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return PDFText{}, fmt.Errorf("read file: %w", err)
+	}
+	if base64.StdEncoding.EncodedLen(len(content)) > visionMaxRequestBytes {
+		return PDFText{}, fmt.Errorf("vision: %s is too large to send inline (%d bytes)", filepath.Base(path), len(content))
+	}
+	if concurrency <= 0 {
+		concurrency = DefaultPageConcurrency
+	}
+	req := visionFileSingleRequest{
+		InputConfig:  visionInputConfig{Content: base64.StdEncoding.EncodeToString(content), MimeType: mimeType},
+		Features:     []visionFeature{{Type: "DOCUMENT_TEXT_DETECTION"}},
+		ImageContext: &visionImageContext{LanguageHints: tesseractLangToBCP47Hints(lang)},
+	}
+
+	// Without a page list Vision reads the first 5 pages, whatever the page count
+	first, totalPages, err := annotateFile(ctx, req)
+	if err != nil {
+		return PDFText{}, err
+	}
+	if totalPages < len(first) {
+		totalPages = len(first)
+	}
+	if totalPages == 0 {
+		return PDFText{}, errors.New("vision: no pages in response")
+	}
+
+	pages := make([]types.PageResult, totalPages)
+	layouts := make([]*types.PageLayout, totalPages)
+	for i := range pages {
+		pages[i] = types.PageResult{Page: i + 1, Method: PageMethodVision, Error: "vision: no result for page"}
+	}
+	storeFilePages(pages, layouts, first, nil)
+
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	// Each goroutine writes only the pages it asked for
+	for start := visionMaxPagesPerRequest + 1; start <= totalPages; start += visionMaxPagesPerRequest {
+		chunk := req
+		chunk.Pages = nil
+		for page := start; page < start+visionMaxPagesPerRequest && page <= totalPages; page++ {
+			chunk.Pages = append(chunk.Pages, page)
+		}
+		wg.Add(1)
+		go func(chunk visionFileSingleRequest) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			responses, _, err := annotateFile(ctx, chunk)
+			if err != nil {
+				for _, page := range chunk.Pages {
+					pages[page-1].Error = err.Error()
+				}
+				return
+			}
+			storeFilePages(pages, layouts, responses, chunk.Pages)
+		}(chunk)
+	}
+	wg.Wait()
+	return newPDFText(pages, layouts), nil
+}
+
+// annotateFile sends one files:annotate request and returns the per-page
+// responses along with the page count of the whole file
+func annotateFile(ctx context.Context, req visionFileSingleRequest) ([]visionSingleResponse, int, error) {
+	var vr visionFileResponse
+	if err := postVision(ctx, "files:annotate", visionFileRequest{Requests: []visionFileSingleRequest{req}}, &vr); err != nil {
+		return nil, 0, err
+	}
+	if len(vr.Responses) == 0 {
+		return nil, 0, errors.New("vision: empty response")
+	}
+	res := vr.Responses[0]
+	if res.Error.Message != "" {
+		return nil, 0, fmt.Errorf("vision error: %s", res.Error.Message)
+	}
+	return res.Responses, res.TotalPages, nil
+}
+
+// storeFilePages fills in the pages answered by a files:annotate request, and
+// their layouts. Responses without a page number are matched to the requested
+// pages in order.
+func storeFilePages(pages []types.PageResult, layouts []*types.PageLayout, responses []visionSingleResponse, requested []int) {
+	for i, r := range responses {
+		page := r.Context.PageNumber
+		if page == 0 {
+			page = i + 1
+			if i < len(requested) {
+				page = requested[i]
+			}
+		}
+		if page < 1 || page > len(pages) {
+			continue
+		}
+		text, confidence, err := r.text()
+		pages[page-1] = types.PageResult{Page: page, Text: text, Method: PageMethodVision, Confidence: confidence}
+		if err != nil {
+			pages[page-1].Error = err.Error()
+			continue
+		}
+		layouts[page-1] = r.layout(page)
+	}
+}
+
+// visionEndpoint returns the base URL of the Vision API
+func visionEndpoint() string {
+	if endpoint := strings.TrimSpace(os.Getenv("VISION_API_ENDPOINT")); endpoint != "" {
+		return strings.TrimRight(endpoint, "/")
+	}
+	return DefaultVisionEndpoint
+}
+
+var errNoVisionKey = fmt.Errorf("%w: GOOGLE_VISION_API_KEY is not set; set it in your environment or .env", ErrEngineUnavailable)
+
+func visionAPIKey() (string, error) {
+	apiKey := strings.TrimSpace(os.Getenv("GOOGLE_VISION_API_KEY"))
+	if apiKey == "" {
+		return "", errNoVisionKey
+	}
+	return apiKey, nil
+}
+
+// postVision sends a request to a Vision API method (e.g. "images:annotate")
+// within the process-wide Vision budget and decodes the response into out
+func postVision(ctx context.Context, method string, req interface{}, out interface{}) error {
+	apiKey, err := visionAPIKey()
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+
+	endpoint := visionEndpoint() + "/" + method + "?key=" + url.QueryEscape(apiKey)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build http request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	release, err := acquireVision(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	client := &http.Client{Timeout: 120 * time.Second}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("vision request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("vision http error: %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
 // --- Minimal response/request structs ---
 
 type visionAnnotateRequest struct {
@@ -165,13 +416,43 @@ type visionImageContext struct {
 	LanguageHints []string `json:"languageHints,omitempty"`
 }
 
+type visionFileRequest struct {
+	Requests []visionFileSingleRequest `json:"requests"`
+}
+
+type visionFileSingleRequest struct {
+	InputConfig  visionInputConfig   `json:"inputConfig"`
+	Features     []visionFeature     `json:"features"`
+	ImageContext *visionImageContext `json:"imageContext,omitempty"`
+	Pages        []int               `json:"pages,omitempty"`
+}
+
+type visionInputConfig struct {
+	Content  string `json:"content"`
+	MimeType string `json:"mimeType"`
+}
+
+type visionFileResponse struct {
+	Responses []struct {
+		Responses  []visionSingleResponse `json:"responses"`
+		TotalPages int                    `json:"totalPages"`
+		Error      struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	} `json:"responses"`
+}
+
 type visionAnnotateResponse struct {
 	Responses []visionSingleResponse `json:"responses"`
 }
 
 type visionSingleResponse struct {
+	Context struct {
+		PageNumber int `json:"pageNumber"`
+	} `json:"context"`
 	FullTextAnnotation struct {
-		Text string `json:"text"`
+		Text  string       `json:"text"`
+		Pages []visionPage `json:"pages"`
 	} `json:"fullTextAnnotation"`
 	TextAnnotations []struct {
 		Description string `json:"description"`
@@ -181,54 +462,26 @@ type visionSingleResponse struct {
 	} `json:"error"`
 }
 
-// ExtractTextFromPDFVision renders PDF pages to images and OCRs them via Vision.
-// Requires Poppler's pdftoppm on PATH.
-func ExtractTextFromPDFVision(ctx context.Context, pdfPath string, lang string, dpi int) (string, error) {
-	apiKey := strings.TrimSpace(os.Getenv("GOOGLE_VISION_API_KEY"))
-	if apiKey == "" {
-		return "", errors.New("GOOGLE_VISION_API_KEY is not set; set it in your environment or .env")
+// confidence averages the confidence of the pages Vision found in the image
+func (r visionSingleResponse) confidence() float64 {
+	if len(r.FullTextAnnotation.Pages) == 0 {
+		return 0
 	}
-
-	tmpDir, err := os.MkdirTemp("", "pdf-ocr-vision-*")
-	if err != nil {
-		return "", fmt.Errorf("ocr fallback: mkdir temp: %w", err)
-	}
-	defer os.RemoveAll(tmpDir)
-
-	if dpi <= 0 {
-		dpi = 300
-	}
-	prefix := filepath.Join(tmpDir, "page")
-	cmd := exec.CommandContext(ctx, "pdftoppm", "-r", fmt.Sprintf("%d", dpi), "-png", pdfPath, prefix)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("pdftoppm error: %v: %s", err, strings.TrimSpace(stderr.String()))
+	var sum float64
+	for _, page := range r.FullTextAnnotation.Pages {
+		sum += page.Confidence
 	}
+	return sum / float64(len(r.FullTextAnnotation.Pages))
+}
 
-	images, err := filepath.Glob(prefix + "-*.png")
+// ExtractTextFromPDFVision OCRs a PDF via Vision's files:annotate, falling back
+// to rendering the pages to images with Poppler's pdftoppm (see OCRPDF).
+func ExtractTextFromPDFVision(ctx context.Context, pdfPath string, lang string, dpi int) (string, error) {
+	doc, err := OCRPDF(ctx, VisionEngine{}, pdfPath, lang, dpi, 0)
 	if err != nil {
-		return "", fmt.Errorf("ocr fallback: glob images: %w", err)
-	}
-	if len(images) == 0 {
-		return "", fmt.Errorf("ocr fallback: no images produced from PDF")
-	}
-	sort.Strings(images)
-
-	var b strings.Builder
-	for _, img := range images {
-		text, err := ExtractTextFromImageVision(ctx, img, lang)
-		if err != nil {
-			continue
-		}
-		if s := strings.TrimSpace(text); s != "" {
-			if b.Len() > 0 {
-				b.WriteString("\n\n")
-			}
-			b.WriteString(s)
-		}
+		return "", err
 	}
-	return b.String(), nil
+	return doc.Text, nil
 }
 
 // ExtractTextFromImageTesseract performs OCR using Tesseract as a fallback when Vision API fails
@@ -237,48 +490,8 @@ func ExtractTextFromImageTesseract(ctx context.Context, imagePath string, lang s
 		return "", errors.New("image path is empty")
 	}
 
-	// Convert Tesseract language codes
-	tesseractLang := "eng" // default
-	if lang != "" {
-		parts := strings.FieldsFunc(lang, func(r rune) bool { return r == '+' || r == ',' || r == ';' || r == ' ' })
-		if len(parts) > 0 {
-			switch strings.ToLower(parts[0]) {
-			case "vie", "vin":
-				tesseractLang = "vie"
-			case "jpn":
-				tesseractLang = "jpn"
-			case "chi_sim":
-				tesseractLang = "chi_sim"
-			case "chi_tra":
-				tesseractLang = "chi_tra"
-			case "spa":
-				tesseractLang = "spa"
-			case "fra", "fre":
-				tesseractLang = "fra"
-			case "deu", "ger":
-				tesseractLang = "deu"
-			case "ita":
-				tesseractLang = "ita"
-			case "rus":
-				tesseractLang = "rus"
-			case "ara":
-				tesseractLang = "ara"
-			case "hin":
-				tesseractLang = "hin"
-			case "tha":
-				tesseractLang = "tha"
-			case "kor":
-				tesseractLang = "kor"
-			case "por":
-				tesseractLang = "por"
-			default:
-				tesseractLang = "eng"
-			}
-		}
-	}
-
 	// Run Tesseract command
-	cmd := exec.CommandContext(ctx, "tesseract", imagePath, "stdout", "-l", tesseractLang)
+	cmd := exec.CommandContext(ctx, "tesseract", imagePath, "stdout", "-l", tesseractLang(lang))
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
@@ -0,0 +1,401 @@
+package ocr
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// visionStub is a local stand-in for the Vision API. An image's text is
+// "text of " followed by its content, and images whose content starts with
+// "bad" get a per-image error. A file has totalPages pages, page N reading
+// "page N"; errorPages get a per-page error and requests for any of failPages
+// fail as a whole.
+type visionStub struct {
+	totalPages int
+	errorPages map[int]bool
+	failPages  map[int]bool
+	delay      time.Duration // how long each request takes
+
+	mu           sync.Mutex
+	imageBatches [][]string // image contents of each images:annotate request
+	pageRequests [][]int    // pages asked for in each files:annotate request
+	inFlight     int
+	maxInFlight  int // most requests handled at once
+}
+
+func newVisionStub(t *testing.T) *visionStub {
+	t.Helper()
+	stub := &visionStub{}
+	srv := httptest.NewServer(stub)
+	t.Cleanup(srv.Close)
+	t.Setenv("VISION_API_ENDPOINT", srv.URL+"/")
+	t.Setenv("GOOGLE_VISION_API_KEY", "test-key")
+	return stub
+}
+
+func (s *visionStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Query().Get("key") != "test-key" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.inFlight++
+	s.maxInFlight = max(s.maxInFlight, s.inFlight)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+	time.Sleep(s.delay)
+	switch r.URL.Path {
+	case "/images:annotate":
+		var req visionAnnotateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var contents []string
+		var responses []interface{}
+		for _, single := range req.Requests {
+			content, _ := base64.StdEncoding.DecodeString(single.Image.Content)
+			contents = append(contents, string(content))
+			if strings.HasPrefix(string(content), "bad") {
+				responses = append(responses, map[string]interface{}{"error": map[string]string{"message": "Bad image data."}})
+				continue
+			}
+			responses = append(responses, stubTextResponse(0, "text of "+string(content)))
+		}
+		s.mu.Lock()
+		s.imageBatches = append(s.imageBatches, contents)
+		s.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"responses": responses})
+
+	case "/files:annotate":
+		var req visionFileRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Requests) != 1 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		pages := req.Requests[0].Pages
+		s.mu.Lock()
+		s.pageRequests = append(s.pageRequests, pages)
+		s.mu.Unlock()
+		if len(pages) == 0 {
+			for page := 1; page <= visionMaxPagesPerRequest && page <= s.totalPages; page++ {
+				pages = append(pages, page)
+			}
+		}
+		var responses []interface{}
+		for _, page := range pages {
+			if s.failPages[page] {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			if s.errorPages[page] {
+				responses = append(responses, map[string]interface{}{
+					"context": map[string]int{"pageNumber": page},
+					"error":   map[string]string{"message": "Page could not be read."},
+				})
+				continue
+			}
+			responses = append(responses, stubTextResponse(page, fmt.Sprintf("page %d", page)))
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"responses": []interface{}{map[string]interface{}{"responses": responses, "totalPages": s.totalPages}},
+		})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func stubTextResponse(page int, text string) map[string]interface{} {
+	return map[string]interface{}{
+		"context": map[string]int{"pageNumber": page},
+		"fullTextAnnotation": map[string]interface{}{
+			"text":  text,
+			"pages": []map[string]interface{}{{"width": 100, "height": 100, "confidence": 0.9}},
+		},
+	}
+}
+
+// batchSizes returns the number of images in each images:annotate request, largest first
+func (s *visionStub) batchSizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sizes []int
+	for _, batch := range s.imageBatches {
+		sizes = append(sizes, len(batch))
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(sizes)))
+	return sizes
+}
+
+// writeImages writes one file per content and returns their paths
+func writeImages(t *testing.T, contents ...string) []string {
+	t.Helper()
+	dir := t.TempDir()
+	var paths []string
+	for i, content := range contents {
+		path := filepath.Join(dir, fmt.Sprintf("image%02d.png", i))
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func TestOCRImagesVisionBatchesOf16(t *testing.T) {
+	stub := newVisionStub(t)
+	var contents []string
+	for i := 0; i < 40; i++ {
+		contents = append(contents, fmt.Sprintf("image %d", i))
+	}
+	results, err := OCRImagesVision(context.Background(), writeImages(t, contents...), "vie", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(stub.batchSizes()); got != "[16 16 8]" {
+		t.Errorf("images per request = %s, want [16 16 8]", got)
+	}
+	for i, r := range results {
+		if r.Err != nil || r.Text != "text of "+contents[i] || r.Engine != EngineVision || r.Confidence != 0.9 || r.Layout == nil {
+			t.Errorf("result %d = %+v", i, r)
+		}
+	}
+}
+
+func TestOCRImagesVisionSizeCap(t *testing.T) {
+	stub := newVisionStub(t)
+	// 4 MB encoded each: two fit in a request, a third would pass 9 MB
+	large := strings.Repeat("x", 3<<20)
+	var contents []string
+	for i := 0; i < 5; i++ {
+		contents = append(contents, fmt.Sprintf("%d", i)+large)
+	}
+	results, err := OCRImagesVision(context.Background(), writeImages(t, contents...), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(stub.batchSizes()); got != "[2 2 1]" {
+		t.Errorf("images per request = %s, want [2 2 1]", got)
+	}
+	for i, r := range results {
+		if r.Err != nil || r.Text != "text of "+contents[i] {
+			t.Errorf("result %d: text of %d bytes, error %v", i, len(r.Text), r.Err)
+		}
+	}
+}
+
+func TestImageBatches(t *testing.T) {
+	dir := t.TempDir()
+	size := func(name string, n int64) string {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := f.Truncate(n); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	small, huge := size("small", 1000), size("huge", 8<<20)
+	tests := []struct {
+		name  string
+		paths []string
+		want  string
+	}{
+		{"empty", nil, "[]"},
+		{"one", []string{small}, "[[0 1]]"},
+		{"17 small", repeat(small, 17), "[[0 16] [16 17]]"},
+		{"too large to share", []string{small, huge, small, small}, "[[0 1] [1 2] [2 4]]"},
+		{"missing files count as empty", repeat(filepath.Join(dir, "missing"), 3), "[[0 3]]"},
+	}
+	for _, tt := range tests {
+		if got := fmt.Sprint(imageBatches(tt.paths)); got != tt.want {
+			t.Errorf("%s: batches = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func repeat(s string, n int) []string {
+	var out []string
+	for i := 0; i < n; i++ {
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestOCRImagesVisionPerImageErrors(t *testing.T) {
+	stub := newVisionStub(t)
+	paths := writeImages(t, "first", "bad one", "third")
+	paths = append(paths, filepath.Join(t.TempDir(), "missing.png"))
+	results, err := OCRImagesVision(context.Background(), paths, "eng", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(stub.batchSizes()); got != "[3]" {
+		t.Errorf("images per request = %s, want [3] (the missing image isn't sent)", got)
+	}
+	if results[0].Err != nil || results[0].Text != "text of first" {
+		t.Errorf("first = %+v", results[0])
+	}
+	if results[1].Err == nil || !strings.Contains(results[1].Err.Error(), "Bad image data.") || results[1].Text != "" {
+		t.Errorf("bad image = %+v, want its error", results[1])
+	}
+	if results[2].Err != nil || results[2].Text != "text of third" {
+		t.Errorf("third = %+v", results[2])
+	}
+	if results[3].Err == nil || !strings.Contains(results[3].Err.Error(), "read image") {
+		t.Errorf("missing image = %+v, want a read error", results[3])
+	}
+
+	if _, err := ExtractImageVision(context.Background(), paths[1], "eng"); err == nil {
+		t.Errorf("ExtractImageVision returned no error for a failed image")
+	}
+}
+
+func TestOCRImagesVisionWithoutKey(t *testing.T) {
+	t.Setenv("GOOGLE_VISION_API_KEY", "")
+	if _, err := OCRImagesVision(context.Background(), []string{"a.png"}, "", 1); err != errNoVisionKey {
+		t.Errorf("err = %v, want errNoVisionKey", err)
+	}
+}
+
+func TestExtractPagesVisionFileChunks(t *testing.T) {
+	stub := newVisionStub(t)
+	stub.totalPages = 12
+	stub.errorPages = map[int]bool{8: true}
+	path := writeImages(t, "%PDF-1.4 twelve pages")[0]
+
+	doc, err := extractPagesVisionFile(context.Background(), path, "application/pdf", "vie", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := fmt.Sprint(stub.pageRequests)
+	if requests != "[[] [6 7 8 9 10] [11 12]]" && requests != "[[] [11 12] [6 7 8 9 10]]" {
+		t.Errorf("pages requested = %s, want the first 5 by default, then [6 7 8 9 10] and [11 12]", requests)
+	}
+	if len(doc.Pages) != 12 {
+		t.Fatalf("%d pages, want 12", len(doc.Pages))
+	}
+	for i, page := range doc.Pages {
+		n := i + 1
+		if page.Page != n || page.Method != PageMethodVision {
+			t.Errorf("page %d = %+v", n, page)
+		}
+		if n == 8 {
+			if page.Error == "" || page.Text != "" {
+				t.Errorf("page 8 = %+v, want its error", page)
+			}
+			continue
+		}
+		if page.Error != "" || page.Text != fmt.Sprintf("page %d", n) {
+			t.Errorf("page %d = %+v", n, page)
+		}
+	}
+	if len(doc.Layout) != 11 {
+		t.Errorf("%d page layouts, want 11", len(doc.Layout))
+	}
+}
+
+func TestExtractPagesVisionFileFailedChunk(t *testing.T) {
+	stub := newVisionStub(t)
+	stub.totalPages = 7
+	stub.failPages = map[int]bool{7: true}
+	path := writeImages(t, "%PDF-1.4 seven pages")[0]
+
+	doc, err := extractPagesVisionFile(context.Background(), path, "application/pdf", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, page := range doc.Pages {
+		failed := page.Error != ""
+		if wantFailed := i >= 5; failed != wantFailed {
+			t.Errorf("page %d: error %q, want failure %v", i+1, page.Error, wantFailed)
+		}
+	}
+	if !strings.Contains(doc.Pages[6].Error, "vision http error") {
+		t.Errorf("page 7 error = %q, want the HTTP error", doc.Pages[6].Error)
+	}
+
+	// A file whose first request fails has no pages to report
+	stub.failPages = map[int]bool{1: true}
+	if _, err := extractPagesVisionFile(context.Background(), path, "application/pdf", "", 0); err == nil {
+		t.Errorf("no error when the first request failed")
+	}
+}
+
+func TestVisionBudget(t *testing.T) {
+	stub := newVisionStub(t)
+	stub.delay = 20 * time.Millisecond
+	SetVisionBudget(2)
+	t.Cleanup(func() { SetVisionBudget(0) })
+
+	// 40 images make 3 requests of up to 16, sent 8 at a time
+	var contents []string
+	for i := 0; i < 40; i++ {
+		contents = append(contents, fmt.Sprintf("image %d", i))
+	}
+	paths := writeImages(t, contents...)
+
+	// Two files OCR'd at once share the budget
+	var wg sync.WaitGroup
+	results := make([][]ImageText, 2)
+	errs := make([]error, 2)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = OCRImagesVision(context.Background(), paths, "vie", 8)
+		}(i)
+	}
+	wg.Wait()
+	for i := range results {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		for j, r := range results[i] {
+			if r.Err != nil || r.Text != "text of "+contents[j] {
+				t.Fatalf("call %d, result %d = %q, %v, want image %d in input order", i, j, r.Text, r.Err, j)
+			}
+		}
+	}
+	if got := fmt.Sprint(stub.batchSizes()); got != "[16 16 16 16 8 8]" {
+		t.Errorf("images per request = %s, want [16 16 16 16 8 8]", got)
+	}
+	if stub.maxInFlight != 2 {
+		t.Errorf("at most %d requests in flight, want 2", stub.maxInFlight)
+	}
+
+	// Pages of a file are chunked into requests that share the same budget
+	stub.maxInFlight = 0
+	stub.totalPages = 40
+	doc, err := extractPagesVisionFile(context.Background(), writeImages(t, "%PDF-1.4 forty pages")[0], "application/pdf", "vie", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, page := range doc.Pages {
+		if page.Page != i+1 || page.Text != fmt.Sprintf("page %d", i+1) {
+			t.Fatalf("page %d = %+v, want pages in order", i+1, page)
+		}
+	}
+	if stub.maxInFlight != 2 {
+		t.Errorf("at most %d page requests in flight, want 2", stub.maxInFlight)
+	}
+}
@@ -0,0 +1,265 @@
+package office
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"extraction/internal/analysis"
+	"github.com/xuri/excelize/v2"
+)
+
+// ExtractTextFromExcel renders every sheet of a workbook as text for the LLM:
+// a "Sheet: <name>" heading followed by one tab-separated line per non-empty
+// row, so the table layout survives. Legacy .xls files are converted with
+// LibreOffice first.
+func ExtractTextFromExcel(ctx context.Context, path string) (string, error) {
+	f, cleanup, err := openWorkbook(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	var b strings.Builder
+	for _, sheet := range f.GetSheetList() {
+		rows, err := f.GetRows(sheet)
+		if err != nil {
+			return "", fmt.Errorf("read sheet %s: %w", sheet, err)
+		}
+		var lines []string
+		for _, row := range rows {
+			cells := trimRow(row)
+			if len(cells) == 0 {
+				continue
+			}
+			for i, c := range cells {
+				cells[i] = strings.NewReplacer("\t", " ", "\r\n", " ", "\n", " ").Replace(c)
+			}
+			lines = append(lines, strings.Join(cells, "\t"))
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+		b.WriteString("Sheet: " + sheet + "\n")
+		b.WriteString(strings.Join(lines, "\n"))
+	}
+	return b.String(), nil
+}
+
+// financialPeriods are the reporting dates of the P&L and balance sheet
+// series in the customer check, in model order
+var financialPeriods = []time.Time{
+	time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC),
+	time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC),
+	time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC),
+	time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC),
+	time.Date(2023, 6, 30, 0, 0, 0, 0, time.UTC),
+}
+
+// financialRowLabels maps extraction fields to the row labels that identify
+// them in Vietnamese (VAS) and English statements. The first matching row wins,
+// so more specific labels come first.
+var financialRowLabels = []struct {
+	field  string
+	labels []string
+}{
+	{"total_revenues", []string{"tổng doanh thu", "tong doanh thu", "doanh thu thuần", "doanh thu thuan", "total revenue", "net revenue"}},
+	{"total_costs", []string{"tổng chi phí", "tong chi phi", "total costs", "total expenses"}},
+	{"total_energy_costs", []string{"chi phí năng lượng", "chi phi nang luong", "chi phí điện", "chi phi dien", "tiền điện", "tien dien", "energy cost", "electricity"}},
+	{"total_assets", []string{"tổng cộng tài sản", "tong cong tai san", "tổng tài sản", "tong tai san", "total assets"}},
+	{"total_debt", []string{"nợ phải trả", "no phai tra", "tổng nợ", "tong no", "total liabilities", "total debt"}},
+}
+
+// MapFinancialStatement reads P&L and balance sheet figures straight from the
+// cells of a financial statement workbook, without OCR or an LLM. Rows are
+// found by their labels and columns by reporting-date headers. The result has
+// the same shape as the LLM output for analysis.SourceFinancialStatement; ok is
+// false when no period header or no known row was found, in which case the
+// caller should fall back to the LLM.
+func MapFinancialStatement(ctx context.Context, path string) (map[string]interface{}, bool, error) {
+	f, cleanup, err := openWorkbook(ctx, path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer cleanup()
+
+	result := make(map[string]interface{})
+	var latest time.Time
+	for _, sheet := range f.GetSheetList() {
+		rows, err := f.GetRows(sheet, excelize.Options{RawCellValue: true})
+		if err != nil {
+			return nil, false, fmt.Errorf("read sheet %s: %w", sheet, err)
+		}
+		columns := periodColumns(rows)
+		if len(columns) == 0 {
+			continue
+		}
+		for period := range columns {
+			if financialPeriods[period].After(latest) {
+				latest = financialPeriods[period]
+			}
+		}
+
+		for _, row := range rows {
+			field := financialRowField(row)
+			if field == "" {
+				continue
+			}
+			if _, done := result[field]; done {
+				continue
+			}
+			series := make([]interface{}, len(financialPeriods))
+			found := false
+			for period, col := range columns {
+				if col >= len(row) {
+					continue
+				}
+				amount, ok, err := analysis.ParseMoneyVND(row[col])
+				if err != nil || !ok {
+					continue
+				}
+				series[period] = float64(amount)
+				found = true
+			}
+			if found {
+				result[field] = series
+			}
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, false, nil
+	}
+	result["financial_statement_date"] = latest.Format("2006-01-02")
+	return result, true, nil
+}
+
+// periodColumns finds the header row with the most reporting dates and returns
+// the column of each period it contains
+func periodColumns(rows [][]string) map[int]int {
+	var best map[int]int
+	for _, row := range rows {
+		columns := make(map[int]int)
+		for col, cell := range row {
+			if period := cellPeriod(cell); period >= 0 {
+				if _, dup := columns[period]; !dup {
+					columns[period] = col
+				}
+			}
+		}
+		if len(columns) > len(best) {
+			best = columns
+		}
+	}
+	return best
+}
+
+// cellPeriod returns the index in financialPeriods of a header cell holding
+// one of the reporting dates, as an Excel date serial or text, or -1
+func cellPeriod(cell string) int {
+	cell = strings.TrimSpace(cell)
+	if cell == "" {
+		return -1
+	}
+	var date time.Time
+	if serial, err := strconv.ParseFloat(cell, 64); err == nil {
+		// Plausible serials for 1960-2100; anything else is an amount
+		if serial < 21916 || serial > 73415 {
+			return -1
+		}
+		t, err := excelize.ExcelDateToTime(serial, false)
+		if err != nil {
+			return -1
+		}
+		date = t
+	} else {
+		// Headers like "Số cuối kỳ 30/06/2025" carry the date at the end
+		fields := strings.Fields(cell)
+		t, ok, err := analysis.ParseDate(fields[len(fields)-1])
+		if err != nil || !ok {
+			return -1
+		}
+		date = t
+	}
+	for i, p := range financialPeriods {
+		if date.Year() == p.Year() && date.Month() == p.Month() && date.Day() == p.Day() {
+			return i
+		}
+	}
+	return -1
+}
+
+// financialRowField returns the extraction field whose label appears in the
+// row's first text cell, or ""
+func financialRowField(row []string) string {
+	for _, cell := range row {
+		cell = strings.ToLower(strings.TrimSpace(cell))
+		if cell == "" {
+			continue
+		}
+		if _, err := strconv.ParseFloat(cell, 64); err == nil {
+			continue
+		}
+		for _, m := range financialRowLabels {
+			for _, label := range m.labels {
+				if strings.Contains(cell, label) {
+					return m.field
+				}
+			}
+		}
+		return ""
+	}
+	return ""
+}
+
+// openWorkbook opens an .xlsx/.xlsm workbook, converting legacy .xls with LibreOffice
+func openWorkbook(ctx context.Context, path string) (*excelize.File, func(), error) {
+	magic, err := readMagic(path, len(oleMagic))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	openPath := path
+	cleanup := func() {}
+	if bytes.HasPrefix(magic, oleMagic) {
+		outDir, err := os.MkdirTemp("", "office-convert-*")
+		if err != nil {
+			return nil, nil, err
+		}
+		cleanup = func() { os.RemoveAll(outDir) }
+		openPath, err = libreOfficeConvert(ctx, path, "xlsx", outDir)
+		if err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("legacy .xls needs LibreOffice: %w", err)
+		}
+	}
+
+	f, err := excelize.OpenFile(openPath)
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("open workbook: %w", err)
+	}
+	return f, func() {
+		f.Close()
+		cleanup()
+	}, nil
+}
+
+// trimRow drops trailing empty cells and returns nil for an empty row
+func trimRow(row []string) []string {
+	end := len(row)
+	for end > 0 && strings.TrimSpace(row[end-1]) == "" {
+		end--
+	}
+	if end == 0 {
+		return nil
+	}
+	return append([]string(nil), row[:end]...)
+}
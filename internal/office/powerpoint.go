@@ -0,0 +1,341 @@
+package office
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ImageOCR extracts the text of an image file
+type ImageOCR func(ctx context.Context, imagePath string) (string, error)
+
+// Embedded images smaller than this are bullets, icons and decorations
+const minOCRImageSize = 4 * 1024
+
+// Image formats the OCR path accepts; EMF/WMF/SVG vector art is skipped
+var ocrImageExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".bmp": true, ".tif": true, ".tiff": true, ".webp": true,
+}
+
+// ExtractTextFromPowerPoint extracts slide text, embedded tables and speaker
+// notes from a PPTX deck, slide by slide. If ocrImage is not nil, embedded
+// pictures are OCRed too; failures there are returned as warnings rather than
+// failing the deck. Legacy .ppt files are converted with LibreOffice first.
+func ExtractTextFromPowerPoint(ctx context.Context, deckPath string, ocrImage ImageOCR) (string, []string, error) {
+	magic, err := readMagic(deckPath, len(oleMagic))
+	if err != nil {
+		return "", nil, err
+	}
+	if bytes.HasPrefix(magic, oleMagic) {
+		outDir, err := os.MkdirTemp("", "office-convert-*")
+		if err != nil {
+			return "", nil, err
+		}
+		defer os.RemoveAll(outDir)
+		deckPath, err = libreOfficeConvert(ctx, deckPath, "pptx", outDir)
+		if err != nil {
+			return "", nil, fmt.Errorf("legacy .ppt needs LibreOffice: %w", err)
+		}
+	}
+
+	zr, err := zip.OpenReader(deckPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("open pptx: %w", err)
+	}
+	defer zr.Close()
+
+	parts := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		parts[f.Name] = f
+	}
+	slides, err := slideOrder(parts)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var sections []string
+	var warnings []string
+	ocrDone := make(map[string]bool)
+	for i, slide := range slides {
+		text, err := partText(parts[slide])
+		if err != nil {
+			return "", nil, fmt.Errorf("read %s: %w", slide, err)
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "Slide %d:", i+1)
+		if text != "" {
+			b.WriteString("\n" + text)
+		}
+
+		rels, err := readRels(parts, slide)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, rel := range rels {
+			switch {
+			case strings.HasSuffix(rel.Type, "/notesSlide"):
+				notes, err := notesText(parts[rel.Target])
+				if err != nil {
+					return "", nil, fmt.Errorf("read %s: %w", rel.Target, err)
+				}
+				if notes = strings.TrimSpace(notes); notes != "" {
+					b.WriteString("\nNotes:\n" + notes)
+				}
+			case strings.HasSuffix(rel.Type, "/image") && ocrImage != nil:
+				if ocrDone[rel.Target] {
+					continue
+				}
+				ocrDone[rel.Target] = true
+				imageText, err := ocrEmbeddedImage(ctx, parts[rel.Target], ocrImage)
+				if err != nil {
+					warnings = append(warnings, fmt.Sprintf("slide %d: OCR of %s failed: %v", i+1, path.Base(rel.Target), err))
+					continue
+				}
+				if imageText != "" {
+					b.WriteString("\nImage text:\n" + imageText)
+				}
+			}
+		}
+		sections = append(sections, b.String())
+	}
+	return strings.Join(sections, "\n\n"), warnings, nil
+}
+
+// opcRel is one relationship in an OPC .rels part, with Target resolved to a part name
+type opcRel struct {
+	ID     string
+	Type   string
+	Target string
+}
+
+// readRels reads the relationships of a part, e.g. ppt/slides/_rels/slide1.xml.rels
+func readRels(parts map[string]*zip.File, partName string) ([]opcRel, error) {
+	relsName := path.Join(path.Dir(partName), "_rels", path.Base(partName)+".rels")
+	f, ok := parts[relsName]
+	if !ok {
+		return nil, nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var doc struct {
+		Relationships []struct {
+			ID         string `xml:"Id,attr"`
+			Type       string `xml:"Type,attr"`
+			Target     string `xml:"Target,attr"`
+			TargetMode string `xml:"TargetMode,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := xml.NewDecoder(rc).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("read %s: %w", relsName, err)
+	}
+	var rels []opcRel
+	for _, r := range doc.Relationships {
+		if r.TargetMode == "External" {
+			continue
+		}
+		target := path.Join(path.Dir(partName), r.Target)
+		if strings.HasPrefix(r.Target, "/") {
+			target = strings.TrimPrefix(r.Target, "/")
+		}
+		rels = append(rels, opcRel{ID: r.ID, Type: r.Type, Target: target})
+	}
+	return rels, nil
+}
+
+var slideNumber = regexp.MustCompile(`^ppt/slides/slide(\d+)\.xml$`)
+
+// slideOrder returns the slide part names in presentation order, falling back
+// to numeric file order if presentation.xml can't be read
+func slideOrder(parts map[string]*zip.File) ([]string, error) {
+	if f, ok := parts["ppt/presentation.xml"]; ok {
+		rels, err := readRels(parts, "ppt/presentation.xml")
+		if err != nil {
+			return nil, err
+		}
+		targets := make(map[string]string, len(rels))
+		for _, r := range rels {
+			targets[r.ID] = r.Target
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		var pres struct {
+			SlideIDs []struct {
+				RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+			} `xml:"sldIdLst>sldId"`
+		}
+		if err := xml.NewDecoder(rc).Decode(&pres); err == nil && len(pres.SlideIDs) > 0 {
+			var slides []string
+			for _, s := range pres.SlideIDs {
+				if target, ok := targets[s.RelID]; ok && parts[target] != nil {
+					slides = append(slides, target)
+				}
+			}
+			if len(slides) > 0 {
+				return slides, nil
+			}
+		}
+	}
+
+	var slides []string
+	for name := range parts {
+		if slideNumber.MatchString(name) {
+			slides = append(slides, name)
+		}
+	}
+	sort.Slice(slides, func(i, j int) bool {
+		a, _ := strconv.Atoi(slideNumber.FindStringSubmatch(slides[i])[1])
+		b, _ := strconv.Atoi(slideNumber.FindStringSubmatch(slides[j])[1])
+		return a < b
+	})
+	if len(slides) == 0 {
+		return nil, fmt.Errorf("pptx has no slides")
+	}
+	return slides, nil
+}
+
+// partText extracts the text of a slide or notes part
+func partText(f *zip.File) (string, error) {
+	if f == nil {
+		return "", nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	return officeXMLText(rc)
+}
+
+// notesText extracts the text of a notes part, without the slide number
+// placeholder that notes pages carry
+func notesText(f *zip.File) (string, error) {
+	if f == nil {
+		return "", nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	return officeXMLTokenText(xml.NewTokenDecoder(&slideNumberFilter{next: xml.NewDecoder(rc)}))
+}
+
+// slideNumberFilter drops the shapes holding a slide number placeholder
+// (<p:sp> with <p:ph type="sldNum">) from the tokens of a slide or notes part
+type slideNumberFilter struct {
+	next    xml.TokenReader
+	pending []xml.Token
+}
+
+func (f *slideNumberFilter) Token() (xml.Token, error) {
+	for len(f.pending) == 0 {
+		tok, err := f.next.Token()
+		if err != nil {
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "sp" {
+			return tok, nil
+		}
+		shape, err := f.readShape(start)
+		if err != nil {
+			return nil, err
+		}
+		if !isSlideNumberShape(shape) {
+			f.pending = shape
+		}
+	}
+	tok := f.pending[0]
+	f.pending = f.pending[1:]
+	return tok, nil
+}
+
+// readShape reads the tokens of a shape up to and including its end element
+func (f *slideNumberFilter) readShape(start xml.StartElement) ([]xml.Token, error) {
+	shape := []xml.Token{start.Copy()}
+	for depth := 1; depth > 0; {
+		tok, err := f.next.Token()
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch tok.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+		shape = append(shape, xml.CopyToken(tok))
+	}
+	return shape, nil
+}
+
+// isSlideNumberShape reports whether a shape is a slide number placeholder
+func isSlideNumberShape(shape []xml.Token) bool {
+	for _, tok := range shape {
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local == "ph" {
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "type" && attr.Value == "sldNum" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// ocrEmbeddedImage writes an embedded picture to a temp file and OCRs it.
+// Small images and unsupported formats are skipped.
+func ocrEmbeddedImage(ctx context.Context, f *zip.File, ocrImage ImageOCR) (string, error) {
+	if f == nil || f.UncompressedSize64 < minOCRImageSize {
+		return "", nil
+	}
+	ext := strings.ToLower(filepath.Ext(f.Name))
+	if !ocrImageExtensions[ext] {
+		return "", nil
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	tmp, err := os.CreateTemp("", "pptx-image-*"+ext)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, rc); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	text, err := ocrImage(ctx, tmp.Name())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(text), nil
+}
@@ -0,0 +1,64 @@
+package office
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeZip writes the given parts to a zip file in a temporary directory
+func writeZip(t *testing.T, name string, parts map[string]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const presentationML = `xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main"`
+
+func TestPowerPointNotesKeepNumbers(t *testing.T) {
+	deck := writeZip(t, "deck.pptx", map[string]string{
+		"ppt/slides/slide1.xml": `<p:sld ` + presentationML + `><p:cSld><p:spTree>
+<p:sp><p:txBody><a:p><a:r><a:t>Doanh thu</a:t></a:r></a:p></p:txBody></p:sp>
+</p:spTree></p:cSld></p:sld>`,
+		"ppt/slides/_rels/slide1.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/notesSlide" Target="../notesSlides/notesSlide1.xml"/>
+</Relationships>`,
+		"ppt/notesSlides/notesSlide1.xml": `<p:notes ` + presentationML + `><p:cSld><p:spTree>
+<p:sp><p:nvSpPr><p:cNvPr id="2" name="Slide Image Placeholder 1"/><p:nvPr><p:ph type="sldImg"/></p:nvPr></p:nvSpPr></p:sp>
+<p:sp><p:nvSpPr><p:cNvPr id="3" name="Notes Placeholder 2"/><p:nvPr><p:ph type="body" idx="1"/></p:nvPr></p:nvSpPr>
+  <p:txBody><a:p><a:r><a:t>Năm thành lập:</a:t></a:r></a:p><a:p><a:r><a:t>2019</a:t></a:r></a:p><a:p><a:r><a:t>15</a:t></a:r></a:p></p:txBody></p:sp>
+<p:sp><p:nvSpPr><p:cNvPr id="4" name="Slide Number Placeholder 3"/><p:nvPr><p:ph type="sldNum" sz="quarter" idx="5"/></p:nvPr></p:nvSpPr>
+  <p:txBody><a:p><a:fld id="{1}" type="slidenum"><a:t>1</a:t></a:fld></a:p></p:txBody></p:sp>
+</p:spTree></p:cSld></p:notes>`,
+	})
+	got, _, err := ExtractTextFromPowerPoint(context.Background(), deck, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Slide 1:\nDoanh thu\nNotes:\nNăm thành lập:\n2019\n15"
+	if got != want {
+		t.Errorf("ExtractTextFromPowerPoint = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,333 @@
+package office
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const wordprocessingMLNamespace = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+
+// Magic numbers of the two Word container formats
+var (
+	zipMagic = []byte("PK\x03\x04")
+	oleMagic = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+)
+
+// ExtractTextFromWord extracts the text of a Word document. DOCX files are
+// parsed natively: paragraphs, tables (one tab-separated line per row) and
+// headers/footers. Legacy .doc files are converted with antiword, catdoc or
+// LibreOffice, whichever is installed.
+func ExtractTextFromWord(ctx context.Context, path string) (string, error) {
+	magic, err := readMagic(path, len(oleMagic))
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case bytes.HasPrefix(magic, zipMagic):
+		return ExtractTextFromDOCX(path)
+	case bytes.HasPrefix(magic, oleMagic):
+		return extractTextFromDOC(ctx, path)
+	default:
+		return "", fmt.Errorf("not a Word document: %s", filepath.Base(path))
+	}
+}
+
+// ExtractTextFromDOCX extracts headers, body and footers from a DOCX file
+func ExtractTextFromDOCX(path string) (string, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return "", fmt.Errorf("open docx: %w", err)
+	}
+	defer zr.Close()
+
+	var body *zip.File
+	var headers, footers []*zip.File
+	for _, f := range zr.File {
+		switch {
+		case f.Name == "word/document.xml":
+			body = f
+		case strings.HasPrefix(f.Name, "word/header") && strings.HasSuffix(f.Name, ".xml"):
+			headers = append(headers, f)
+		case strings.HasPrefix(f.Name, "word/footer") && strings.HasSuffix(f.Name, ".xml"):
+			footers = append(footers, f)
+		}
+	}
+	if body == nil {
+		return "", fmt.Errorf("docx has no word/document.xml")
+	}
+	sortParts(headers)
+	sortParts(footers)
+
+	var sections []string
+	seen := make(map[string]bool)
+	for _, part := range append(append(headers, body), footers...) {
+		text, err := wordPartText(part)
+		if err != nil {
+			return "", fmt.Errorf("read %s: %w", part.Name, err)
+		}
+		// The same header/footer is often repeated for first, odd and even pages
+		if text == "" || (part != body && seen[text]) {
+			continue
+		}
+		seen[text] = true
+		sections = append(sections, text)
+	}
+	return strings.Join(sections, "\n\n"), nil
+}
+
+// wordPartText extracts the text of one WordprocessingML part
+func wordPartText(f *zip.File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	return officeXMLText(rc)
+}
+
+// xmlTable accumulates the rows of a table being parsed
+type xmlTable struct {
+	rows []string
+	row  []string
+	cell []string
+}
+
+// officeXMLText walks WordprocessingML (Word) or DrawingML (PowerPoint) and
+// returns its text. Paragraphs become lines; table rows become one line of
+// tab-separated cells. Nested tables are flattened into the enclosing cell.
+func officeXMLText(r io.Reader) (string, error) {
+	return officeXMLTokenText(xml.NewDecoder(r))
+}
+
+// officeXMLTokenText is officeXMLText reading from a decoder, which may filter
+// the tokens of the part
+func officeXMLTokenText(dec *xml.Decoder) (string, error) {
+	var lines []string
+	// Paragraphs nest: a text box anchored in a run holds paragraphs of its
+	// own (<w:txbxContent><w:p>), which must not end the paragraph around it
+	var paras []*strings.Builder
+	var loose strings.Builder // text outside any paragraph
+	para := func() *strings.Builder {
+		if len(paras) == 0 {
+			return &loose
+		}
+		return paras[len(paras)-1]
+	}
+	var tables []*xmlTable
+	inText := false
+	runDepth := 0 // open WordprocessingML runs (<w:r>)
+
+	emit := func(text string) {
+		if len(tables) == 0 {
+			lines = append(lines, text)
+			return
+		}
+		t := tables[len(tables)-1]
+		t.cell = append(t.cell, text)
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "r":
+				if t.Name.Space == wordprocessingMLNamespace {
+					runDepth++
+				}
+			case "tab":
+				// Only a <w:tab> in a run is text; <w:tabs><w:tab> in paragraph
+				// properties, and DrawingML <a:tab>, define tab stops
+				if t.Name.Space == wordprocessingMLNamespace && runDepth > 0 {
+					para().WriteString("\t")
+				}
+			case "br", "cr":
+				para().WriteString("\n")
+			case "p":
+				paras = append(paras, &strings.Builder{})
+			case "tbl":
+				tables = append(tables, &xmlTable{})
+			case "tr":
+				if len(tables) > 0 {
+					tables[len(tables)-1].row = nil
+				}
+			case "tc":
+				if len(tables) > 0 {
+					tables[len(tables)-1].cell = nil
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "r":
+				if t.Name.Space == wordprocessingMLNamespace && runDepth > 0 {
+					runDepth--
+				}
+			case "p":
+				if text := strings.TrimRight(para().String(), " "); strings.TrimSpace(text) != "" {
+					emit(text)
+				}
+				if len(paras) > 0 {
+					paras = paras[:len(paras)-1]
+				}
+				loose.Reset()
+			case "tc":
+				if len(tables) > 0 {
+					tbl := tables[len(tables)-1]
+					tbl.row = append(tbl.row, cellText(tbl.cell))
+				}
+			case "tr":
+				if len(tables) > 0 {
+					tbl := tables[len(tables)-1]
+					if strings.TrimSpace(strings.Join(tbl.row, "")) != "" {
+						tbl.rows = append(tbl.rows, strings.Join(tbl.row, "\t"))
+					}
+				}
+			case "tbl":
+				if len(tables) > 0 {
+					tbl := tables[len(tables)-1]
+					tables = tables[:len(tables)-1]
+					if len(tables) == 0 {
+						lines = append(lines, tbl.rows...)
+					} else {
+						emit(strings.Join(tbl.rows, "; "))
+					}
+				}
+			}
+		case xml.CharData:
+			if inText {
+				para().Write(t)
+			}
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// cellText joins a cell's paragraphs, keeping the row on one line
+func cellText(paras []string) string {
+	text := strings.Join(paras, " ")
+	return strings.NewReplacer("\t", " ", "\n", " ").Replace(text)
+}
+
+// sortParts orders header/footer parts numerically (header2 before header10)
+func sortParts(parts []*zip.File) {
+	sort.Slice(parts, func(i, j int) bool {
+		a, b := parts[i].Name, parts[j].Name
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return a < b
+	})
+}
+
+// extractTextFromDOC converts a legacy binary .doc with the first available tool
+func extractTextFromDOC(ctx context.Context, path string) (string, error) {
+	var errs []string
+	for _, tool := range []string{"antiword", "catdoc"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			continue
+		}
+		out, err := runTool(ctx, tool, path)
+		if err == nil && strings.TrimSpace(out) != "" {
+			return out, nil
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	text, err := convertWithLibreOffice(ctx, path, "txt:Text")
+	if err == nil {
+		return text, nil
+	}
+	errs = append(errs, err.Error())
+	return "", fmt.Errorf("legacy .doc needs antiword, catdoc or LibreOffice: %s", strings.Join(errs, "; "))
+}
+
+// convertWithLibreOffice converts a document with soffice --headless and returns the output text
+func convertWithLibreOffice(ctx context.Context, path, format string) (string, error) {
+	outDir, err := os.MkdirTemp("", "office-convert-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(outDir)
+
+	outPath, err := libreOfficeConvert(ctx, path, format, outDir)
+	if err != nil {
+		return "", err
+	}
+	out, err := os.ReadFile(outPath)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// libreOfficeConvert converts a document into outDir with soffice --headless
+// (format as accepted by --convert-to, e.g. "txt:Text" or "xlsx") and returns the output path
+func libreOfficeConvert(ctx context.Context, path, format, outDir string) (string, error) {
+	soffice := ""
+	for _, name := range []string{"soffice", "libreoffice"} {
+		if p, err := exec.LookPath(name); err == nil {
+			soffice = p
+			break
+		}
+	}
+	if soffice == "" {
+		return "", fmt.Errorf("soffice not found on PATH")
+	}
+
+	if _, err := runTool(ctx, soffice, "--headless", "--convert-to", format, "--outdir", outDir, path); err != nil {
+		return "", err
+	}
+	ext := strings.SplitN(format, ":", 2)[0]
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	outPath := filepath.Join(outDir, base+"."+ext)
+	if _, err := os.Stat(outPath); err != nil {
+		return "", fmt.Errorf("soffice produced no output: %w", err)
+	}
+	return outPath, nil
+}
+
+func runTool(ctx context.Context, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s error: %v: %s", filepath.Base(name), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+func readMagic(path string, n int) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf := make([]byte, n)
+	read, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	return buf[:read], nil
+}
@@ -0,0 +1,71 @@
+package office
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOfficeXMLTextTabs(t *testing.T) {
+	doc := `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p>
+  <w:pPr><w:tabs><w:tab w:val="left" w:pos="2880"/><w:tab w:val="right" w:pos="9360"/></w:tabs></w:pPr>
+  <w:r><w:t>Mã số thuế:</w:t></w:r><w:r><w:tab/><w:t>0312345678</w:t></w:r>
+</w:p>
+<w:p><w:pPr><w:tabs><w:tab w:val="center" w:pos="4680"/></w:tabs></w:pPr><w:r><w:t>Vốn điều lệ</w:t></w:r></w:p>
+<w:tbl><w:tr>
+  <w:tc><w:p><w:r><w:t>A</w:t></w:r></w:p></w:tc>
+  <w:tc><w:p><w:pPr><w:tabs><w:tab w:val="left" w:pos="720"/></w:tabs></w:pPr><w:r><w:t>B</w:t><w:tab/><w:t>C</w:t></w:r></w:p></w:tc>
+</w:tr></w:tbl>
+</w:body></w:document>`
+	got, err := officeXMLText(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Mã số thuế:\t0312345678\nVốn điều lệ\nA\tB C"
+	if got != want {
+		t.Errorf("officeXMLText = %q, want %q", got, want)
+	}
+}
+
+func TestOfficeXMLTextDrawingMLTabStops(t *testing.T) {
+	slide := `<p:sld xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main">
+<a:p><a:pPr><a:tabLst><a:tab pos="914400" algn="l"/></a:tabLst></a:pPr><a:r><a:t>Doanh thu 2024</a:t></a:r></a:p>
+</p:sld>`
+	got, err := officeXMLText(strings.NewReader(slide))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "Doanh thu 2024" {
+		t.Errorf("officeXMLText = %q, want %q", got, "Doanh thu 2024")
+	}
+}
+
+func TestOfficeXMLTextNestedParagraphs(t *testing.T) {
+	// A text box anchored in the middle of a paragraph, the way Word writes a
+	// stamp or a boxed note next to body text
+	doc := `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+  xmlns:wps="http://schemas.microsoft.com/office/word/2010/wordprocessingShape"><w:body>
+<w:p>
+  <w:r><w:t xml:space="preserve">Người đại diện: </w:t></w:r>
+  <w:r><w:drawing><wps:txbx><w:txbxContent>
+    <w:p><w:r><w:t>ĐÃ ĐỐI CHIẾU</w:t></w:r></w:p>
+    <w:p><w:r><w:t>Bản chính</w:t></w:r></w:p>
+  </w:txbxContent></wps:txbx></w:drawing></w:r>
+  <w:r><w:t>Trần Văn Bình</w:t></w:r>
+</w:p>
+<w:tbl><w:tr><w:tc><w:p>
+  <w:r><w:t xml:space="preserve">Ký tên </w:t></w:r>
+  <w:r><w:pict><w:txbxContent><w:p><w:r><w:t>dấu</w:t></w:r></w:p></w:txbxContent></w:pict></w:r>
+  <w:r><w:t>giám đốc</w:t></w:r>
+</w:p></w:tc></w:tr></w:tbl>
+<w:p><w:r><w:t>Hết</w:t></w:r></w:p>
+</w:body></w:document>`
+	got, err := officeXMLText(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "ĐÃ ĐỐI CHIẾU\nBản chính\nNgười đại diện: Trần Văn Bình\ndấu Ký tên giám đốc\nHết"
+	if got != want {
+		t.Errorf("officeXMLText = %q, want %q", got, want)
+	}
+}
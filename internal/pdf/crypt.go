@@ -0,0 +1,291 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rc4"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"hash"
+)
+
+// passwordPadding pads passwords to 32 bytes in the standard security handler
+var passwordPadding = []byte{
+	0x28, 0xBF, 0x4E, 0x5E, 0x4E, 0x75, 0x8A, 0x41, 0x64, 0x00, 0x4E, 0x56, 0xFF, 0xFA, 0x01, 0x08,
+	0x2E, 0x2E, 0x00, 0xB6, 0xD0, 0x68, 0x3E, 0x80, 0x2F, 0x0C, 0xA9, 0xFE, 0x64, 0x53, 0x69, 0x7A,
+}
+
+// Crypt methods of the standard security handler
+const (
+	cryptIdentity = "Identity"
+	cryptRC4      = "V2"
+	cryptAES128   = "AESV2"
+	cryptAES256   = "AESV3"
+)
+
+// decrypter decrypts the strings and streams of a file encrypted with the
+// standard security handler, once the file key is known
+type decrypter struct {
+	key       []byte
+	streamCFM string // crypt method of streams
+	stringCFM string // crypt method of strings
+}
+
+// newDecrypter derives the file key of an encrypted file from the empty user
+// password, which is how most encrypted documents are distributed: they open
+// without a password and only restrict printing or copying. Files that need
+// a password fail with ErrEncrypted.
+func newDecrypter(encrypt dict, id []byte) (*decrypter, error) {
+	if filter, _ := encrypt["Filter"].(name); filter != "Standard" {
+		return nil, fmt.Errorf("%w: unsupported security handler %q", ErrEncrypted, filter)
+	}
+	v := intValue(encrypt["V"])
+	r := intValue(encrypt["R"])
+	o := []byte(stringValue(encrypt["O"]))
+	u := []byte(stringValue(encrypt["U"]))
+	p := uint32(int32(intValue(encrypt["P"])))
+
+	c := &decrypter{streamCFM: cryptRC4, stringCFM: cryptRC4}
+	keyLength := 5
+	if length := intValue(encrypt["Length"]); v >= 2 && length >= 40 {
+		keyLength = length / 8
+	}
+	if v >= 4 {
+		filters, _ := encrypt["CF"].(dict)
+		method := func(filterName object) string {
+			n, _ := filterName.(name)
+			if n == "" || n == cryptIdentity {
+				return cryptIdentity
+			}
+			cf, _ := filters[n].(dict)
+			cfm, _ := cf["CFM"].(name)
+			if cfm == "None" {
+				return cryptIdentity
+			}
+			if length := intValue(cf["Length"]); length > 0 && v == 4 {
+				keyLength = length
+				if length > 32 { // some writers give bits instead of bytes
+					keyLength = length / 8
+				}
+			}
+			return string(cfm)
+		}
+		c.streamCFM = method(encrypt["StmF"])
+		c.stringCFM = method(encrypt["StrF"])
+	}
+
+	if r >= 5 {
+		key, err := aes256Key(r, u, []byte(stringValue(encrypt["UE"])))
+		if err != nil {
+			return nil, err
+		}
+		c.key = key
+		return c, nil
+	}
+
+	encryptMetadata := true
+	if b, ok := encrypt["EncryptMetadata"].(bool); ok {
+		encryptMetadata = b
+	}
+	keyLength = min(max(keyLength, 5), 16)
+	fileKey := func(password []byte) []byte {
+		h := md5.New()
+		h.Write(padPassword(password))
+		h.Write(o[:min(32, len(o))])
+		binary.Write(h, binary.LittleEndian, p)
+		h.Write(id)
+		if r >= 4 && !encryptMetadata {
+			h.Write([]byte{0xFF, 0xFF, 0xFF, 0xFF})
+		}
+		key := h.Sum(nil)
+		if r >= 3 {
+			for i := 0; i < 50; i++ {
+				sum := md5.Sum(key[:keyLength])
+				key = sum[:]
+			}
+		}
+		return key[:keyLength]
+	}
+	checkUser := func(key []byte) bool {
+		if r == 2 {
+			return bytes.Equal(rc4Crypt(key, passwordPadding), u)
+		}
+		h := md5.New()
+		h.Write(passwordPadding)
+		h.Write(id)
+		x := h.Sum(nil)
+		for i := 0; i < 20; i++ {
+			x = rc4Crypt(xorKey(key, byte(i)), x)
+		}
+		return len(u) >= 16 && bytes.Equal(x, u[:16])
+	}
+
+	if key := fileKey(nil); checkUser(key) {
+		c.key = key
+		return c, nil
+	}
+	// An empty owner password also opens the file: recover the user password from /O
+	ownerKey := md5.Sum(padPassword(nil))
+	ok := ownerKey[:]
+	if r >= 3 {
+		for i := 0; i < 50; i++ {
+			sum := md5.Sum(ok)
+			ok = sum[:]
+		}
+	}
+	ok = ok[:keyLength]
+	userPassword := o[:min(32, len(o))]
+	if r == 2 {
+		userPassword = rc4Crypt(ok, userPassword)
+	} else {
+		for i := 19; i >= 0; i-- {
+			userPassword = rc4Crypt(xorKey(ok, byte(i)), userPassword)
+		}
+	}
+	if key := fileKey(userPassword); checkUser(key) {
+		c.key = key
+		return c, nil
+	}
+	return nil, fmt.Errorf("%w: a password is needed to open it", ErrEncrypted)
+}
+
+// aes256Key derives the AES-256 file key of revision 5 and 6 encryption from
+// the empty user password
+func aes256Key(r int, u, ue []byte) ([]byte, error) {
+	if len(u) < 48 || len(ue) < 32 {
+		return nil, fmt.Errorf("%w: malformed encryption dictionary", ErrEncrypted)
+	}
+	hashOf := func(salt []byte) []byte {
+		if r == 5 {
+			sum := sha256.Sum256(salt)
+			return sum[:]
+		}
+		return hardenedHash(nil, salt)
+	}
+	if !bytes.Equal(hashOf(u[32:40]), u[:32]) {
+		return nil, fmt.Errorf("%w: a password is needed to open it", ErrEncrypted)
+	}
+	block, err := aes.NewCipher(hashOf(u[40:48]))
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(key, ue[:32])
+	return key, nil
+}
+
+// hardenedHash is the iterated SHA-2/AES hash of revision 6 encryption
+// (ISO 32000-2, algorithm 2.B) for a user password
+func hardenedHash(password, salt []byte) []byte {
+	sum := sha256.Sum256(append(append([]byte{}, password...), salt...))
+	k := sum[:]
+	for round := 0; ; round++ {
+		k1 := bytes.Repeat(append(append([]byte{}, password...), k...), 64)
+		block, _ := aes.NewCipher(k[:16])
+		e := make([]byte, len(k1))
+		cipher.NewCBCEncrypter(block, k[16:32]).CryptBlocks(e, k1)
+		var mod int
+		for _, b := range e[:16] {
+			mod += int(b)
+		}
+		var h hash.Hash
+		switch mod % 3 {
+		case 0:
+			h = sha256.New()
+		case 1:
+			h = sha512.New384()
+		default:
+			h = sha512.New()
+		}
+		h.Write(e)
+		k = h.Sum(nil)
+		if round >= 63 && int(e[len(e)-1]) <= round-31 {
+			break
+		}
+	}
+	return k[:32]
+}
+
+func padPassword(password []byte) []byte {
+	padded := append(append([]byte{}, password[:min(32, len(password))]...), passwordPadding...)
+	return padded[:32]
+}
+
+func xorKey(key []byte, x byte) []byte {
+	out := make([]byte, len(key))
+	for i, b := range key {
+		out[i] = b ^ x
+	}
+	return out
+}
+
+func rc4Crypt(key, data []byte) []byte {
+	c, err := rc4.NewCipher(key)
+	if err != nil {
+		return nil
+	}
+	out := make([]byte, len(data))
+	c.XORKeyStream(out, data)
+	return out
+}
+
+// decrypt decrypts the data of a string or stream of object r with a crypt method
+func (c *decrypter) decrypt(r ref, data []byte, method string) []byte {
+	switch method {
+	case cryptIdentity, "":
+		return data
+	case cryptAES256:
+		return aesDecrypt(c.key, data)
+	}
+	h := md5.New()
+	h.Write(c.key)
+	h.Write([]byte{byte(r.num), byte(r.num >> 8), byte(r.num >> 16), byte(r.gen), byte(r.gen >> 8)})
+	if method == cryptAES128 {
+		h.Write([]byte("sAlT"))
+	}
+	key := h.Sum(nil)[:min(len(c.key)+5, 16)]
+	if method == cryptAES128 {
+		return aesDecrypt(key, data)
+	}
+	return rc4Crypt(key, data)
+}
+
+// aesDecrypt decrypts AES-CBC data that starts with its IV and ends with
+// PKCS#5 padding
+func aesDecrypt(key, data []byte) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil || len(data) < 2*aes.BlockSize {
+		return nil
+	}
+	iv, data := data[:aes.BlockSize], data[aes.BlockSize:]
+	data = data[:len(data)/aes.BlockSize*aes.BlockSize]
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+	if n := int(out[len(out)-1]); n >= 1 && n <= aes.BlockSize && n <= len(out) {
+		out = out[:len(out)-n]
+	}
+	return out
+}
+
+// decryptStrings decrypts the strings inside an object read from object r
+func (c *decrypter) decryptStrings(r ref, o object) object {
+	switch v := o.(type) {
+	case pdfString:
+		return pdfString(c.decrypt(r, []byte(v), c.stringCFM))
+	case array:
+		for i := range v {
+			v[i] = c.decryptStrings(r, v[i])
+		}
+	case dict:
+		for k := range v {
+			v[k] = c.decryptStrings(r, v[k])
+		}
+	case *stream:
+		c.decryptStrings(r, v.dict)
+	}
+	return o
+}
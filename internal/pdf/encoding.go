@@ -0,0 +1,341 @@
+package pdf
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Simple font encodings, by code; zero entries are undefined
+var (
+	standardEncoding [256]rune
+	winAnsiEncoding  [256]rune
+	macRomanEncoding [256]rune
+)
+
+func init() {
+	for c := 0x20; c < 0x7F; c++ {
+		standardEncoding[c] = rune(c)
+		winAnsiEncoding[c] = rune(c)
+		macRomanEncoding[c] = rune(c)
+	}
+	standardEncoding['\''] = '’'
+	standardEncoding['`'] = '‘'
+	const standardUpper = "\xA1¡\xA2¢\xA3£\xA4⁄\xA5¥\xA6ƒ\xA7§\xA8¤\xA9'\xAA“\xAB«\xAC‹\xAD›\xAEﬁ\xAFﬂ" +
+		"\xB1–\xB2†\xB3‡\xB4·\xB6¶\xB7•\xB8‚\xB9„\xBA”\xBB»\xBC…\xBD‰\xBF¿" +
+		"\xC1`\xC2´\xC3ˆ\xC4˜\xC5¯\xC6˘\xC7˙\xC8¨\xCA˚\xCB¸\xCD˝\xCE˛\xCFˇ\xD0—" +
+		"\xE1Æ\xE3ª\xE8Ł\xE9Ø\xEAŒ\xEBº\xF1æ\xF5ı\xF8ł\xF9ø\xFAœ\xFBß"
+	for i := 0; i < len(standardUpper); {
+		code := standardUpper[i]
+		r, size := utf8.DecodeRuneInString(standardUpper[i+1:])
+		standardEncoding[code] = r
+		i += 1 + size
+	}
+
+	const cp1252 = "€\x00‚ƒ„…†‡ˆ‰Š‹Œ\x00Ž\x00\x00‘’“”•–—˜™š›œ\x00žŸ"
+	c := 0x80
+	for _, r := range cp1252 {
+		winAnsiEncoding[c] = r
+		c++
+	}
+	for c := 0xA0; c <= 0xFF; c++ {
+		winAnsiEncoding[c] = rune(c)
+	}
+
+	const macRoman = "ÄÅÇÉÑÖÜáàâäãåçéèêëíìîïñóòôöõúùûü†°¢£§•¶ß®©™´¨≠ÆØ∞±≤≥¥µ∂∑∏π∫ªºΩæø" +
+		"¿¡¬√ƒ≈∆«»… ÀÃÕŒœ–—“”‘’÷◊ÿŸ⁄€‹›ﬁﬂ‡·‚„‰ÂÊÁËÈÍÎÏÌÓÔÒÚÛÙıˆ˜¯˘˙˚¸˝˛ˇ"
+	c = 0x80
+	for _, r := range macRoman {
+		macRomanEncoding[c] = r
+		c++
+	}
+}
+
+// glyphNames maps the Adobe glyph names that aren't a single letter or a
+// letter with accents to their characters
+var glyphNames = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$', "percent": '%',
+	"ampersand": '&', "quotesingle": '\'', "quoteright": '’', "parenleft": '(', "parenright": ')',
+	"asterisk": '*', "plus": '+', "comma": ',', "hyphen": '-', "period": '.', "slash": '/',
+	"zero": '0', "one": '1', "two": '2', "three": '3', "four": '4', "five": '5', "six": '6',
+	"seven": '7', "eight": '8', "nine": '9', "colon": ':', "semicolon": ';', "less": '<',
+	"equal": '=', "greater": '>', "question": '?', "at": '@', "bracketleft": '[', "backslash": '\\',
+	"bracketright": ']', "asciicircum": '^', "underscore": '_', "grave": '`', "quoteleft": '‘',
+	"braceleft": '{', "bar": '|', "braceright": '}', "asciitilde": '~',
+	"exclamdown": '¡', "cent": '¢', "sterling": '£', "fraction": '⁄', "yen": '¥', "florin": 'ƒ',
+	"section": '§', "currency": '¤', "quotedblleft": '“', "guillemotleft": '«', "guilsinglleft": '‹',
+	"guilsinglright": '›', "fi": 'ﬁ', "fl": 'ﬂ', "endash": '–', "dagger": '†', "daggerdbl": '‡',
+	"periodcentered": '·', "paragraph": '¶', "bullet": '•', "quotesinglbase": '‚', "quotedblbase": '„',
+	"quotedblright": '”', "guillemotright": '»', "ellipsis": '…', "perthousand": '‰', "questiondown": '¿',
+	"acute": '´', "circumflex": 'ˆ', "tilde": '˜', "macron": '¯', "breve": '˘', "dotaccent": '˙',
+	"dieresis": '¨', "ring": '˚', "cedilla": '¸', "hungarumlaut": '˝', "ogonek": '˛', "caron": 'ˇ',
+	"emdash": '—', "AE": 'Æ', "ae": 'æ', "OE": 'Œ', "oe": 'œ', "ordfeminine": 'ª', "ordmasculine": 'º',
+	"Lslash": 'Ł', "lslash": 'ł', "Oslash": 'Ø', "oslash": 'ø', "dotlessi": 'ı', "germandbls": 'ß',
+	"Eth": 'Ð', "eth": 'ð', "Thorn": 'Þ', "thorn": 'þ', "Euro": '€', "trademark": '™',
+	"copyright": '©', "registered": '®', "degree": '°', "plusminus": '±', "multiply": '×',
+	"divide": '÷', "brokenbar": '¦', "logicalnot": '¬', "mu": 'µ', "onehalf": '½',
+	"onequarter": '¼', "threequarters": '¾', "onesuperior": '¹', "twosuperior": '²',
+	"threesuperior": '³', "nbspace": '\u00a0', "nonbreakingspace": '\u00a0', "sfthyphen": '\u00ad',
+	"softhyphen": '\u00ad', "minus": '−', "dcroat": 'đ', "Dcroat": 'Đ', "dmacron": 'đ', "Dslash": 'Đ',
+	"ohorn": 'ơ', "Ohorn": 'Ơ', "uhorn": 'ư', "Uhorn": 'Ư', "numero": '№', "dong": '₫',
+}
+
+// accentMarks maps the accent names of composite glyph names, such as the
+// "circumflexacute" of "acircumflexacute", to combining marks
+var accentMarks = []struct {
+	name string
+	mark rune
+}{
+	{"grave", 0x300}, {"acute", 0x301}, {"circumflex", 0x302}, {"tilde", 0x303}, {"macron", 0x304},
+	{"breve", 0x306}, {"dotaccent", 0x307}, {"dieresis", 0x308}, {"hookabove", 0x309}, {"ring", 0x30A},
+	{"hungarumlaut", 0x30B}, {"caron", 0x30C}, {"horn", 0x31B}, {"dotbelow", 0x323},
+	{"commaaccent", 0x326}, {"cedilla", 0x327}, {"ogonek", 0x328},
+}
+
+// glyphText returns the text of a glyph name, or "" if it is unknown. Besides
+// the names in glyphNames, it reads letters with accents ("ecircumflexacute"),
+// uniXXXX and uXXXX names, ligatures ("f_f_i") and variants ("a.sc").
+func glyphText(glyph string) string {
+	if i := strings.IndexByte(glyph, '.'); i > 0 {
+		glyph = glyph[:i]
+	}
+	if strings.Contains(glyph, "_") {
+		var b strings.Builder
+		for _, part := range strings.Split(glyph, "_") {
+			b.WriteString(glyphText(part))
+		}
+		return b.String()
+	}
+	if r, ok := glyphNames[glyph]; ok {
+		return string(r)
+	}
+	if len(glyph) == 1 && (glyph[0] >= 'a' && glyph[0] <= 'z' || glyph[0] >= 'A' && glyph[0] <= 'Z') {
+		return glyph
+	}
+	if hex, ok := strings.CutPrefix(glyph, "uni"); ok && len(hex) >= 4 && len(hex)%4 == 0 {
+		var units []uint16
+		for i := 0; i < len(hex); i += 4 {
+			v, err := strconv.ParseUint(hex[i:i+4], 16, 16)
+			if err != nil {
+				return ""
+			}
+			units = append(units, uint16(v))
+		}
+		return string(utf16.Decode(units))
+	}
+	if hex, ok := strings.CutPrefix(glyph, "u"); ok && len(hex) >= 4 && len(hex) <= 6 {
+		if v, err := strconv.ParseUint(hex, 16, 32); err == nil && v <= 0x10FFFF {
+			return string(rune(v))
+		}
+	}
+	return accentedLetter(glyph)
+}
+
+// accentedLetter composes a letter with accents from a name such as
+// "acircumflexacute" or "uhorndotbelow"
+func accentedLetter(glyph string) string {
+	var base string
+	for _, b := range []string{"ohorn", "Ohorn", "uhorn", "Uhorn", "dotlessi"} {
+		if strings.HasPrefix(glyph, b) {
+			base = string(glyphNames[b])
+			glyph = glyph[len(b):]
+			break
+		}
+	}
+	if base == "" {
+		if glyph == "" || !(glyph[0] >= 'a' && glyph[0] <= 'z' || glyph[0] >= 'A' && glyph[0] <= 'Z') {
+			return ""
+		}
+		base, glyph = glyph[:1], glyph[1:]
+	}
+	if glyph == "" {
+		return base
+	}
+	composed := []rune(base)
+	for glyph != "" {
+		found := false
+		for _, a := range accentMarks {
+			if strings.HasPrefix(glyph, a.name) {
+				composed = append(composed, a.mark)
+				glyph = glyph[len(a.name):]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return ""
+		}
+	}
+	if s := norm.NFC.String(string(composed)); len([]rune(s)) == 1 {
+		return s
+	}
+	return ""
+}
+
+// cmap is a parsed CMap: the codespace of a font's character codes, their
+// text (ToUnicode CMaps) or their CIDs (encoding CMaps of Type0 fonts)
+type cmap struct {
+	spaces []codespace
+	text   map[uint32]string
+	cids   []cidRange
+}
+
+type codespace struct {
+	n      int // bytes per code
+	lo, hi uint32
+}
+
+type cidRange struct {
+	lo, hi uint32
+	cid    int
+}
+
+// maxCMapRange caps the codes expanded from one bfrange
+const maxCMapRange = 1 << 16
+
+// parseCMap reads the codespace ranges and the bfchar, bfrange, cidchar and
+// cidrange mappings of a CMap
+func parseCMap(data []byte) *cmap {
+	c := &cmap{text: map[uint32]string{}}
+	l := &lexer{data: data}
+	var operands []object
+	code := func(o object) (uint32, int, bool) {
+		s, ok := o.(pdfString)
+		if !ok || len(s) == 0 || len(s) > 4 {
+			return 0, 0, false
+		}
+		var v uint32
+		for i := 0; i < len(s); i++ {
+			v = v<<8 | uint32(s[i])
+		}
+		return v, len(s), true
+	}
+	for l.pos < len(data) {
+		o, err := l.object()
+		if err != nil {
+			continue
+		}
+		kw, ok := o.(keyword)
+		if !ok {
+			operands = append(operands, o)
+			continue
+		}
+		switch kw {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				lo, n, ok1 := code(operands[i])
+				hi, _, ok2 := code(operands[i+1])
+				if ok1 && ok2 {
+					c.spaces = append(c.spaces, codespace{n: n, lo: lo, hi: hi})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				if src, _, ok := code(operands[i]); ok {
+					c.text[src] = cmapText(operands[i+1])
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, _, ok1 := code(operands[i])
+				hi, _, ok2 := code(operands[i+1])
+				if !ok1 || !ok2 || hi < lo || hi-lo >= maxCMapRange {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case array:
+					for j, o := range dst {
+						if lo+uint32(j) > hi {
+							break
+						}
+						c.text[lo+uint32(j)] = cmapText(o)
+					}
+				case pdfString:
+					runes := []rune(cmapText(dst))
+					if len(runes) == 0 {
+						continue
+					}
+					for v := lo; v <= hi; v++ {
+						r := append([]rune{}, runes...)
+						r[len(r)-1] += rune(v - lo)
+						c.text[v] = string(r)
+					}
+				}
+			}
+		case "endcidrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, _, ok1 := code(operands[i])
+				hi, _, ok2 := code(operands[i+1])
+				if ok1 && ok2 {
+					c.cids = append(c.cids, cidRange{lo: lo, hi: hi, cid: intValue(operands[i+2])})
+				}
+			}
+		case "endcidchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				if v, _, ok := code(operands[i]); ok {
+					c.cids = append(c.cids, cidRange{lo: v, hi: v, cid: intValue(operands[i+1])})
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+	return c
+}
+
+// cmapText decodes the destination of a bfchar or bfrange mapping: UTF-16BE
+// text, or a glyph name
+func cmapText(o object) string {
+	switch v := o.(type) {
+	case pdfString:
+		if len(v)%2 == 1 {
+			return string(v) // single bytes, as some writers emit
+		}
+		units := make([]uint16, len(v)/2)
+		for i := range units {
+			units[i] = uint16(v[2*i])<<8 | uint16(v[2*i+1])
+		}
+		return string(utf16.Decode(units))
+	case name:
+		return glyphText(string(v))
+	}
+	return ""
+}
+
+// codeLength returns the length of the character code at the start of s,
+// from the codespace ranges, or 0 if there are none
+func (c *cmap) codeLength(s []byte) int {
+	shortest := 0
+	for _, space := range c.spaces {
+		if shortest == 0 || space.n < shortest {
+			shortest = space.n
+		}
+		if space.n > len(s) {
+			continue
+		}
+		var v uint32
+		for _, b := range s[:space.n] {
+			v = v<<8 | uint32(b)
+		}
+		if v >= space.lo && v <= space.hi {
+			return space.n
+		}
+	}
+	return shortest
+}
+
+// cid returns the CID of a character code, or the code itself if the CMap
+// has no CID mappings
+func (c *cmap) cid(code uint32) int {
+	if len(c.cids) == 0 {
+		return int(code)
+	}
+	for _, r := range c.cids {
+		if code >= r.lo && code <= r.hi {
+			return r.cid + int(code-r.lo)
+		}
+	}
+	return 0
+}
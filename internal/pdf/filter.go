@@ -0,0 +1,310 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxDecodedSize caps the decoded size of one stream, against decompression bombs
+const maxDecodedSize = 256 << 20
+
+// Image filters hold compressed pictures; decoding stops in front of them
+var imageFilters = map[name]bool{"DCTDecode": true, "DCT": true, "JPXDecode": true, "CCITTFaxDecode": true, "CCF": true, "JBIG2Decode": true}
+
+// decodeStream decrypts and decodes a stream whose filters are all general
+// purpose, as for content streams, fonts and object streams
+func (d *Document) decodeStream(s *stream) ([]byte, error) {
+	data, imageFilter, _, err := d.decodeFilters(s)
+	if err != nil {
+		return nil, err
+	}
+	if imageFilter != "" {
+		return nil, fmt.Errorf("pdf: unexpected image filter %s", imageFilter)
+	}
+	return data, nil
+}
+
+// decodeFilters decrypts a stream and applies its filters up to an image
+// filter, which is returned with its parameters for the caller to decode
+func (d *Document) decodeFilters(s *stream) ([]byte, name, dict, error) {
+	data := s.data
+	if d.crypt != nil && s.dict["Type"] != name("XRef") {
+		method := d.crypt.streamCFM
+		if isIdentityCrypt(s.dict) {
+			method = cryptIdentity
+		}
+		data = d.crypt.decrypt(s.ref, data, method)
+	}
+
+	var filters array
+	var parms array
+	switch f := d.resolveQuiet(s.dict["Filter"]).(type) {
+	case name:
+		filters = array{f}
+		parms = array{d.resolveQuiet(s.dict["DecodeParms"])}
+	case array:
+		filters = f
+		if p, ok := d.resolveQuiet(s.dict["DecodeParms"]).(array); ok {
+			parms = p
+		}
+	}
+	for i, f := range filters {
+		filter, _ := d.resolveQuiet(f).(name)
+		var p dict
+		if i < len(parms) {
+			p, _ = d.resolveQuiet(parms[i]).(dict)
+		}
+		if imageFilters[filter] {
+			return data, filter, p, nil
+		}
+		var err error
+		data, err = applyFilter(filter, data, p)
+		if err != nil {
+			return nil, "", nil, err
+		}
+	}
+	return data, "", nil, nil
+}
+
+// isIdentityCrypt reports whether a stream opts out of encryption with a Crypt filter
+func isIdentityCrypt(d dict) bool {
+	switch f := d["Filter"].(type) {
+	case name:
+		return f == "Crypt"
+	case array:
+		return len(f) > 0 && f[0] == name("Crypt")
+	}
+	return false
+}
+
+// applyFilter decodes data with one general purpose filter
+func applyFilter(filter name, data []byte, parms dict) ([]byte, error) {
+	var out []byte
+	var err error
+	switch filter {
+	case "FlateDecode", "Fl":
+		out, err = inflate(data)
+	case "LZWDecode", "LZW":
+		earlyChange := true
+		if v, ok := parms["EarlyChange"].(int64); ok {
+			earlyChange = v != 0
+		}
+		out, err = lzwDecode(data, earlyChange)
+	case "ASCIIHexDecode", "AHx":
+		out = []byte((&lexer{data: append(append([]byte{}, data...), '>')}).hexString())
+	case "ASCII85Decode", "A85":
+		out, err = ascii85Decode(data)
+	case "RunLengthDecode", "RL":
+		out = runLengthDecode(data)
+	case "Crypt":
+		return data, nil
+	default:
+		return nil, fmt.Errorf("pdf: unsupported filter %s", filter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("pdf: %s: %w", filter, err)
+	}
+	if filter == "FlateDecode" || filter == "Fl" || filter == "LZWDecode" || filter == "LZW" {
+		return unpredict(out, parms)
+	}
+	return out, nil
+}
+
+// inflate decompresses zlib data. Damaged streams are common, so whatever
+// could be decompressed before an error is kept.
+func inflate(data []byte) ([]byte, error) {
+	var r io.Reader
+	if zr, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+		r = zr
+	} else {
+		r = flate.NewReader(bytes.NewReader(data)) // a missing zlib header
+	}
+	out, err := io.ReadAll(io.LimitReader(r, maxDecodedSize+1))
+	if len(out) > maxDecodedSize {
+		return nil, errors.New("stream too large")
+	}
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+func ascii85Decode(data []byte) ([]byte, error) {
+	if i := bytes.Index(data, []byte("~>")); i >= 0 {
+		data = data[:i]
+	}
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+	out := make([]byte, 4*len(data)/5+4*bytes.Count(data, []byte("z"))+4)
+	n, _, err := ascii85.Decode(out, data, true)
+	if err != nil {
+		return nil, err
+	}
+	return out[:n], nil
+}
+
+func runLengthDecode(data []byte) []byte {
+	var out []byte
+	for i := 0; i < len(data); {
+		n := int(data[i])
+		i++
+		switch {
+		case n == 128:
+			return out
+		case n < 128:
+			end := min(i+n+1, len(data))
+			out = append(out, data[i:end]...)
+			i = end
+		default:
+			if i < len(data) {
+				out = append(out, bytes.Repeat(data[i:i+1], 257-n)...)
+				i++
+			}
+		}
+	}
+	return out
+}
+
+// lzwDecode decodes PDF's LZW variant: MSB-first codes of 9 to 12 bits
+// which, with earlyChange, grow one code early
+func lzwDecode(data []byte, earlyChange bool) ([]byte, error) {
+	const clearCode, eodCode = 256, 257
+	var out []byte
+	table := make([][]byte, 258, 4096)
+	reset := func() {
+		table = table[:258]
+		for i := 0; i < 256; i++ {
+			table[i] = []byte{byte(i)}
+		}
+	}
+	reset()
+	early := 0
+	if earlyChange {
+		early = 1
+	}
+	width := 9
+	var bits uint32
+	var nbits int
+	var prev []byte
+	for _, b := range data {
+		bits = bits<<8 | uint32(b)
+		nbits += 8
+		for nbits >= width {
+			code := int(bits>>(nbits-width)) & (1<<width - 1)
+			nbits -= width
+			switch {
+			case code == clearCode:
+				reset()
+				width = 9
+				prev = nil
+				continue
+			case code == eodCode:
+				return out, nil
+			}
+			var entry []byte
+			switch {
+			case code < len(table):
+				entry = table[code]
+			case code == len(table) && prev != nil:
+				entry = append(append([]byte{}, prev...), prev[0])
+			default:
+				return out, errors.New("bad LZW code")
+			}
+			out = append(out, entry...)
+			if len(out) > maxDecodedSize {
+				return nil, errors.New("stream too large")
+			}
+			if prev != nil && len(table) < 4096 {
+				table = append(table, append(append([]byte{}, prev...), entry[0]))
+			}
+			prev = entry
+			if len(table)+early >= 1<<width && width < 12 {
+				width++
+			}
+		}
+	}
+	return out, nil
+}
+
+// unpredict undoes the PNG or TIFF predictor of Flate and LZW data
+func unpredict(data []byte, parms dict) ([]byte, error) {
+	predictor := intValue(parms["Predictor"])
+	if predictor <= 1 {
+		return data, nil
+	}
+	colors := max(1, intValue(parms["Colors"]))
+	bpc := intValue(parms["BitsPerComponent"])
+	if bpc == 0 {
+		bpc = 8
+	}
+	columns := intValue(parms["Columns"])
+	if columns == 0 {
+		columns = 1
+	}
+	bpp := max(1, colors*bpc/8)
+	rowLen := (colors*bpc*columns + 7) / 8
+
+	if predictor == 2 { // TIFF: horizontal differencing, 8-bit samples only
+		if bpc != 8 {
+			return data, nil
+		}
+		for row := 0; row+rowLen <= len(data); row += rowLen {
+			for i := bpp; i < rowLen; i++ {
+				data[row+i] += data[row+i-bpp]
+			}
+		}
+		return data, nil
+	}
+
+	// PNG: every row starts with its filter type
+	out := make([]byte, 0, len(data)/(rowLen+1)*rowLen)
+	prev := make([]byte, rowLen)
+	for pos := 0; pos < len(data); pos += rowLen + 1 {
+		filterType := data[pos]
+		row := make([]byte, rowLen)
+		copy(row, data[pos+1:min(pos+1+rowLen, len(data))])
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = row[i-bpp], prev[i-bpp]
+			}
+			up := prev[i]
+			switch filterType {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,409 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rc4"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The fixtures in testdata are written by writeFixtures when the tests run
+// with -update. The encryption below is written from the PDF specification
+// rather than with the package's own helpers, so the fixtures check them.
+
+// pdfBuilder assembles the objects of a PDF file, numbered from 1 in the
+// order they are added
+type pdfBuilder struct {
+	objs        []string
+	streamDicts map[int]string
+	streamData  map[int][]byte
+}
+
+func newPDFBuilder() *pdfBuilder {
+	return &pdfBuilder{streamDicts: map[int]string{}, streamData: map[int][]byte{}}
+}
+
+func (b *pdfBuilder) add(body string) int {
+	b.objs = append(b.objs, body)
+	return len(b.objs)
+}
+
+func (b *pdfBuilder) stream(dict string, data []byte) int {
+	n := b.add("")
+	b.streamDicts[n] = dict
+	b.streamData[n] = data
+	return n
+}
+
+// next returns the number the object added after n more will get
+func (b *pdfBuilder) next(n int) int {
+	return len(b.objs) + n + 1
+}
+
+// encryption is the /Encrypt dictionary of a file and the function that
+// encrypts the data of object num
+type encryption struct {
+	dict    string
+	encrypt func(num int, data []byte) []byte
+}
+
+// fixtureID is the first element of the file identifier of every fixture
+var fixtureID = []byte("0123456789abcdef")
+
+// build writes the file. With objStm, the objects other than streams go into
+// an object stream, indexed by a cross-reference stream.
+func (b *pdfBuilder) build(root int, enc *encryption, objStm bool) []byte {
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.7\n%\xE2\xE3\xCF\xD3\n")
+	encNum := 0
+	if enc != nil {
+		encNum = b.add(enc.dict)
+	}
+	total := len(b.objs)
+	offsets := map[int]int{}
+	writeObj := func(n int) {
+		offsets[n] = out.Len()
+		if dict, ok := b.streamDicts[n]; ok {
+			data := b.streamData[n]
+			if enc != nil {
+				data = enc.encrypt(n, data)
+			}
+			fmt.Fprintf(&out, "%d 0 obj\n<< %s /Length %d >>\nstream\n", n, dict, len(data))
+			out.Write(data)
+			out.WriteString("\nendstream\nendobj\n")
+			return
+		}
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", n, b.objs[n-1])
+	}
+	trailer := fmt.Sprintf("/Root %d 0 R /ID [<%x> <%x>]", root, fixtureID, fixtureID)
+	if encNum > 0 {
+		trailer += fmt.Sprintf(" /Encrypt %d 0 R", encNum)
+	}
+
+	if !objStm {
+		for n := 1; n <= total; n++ {
+			writeObj(n)
+		}
+		xref := out.Len()
+		fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", total+1)
+		for n := 1; n <= total; n++ {
+			fmt.Fprintf(&out, "%010d 00000 n \n", offsets[n])
+		}
+		fmt.Fprintf(&out, "trailer\n<< /Size %d %s >>\nstartxref\n%d\n%%%%EOF\n", total+1, trailer, xref)
+		return out.Bytes()
+	}
+
+	stmNum, xrefNum := total+1, total+2
+	index := map[int]int{}
+	var head, body bytes.Buffer
+	for n := 1; n <= total; n++ {
+		if _, isStream := b.streamDicts[n]; isStream || n == encNum {
+			writeObj(n)
+			continue
+		}
+		index[n] = len(index)
+		fmt.Fprintf(&head, "%d %d ", n, body.Len())
+		body.WriteString(b.objs[n-1] + "\n")
+	}
+	data := deflate(append(head.Bytes(), body.Bytes()...))
+	if enc != nil {
+		data = enc.encrypt(stmNum, data)
+	}
+	offsets[stmNum] = out.Len()
+	fmt.Fprintf(&out, "%d 0 obj\n<< /Type /ObjStm /N %d /First %d /Filter /FlateDecode /Length %d >>\nstream\n", stmNum, len(index), head.Len(), len(data))
+	out.Write(data)
+	out.WriteString("\nendstream\nendobj\n")
+
+	xref := out.Len()
+	offsets[xrefNum] = xref
+	var rows bytes.Buffer
+	for n := 0; n <= xrefNum; n++ {
+		if i, ok := index[n]; ok {
+			rows.WriteByte(2)
+			binary.Write(&rows, binary.BigEndian, uint32(stmNum))
+			binary.Write(&rows, binary.BigEndian, uint16(i))
+			continue
+		}
+		if n == 0 {
+			rows.Write([]byte{0, 0, 0, 0, 0, 0xFF, 0xFF})
+			continue
+		}
+		rows.WriteByte(1)
+		binary.Write(&rows, binary.BigEndian, uint32(offsets[n]))
+		rows.Write([]byte{0, 0})
+	}
+	xdata := deflate(rows.Bytes())
+	fmt.Fprintf(&out, "%d 0 obj\n<< /Type /XRef /Size %d /W [1 4 2] %s /Filter /FlateDecode /Length %d >>\nstream\n", xrefNum, xrefNum+1, trailer, len(xdata))
+	out.Write(xdata)
+	fmt.Fprintf(&out, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", xref)
+	return out.Bytes()
+}
+
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+// textDocument adds two pages of text: a Helvetica page, and a page shown
+// rotated whose Vietnamese text uses an Identity-H font with a ToUnicode map.
+// It returns the catalog.
+func textDocument(b *pdfBuilder) int {
+	c1 := b.stream("/Filter /FlateDecode", deflate([]byte("BT /F1 12 Tf 72 720 Td (Hello World) Tj 0 -14 Td [(Second)-300(line \\(x\\))] TJ ET BT /F1 12 Tf 300 720 Td (right) Tj ET")))
+	viet := []rune("Tiếng Việt có dấu")
+	var bfchars, codes strings.Builder
+	for i, r := range viet {
+		fmt.Fprintf(&bfchars, "<%04x> <%04x>\n", i+1, r)
+		fmt.Fprintf(&codes, "%04x", i+1)
+	}
+	toUnicode := b.stream("", []byte(fmt.Sprintf("/CIDInit /ProcSet findresource begin 12 dict begin begincmap 1 begincodespacerange <0000> <FFFF> endcodespacerange %d beginbfchar\n%sendbfchar endcmap CMapName currentdict /CMap defineresource pop end end", len(viet), bfchars.String())))
+	cidFont := b.add("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /Arial /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /DW 500 >>")
+	f2 := b.add(fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /Arial /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>", cidFont, toUnicode))
+	f1 := b.add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	// The text runs up the page in user space and reads across once the page is turned
+	c2 := b.stream("", []byte(fmt.Sprintf("BT /F2 14 Tf 0 1 -1 0 100 72 Tm <%s> Tj ET BT /F1 10 Tf 0 1 -1 0 130 72 Tm (next line) Tj ET", codes.String())))
+	pages := b.next(2)
+	p1 := b.add(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /Contents %d 0 R >>", pages, c1))
+	p2 := b.add(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /Contents %d 0 R /Rotate 90 /Resources << /Font << /F1 %d 0 R /F2 %d 0 R >> >> >>", pages, c2, f1, f2))
+	b.add(fmt.Sprintf("<< /Type /Pages /Kids [%d 0 R %d 0 R] /Count 2 /Resources << /Font << /F1 %d 0 R >> >> /MediaBox [0 0 612 792] >>", p1, p2, f1))
+	return b.add(fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pages))
+}
+
+// scanDocument adds pages that are each one image: drawn as is, mirrored,
+// on a page shown rotated, a JPEG drawn turned, and an indexed image, plus a
+// page whose image is too small to be a scan. Each image is white with a
+// dark marker in its top left corner.
+func scanDocument(b *pdfBuilder) int {
+	var kids []string
+	pages := -1 // patched below, once known
+	addPage := func(img int, cm string, rotate int) {
+		c := b.stream("", []byte("q "+cm+" cm /Im Do Q"))
+		kids = append(kids, fmt.Sprintf("%d 0 R", b.add(fmt.Sprintf("<< /Type /Page /Parent PARENT /Contents %d 0 R /Rotate %d /Resources << /XObject << /Im %d 0 R >> >> >>", c, rotate, img))))
+	}
+
+	gray := bytes.Repeat([]byte{255}, 200*100)
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 20; x++ {
+			gray[y*200+x] = 0
+		}
+	}
+	g := b.stream("/Type /XObject /Subtype /Image /Width 200 /Height 100 /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode", deflate(gray))
+	addPage(g, "612 0 0 792 0 0", 0)
+	addPage(g, "-612 0 0 792 612 0", 0)
+	addPage(g, "612 0 0 792 0 0", 90)
+
+	rgb := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 64; x++ {
+			rgb.Set(x, y, color.White)
+			if x < 8 && y < 8 {
+				rgb.Set(x, y, color.RGBA{200, 0, 0, 255})
+			}
+		}
+	}
+	var jpg bytes.Buffer
+	jpeg.Encode(&jpg, rgb, &jpeg.Options{Quality: 90})
+	j := b.stream("/Type /XObject /Subtype /Image /Width 64 /Height 32 /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode", jpg.Bytes())
+	addPage(j, "0 -612 792 0 0 612", 0)
+
+	// 16x2 pixels of 1 bit: the first four of the top row use color 0, red
+	idx := b.stream("/Type /XObject /Subtype /Image /Width 16 /Height 2 /ColorSpace [/Indexed /DeviceRGB 1 <FF0000FFFFFF>] /BitsPerComponent 1", []byte{0x0F, 0xFF, 0xFF, 0xFF})
+	addPage(idx, "612 0 0 792 0 0", 0)
+	addPage(idx, "100 0 0 100 0 0", 0)
+
+	pages = b.add(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d /MediaBox [0 0 612 792] >>", strings.Join(kids, " "), len(kids)))
+	for i := range b.objs {
+		b.objs[i] = strings.ReplaceAll(b.objs[i], "PARENT", fmt.Sprintf("%d 0 R", pages))
+	}
+	return b.add(fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pages))
+}
+
+// mixedDocument adds a page of text, a scanned page and a page with only
+// vector drawing
+func mixedDocument(b *pdfBuilder) int {
+	f1 := b.add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	var text strings.Builder
+	text.WriteString("BT /F1 10 Tf 12 TL 50 750 Td ")
+	for i := 1; i <= 55; i++ {
+		fmt.Fprintf(&text, "(Line %d of a page of text.) ' ", i)
+	}
+	text.WriteString("ET")
+	c1 := b.stream("/Filter /FlateDecode", deflate([]byte(text.String())))
+	g := b.stream("/Type /XObject /Subtype /Image /Width 100 /Height 100 /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode", deflate(make([]byte, 100*100)))
+	c2 := b.stream("", []byte("q 612 0 0 792 0 0 cm /Im Do Q"))
+	c3 := b.stream("", []byte("0 0 m 100 100 l S"))
+	pages := b.next(3)
+	p1 := b.add(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /Contents %d 0 R /Resources << /Font << /F1 %d 0 R >> >> >>", pages, c1, f1))
+	p2 := b.add(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /Contents %d 0 R /Resources << /XObject << /Im %d 0 R >> >> >>", pages, c2, g))
+	p3 := b.add(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /Contents %d 0 R >>", pages, c3))
+	b.add(fmt.Sprintf("<< /Type /Pages /Kids [%d 0 R %d 0 R %d 0 R] /Count 3 /MediaBox [0 0 595 842] >>", p1, p2, p3))
+	return b.add(fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pages))
+}
+
+// standardPadding pads passwords in the standard security handler
+var standardPadding = []byte{
+	0x28, 0xBF, 0x4E, 0x5E, 0x4E, 0x75, 0x8A, 0x41, 0x64, 0x00, 0x4E, 0x56, 0xFF, 0xFA, 0x01, 0x08,
+	0x2E, 0x2E, 0x00, 0xB6, 0xD0, 0x68, 0x3E, 0x80, 0x2F, 0x0C, 0xA9, 0xFE, 0x64, 0x53, 0x69, 0x7A,
+}
+
+func padded(password string) []byte {
+	return append([]byte(password), standardPadding...)[:32]
+}
+
+func rc4Apply(key, data []byte) []byte {
+	c, _ := rc4.NewCipher(key)
+	out := make([]byte, len(data))
+	c.XORKeyStream(out, data)
+	return out
+}
+
+// rc4Rounds applies RC4 with the key XORed with each of 0 to 19 in turn,
+// as revision 3 does
+func rc4Rounds(key, data []byte) []byte {
+	for i := 0; i < 20; i++ {
+		k := make([]byte, len(key))
+		for j := range key {
+			k[j] = key[j] ^ byte(i)
+		}
+		data = rc4Apply(k, data)
+	}
+	return data
+}
+
+// rc4Encryption is 128-bit RC4 encryption, revision 3 (algorithms 2 to 5 of
+// the PDF specification)
+func rc4Encryption(user, owner string) *encryption {
+	ownerKey := md5.Sum(padded(owner))
+	k := ownerKey[:]
+	for i := 0; i < 50; i++ {
+		sum := md5.Sum(k)
+		k = sum[:]
+	}
+	o := rc4Rounds(k, padded(user))
+
+	p := int32(-3904)
+	h := md5.New()
+	h.Write(padded(user))
+	h.Write(o)
+	binary.Write(h, binary.LittleEndian, p)
+	h.Write(fixtureID)
+	key := h.Sum(nil)
+	for i := 0; i < 50; i++ {
+		sum := md5.Sum(key[:16])
+		key = sum[:]
+	}
+	key = key[:16]
+
+	h = md5.New()
+	h.Write(standardPadding)
+	h.Write(fixtureID)
+	u := append(rc4Rounds(key, h.Sum(nil)), make([]byte, 16)...)
+
+	return &encryption{
+		dict: fmt.Sprintf("<< /Filter /Standard /V 2 /R 3 /Length 128 /O <%x> /U <%x> /P %d >>", o, u, p),
+		encrypt: func(num int, data []byte) []byte {
+			h := md5.New()
+			h.Write(key)
+			h.Write([]byte{byte(num), byte(num >> 8), byte(num >> 16), 0, 0})
+			return rc4Apply(h.Sum(nil), data)
+		},
+	}
+}
+
+// revision6Hash is algorithm 2.B of ISO 32000-2, for the empty user password
+func revision6Hash(password, salt []byte) []byte {
+	sum := sha256.Sum256(append(append([]byte{}, password...), salt...))
+	k := sum[:]
+	for round := 0; ; round++ {
+		k1 := bytes.Repeat(append(append([]byte{}, password...), k...), 64)
+		block, _ := aes.NewCipher(k[:16])
+		e := make([]byte, len(k1))
+		cipher.NewCBCEncrypter(block, k[16:32]).CryptBlocks(e, k1)
+		n := 0
+		for _, x := range e[:16] {
+			n += int(x)
+		}
+		var h hash.Hash
+		switch n % 3 {
+		case 0:
+			h = sha256.New()
+		case 1:
+			h = sha512.New384()
+		default:
+			h = sha512.New()
+		}
+		h.Write(e)
+		k = h.Sum(nil)
+		if round >= 63 && int(e[len(e)-1]) <= round-31 {
+			break
+		}
+	}
+	return k[:32]
+}
+
+// aes256Encryption is AES-256 encryption, revision 6, with an empty user password
+func aes256Encryption() *encryption {
+	fileKey := []byte("0123456789abcdef0123456789abcdef")
+	validationSalt, keySalt := []byte("vsalt123"), []byte("ksalt123")
+	u := append(append(revision6Hash(nil, validationSalt), validationSalt...), keySalt...)
+	block, _ := aes.NewCipher(revision6Hash(nil, keySalt))
+	ue := make([]byte, 32)
+	cipher.NewCBCEncrypter(block, make([]byte, 16)).CryptBlocks(ue, fileKey)
+	return &encryption{
+		dict: fmt.Sprintf("<< /Filter /Standard /V 5 /R 6 /Length 256 /CF << /StdCF << /CFM /AESV3 /Length 32 >> >> /StmF /StdCF /StrF /StdCF /O <%x> /U <%x> /OE <%x> /UE <%x> /P -4 >>",
+			make([]byte, 48), u, make([]byte, 32), ue),
+		encrypt: func(num int, data []byte) []byte {
+			iv := []byte("0000111122223333")
+			n := 16 - len(data)%16
+			data = append(append([]byte{}, data...), bytes.Repeat([]byte{byte(n)}, n)...)
+			block, _ := aes.NewCipher(fileKey)
+			out := make([]byte, len(data))
+			cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, data)
+			return append(iv, out...)
+		},
+	}
+}
+
+// fixtures are the files in testdata, by name
+func fixtures() map[string][]byte {
+	build := func(document func(*pdfBuilder) int, enc *encryption, objStm bool) []byte {
+		b := newPDFBuilder()
+		return b.build(document(b), enc, objStm)
+	}
+	text := build(textDocument, nil, false)
+	return map[string][]byte{
+		"text.pdf":             text,
+		"scan.pdf":             build(scanDocument, nil, false),
+		"mixed.pdf":            build(mixedDocument, nil, false),
+		"object_streams.pdf":   build(textDocument, nil, true),
+		"broken_xref.pdf":      bytes.Replace(text, []byte("startxref\n"), []byte("startxref\n9"), 1),
+		"encrypted_rc4.pdf":    build(textDocument, rc4Encryption("", "owner"), false),
+		"encrypted_aes256.pdf": build(textDocument, aes256Encryption(), true),
+		"password.pdf":         build(textDocument, rc4Encryption("secret", "owner"), false),
+	}
+}
+
+// writeFixtures regenerates the files in testdata
+func writeFixtures() error {
+	for name, data := range fixtures() {
+		if err := os.WriteFile(filepath.Join("testdata", name), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,316 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"math"
+
+	"golang.org/x/image/ccitt"
+)
+
+// ErrNoScan is returned by ScanImage for pages without an image covering
+// most of the page
+var ErrNoScan = errors.New("pdf: page is not a scanned image")
+
+// maxImagePixels caps the size of the images decoded
+const maxImagePixels = 1 << 28
+
+// ScanImage returns the image of a scanned page: the largest image drawn on
+// it, if it covers at least half of the page, turned the way the page is
+// shown. Text and other drawing on the page are not included. Images
+// compressed with JPEG 2000 or JBIG2 aren't supported.
+func (p *Page) ScanImage() (image.Image, error) {
+	c := p.interpret()
+	var scan *placedImage
+	for i := range c.images {
+		if scan == nil || c.images[i].area > scan.area {
+			scan = &c.images[i]
+		}
+	}
+	if scan == nil || scan.area < minScanCoverage*p.Width*p.Height {
+		if c.err != nil {
+			return nil, c.err
+		}
+		return nil, ErrNoScan
+	}
+	img, err := p.doc.decodeImage(scan.image)
+	if err != nil {
+		return nil, err
+	}
+	return orientImage(img, scan.ctm), nil
+}
+
+// colorSpace is what decodeImage needs to know of an image color space
+type colorSpace struct {
+	kind   string // "gray", "rgb", "cmyk", "indexed" or "tint"
+	comps  int
+	base   *colorSpace // of indexed color spaces
+	lookup []byte      // palette of indexed color spaces
+}
+
+// colorSpace reads an image color space; unknown ones are taken for gray
+func (d *Document) colorSpace(o object, depth int) *colorSpace {
+	gray := &colorSpace{kind: "gray", comps: 1}
+	o = d.resolveQuiet(o)
+	var family name
+	var arr array
+	switch v := o.(type) {
+	case name:
+		family = v
+	case array:
+		if len(v) == 0 {
+			return gray
+		}
+		family, _ = d.resolveQuiet(v[0]).(name)
+		arr = v
+	}
+	switch family {
+	case "DeviceRGB", "RGB", "CalRGB", "Lab":
+		return &colorSpace{kind: "rgb", comps: 3}
+	case "DeviceCMYK", "CMYK":
+		return &colorSpace{kind: "cmyk", comps: 4}
+	case "ICCBased":
+		if len(arr) > 1 {
+			if s, ok := d.resolveQuiet(arr[1]).(*stream); ok {
+				switch intValue(d.resolveQuiet(s.dict["N"])) {
+				case 3:
+					return &colorSpace{kind: "rgb", comps: 3}
+				case 4:
+					return &colorSpace{kind: "cmyk", comps: 4}
+				}
+			}
+		}
+	case "Indexed", "I":
+		if len(arr) < 4 || depth > 0 {
+			return gray
+		}
+		cs := &colorSpace{kind: "indexed", comps: 1, base: d.colorSpace(arr[1], depth+1)}
+		switch lookup := d.resolveQuiet(arr[3]).(type) {
+		case pdfString:
+			cs.lookup = []byte(lookup)
+		case *stream:
+			cs.lookup, _ = d.decodeStream(lookup)
+		}
+		return cs
+	case "Separation", "DeviceN":
+		comps := 1
+		if family == "DeviceN" && len(arr) > 1 {
+			if names, ok := d.resolveQuiet(arr[1]).(array); ok {
+				comps = max(1, len(names))
+			}
+		}
+		return &colorSpace{kind: "tint", comps: comps}
+	}
+	return gray
+}
+
+// decodeImage decodes an image XObject or inline image into an *image.Gray
+// or *image.RGBA, or whatever image/jpeg returns for JPEG images
+func (d *Document) decodeImage(s *stream) (image.Image, error) {
+	data, filter, parms, err := d.decodeFilters(s)
+	if err != nil {
+		return nil, err
+	}
+	w := intValue(d.resolveQuiet(s.dict["Width"]))
+	h := intValue(d.resolveQuiet(s.dict["Height"]))
+	if w <= 0 || h <= 0 || w*h > maxImagePixels {
+		return nil, fmt.Errorf("pdf: bad image size %dx%d", w, h)
+	}
+	isMask, _ := d.resolveQuiet(s.dict["ImageMask"]).(bool)
+	bpc := intValue(d.resolveQuiet(s.dict["BitsPerComponent"]))
+	if bpc == 0 || isMask {
+		bpc = 1
+	}
+	inverted := false // a /Decode [1 0] on the first component
+	if dec, ok := d.resolveQuiet(s.dict["Decode"]).(array); ok && len(dec) >= 2 {
+		inverted = numberValue(d.resolveQuiet(dec[0])) > numberValue(d.resolveQuiet(dec[1]))
+	}
+
+	switch filter {
+	case "":
+	case "DCTDecode", "DCT":
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("pdf: JPEG image: %w", err)
+		}
+		if gray, ok := img.(*image.Gray); ok && inverted {
+			for i := range gray.Pix {
+				gray.Pix[i] = 255 - gray.Pix[i]
+			}
+		}
+		return img, nil
+	case "CCITTFaxDecode", "CCF":
+		k := intValue(d.resolveQuiet(parms["K"]))
+		if k > 0 {
+			return nil, errors.New("pdf: CCITT Group 3 2-D images are not supported")
+		}
+		subFormat := ccitt.Group3
+		if k < 0 {
+			subFormat = ccitt.Group4
+		}
+		columns := intValue(d.resolveQuiet(parms["Columns"]))
+		if columns <= 0 {
+			columns = 1728
+		}
+		blackIs1, _ := d.resolveQuiet(parms["BlackIs1"]).(bool)
+		align, _ := d.resolveQuiet(parms["EncodedByteAlign"]).(bool)
+		// The reader gives 1 for white; BlackIs1 wants 1 for black
+		r := ccitt.NewReader(bytes.NewReader(data), ccitt.MSB, subFormat, columns, h, &ccitt.Options{Align: align, Invert: blackIs1})
+		data, err = io.ReadAll(r)
+		if err != nil && len(data) == 0 {
+			return nil, fmt.Errorf("pdf: CCITT image: %w", err)
+		}
+		w, bpc = columns, 1
+	default:
+		return nil, fmt.Errorf("pdf: %s images are not supported", filter)
+	}
+
+	cs := &colorSpace{kind: "gray", comps: 1}
+	if !isMask {
+		cs = d.colorSpace(s.dict["ColorSpace"], 0)
+	}
+	if bpc != 1 && bpc != 2 && bpc != 4 && bpc != 8 && (bpc != 16 || cs.kind == "indexed") {
+		return nil, fmt.Errorf("pdf: unsupported image depth of %d bits", bpc)
+	}
+	rowLen := (w*cs.comps*bpc + 7) / 8
+	if len(data) < rowLen*h {
+		// Truncated data: the missing rows stay white
+		data = append(data, bytes.Repeat([]byte{0xFF}, rowLen*h-len(data))...)
+	}
+	maxValue := float64(int(1)<<bpc - 1)
+	sample := func(row []byte, i int) byte {
+		switch bpc {
+		case 8:
+			return row[i]
+		case 16:
+			return row[2*i]
+		}
+		bit := i * bpc
+		v := row[bit/8] >> (8 - bpc - bit%8) & byte(1<<bpc-1)
+		return byte(math.Round(float64(v) * 255 / maxValue))
+	}
+
+	switch cs.kind {
+	case "gray", "tint":
+		img := image.NewGray(image.Rect(0, 0, w, h))
+		invert := inverted != (cs.kind == "tint") // tints darken as they grow
+		for y := 0; y < h; y++ {
+			row := data[y*rowLen:]
+			for x := 0; x < w; x++ {
+				v := sample(row, x*cs.comps)
+				if invert {
+					v = 255 - v
+				}
+				img.Pix[y*img.Stride+x] = v
+			}
+		}
+		return img, nil
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	samples := make([]byte, cs.comps)
+	for y := 0; y < h; y++ {
+		row := data[y*rowLen:]
+		for x := 0; x < w; x++ {
+			px := img.Pix[y*img.Stride+4*x:]
+			var c []byte
+			kind := cs.kind
+			if kind == "indexed" {
+				index := int(row[x*bpc/8] >> (8 - bpc - x*bpc%8) & byte(1<<bpc-1))
+				n := cs.base.comps
+				if (index+1)*n > len(cs.lookup) {
+					c = []byte{0, 0, 0, 0}[:n]
+				} else {
+					c = cs.lookup[index*n : (index+1)*n]
+				}
+				kind = cs.base.kind
+			} else {
+				c = samples
+				for i := range c {
+					c[i] = sample(row, x*cs.comps+i)
+				}
+			}
+			switch kind {
+			case "rgb":
+				px[0], px[1], px[2] = c[0], c[1], c[2]
+			case "cmyk":
+				k := 255 - int(c[3])
+				px[0] = byte((255 - int(c[0])) * k / 255)
+				px[1] = byte((255 - int(c[1])) * k / 255)
+				px[2] = byte((255 - int(c[2])) * k / 255)
+			default:
+				px[0], px[1], px[2] = c[0], c[0], c[0]
+			}
+			px[3] = 0xFF
+		}
+	}
+	return img, nil
+}
+
+// orientImage turns and flips an image drawn with the matrix m, which maps
+// the unit square to the page as shown, so it reads the way it appears on
+// the page. Image rows run from the top of the unit square (y = 1) down.
+func orientImage(img image.Image, m matrix) image.Image {
+	// Directions on the page of the image's columns (x) and rows (down)
+	xx, xy := m[0], m[1]
+	dx, dy := -m[2], -m[3]
+	transpose := math.Abs(xx) < math.Abs(xy)
+	var flipX, flipY bool
+	if transpose {
+		flipX, flipY = dx < 0, xy > 0
+	} else {
+		flipX, flipY = xx < 0, dy > 0
+	}
+	if !transpose && !flipX && !flipY {
+		return img
+	}
+
+	var pix []byte
+	var stride, bpp int
+	b := img.Bounds()
+	switch src := img.(type) {
+	case *image.Gray:
+		pix, stride, bpp = src.Pix[src.PixOffset(b.Min.X, b.Min.Y):], src.Stride, 1
+	default:
+		rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+		pix, stride, bpp = rgba.Pix, rgba.Stride, 4
+	}
+	w, h := b.Dx(), b.Dy()
+	ow, oh := w, h
+	if transpose {
+		ow, oh = h, w
+	}
+	var out image.Image
+	var outPix []byte
+	var outStride int
+	if bpp == 1 {
+		g := image.NewGray(image.Rect(0, 0, ow, oh))
+		out, outPix, outStride = g, g.Pix, g.Stride
+	} else {
+		c := image.NewRGBA(image.Rect(0, 0, ow, oh))
+		out, outPix, outStride = c, c.Pix, c.Stride
+	}
+	for y := 0; y < oh; y++ {
+		for x := 0; x < ow; x++ {
+			fx, fy := x, y
+			if flipX {
+				fx = ow - 1 - x
+			}
+			if flipY {
+				fy = oh - 1 - y
+			}
+			sx, sy := fx, fy
+			if transpose {
+				sx, sy = fy, fx
+			}
+			copy(outPix[y*outStride+x*bpp:y*outStride+(x+1)*bpp], pix[sy*stride+sx*bpp:])
+		}
+	}
+	return out
+}
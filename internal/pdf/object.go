@@ -0,0 +1,388 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// PDF objects are represented as nil (null), bool, int64, float64,
+// pdfString, name, array, dict, *stream and ref. Content stream operators
+// are keywords.
+type (
+	object    interface{}
+	name      string
+	pdfString string
+	keyword   string
+	array     []object
+	dict      map[name]object
+)
+
+// ref is an indirect reference such as "12 0 R"
+type ref struct {
+	num, gen int
+}
+
+// stream is a dictionary followed by binary data, still encoded
+type stream struct {
+	dict dict
+	data []byte
+	ref  ref // the object the stream belongs to, for decryption
+}
+
+var errSyntax = errors.New("pdf: syntax error")
+
+// lexer reads PDF tokens and objects from a byte slice
+type lexer struct {
+	data []byte
+	pos  int
+	// length resolves indirect stream /Length values; nil means scanning for endstream
+	length func(object) (int, bool)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == 0
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// skipSpace skips white space and comments
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// regular reads a run of regular characters, such as a number or keyword
+func (l *lexer) regular() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isSpace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+// object reads the next object. Numbers followed by "gen R" become references,
+// and dictionaries followed by "stream" become streams.
+func (l *lexer) object() (object, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, errSyntax
+	}
+	switch c := l.data[l.pos]; c {
+	case '/':
+		l.pos++
+		return l.name(), nil
+	case '(':
+		l.pos++
+		return l.literalString(), nil
+	case '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			d, err := l.dict()
+			if err != nil {
+				return nil, err
+			}
+			return l.maybeStream(d)
+		}
+		l.pos++
+		return l.hexString(), nil
+	case '[':
+		l.pos++
+		var arr array
+		for {
+			l.skipSpace()
+			if l.pos >= len(l.data) {
+				return nil, errSyntax
+			}
+			if l.data[l.pos] == ']' {
+				l.pos++
+				return arr, nil
+			}
+			o, err := l.object()
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, o)
+		}
+	case ']', '>', ')', '{', '}':
+		l.pos++
+		return keyword(string(c)), nil
+	}
+
+	tok := l.regular()
+	if tok == "" {
+		l.pos++
+		return nil, errSyntax
+	}
+	switch tok {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if n, err := strconv.ParseInt(tok, 10, 64); err == nil {
+		// A reference is "num gen R"
+		save := l.pos
+		l.skipSpace()
+		if gen, err := strconv.Atoi(l.regular()); err == nil && gen >= 0 {
+			l.skipSpace()
+			if l.pos < len(l.data) && l.data[l.pos] == 'R' && (l.pos+1 == len(l.data) || isSpace(l.data[l.pos+1]) || isDelimiter(l.data[l.pos+1])) {
+				l.pos++
+				return ref{num: int(n), gen: gen}, nil
+			}
+		}
+		l.pos = save
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(tok, 64); err == nil {
+		return f, nil
+	}
+	if tok[0] == '-' || tok[0] == '+' || tok[0] == '.' || (tok[0] >= '0' && tok[0] <= '9') {
+		// Malformed numbers such as "--5" or "0.5.1" occur in the wild
+		if f, err := strconv.ParseFloat(leadingNumber(tok), 64); err == nil {
+			return f, nil
+		}
+		return 0.0, nil
+	}
+	return keyword(tok), nil
+}
+
+// leadingNumber keeps the sign and digits of a malformed number up to the
+// first character that can't continue it, dropping repeated signs
+func leadingNumber(tok string) string {
+	var b []byte
+	dot := false
+	for i := 0; i < len(tok); i++ {
+		c := tok[i]
+		switch {
+		case (c == '-' || c == '+') && len(b) == 0:
+			b = append(b, c)
+		case c == '.' && !dot:
+			dot = true
+			b = append(b, c)
+		case c >= '0' && c <= '9':
+			b = append(b, c)
+		case c == '-' || c == '+':
+			continue
+		default:
+			return string(b)
+		}
+	}
+	return string(b)
+}
+
+func (l *lexer) name() name {
+	start := l.pos
+	for l.pos < len(l.data) && !isSpace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	raw := l.data[start:l.pos]
+	if bytes.IndexByte(raw, '#') < 0 {
+		return name(raw)
+	}
+	var b []byte
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && i+2 < len(raw) {
+			if v, err := strconv.ParseUint(string(raw[i+1:i+3]), 16, 8); err == nil {
+				b = append(b, byte(v))
+				i += 2
+				continue
+			}
+		}
+		b = append(b, raw[i])
+	}
+	return name(b)
+}
+
+func (l *lexer) literalString() pdfString {
+	var b []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return pdfString(b)
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return pdfString(b)
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return pdfString(b)
+}
+
+func (l *lexer) hexString() pdfString {
+	var b []byte
+	var hi byte
+	odd := false
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		if c == '>' {
+			break
+		}
+		v, ok := hexValue(c)
+		if !ok {
+			continue
+		}
+		if odd {
+			b = append(b, hi<<4|v)
+		} else {
+			hi = v
+		}
+		odd = !odd
+	}
+	if odd {
+		b = append(b, hi<<4)
+	}
+	return pdfString(b)
+}
+
+func hexValue(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// dict reads dictionary entries up to ">>"
+func (l *lexer) dict() (dict, error) {
+	d := dict{}
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.data) {
+			return nil, errSyntax
+		}
+		if l.data[l.pos] == '>' {
+			l.pos++
+			if l.pos < len(l.data) && l.data[l.pos] == '>' {
+				l.pos++
+			}
+			return d, nil
+		}
+		key, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		k, ok := key.(name)
+		if !ok {
+			continue // skip junk between entries
+		}
+		value, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		if kw, ok := value.(keyword); ok && (kw == ">" || kw == "]") {
+			continue
+		}
+		d[k] = value
+	}
+}
+
+// maybeStream turns a dictionary followed by the stream keyword into a stream
+func (l *lexer) maybeStream(d dict) (object, error) {
+	save := l.pos
+	l.skipSpace()
+	if !bytes.HasPrefix(l.data[l.pos:], []byte("stream")) {
+		l.pos = save
+		return d, nil
+	}
+	l.pos += len("stream")
+	// The keyword is followed by CRLF or LF
+	if l.pos < len(l.data) && l.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+		l.pos++
+	}
+	start := l.pos
+
+	if l.length != nil {
+		if n, ok := l.length(d["Length"]); ok && n >= 0 && start+n <= len(l.data) {
+			rest := l.data[start+n:]
+			trimmed := bytes.TrimLeft(rest, " \t\r\n\f\x00")
+			if bytes.HasPrefix(trimmed, []byte("endstream")) {
+				l.pos = start + n + (len(rest) - len(trimmed)) + len("endstream")
+				return &stream{dict: d, data: l.data[start : start+n]}, nil
+			}
+		}
+	}
+	// A missing or wrong /Length: the data runs to endstream
+	end := bytes.Index(l.data[start:], []byte("endstream"))
+	if end < 0 {
+		return nil, fmt.Errorf("%w: stream without endstream", errSyntax)
+	}
+	data := l.data[start : start+end]
+	l.pos = start + end + len("endstream")
+	if n := len(data); n > 0 && data[n-1] == '\n' {
+		data = data[:n-1]
+		if n := len(data); n > 0 && data[n-1] == '\r' {
+			data = data[:n-1]
+		}
+	}
+	return &stream{dict: d, data: data}, nil
+}
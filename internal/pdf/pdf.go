@@ -0,0 +1,324 @@
+// Package pdf reads PDF files in pure Go: the page count and sizes, whether
+// the file is encrypted, the text layer of each page, and the scanned image
+// of pages that are just a scan. It doesn't render pages; Poppler stays the
+// faster and more faithful choice when it is installed, and this package is
+// what the extractor falls back on when it isn't.
+//
+// Files encrypted with an empty user password, which open without a password
+// and only restrict printing or copying, are decrypted (RC4 and AES, up to
+// revision 6). Damaged cross-reference tables are rebuilt by scanning the
+// file for objects.
+//
+// A Document is not safe for concurrent use.
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+)
+
+// Errors returned by Open and Parse
+var (
+	ErrNotPDF    = errors.New("pdf: not a PDF file")
+	ErrEncrypted = errors.New("pdf: encrypted")
+)
+
+// maxResolveDepth bounds chains of references and nested page trees
+const maxResolveDepth = 64
+
+// Document is a parsed PDF file
+type Document struct {
+	// Encrypted is true for encrypted files, including those that open
+	// without a password and were decrypted
+	Encrypted bool
+	// Version is the PDF version from the header, e.g. "1.7"
+	Version string
+	Pages   []*Page
+
+	data      []byte
+	xref      map[int]xrefEntry
+	objStms   map[int]*objStm
+	cache     map[int]object
+	resolving map[int]bool
+	crypt     *decrypter
+	fonts     map[ref]*font
+}
+
+// Page is a page of a Document
+type Page struct {
+	Number int // 1-based
+	// Width and Height are the size of the visible page in points, as shown,
+	// i.e. after Rotate
+	Width, Height float64
+	// Rotate is the clockwise rotation of the page when shown: 0, 90, 180 or 270
+	Rotate int
+
+	doc       *Document
+	dict      dict
+	resources dict
+	box       [4]float64 // crop box in default user space
+	content   *pageContent
+}
+
+// Open reads and parses the PDF file at path. Password-protected files fail
+// with an error wrapping ErrEncrypted, returned along with the Document,
+// whose pages may be missing.
+func Open(path string) (*Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse parses a PDF file held in memory
+func Parse(data []byte) (*Document, error) {
+	header := bytes.Index(data[:min(len(data), 1024)], []byte("%PDF-"))
+	if header < 0 {
+		return nil, ErrNotPDF
+	}
+	d := &Document{
+		data:      data,
+		xref:      map[int]xrefEntry{},
+		objStms:   map[int]*objStm{},
+		cache:     map[int]object{},
+		resolving: map[int]bool{},
+		fonts:     map[ref]*font{},
+	}
+	if end := bytes.IndexAny(data[header+5:min(len(data), header+10)], "\r\n %"); end > 0 {
+		d.Version = string(data[header+5 : header+5+end])
+	}
+
+	trailer, err := d.readXref()
+	if err != nil {
+		if trailer, err = d.reconstructXref(); err != nil {
+			return nil, err
+		}
+	}
+	encryptErr := d.initEncryption(trailer)
+	catalog, ok := d.resolveQuiet(trailer["Root"]).(dict)
+	if !ok && encryptErr == nil {
+		// The xref is broken: rebuild it from the objects in the file
+		if trailer, err = d.reconstructXref(); err != nil {
+			return nil, err
+		}
+		encryptErr = d.initEncryption(trailer)
+		catalog, _ = d.resolveQuiet(trailer["Root"]).(dict)
+	}
+	if encryptErr != nil {
+		// The pages may be unreadable, but the caller learns the file is encrypted
+		d.loadPages(catalog["Pages"], nil, 0)
+		return d, encryptErr
+	}
+	if catalog == nil {
+		return nil, fmt.Errorf("%w: no document catalog", errSyntax)
+	}
+	if err := d.loadPages(catalog["Pages"], nil, 0); err != nil && len(d.Pages) == 0 {
+		return nil, err
+	}
+	return d, nil
+}
+
+// initEncryption sets up the decryption of an encrypted file from the
+// /Encrypt dictionary of its trailer
+func (d *Document) initEncryption(trailer dict) error {
+	encrypt, ok := d.resolveQuiet(trailer["Encrypt"]).(dict)
+	if !ok {
+		return nil
+	}
+	d.Encrypted = true
+	for k, v := range encrypt {
+		encrypt[k] = d.resolveQuiet(v)
+	}
+	var id []byte
+	if ids, ok := d.resolveQuiet(trailer["ID"]).(array); ok && len(ids) > 0 {
+		id = []byte(stringValue(d.resolveQuiet(ids[0])))
+	}
+	var err error
+	d.crypt, err = newDecrypter(encrypt, id)
+	// Objects read so far were not decrypted
+	d.cache = map[int]object{}
+	d.objStms = map[int]*objStm{}
+	return err
+}
+
+// inherited holds the page attributes a page inherits from its ancestors
+type inherited struct {
+	resources dict
+	mediaBox  object
+	cropBox   object
+	rotate    object
+}
+
+// loadPages walks the page tree, appending its pages in order
+func (d *Document) loadPages(node object, parent *inherited, depth int) error {
+	if depth > maxResolveDepth {
+		return fmt.Errorf("%w: page tree too deep", errSyntax)
+	}
+	r, isRef := node.(ref)
+	n, ok := d.resolveQuiet(node).(dict)
+	if !ok {
+		return fmt.Errorf("%w: bad page tree node", errSyntax)
+	}
+	attrs := inherited{}
+	if parent != nil {
+		attrs = *parent
+	}
+	if res, ok := d.resolveQuiet(n["Resources"]).(dict); ok {
+		attrs.resources = res
+	}
+	for key, field := range map[name]*object{"MediaBox": &attrs.mediaBox, "CropBox": &attrs.cropBox, "Rotate": &attrs.rotate} {
+		if v, ok := n[key]; ok {
+			*field = d.resolveQuiet(v)
+		}
+	}
+
+	kids, isTree := d.resolveQuiet(n["Kids"]).(array)
+	if n["Type"] == name("Page") || (!isTree && n["Type"] != name("Pages")) {
+		d.Pages = append(d.Pages, d.newPage(len(d.Pages)+1, n, attrs))
+		return nil
+	}
+	if isRef {
+		if d.resolving[-r.num-1] {
+			return fmt.Errorf("%w: page tree cycle", errSyntax)
+		}
+		d.resolving[-r.num-1] = true // negative keys mark page tree nodes in progress
+		defer delete(d.resolving, -r.num-1)
+	}
+	var firstErr error
+	for _, kid := range kids {
+		if err := d.loadPages(kid, &attrs, depth+1); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (d *Document) newPage(number int, n dict, attrs inherited) *Page {
+	p := &Page{Number: number, doc: d, dict: n, resources: attrs.resources}
+	p.box = [4]float64{0, 0, 612, 792} // US Letter, the default
+	if box, ok := rectangle(d, attrs.mediaBox); ok {
+		p.box = box
+	}
+	if box, ok := rectangle(d, attrs.cropBox); ok {
+		// The crop box is clipped to the media box
+		p.box = [4]float64{max(box[0], p.box[0]), max(box[1], p.box[1]), min(box[2], p.box[2]), min(box[3], p.box[3])}
+		if p.box[2] <= p.box[0] || p.box[3] <= p.box[1] {
+			p.box, _ = rectangle(d, attrs.mediaBox)
+		}
+	}
+	p.Rotate = ((int(numberValue(attrs.rotate))%360 + 360) % 360) / 90 * 90
+	p.Width, p.Height = p.box[2]-p.box[0], p.box[3]-p.box[1]
+	if p.Rotate == 90 || p.Rotate == 270 {
+		p.Width, p.Height = p.Height, p.Width
+	}
+	return p
+}
+
+// rectangle reads a rectangle [x1 y1 x2 y2], normalized so x1 < x2 and y1 < y2
+func rectangle(d *Document, o object) ([4]float64, bool) {
+	arr, ok := d.resolveQuiet(o).(array)
+	if !ok || len(arr) < 4 {
+		return [4]float64{}, false
+	}
+	var r [4]float64
+	for i := range r {
+		r[i] = numberValue(d.resolveQuiet(arr[i]))
+	}
+	r = [4]float64{math.Min(r[0], r[2]), math.Min(r[1], r[3]), math.Max(r[0], r[2]), math.Max(r[1], r[3])}
+	return r, r[2] > r[0] && r[3] > r[1]
+}
+
+// resolve follows a reference to the object it points to; other objects are
+// returned as they are. Missing objects resolve to null.
+func (d *Document) resolve(o object) (object, error) {
+	for depth := 0; depth < maxResolveDepth; depth++ {
+		r, ok := o.(ref)
+		if !ok {
+			return o, nil
+		}
+		if cached, ok := d.cache[r.num]; ok {
+			o = cached
+			continue
+		}
+		if d.resolving[r.num] {
+			return nil, fmt.Errorf("%w: reference cycle at object %d", errSyntax, r.num)
+		}
+		d.resolving[r.num] = true
+		obj, err := d.load(r)
+		delete(d.resolving, r.num)
+		if err != nil {
+			return nil, err
+		}
+		d.cache[r.num] = obj
+		o = obj
+	}
+	return nil, fmt.Errorf("%w: reference chain too long", errSyntax)
+}
+
+// resolveQuiet is resolve for callers that treat broken objects as null
+func (d *Document) resolveQuiet(o object) object {
+	obj, err := d.resolve(o)
+	if err != nil {
+		return nil
+	}
+	return obj
+}
+
+// load reads object r from the file or its object stream
+func (d *Document) load(r ref) (object, error) {
+	entry, ok := d.xref[r.num]
+	if !ok || (!entry.inStream && entry.offset < 0) {
+		return nil, nil
+	}
+	if entry.inStream {
+		objs, err := d.objectStream(entry.streamNum)
+		if err != nil {
+			return nil, err
+		}
+		if entry.index >= len(objs.offsets) {
+			return nil, nil
+		}
+		l := &lexer{data: objs.data, pos: objs.first + objs.offsets[entry.index], length: d.streamLength}
+		return l.object()
+	}
+	obj, err := d.parseIndirect(entry.offset)
+	if err != nil {
+		return nil, err
+	}
+	if d.crypt != nil {
+		obj = d.crypt.decryptStrings(r, obj)
+		if s, ok := obj.(*stream); ok {
+			s.ref = r
+		}
+	}
+	return obj, nil
+}
+
+func intValue(o object) int {
+	switch v := o.(type) {
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+func numberValue(o object) float64 {
+	switch v := o.(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
+
+func stringValue(o object) string {
+	s, _ := o.(pdfString)
+	return string(s)
+}
@@ -0,0 +1,243 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "regenerate the PDF files in testdata")
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if *update {
+		if err := writeFixtures(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	os.Exit(m.Run())
+}
+
+func openFixture(t *testing.T, name string) *Document {
+	t.Helper()
+	d, err := Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return d
+}
+
+// The two pages of textDocument
+var textPages = []string{
+	"Hello World                           right\nSecond line (x)",
+	"Tiếng Việt có dấu\n\nnext line",
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		file      string
+		encrypted bool
+		sizes     []string // width x height, and the rotation
+	}{
+		{file: "text.pdf", sizes: []string{"612x792", "792x612 rotated 90"}},
+		{file: "object_streams.pdf", sizes: []string{"612x792", "792x612 rotated 90"}},
+		{file: "broken_xref.pdf", sizes: []string{"612x792", "792x612 rotated 90"}},
+		{file: "encrypted_rc4.pdf", encrypted: true, sizes: []string{"612x792", "792x612 rotated 90"}},
+		{file: "encrypted_aes256.pdf", encrypted: true, sizes: []string{"612x792", "792x612 rotated 90"}},
+		{file: "mixed.pdf", sizes: []string{"595x842", "595x842", "595x842"}},
+		{file: "scan.pdf", sizes: []string{"612x792", "612x792", "792x612 rotated 90", "612x792", "612x792", "612x792"}},
+	}
+	for _, tt := range tests {
+		d := openFixture(t, tt.file)
+		if d.Version != "1.7" || d.Encrypted != tt.encrypted {
+			t.Errorf("%s: version %q, encrypted %v", tt.file, d.Version, d.Encrypted)
+		}
+		var sizes []string
+		for i, p := range d.Pages {
+			if p.Number != i+1 {
+				t.Errorf("%s: page %d is numbered %d", tt.file, i+1, p.Number)
+			}
+			size := fmt.Sprintf("%gx%g", p.Width, p.Height)
+			if p.Rotate != 0 {
+				size += fmt.Sprintf(" rotated %d", p.Rotate)
+			}
+			sizes = append(sizes, size)
+		}
+		if strings.Join(sizes, ", ") != strings.Join(tt.sizes, ", ") {
+			t.Errorf("%s: pages %q, want %q", tt.file, sizes, tt.sizes)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"empty":       nil,
+		"text":        []byte("hello, world"),
+		"PNG":         []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"),
+		"late header": append(bytes.Repeat([]byte(" "), 2000), "%PDF-1.4"...),
+	} {
+		if d, err := Parse(data); !errors.Is(err, ErrNotPDF) || d != nil {
+			t.Errorf("%s: Parse = %v, %v, want ErrNotPDF", name, d, err)
+		}
+	}
+	if _, err := Parse([]byte("%PDF-1.4\nnothing else")); err == nil || errors.Is(err, ErrNotPDF) {
+		t.Errorf("header only: err = %v, want a syntax error", err)
+	}
+	if _, err := Open(filepath.Join("testdata", "missing.pdf")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: err = %v", err)
+	}
+
+	// A file that needs a password still tells its pages, without their text
+	d, err := Open(filepath.Join("testdata", "password.pdf"))
+	if !errors.Is(err, ErrEncrypted) {
+		t.Fatalf("password.pdf: err = %v, want ErrEncrypted", err)
+	}
+	if d == nil || !d.Encrypted || len(d.Pages) != 2 {
+		t.Fatalf("password.pdf: document %+v", d)
+	}
+	if text, _ := d.Pages[0].Text(); text != "" {
+		t.Errorf("password.pdf: page 1 text %q without the password", text)
+	}
+}
+
+func TestPageText(t *testing.T) {
+	for _, file := range []string{"text.pdf", "object_streams.pdf", "broken_xref.pdf", "encrypted_rc4.pdf", "encrypted_aes256.pdf"} {
+		d := openFixture(t, file)
+		for i, p := range d.Pages {
+			text, err := p.Text()
+			if err != nil || text != textPages[i] {
+				t.Errorf("%s: page %d text %q, %v, want %q", file, i+1, text, err, textPages[i])
+			}
+		}
+	}
+
+	d := openFixture(t, "mixed.pdf")
+	text, err := d.Pages[0].Text()
+	lines := strings.Split(text, "\n")
+	if err != nil || len(lines) != 55 || lines[0] != "Line 1 of a page of text." || lines[54] != "Line 55 of a page of text." {
+		t.Errorf("mixed.pdf: page 1 has %d lines (%v), first %q", len(lines), err, lines[0])
+	}
+	for _, p := range d.Pages[1:] {
+		if text, err := p.Text(); text != "" || err != nil {
+			t.Errorf("mixed.pdf: page %d text %q, %v, want none", p.Number, text, err)
+		}
+	}
+}
+
+func TestImageOnly(t *testing.T) {
+	for file, want := range map[string]string{
+		"text.pdf":  "false false",
+		"mixed.pdf": "false true false",
+		"scan.pdf":  "true true true true true false",
+	} {
+		d := openFixture(t, file)
+		var got []string
+		for _, p := range d.Pages {
+			only, err := p.ImageOnly()
+			if err != nil {
+				t.Errorf("%s: page %d: %v", file, p.Number, err)
+			}
+			got = append(got, fmt.Sprint(only))
+		}
+		if strings.Join(got, " ") != want {
+			t.Errorf("%s: image only %s, want %s", file, strings.Join(got, " "), want)
+		}
+	}
+}
+
+func TestScanImage(t *testing.T) {
+	// Each scan has a dark marker in the top left corner of the image, which
+	// ends up where the page shows it
+	tests := []struct {
+		size   image.Point
+		marker string // corner the marker is shown in
+	}{
+		{image.Pt(200, 100), "top left"},
+		{image.Pt(200, 100), "top right"}, // drawn mirrored
+		{image.Pt(100, 200), "top right"}, // page shown turned 90° clockwise
+		{image.Pt(32, 64), "top right"},   // JPEG drawn turned
+		{image.Pt(16, 2), "top left"},     // indexed colors
+	}
+	d := openFixture(t, "scan.pdf")
+	for i, tt := range tests {
+		img, err := d.Pages[i].ScanImage()
+		if err != nil {
+			t.Errorf("page %d: %v", i+1, err)
+			continue
+		}
+		b := img.Bounds()
+		if b.Size() != tt.size {
+			t.Errorf("page %d: image %v, want %v", i+1, b.Size(), tt.size)
+		}
+		corners := map[string]image.Point{
+			"top left":     b.Min,
+			"top right":    image.Pt(b.Max.X-1, b.Min.Y),
+			"bottom left":  image.Pt(b.Min.X, b.Max.Y-1),
+			"bottom right": image.Pt(b.Max.X-1, b.Max.Y-1),
+		}
+		for corner, at := range corners {
+			r, g, b, _ := img.At(at.X, at.Y).RGBA()
+			if marked := r < 0xE000 || g < 0xE000 || b < 0xE000; marked != (corner == tt.marker) {
+				t.Errorf("page %d: %s corner marked %v, want the marker %s", i+1, corner, marked, tt.marker)
+			}
+		}
+	}
+
+	if _, err := d.Pages[5].ScanImage(); !errors.Is(err, ErrNoScan) {
+		t.Errorf("page 6 with a small image: err = %v, want ErrNoScan", err)
+	}
+	if _, err := openFixture(t, "text.pdf").Pages[0].ScanImage(); !errors.Is(err, ErrNoScan) {
+		t.Errorf("text page: err = %v, want ErrNoScan", err)
+	}
+	if img, err := openFixture(t, "mixed.pdf").Pages[1].ScanImage(); err != nil || img.Bounds().Size() != image.Pt(100, 100) {
+		t.Errorf("mixed.pdf page 2: %v", err)
+	}
+}
+
+// FuzzParse checks that no input makes Parse, or reading the text of the
+// pages it finds, panic or hang
+func FuzzParse(f *testing.F) {
+	names, err := filepath.Glob(filepath.Join("testdata", "*.pdf"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+		f.Add(data[:len(data)/2])
+	}
+	f.Add([]byte("%PDF-1.4\n1 0 obj << /Type /Catalog /Pages 1 0 R >> endobj trailer << /Root 1 0 R >>"))
+	objStm, err := os.ReadFile(filepath.Join("testdata", "object_streams.pdf"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	// A negative field width, and a damaged file with an object stream
+	// claiming far more objects than it holds
+	f.Add(bytes.Replace(objStm, []byte("/W [1 4 2]"), []byte("/W [-1 4 2]"), 1))
+	damaged := bytes.Replace(objStm, []byte("startxref\n"), []byte("startxref\n9"), 1)
+	f.Add(regexp.MustCompile(`/N \d+`).ReplaceAll(damaged, []byte("/N 999999999999")))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		d, err := Parse(data)
+		if d == nil {
+			if err == nil {
+				t.Fatal("no document and no error")
+			}
+			return
+		}
+		for _, p := range d.Pages {
+			p.Text()
+			p.ImageOnly()
+		}
+	})
+}
@@ -0,0 +1,705 @@
+package pdf
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// maxFormDepth bounds the nesting of form XObjects
+const maxFormDepth = 16
+
+// minScanCoverage is the share of a page an image must cover for the page to
+// be taken for a scan
+const minScanCoverage = 0.5
+
+// matrix is an affine transformation [a b c d e f], mapping (x, y) to
+// (a*x + c*y + e, b*x + d*y + f)
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// mul returns the transformation m followed by n
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2], m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2], m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4], m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func (m matrix) apply(x, y float64) (float64, float64) {
+	return x*m[0] + y*m[2] + m[4], x*m[1] + y*m[3] + m[5]
+}
+
+// matrixOf reads a matrix from six numbers, or returns the identity
+func matrixOf(d *Document, o object) matrix {
+	arr, ok := d.resolveQuiet(o).(array)
+	if !ok || len(arr) < 6 {
+		return identity
+	}
+	var m matrix
+	for i := range m {
+		m[i] = numberValue(d.resolveQuiet(arr[i]))
+	}
+	return m
+}
+
+// pageContent is what a page draws: its text runs and images, in the
+// coordinates of the page as shown (origin at the bottom left, y up)
+type pageContent struct {
+	runs   []textRun
+	images []placedImage
+	err    error // the first error reading the content, which may be partial
+}
+
+// textRun is the text shown by one text operator
+type textRun struct {
+	x, y, endX float64
+	size       float64
+	text       string
+}
+
+// placedImage is an image drawn on the page
+type placedImage struct {
+	image *stream
+	ctm   matrix  // maps the unit square to the page as shown
+	area  float64 // area of the page covered, in square points
+}
+
+// Text returns the text layer of the page, in reading order: lines from top
+// to bottom, runs within a line from left to right
+func (p *Page) Text() (string, error) {
+	c := p.interpret()
+	text := c.text()
+	if text == "" && c.err != nil {
+		return "", c.err
+	}
+	return text, nil
+}
+
+// ImageOnly reports whether the page has no text and images cover at least
+// half of it, as for scans without a text layer
+func (p *Page) ImageOnly() (bool, error) {
+	c := p.interpret()
+	if c.err != nil && len(c.runs) == 0 && len(c.images) == 0 {
+		return false, c.err
+	}
+	for _, r := range c.runs {
+		if strings.TrimSpace(r.text) != "" {
+			return false, nil
+		}
+	}
+	var covered float64
+	for _, img := range c.images {
+		covered += img.area
+	}
+	return covered >= minScanCoverage*p.Width*p.Height, nil
+}
+
+// display maps the default user space of the page to the page as shown,
+// with the crop box origin at (0, 0) and the page rotation applied
+func (p *Page) display() matrix {
+	w, h := p.box[2]-p.box[0], p.box[3]-p.box[1]
+	m := matrix{1, 0, 0, 1, -p.box[0], -p.box[1]}
+	switch p.Rotate {
+	case 90:
+		return m.mul(matrix{0, -1, 1, 0, 0, w})
+	case 180:
+		return m.mul(matrix{-1, 0, 0, -1, w, h})
+	case 270:
+		return m.mul(matrix{0, 1, -1, 0, h, 0})
+	}
+	return m
+}
+
+// interpret runs the content stream of the page once, collecting its text
+// and images
+func (p *Page) interpret() *pageContent {
+	if p.content != nil {
+		return p.content
+	}
+	d := p.doc
+	in := &interpreter{doc: d, page: p, display: p.display(), content: &pageContent{}, forms: map[ref]bool{}}
+	var data [][]byte
+	contents := d.resolveQuiet(p.dict["Contents"])
+	if s, ok := contents.(*stream); ok {
+		contents = array{s}
+	}
+	if arr, ok := contents.(array); ok {
+		for _, o := range arr {
+			s, ok := d.resolveQuiet(o).(*stream)
+			if !ok {
+				continue
+			}
+			b, err := d.decodeStream(s)
+			if err != nil {
+				in.fail(err)
+				continue
+			}
+			data = append(data, b)
+		}
+	}
+	// Content streams may split an operator across streams
+	in.execute(bytes.Join(data, []byte("\n")), p.resources, gstate{ctm: identity, scale: 1}, 0)
+	p.content = in.content
+	return p.content
+}
+
+// gstate is the part of the graphics state that text and images depend on
+type gstate struct {
+	ctm                                              matrix
+	font                                             *font
+	size, charSpace, wordSpace, scale, leading, rise float64
+}
+
+// interpreter runs content streams
+type interpreter struct {
+	doc     *Document
+	page    *Page
+	display matrix
+	content *pageContent
+	forms   map[ref]bool // forms being drawn, against cycles
+	tm, tlm matrix       // text matrix and text line matrix
+}
+
+func (in *interpreter) fail(err error) {
+	if in.content.err == nil {
+		in.content.err = err
+	}
+}
+
+// execute runs a content stream with its resources
+func (in *interpreter) execute(data []byte, resources dict, gs gstate, depth int) {
+	d := in.doc
+	l := &lexer{data: data}
+	var operands []object
+	var saved []gstate
+	num := func(i int) float64 {
+		if i < len(operands) {
+			return numberValue(operands[i])
+		}
+		return 0
+	}
+	for l.pos < len(data) {
+		o, err := l.object()
+		if err != nil {
+			operands = operands[:0]
+			continue
+		}
+		op, ok := o.(keyword)
+		if !ok {
+			operands = append(operands, o)
+			continue
+		}
+		switch op {
+		case "q":
+			saved = append(saved, gs)
+		case "Q":
+			if len(saved) > 0 {
+				gs = saved[len(saved)-1]
+				saved = saved[:len(saved)-1]
+			}
+		case "cm":
+			if len(operands) >= 6 {
+				gs.ctm = matrix{num(0), num(1), num(2), num(3), num(4), num(5)}.mul(gs.ctm)
+			}
+		case "BT":
+			in.tm, in.tlm = identity, identity
+		case "Tf":
+			if len(operands) >= 2 {
+				fonts, _ := d.resolveQuiet(resources["Font"]).(dict)
+				fontName, _ := operands[0].(name)
+				gs.font = d.font(fonts[fontName])
+				gs.size = num(1)
+			}
+		case "Tc":
+			gs.charSpace = num(0)
+		case "Tw":
+			gs.wordSpace = num(0)
+		case "Tz":
+			gs.scale = num(0) / 100
+		case "TL":
+			gs.leading = num(0)
+		case "Ts":
+			gs.rise = num(0)
+		case "Td":
+			in.nextLine(num(0), num(1))
+		case "TD":
+			gs.leading = -num(1)
+			in.nextLine(num(0), num(1))
+		case "Tm":
+			if len(operands) >= 6 {
+				in.tm = matrix{num(0), num(1), num(2), num(3), num(4), num(5)}
+				in.tlm = in.tm
+			}
+		case "T*":
+			in.nextLine(0, -gs.leading)
+		case "Tj":
+			if len(operands) >= 1 {
+				in.show(&gs, array{operands[0]})
+			}
+		case "'":
+			in.nextLine(0, -gs.leading)
+			if len(operands) >= 1 {
+				in.show(&gs, array{operands[0]})
+			}
+		case "\"":
+			if len(operands) >= 3 {
+				gs.wordSpace, gs.charSpace = num(0), num(1)
+				in.nextLine(0, -gs.leading)
+				in.show(&gs, array{operands[2]})
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				if items, ok := operands[0].(array); ok {
+					in.show(&gs, items)
+				}
+			}
+		case "Do":
+			if len(operands) >= 1 {
+				xobjects, _ := d.resolveQuiet(resources["XObject"]).(dict)
+				xname, _ := operands[0].(name)
+				in.xobject(xobjects[xname], resources, gs, depth)
+			}
+		case "BI":
+			in.inlineImage(l, gs)
+		}
+		operands = operands[:0]
+	}
+}
+
+func (in *interpreter) nextLine(tx, ty float64) {
+	in.tlm = matrix{1, 0, 0, 1, tx, ty}.mul(in.tlm)
+	in.tm = in.tlm
+}
+
+// show shows the strings of a Tj or TJ operator, moving the text matrix past
+// each glyph, and records them as one run. Negative adjustments of more than
+// an eighth of the font size between strings stand for spaces.
+func (in *interpreter) show(gs *gstate, items array) {
+	f := gs.font
+	if f == nil {
+		f = defaultFont
+	}
+	start := in.textPoint(gs)
+	var b strings.Builder
+	for _, item := range items {
+		switch v := item.(type) {
+		case pdfString:
+			for _, g := range f.decode([]byte(v)) {
+				b.WriteString(g.text)
+				tx := g.width*gs.size + gs.charSpace
+				if g.space {
+					tx += gs.wordSpace
+				}
+				in.tm = matrix{1, 0, 0, 1, tx * gs.scale, 0}.mul(in.tm)
+			}
+		case int64, float64:
+			adjust := numberValue(v)
+			if adjust < -120 && b.Len() > 0 && !strings.HasSuffix(b.String(), " ") {
+				b.WriteByte(' ')
+			}
+			in.tm = matrix{1, 0, 0, 1, -adjust / 1000 * gs.size * gs.scale, 0}.mul(in.tm)
+		}
+	}
+	if b.Len() == 0 {
+		return
+	}
+	end := in.textPoint(gs)
+	m := in.tm.mul(gs.ctm).mul(in.display)
+	size := math.Abs(gs.size) * math.Hypot(m[2], m[3])
+	if size == 0 {
+		size = 1
+	}
+	in.content.runs = append(in.content.runs, textRun{x: start[0], y: start[1], endX: end[0], size: size, text: b.String()})
+}
+
+// textPoint returns the current text position on the page as shown
+func (in *interpreter) textPoint(gs *gstate) [2]float64 {
+	x, y := matrix{1, 0, 0, 1, 0, gs.rise}.mul(in.tm).mul(gs.ctm).mul(in.display).apply(0, 0)
+	return [2]float64{x, y}
+}
+
+// xobject draws an image or form XObject
+func (in *interpreter) xobject(o object, resources dict, gs gstate, depth int) {
+	d := in.doc
+	s, ok := d.resolveQuiet(o).(*stream)
+	if !ok {
+		return
+	}
+	switch s.dict["Subtype"] {
+	case name("Image"):
+		in.addImage(s, gs.ctm)
+	case name("Form"):
+		if depth >= maxFormDepth || in.forms[s.ref] {
+			return
+		}
+		data, err := d.decodeStream(s)
+		if err != nil {
+			in.fail(err)
+			return
+		}
+		if res, ok := d.resolveQuiet(s.dict["Resources"]).(dict); ok {
+			resources = res
+		}
+		in.forms[s.ref] = true
+		tm, tlm := in.tm, in.tlm
+		gs.ctm = matrixOf(d, s.dict["Matrix"]).mul(gs.ctm)
+		in.execute(data, resources, gs, depth+1)
+		in.tm, in.tlm = tm, tlm
+		delete(in.forms, s.ref)
+	}
+}
+
+// addImage records an image drawn in the unit square of ctm
+func (in *interpreter) addImage(s *stream, ctm matrix) {
+	m := ctm.mul(in.display)
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, corner := range [][2]float64{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+		x, y := m.apply(corner[0], corner[1])
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+	}
+	w := math.Min(maxX, in.page.Width) - math.Max(minX, 0)
+	h := math.Min(maxY, in.page.Height) - math.Max(minY, 0)
+	if w <= 0 || h <= 0 {
+		return
+	}
+	in.content.images = append(in.content.images, placedImage{image: s, ctm: m, area: w * h})
+}
+
+// inlineImageKeys expands the abbreviated keys of inline images
+var inlineImageKeys = map[name]name{
+	"W": "Width", "H": "Height", "BPC": "BitsPerComponent", "CS": "ColorSpace", "F": "Filter",
+	"DP": "DecodeParms", "IM": "ImageMask", "D": "Decode", "I": "Interpolate", "L": "Length",
+}
+
+// inlineImage reads a "BI ... ID data EI" inline image, the lexer being past BI
+func (in *interpreter) inlineImage(l *lexer, gs gstate) {
+	s := &stream{dict: dict{}}
+	var key name
+	for {
+		o, err := l.object()
+		if err != nil {
+			return
+		}
+		if o == keyword("ID") {
+			break
+		}
+		if k, ok := o.(name); ok && key == "" {
+			key = k
+			if full, ok := inlineImageKeys[k]; ok {
+				key = full
+			}
+			continue
+		}
+		if key != "" {
+			s.dict[key] = o
+			key = ""
+		}
+	}
+	// One white-space character separates ID from the data, which runs to an EI
+	// standing on its own
+	start := l.pos + 1
+	for i := start; i+2 <= len(l.data); i++ {
+		j := bytes.Index(l.data[i:], []byte("EI"))
+		if j < 0 {
+			break
+		}
+		i += j
+		if isSpace(l.data[i-1]) && (i+2 == len(l.data) || isSpace(l.data[i+2]) || isDelimiter(l.data[i+2])) {
+			s.data = l.data[start : i-1]
+			l.pos = i + 2
+			in.addImage(s, gs.ctm)
+			return
+		}
+	}
+	l.pos = len(l.data)
+}
+
+// text assembles the runs of a page into lines: runs whose baselines are
+// within half their size of each other form a line, ordered left to right,
+// with spaces for the gaps between them
+func (c *pageContent) text() string {
+	runs := make([]textRun, 0, len(c.runs))
+	for _, r := range c.runs {
+		if r.text != "" {
+			runs = append(runs, r)
+		}
+	}
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].y > runs[j].y })
+
+	var lines [][]textRun
+	var lineY, lineSize float64
+	for _, r := range runs {
+		if len(lines) > 0 && math.Abs(r.y-lineY) <= 0.5*math.Max(r.size, lineSize) {
+			lines[len(lines)-1] = append(lines[len(lines)-1], r)
+			continue
+		}
+		lines = append(lines, []textRun{r})
+		lineY, lineSize = r.y, r.size
+	}
+
+	var b strings.Builder
+	var prevY, prevSize float64
+	for i, line := range lines {
+		sort.SliceStable(line, func(i, j int) bool { return line[i].x < line[j].x })
+		if i > 0 {
+			b.WriteByte('\n')
+			if prevY-line[0].y > 2*math.Max(prevSize, line[0].size) {
+				b.WriteByte('\n') // a paragraph break
+			}
+		}
+		for j, r := range line {
+			if j > 0 {
+				prev := line[j-1]
+				gap := r.x - prev.endX
+				if gap > 0.15*r.size && !endsWithSpace(prev.text) && !startsWithSpace(r.text) {
+					// Wide gaps, as between table columns, keep some of their width
+					b.WriteString(strings.Repeat(" ", max(1, min(int(gap/(0.5*r.size)), 40))))
+				}
+			}
+			b.WriteString(r.text)
+		}
+		prevY, prevSize = line[0].y, line[0].size
+	}
+	return b.String()
+}
+
+func endsWithSpace(s string) bool {
+	return s != "" && unicode.IsSpace(rune(s[len(s)-1]))
+}
+
+func startsWithSpace(s string) bool {
+	return s != "" && unicode.IsSpace(rune(s[0]))
+}
+
+// glyph is a decoded character code: its text and its advance width in text
+// space units (thousandths of the font size)
+type glyph struct {
+	text  string
+	width float64
+	space bool // a single-byte code 32, to which word spacing applies
+}
+
+// font decodes the character codes of strings shown with a font
+type font struct {
+	type0        bool
+	encoding     *cmap // CMap of a Type0 font, nil for Identity encodings
+	unicodeCodes bool  // a predefined CMap whose codes are UCS-2
+	toUnicode    *cmap
+	simple       [256]string
+	widths       map[int]float64 // by code for simple fonts, by CID for Type0 fonts
+	defaultWidth float64
+}
+
+// defaultFont decodes text shown before any font is selected
+var defaultFont = &font{simple: simpleTexts(winAnsiEncoding), widths: map[int]float64{}, defaultWidth: 0.5}
+
+// font loads the font of a font dictionary, caching fonts by reference
+func (d *Document) font(o object) *font {
+	r, isRef := o.(ref)
+	if isRef {
+		if f, ok := d.fonts[r]; ok {
+			return f
+		}
+	}
+	fd, ok := d.resolveQuiet(o).(dict)
+	if !ok {
+		return defaultFont
+	}
+	f := d.loadFont(fd)
+	if isRef {
+		d.fonts[r] = f
+	}
+	return f
+}
+
+func (d *Document) loadFont(fd dict) *font {
+	f := &font{widths: map[int]float64{}, defaultWidth: 0.5}
+	if s, ok := d.resolveQuiet(fd["ToUnicode"]).(*stream); ok {
+		if data, err := d.decodeStream(s); err == nil {
+			f.toUnicode = parseCMap(data)
+		}
+	}
+	subtype, _ := d.resolveQuiet(fd["Subtype"]).(name)
+
+	if subtype == "Type0" {
+		f.type0 = true
+		switch enc := d.resolveQuiet(fd["Encoding"]).(type) {
+		case name:
+			f.unicodeCodes = strings.Contains(string(enc), "UCS2") || strings.Contains(string(enc), "UTF16")
+		case *stream:
+			if data, err := d.decodeStream(enc); err == nil {
+				f.encoding = parseCMap(data)
+			}
+		}
+		f.defaultWidth = 1
+		descendants, _ := d.resolveQuiet(fd["DescendantFonts"]).(array)
+		if len(descendants) == 0 {
+			return f
+		}
+		cidFont, _ := d.resolveQuiet(descendants[0]).(dict)
+		if dw, ok := d.resolveQuiet(cidFont["DW"]).(int64); ok {
+			f.defaultWidth = float64(dw) / 1000
+		}
+		w, _ := d.resolveQuiet(cidFont["W"]).(array)
+		for i := 0; i+1 < len(w); {
+			first := intValue(d.resolveQuiet(w[i]))
+			if list, ok := d.resolveQuiet(w[i+1]).(array); ok {
+				for j, width := range list {
+					f.widths[first+j] = numberValue(d.resolveQuiet(width)) / 1000
+				}
+				i += 2
+				continue
+			}
+			if i+2 >= len(w) {
+				break
+			}
+			last := intValue(d.resolveQuiet(w[i+1]))
+			width := numberValue(d.resolveQuiet(w[i+2])) / 1000
+			for cid := first; cid <= last && cid-first < maxCMapRange; cid++ {
+				f.widths[cid] = width
+			}
+			i += 3
+		}
+		return f
+	}
+
+	scale := 0.001
+	if subtype == "Type3" {
+		if fm, ok := d.resolveQuiet(fd["FontMatrix"]).(array); ok && len(fm) > 0 {
+			scale = numberValue(d.resolveQuiet(fm[0]))
+		}
+	}
+	first := intValue(d.resolveQuiet(fd["FirstChar"]))
+	widths, _ := d.resolveQuiet(fd["Widths"]).(array)
+	for i, w := range widths {
+		f.widths[first+i] = numberValue(d.resolveQuiet(w)) * scale
+	}
+	if desc, ok := d.resolveQuiet(fd["FontDescriptor"]).(dict); ok {
+		if missing := numberValue(d.resolveQuiet(desc["MissingWidth"])); missing > 0 {
+			f.defaultWidth = missing * scale
+		}
+	}
+	f.simple = simpleTexts(d.simpleEncoding(fd, subtype))
+	return f
+}
+
+// simpleEncoding returns the encoding of a simple font: its base encoding
+// with the differences applied
+func (d *Document) simpleEncoding(fd dict, subtype name) [256]rune {
+	enc := standardEncoding
+	if subtype == "TrueType" {
+		enc = winAnsiEncoding
+	}
+	base := func(n name) {
+		switch n {
+		case "WinAnsiEncoding":
+			enc = winAnsiEncoding
+		case "MacRomanEncoding":
+			enc = macRomanEncoding
+		case "StandardEncoding":
+			enc = standardEncoding
+		}
+	}
+	switch e := d.resolveQuiet(fd["Encoding"]).(type) {
+	case name:
+		base(e)
+	case dict:
+		if n, ok := d.resolveQuiet(e["BaseEncoding"]).(name); ok {
+			base(n)
+		}
+		differences, _ := d.resolveQuiet(e["Differences"]).(array)
+		code := 0
+		for _, o := range differences {
+			switch v := d.resolveQuiet(o).(type) {
+			case int64:
+				code = int(v)
+			case name:
+				if code >= 0 && code < 256 {
+					if text := []rune(glyphText(string(v))); len(text) == 1 {
+						enc[code] = text[0]
+					} else {
+						enc[code] = 0
+					}
+				}
+				code++
+			}
+		}
+	}
+	return enc
+}
+
+// simpleTexts turns an encoding into the text of each code. Codes the
+// encoding leaves undefined are read as Latin-1, except control codes.
+func simpleTexts(enc [256]rune) [256]string {
+	var texts [256]string
+	for code, r := range enc {
+		switch {
+		case r != 0:
+			texts[code] = string(r)
+		case code >= 0x20 && code != 0x7F && (code < 0x80 || code >= 0xA0):
+			texts[code] = string(rune(code))
+		}
+	}
+	return texts
+}
+
+// decode splits a string into character codes and decodes them
+func (f *font) decode(s []byte) []glyph {
+	var glyphs []glyph
+	if !f.type0 {
+		for _, c := range s {
+			text := f.simple[c]
+			if f.toUnicode != nil {
+				if t, ok := f.toUnicode.text[uint32(c)]; ok {
+					text = t
+				}
+			}
+			glyphs = append(glyphs, glyph{text: text, width: f.width(int(c)), space: c == ' '})
+		}
+		return glyphs
+	}
+	for len(s) > 0 {
+		n := 2
+		if f.encoding != nil {
+			if l := f.encoding.codeLength(s); l > 0 {
+				n = l
+			}
+		}
+		n = min(n, len(s))
+		var code uint32
+		for _, c := range s[:n] {
+			code = code<<8 | uint32(c)
+		}
+		s = s[n:]
+		cid := int(code)
+		if f.encoding != nil {
+			cid = f.encoding.cid(code)
+		}
+		text, ok := "", false
+		if f.toUnicode != nil {
+			text, ok = f.toUnicode.text[code]
+		}
+		if !ok {
+			text = string(unicode.ReplacementChar)
+			if f.unicodeCodes {
+				text = string(rune(code))
+			}
+		}
+		glyphs = append(glyphs, glyph{text: text, width: f.width(cid), space: n == 1 && code == ' '})
+	}
+	return glyphs
+}
+
+func (f *font) width(code int) float64 {
+	if w, ok := f.widths[code]; ok {
+		return w
+	}
+	return f.defaultWidth
+}
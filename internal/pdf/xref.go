@@ -0,0 +1,353 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// xrefEntry locates an object: at an offset in the file, or as the index-th
+// object of an object stream
+type xrefEntry struct {
+	offset    int
+	inStream  bool
+	streamNum int
+	index     int
+}
+
+// readXref reads the cross-reference sections from the last one back through
+// /Prev, returning the merged entries and the newest trailer. Entries of newer
+// sections win.
+func (d *Document) readXref() (dict, error) {
+	tail := d.data[max(0, len(d.data)-2048):]
+	i := bytes.LastIndex(tail, []byte("startxref"))
+	if i < 0 {
+		return nil, fmt.Errorf("%w: no startxref", errSyntax)
+	}
+	l := &lexer{data: tail, pos: i + len("startxref")}
+	o, err := l.object()
+	if err != nil {
+		return nil, err
+	}
+	offset, ok := o.(int64)
+	if !ok {
+		return nil, fmt.Errorf("%w: bad startxref", errSyntax)
+	}
+
+	var trailer dict
+	seen := map[int]bool{}
+	for next := int(offset); ; {
+		if seen[next] || next < 0 || next >= len(d.data) {
+			break
+		}
+		seen[next] = true
+		section, err := d.readXrefSection(next)
+		if err != nil {
+			return nil, err
+		}
+		if trailer == nil {
+			trailer = section
+		}
+		// Hybrid files keep the entries of compressed objects in a separate stream
+		if stm, ok := section["XRefStm"].(int64); ok && !seen[int(stm)] {
+			seen[int(stm)] = true
+			if _, err := d.readXrefSection(int(stm)); err != nil {
+				return nil, err
+			}
+		}
+		prev, ok := section["Prev"].(int64)
+		if !ok {
+			break
+		}
+		next = int(prev)
+	}
+	if trailer == nil {
+		return nil, fmt.Errorf("%w: no trailer", errSyntax)
+	}
+	return trailer, nil
+}
+
+// readXrefSection reads the xref table or stream at offset and returns its trailer
+func (d *Document) readXrefSection(offset int) (dict, error) {
+	l := &lexer{data: d.data, pos: offset}
+	l.skipSpace()
+	if bytes.HasPrefix(d.data[l.pos:], []byte("xref")) {
+		l.pos += len("xref")
+		return d.readXrefTable(l)
+	}
+	// An xref stream: "num gen obj << /Type /XRef ... >> stream"
+	obj, err := d.parseIndirect(l.pos)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := obj.(*stream)
+	if !ok || s.dict["Type"] != name("XRef") {
+		return nil, fmt.Errorf("%w: no xref at offset %d", errSyntax, offset)
+	}
+	return s.dict, d.readXrefStream(s)
+}
+
+// readXrefTable reads the subsections of a classic xref table up to its trailer
+func (d *Document) readXrefTable(l *lexer) (dict, error) {
+	for {
+		l.skipSpace()
+		if bytes.HasPrefix(d.data[l.pos:], []byte("trailer")) {
+			l.pos += len("trailer")
+			o, err := l.object()
+			if err != nil {
+				return nil, err
+			}
+			trailer, ok := o.(dict)
+			if !ok {
+				return nil, fmt.Errorf("%w: bad trailer", errSyntax)
+			}
+			return trailer, nil
+		}
+		start, err1 := strconv.Atoi(l.regular())
+		l.skipSpace()
+		count, err2 := strconv.Atoi(l.regular())
+		if err1 != nil || err2 != nil || count < 0 {
+			return nil, fmt.Errorf("%w: bad xref subsection", errSyntax)
+		}
+		for i := 0; i < count; i++ {
+			l.skipSpace()
+			offset, err1 := strconv.Atoi(l.regular())
+			l.skipSpace()
+			_, err2 := strconv.Atoi(l.regular())
+			l.skipSpace()
+			kind := l.regular()
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("%w: bad xref entry", errSyntax)
+			}
+			num := start + i
+			if _, ok := d.xref[num]; ok {
+				continue
+			}
+			if kind == "n" {
+				d.xref[num] = xrefEntry{offset: offset}
+			} else {
+				d.xref[num] = xrefEntry{offset: -1} // free
+			}
+		}
+	}
+}
+
+// readXrefStream reads the binary entries of an xref stream (PDF 1.5)
+func (d *Document) readXrefStream(s *stream) error {
+	data, err := d.decodeStream(s)
+	if err != nil {
+		return err
+	}
+	w, _ := s.dict["W"].(array)
+	if len(w) < 3 {
+		return fmt.Errorf("%w: bad xref stream /W", errSyntax)
+	}
+	var widths [3]int
+	for i := range widths {
+		n, _ := w[i].(int64)
+		if n < 0 || n > 8 {
+			return fmt.Errorf("%w: bad xref stream /W", errSyntax)
+		}
+		widths[i] = int(n)
+	}
+	size, _ := s.dict["Size"].(int64)
+	index, _ := s.dict["Index"].(array)
+	if len(index) == 0 {
+		index = array{int64(0), size}
+	}
+	field := func(b []byte) int {
+		v := 0
+		for _, c := range b {
+			v = v<<8 | int(c)
+		}
+		return v
+	}
+	entrySize := widths[0] + widths[1] + widths[2]
+	if entrySize == 0 {
+		return fmt.Errorf("%w: bad xref stream /W", errSyntax)
+	}
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		start, _ := index[i].(int64)
+		count, _ := index[i+1].(int64)
+		for n := 0; n < int(count) && pos+entrySize <= len(data); n++ {
+			entry := data[pos : pos+entrySize]
+			pos += entrySize
+			kind := 1 // the type defaults to 1 when its field is absent
+			if widths[0] > 0 {
+				kind = field(entry[:widths[0]])
+			}
+			f2 := field(entry[widths[0] : widths[0]+widths[1]])
+			f3 := field(entry[widths[0]+widths[1]:])
+			num := int(start) + n
+			if _, ok := d.xref[num]; ok {
+				continue
+			}
+			switch kind {
+			case 0:
+				d.xref[num] = xrefEntry{offset: -1}
+			case 1:
+				d.xref[num] = xrefEntry{offset: f2}
+			case 2:
+				d.xref[num] = xrefEntry{inStream: true, streamNum: f2, index: f3}
+			}
+		}
+	}
+	return nil
+}
+
+// objectHeader matches the start of an indirect object
+var objectHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// reconstructXref rebuilds the cross-reference table of a damaged file by
+// scanning it for objects, and finds the trailer or at least the catalog
+func (d *Document) reconstructXref() (dict, error) {
+	d.xref = map[int]xrefEntry{}
+	d.cache = map[int]object{}
+	d.objStms = map[int]*objStm{}
+	for _, m := range objectHeader.FindAllSubmatchIndex(d.data, -1) {
+		if m[0] > 0 && !isSpace(d.data[m[0]-1]) && !isDelimiter(d.data[m[0]-1]) {
+			continue
+		}
+		num, _ := strconv.Atoi(string(d.data[m[2]:m[3]]))
+		d.xref[num] = xrefEntry{offset: m[0]} // later copies win, as in incremental updates
+	}
+	if len(d.xref) == 0 {
+		return nil, fmt.Errorf("%w: no objects", errSyntax)
+	}
+
+	// Objects inside object streams
+	for num, entry := range d.xref {
+		obj, err := d.parseIndirect(entry.offset)
+		if err != nil {
+			continue
+		}
+		if s, ok := obj.(*stream); ok && s.dict["Type"] == name("ObjStm") {
+			objs, err := d.objectStream(num)
+			if err != nil {
+				continue
+			}
+			for i, objNum := range objs.nums {
+				if _, exists := d.xref[objNum]; !exists {
+					d.xref[objNum] = xrefEntry{inStream: true, streamNum: num, index: i}
+				}
+			}
+		}
+	}
+
+	if i := bytes.LastIndex(d.data, []byte("trailer")); i >= 0 {
+		l := &lexer{data: d.data, pos: i + len("trailer")}
+		if o, err := l.object(); err == nil {
+			if trailer, ok := o.(dict); ok && trailer["Root"] != nil {
+				return trailer, nil
+			}
+		}
+	}
+	// An xref stream has the trailer entries, such as /Encrypt; a catalog alone will do
+	var catalog dict
+	for num := range d.xref {
+		o, err := d.resolve(ref{num: num})
+		if err != nil {
+			continue
+		}
+		if obj, ok := o.(dict); ok && obj["Type"] == name("Catalog") {
+			catalog = dict{"Root": ref{num: num}}
+		}
+		if s, ok := o.(*stream); ok && s.dict["Type"] == name("XRef") && s.dict["Root"] != nil {
+			return s.dict, nil
+		}
+	}
+	if catalog == nil {
+		return nil, fmt.Errorf("%w: no document catalog", errSyntax)
+	}
+	return catalog, nil
+}
+
+// parseIndirect parses the "num gen obj ... endobj" object at offset
+func (d *Document) parseIndirect(offset int) (object, error) {
+	if offset < 0 || offset >= len(d.data) {
+		return nil, fmt.Errorf("%w: object offset %d out of range", errSyntax, offset)
+	}
+	l := &lexer{data: d.data, pos: offset, length: d.streamLength}
+	num, err1 := l.object()
+	gen, err2 := l.object()
+	kw, err3 := l.object()
+	n, ok1 := num.(int64)
+	g, ok2 := gen.(int64)
+	if err1 != nil || err2 != nil || err3 != nil || !ok1 || !ok2 || kw != keyword("obj") {
+		return nil, fmt.Errorf("%w: no object at offset %d", errSyntax, offset)
+	}
+	obj, err := l.object()
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := obj.(*stream); ok {
+		s.ref = ref{num: int(n), gen: int(g)}
+	}
+	return obj, nil
+}
+
+// streamLength resolves a stream's /Length, which may be an indirect object
+func (d *Document) streamLength(o object) (int, bool) {
+	if r, ok := o.(ref); ok {
+		if d.resolving[r.num] {
+			return 0, false
+		}
+		resolved, err := d.resolve(r)
+		if err != nil {
+			return 0, false
+		}
+		o = resolved
+	}
+	n, ok := o.(int64)
+	return int(n), ok
+}
+
+// objStm is a decoded object stream: the numbers and offsets of its objects
+type objStm struct {
+	data    []byte
+	first   int
+	nums    []int
+	offsets []int
+}
+
+// objectStream decodes an object stream and its index, caching the result
+func (d *Document) objectStream(num int) (*objStm, error) {
+	if objs, ok := d.objStms[num]; ok {
+		return objs, nil
+	}
+	entry, ok := d.xref[num]
+	if !ok || entry.inStream {
+		return nil, fmt.Errorf("%w: object stream %d not found", errSyntax, num)
+	}
+	obj, err := d.parseIndirect(entry.offset)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := obj.(*stream)
+	if !ok {
+		return nil, fmt.Errorf("%w: object %d is not a stream", errSyntax, num)
+	}
+	data, err := d.decodeStream(s)
+	if err != nil {
+		return nil, err
+	}
+	n, _ := s.dict["N"].(int64)
+	first, _ := s.dict["First"].(int64)
+	objs := &objStm{data: data, first: int(first)}
+	l := &lexer{data: data}
+	for i := 0; i < int(n); i++ {
+		o1, err1 := l.object()
+		o2, err2 := l.object()
+		objNum, ok1 := o1.(int64)
+		offset, ok2 := o2.(int64)
+		if err1 != nil || err2 != nil || !ok1 || !ok2 {
+			break
+		}
+		objs.nums = append(objs.nums, int(objNum))
+		objs.offsets = append(objs.offsets, int(offset))
+	}
+	d.objStms[num] = objs
+	return objs, nil
+}
@@ -5,6 +5,7 @@ import (
 )
 
 type FileResult struct {
+	InputIndex    int // Position of the file in the batch input
 	SourceURL     string
 	LocalPath     string
 	FileName      string
@@ -15,6 +16,70 @@ type FileResult struct {
 	ProcessingTime time.Duration
 	FileSize      int64
 	DocumentSource string // The type of document (business_license, evn_bill, etc.)
+	GuessedSource    string  // Document type guessed by classification, if the input had none
+	SourceConfidence float64 // Confidence of that guess, from 0 to 1
+	Warnings       []string // Non-fatal problems, e.g. extracted values that could not be coerced
+	ParentSourceURL string // SourceURL of the archive this file was extracted from, if any
+	ArchiveMember   string // Path of the file inside that archive
+	PageStart       int    // First page of the document, when a PDF was split into several documents
+	PageEnd         int    // Last page of that document
+	Pages           []PageResult // Per-page text of PDFs
+	Layout          []PageLayout // Text structure found by OCR, for the pages that were OCR'd
+	OCREngine       string       // OCR engine(s) that produced the text
+	OCRScores       map[string]float64 // Text score of each OCR engine for an image, if an ensemble compared several
+	Preprocessed    []string           // What was done to an image before OCR, e.g. "deskew 2.25°"
+}
+
+// PageResult is the text extracted from one page of a PDF
+type PageResult struct {
+	Page       int     // 1-based page number
+	Text       string
+	Method     string  // "text-layer" (embedded text), or the OCR engine: "vision" or "tesseract"
+	Confidence float64 // Confidence reported by the OCR engine, from 0 to 1; 0 for the text layer
+	DPI        int     // Resolution the page was rendered at for OCR
+	Error      string  // Why OCR failed on the page, if it did
+	Scores     map[string]float64 // Text score of each OCR engine, if an ensemble compared several
+	TextLayerIssue string         // Why the page's embedded text wasn't trusted and it was OCR'd, if it was
+}
+
+// PageLayout is the structure OCR found on a page: blocks of paragraphs of
+// words, each with its bounding polygon. Coordinates are in the units of Width
+// and Height, with the origin at the top left: pixels for images and rendered
+// pages, points for PDF pages OCR'd directly.
+type PageLayout struct {
+	Page       int // 1-based page number; 1 for images
+	Width      int
+	Height     int
+	Confidence float64
+	Blocks     []LayoutBlock
+}
+
+// LayoutBlock is a block of text, a table, a picture or a barcode on a page
+type LayoutBlock struct {
+	Type        string // "text", "table", "picture", "ruler", "barcode" or "unknown"
+	BoundingBox []Point
+	Confidence  float64
+	Paragraphs  []LayoutParagraph
+}
+
+// LayoutParagraph is a paragraph of a block, with its text as OCR read it
+type LayoutParagraph struct {
+	Text        string
+	BoundingBox []Point
+	Confidence  float64
+	Words       []LayoutWord
+}
+
+// LayoutWord is a word of a paragraph
+type LayoutWord struct {
+	Text        string
+	BoundingBox []Point
+	Confidence  float64
+}
+
+// Point is a vertex of a bounding polygon
+type Point struct {
+	X, Y float64
 }
 
 // BatchResult represents the result of processing multiple files